@@ -9,6 +9,12 @@ import (
 
 func main() {
 	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := server.Migrate(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err.Error())
+		}
+		return
+	}
 	if err := server.Run(); err != nil {
 		log.Fatal(err.Error())
 	}
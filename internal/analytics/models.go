@@ -43,3 +43,41 @@ type GameRecap struct {
 	EndedAt   *time.Time
 	Players   []PlayerGameStats
 }
+
+// ReplayTimeline is everything needed to play a finished round back. Times
+// are milliseconds from the start of the round.
+type ReplayTimeline struct {
+	GameID     string         `json:"game_id"`
+	RoomCode   string         `json:"room_code"`
+	DurationMs int            `json:"duration_ms"`
+	Players    []ReplayPlayer `json:"players"`
+	Targets    []ReplayTarget `json:"targets"`
+	Scores     []ReplayScore  `json:"scores"`
+}
+
+type ReplayPlayer struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Color      string `json:"color"`
+	FinalScore int    `json:"final_score"`
+}
+
+// ReplayTarget is a target that was hit. Targets nobody hit aren't
+// recorded, so they don't appear in replays.
+type ReplayTarget struct {
+	ID       int    `json:"id"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Size     int    `json:"size"`
+	SpawnMs  int    `json:"spawn_ms"`
+	HitMs    int    `json:"hit_ms"`
+	PlayerID string `json:"player_id"`
+	Points   int    `json:"points"`
+}
+
+// ReplayScore is a player's running score from AtMs on.
+type ReplayScore struct {
+	AtMs     int    `json:"at_ms"`
+	PlayerID string `json:"player_id"`
+	Score    int    `json:"score"`
+}
@@ -2,14 +2,20 @@ package analytics
 
 import (
 	"clicktrainer/internal/db"
+	"clicktrainer/internal/ghost"
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 )
 
+// Queries reads analytics from either backend. Its SQL is common to both but
+// for the length of a game; see secondsBetween.
 type Queries struct {
-	DB *db.DB
+	DB db.Store
 }
 
-func NewQueries(database *db.DB) *Queries {
+func NewQueries(database db.Store) *Queries {
 	return &Queries{DB: database}
 }
 
@@ -43,13 +49,14 @@ func (q *Queries) GetPlayerGameStats(gameID, playerID string) (*PlayerGameStats,
 	}
 
 	// Calculate CPS from game duration
-	var durationSecs float64
+	var startedAt, endedAt *time.Time
 	_ = q.DB.QueryRow(`
-		SELECT EXTRACT(EPOCH FROM (ended_at - started_at))
-		FROM games WHERE id = $1 AND ended_at IS NOT NULL AND started_at IS NOT NULL
-	`, gameID).Scan(&durationSecs)
-	if durationSecs > 0 {
-		stats.CPS = float64(stats.Clicks) / durationSecs
+		SELECT started_at, ended_at FROM games WHERE id = $1
+	`, gameID).Scan(&startedAt, &endedAt)
+	if startedAt != nil && endedAt != nil {
+		if durationSecs := endedAt.Sub(*startedAt).Seconds(); durationSecs > 0 {
+			stats.CPS = float64(stats.Clicks) / durationSecs
+		}
 	}
 
 	if stats.Clicks > 0 {
@@ -70,6 +77,7 @@ func (q *Queries) GetPlayerLifetimeStats(playerID string) (*PlayerLifetimeStats,
 		return nil, fmt.Errorf("getting player: %w", err)
 	}
 
+	// Games spent spectating, recorded with rank 0, aren't counted.
 	err = q.DB.QueryRow(`
 		SELECT
 			COUNT(*) as games_played,
@@ -77,18 +85,19 @@ func (q *Queries) GetPlayerLifetimeStats(playerID string) (*PlayerLifetimeStats,
 			COALESCE(MAX(final_score), 0) as best_game,
 			COUNT(*) FILTER (WHERE rank = 1) as win_count
 		FROM game_players
-		WHERE player_id = $1
+		WHERE player_id = $1 AND rank > 0
 	`, playerID).Scan(&stats.GamesPlayed, &stats.TotalScore, &stats.BestGame, &stats.WinCount)
 	if err != nil {
 		return nil, fmt.Errorf("getting lifetime stats: %w", err)
 	}
 
-	// Calculate win streak (most recent consecutive wins)
+	// Calculate win streak (most recent consecutive wins); games spent
+	// spectating neither extend nor break it.
 	rows, err := q.DB.Query(`
 		SELECT gp.rank
 		FROM game_players gp
 		JOIN games g ON g.id = gp.game_id
-		WHERE gp.player_id = $1 AND g.ended_at IS NOT NULL
+		WHERE gp.player_id = $1 AND gp.rank > 0 AND g.ended_at IS NOT NULL
 		ORDER BY g.ended_at DESC
 	`, playerID)
 	if err != nil {
@@ -122,7 +131,7 @@ func (q *Queries) GetLeaderboard(category string, limit int) ([]LeaderboardEntry
 		query = `
 			SELECT p.id, p.name, p.color, COALESCE(SUM(gp.final_score), 0) as value
 			FROM players p
-			JOIN game_players gp ON gp.player_id = p.id
+			JOIN game_players gp ON gp.player_id = p.id AND gp.rank > 0
 			GROUP BY p.id, p.name, p.color
 			ORDER BY value DESC
 			LIMIT $1`
@@ -138,7 +147,7 @@ func (q *Queries) GetLeaderboard(category string, limit int) ([]LeaderboardEntry
 		query = `
 			SELECT p.id, p.name, p.color, COUNT(*) FILTER (WHERE gp.rank = 1) as value
 			FROM players p
-			JOIN game_players gp ON gp.player_id = p.id
+			JOIN game_players gp ON gp.player_id = p.id AND gp.rank > 0
 			GROUP BY p.id, p.name, p.color
 			ORDER BY value DESC
 			LIMIT $1`
@@ -153,7 +162,7 @@ func (q *Queries) GetLeaderboard(category string, limit int) ([]LeaderboardEntry
 	case "cps":
 		query = `
 			SELECT p.id, p.name, p.color,
-				COALESCE(ROUND(COUNT(ce.id)::numeric / NULLIF(SUM(EXTRACT(EPOCH FROM (g.ended_at - g.started_at))), 0), 2)::int, 0) as value
+				COALESCE(CAST(ROUND(CAST(COUNT(ce.id) AS NUMERIC) / NULLIF(SUM(` + q.secondsBetween("g.started_at", "g.ended_at") + `), 0)) AS INTEGER), 0) as value
 			FROM players p
 			JOIN click_events ce ON ce.player_id = p.id
 			JOIN games g ON g.id = ce.game_id AND g.ended_at IS NOT NULL AND g.started_at IS NOT NULL
@@ -184,6 +193,15 @@ func (q *Queries) GetLeaderboard(category string, limit int) ([]LeaderboardEntry
 	return entries, nil
 }
 
+// secondsBetween is the SQL for the seconds from one timestamp column to
+// another, which each backend spells its own way.
+func (q *Queries) secondsBetween(from, to string) string {
+	if q.DB.Dialect() == db.DialectSQLite {
+		return "(julianday(" + to + ") - julianday(" + from + ")) * 86400"
+	}
+	return "EXTRACT(EPOCH FROM (" + to + " - " + from + "))"
+}
+
 func (q *Queries) GetGameRecap(gameID string) (*GameRecap, error) {
 	recap := &GameRecap{GameID: gameID}
 
@@ -195,7 +213,7 @@ func (q *Queries) GetGameRecap(gameID string) (*GameRecap, error) {
 	}
 
 	rows, err := q.DB.Query(`
-		SELECT gp.player_id FROM game_players gp WHERE gp.game_id = $1 ORDER BY gp.rank
+		SELECT gp.player_id FROM game_players gp WHERE gp.game_id = $1 AND gp.rank > 0 ORDER BY gp.rank
 	`, gameID)
 	if err != nil {
 		return nil, fmt.Errorf("getting game players: %w", err)
@@ -216,3 +234,147 @@ func (q *Queries) GetGameRecap(gameID string) (*GameRecap, error) {
 
 	return recap, nil
 }
+
+func (q *Queries) GetReplayTimeline(gameID string) (*ReplayTimeline, error) {
+	timeline := &ReplayTimeline{GameID: gameID, Players: []ReplayPlayer{}}
+
+	var startedAt, endedAt *time.Time
+	err := q.DB.QueryRow(`
+		SELECT room_code, started_at, ended_at, round_duration_ms FROM games WHERE id = $1
+	`, gameID).Scan(&timeline.RoomCode, &startedAt, &endedAt, &timeline.DurationMs)
+	if err != nil {
+		return nil, fmt.Errorf("getting game: %w", err)
+	}
+	// A paused round runs longer than its configured duration.
+	if startedAt != nil && endedAt != nil {
+		timeline.DurationMs = max(timeline.DurationMs, int(endedAt.Sub(*startedAt).Milliseconds()))
+	}
+
+	rows, err := q.DB.Query(`
+		SELECT p.id, p.name, p.color, gp.final_score
+		FROM game_players gp
+		JOIN players p ON p.id = gp.player_id
+		WHERE gp.game_id = $1 AND gp.rank > 0
+		ORDER BY gp.rank
+	`, gameID)
+	if err != nil {
+		return nil, fmt.Errorf("getting replay players: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p ReplayPlayer
+		if err := rows.Scan(&p.ID, &p.Name, &p.Color, &p.FinalScore); err != nil {
+			return nil, err
+		}
+		timeline.Players = append(timeline.Players, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	clickRows, err := q.DB.Query(`
+		SELECT player_id, target_id, points, target_size, target_x, target_y, spawned_at, clicked_at
+		FROM click_events
+		WHERE game_id = $1
+		ORDER BY clicked_at
+	`, gameID)
+	if err != nil {
+		return nil, fmt.Errorf("getting replay clicks: %w", err)
+	}
+	clicks, err := scanClicks(clickRows)
+	if err != nil {
+		return nil, err
+	}
+
+	var start time.Time
+	if startedAt != nil {
+		start = *startedAt
+	}
+	timeline.Targets, timeline.Scores, timeline.DurationMs = buildReplay(start, timeline.DurationMs, clicks)
+	return timeline, nil
+}
+
+// scanClicks reads rows of player_id, target_id, points, target_size,
+// target_x, target_y, spawned_at, clicked_at, and closes them.
+func scanClicks(rows *sql.Rows) ([]db.ClickEvent, error) {
+	defer rows.Close()
+	var clicks []db.ClickEvent
+	for rows.Next() {
+		var c db.ClickEvent
+		if err := rows.Scan(&c.PlayerID, &c.TargetID, &c.Points, &c.TargetSize, &c.TargetX, &c.TargetY, &c.SpawnedAt, &c.ClickedAt); err != nil {
+			return nil, err
+		}
+		clicks = append(clicks, c)
+	}
+	return clicks, rows.Err()
+}
+
+// ErrNoLayout means there is no run to race: the game was recorded before
+// target layouts were, or the player has no such game.
+var ErrNoLayout = errors.New("no run with a recorded target layout")
+
+// GetGhostRun loads a player's run in a game to race against.
+func (q *Queries) GetGhostRun(gameID, playerID string) (*ghost.Run, error) {
+	var seed *int64
+	var startedAt *time.Time
+	var name, color string
+	err := q.DB.QueryRow(`
+		SELECT g.layout_seed, g.started_at, p.name, p.color
+		FROM games g
+		JOIN game_players gp ON gp.game_id = g.id
+		JOIN players p ON p.id = gp.player_id
+		WHERE g.id = $1 AND gp.player_id = $2
+	`, gameID, playerID).Scan(&seed, &startedAt, &name, &color)
+	if err != nil {
+		return nil, fmt.Errorf("getting ghost run: %w", err)
+	}
+	if seed == nil {
+		return nil, ErrNoLayout
+	}
+
+	rows, err := q.DB.Query(`
+		SELECT player_id, target_id, points, target_size, target_x, target_y, spawned_at, clicked_at
+		FROM click_events
+		WHERE game_id = $1 AND player_id = $2
+		ORDER BY clicked_at
+	`, gameID, playerID)
+	if err != nil {
+		return nil, fmt.Errorf("getting ghost clicks: %w", err)
+	}
+	clicks, err := scanClicks(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var start time.Time
+	if startedAt != nil {
+		start = *startedAt
+	}
+	targets, _, _ := buildReplay(start, 0, clicks)
+	hits := make([]ghost.Hit, len(targets))
+	for i, t := range targets {
+		hits[i] = ghost.Hit{AtMs: t.HitMs, X: t.X, Y: t.Y, Size: t.Size, Points: t.Points}
+	}
+	return ghost.NewRun(gameID, playerID, name, color, *seed, hits), nil
+}
+
+// GetBestRaceableGame returns the game of the player's highest score that
+// can be raced.
+func (q *Queries) GetBestRaceableGame(playerID string) (string, error) {
+	var gameID string
+	err := q.DB.QueryRow(`
+		SELECT gp.game_id
+		FROM game_players gp
+		JOIN games g ON g.id = gp.game_id
+		WHERE gp.player_id = $1 AND gp.rank > 0 AND g.layout_seed IS NOT NULL
+		ORDER BY gp.final_score DESC, g.ended_at DESC
+		LIMIT 1
+	`, playerID).Scan(&gameID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNoLayout
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting best game: %w", err)
+	}
+	return gameID, nil
+}
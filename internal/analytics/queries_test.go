@@ -0,0 +1,238 @@
+package analytics
+
+import (
+	"clicktrainer/internal/db"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStore is a Store the tests can also write to directly.
+type testStore interface {
+	db.Store
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// eachStore runs a test against every backend: SQLite always, and
+// PostgreSQL when TEST_DATABASE_URL is set.
+func eachStore(t *testing.T, test func(t *testing.T, database testStore)) {
+	t.Run("sqlite", func(t *testing.T) {
+		database, err := db.OpenSQLite(filepath.Join(t.TempDir(), "clicktrainer.db"))
+		if err != nil {
+			t.Fatalf("OpenSQLite() error: %v", err)
+		}
+		if err := database.Migrate(); err != nil {
+			t.Fatalf("Migrate() error: %v", err)
+		}
+		t.Cleanup(func() { database.Close() })
+		test(t, database)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_DATABASE_URL")
+		if dsn == "" {
+			t.Skip("TEST_DATABASE_URL not set, skipping database tests")
+		}
+		database, err := db.Connect(dsn)
+		if err != nil {
+			t.Fatalf("Connect() error: %v", err)
+		}
+		if err := database.Migrate(); err != nil {
+			t.Fatalf("Migrate() error: %v", err)
+		}
+		t.Cleanup(func() {
+			// Clean up test data; errors here are intentionally ignored.
+			for _, table := range []string{"click_events", "player_badges", "game_players", "games", "players"} {
+				_, _ = database.Exec("DELETE FROM " + table)
+			}
+			database.Close()
+		})
+		test(t, database)
+	})
+}
+
+const (
+	alice = "550e8400-e29b-41d4-a716-446655440101"
+	bob   = "550e8400-e29b-41d4-a716-446655440102"
+)
+
+// seedGame records a ten-second game Alice won with three hits, two of them
+// bullseyes, to Bob's one.
+func seedGame(t *testing.T, database testStore) string {
+	t.Helper()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(database.UpsertPlayer(alice, "Alice", "#ff0000"))
+	must(database.UpsertPlayer(bob, "Bob", "#0000ff"))
+	gameID, err := database.CreateGame("ABCD", alice, 10000)
+	must(err)
+	must(database.SetLayoutSeed(gameID, 7))
+	must(database.EndGame(gameID))
+
+	start := time.Now().UTC().Add(-10 * time.Second)
+	_, err = database.Exec(`UPDATE games SET started_at = $2 WHERE id = $1`, gameID, start)
+	must(err)
+	click := func(playerID string, target, points, atMs, reactionMs int) db.ClickEvent {
+		clicked := start.Add(time.Duration(atMs) * time.Millisecond)
+		return db.ClickEvent{
+			GameID: gameID, PlayerID: playerID, TargetID: target, Points: points,
+			TargetSize: 60, TargetX: 100 * target, TargetY: 50,
+			SpawnedAt: clicked.Add(-time.Duration(reactionMs) * time.Millisecond), ClickedAt: clicked,
+			ReactionMs: reactionMs,
+		}
+	}
+	must(database.BatchRecordClicks([]db.ClickEvent{
+		click(alice, 1, 4, 1000, 300),
+		click(bob, 2, 1, 2000, 150),
+		click(alice, 3, 2, 3000, 200),
+		click(alice, 4, 4, 4000, 400),
+	}))
+	must(database.AddGamePlayer(gameID, alice, 10, 1, ""))
+	must(database.AddGamePlayer(gameID, bob, 1, 2, ""))
+	return gameID
+}
+
+func TestQueries_GameStats(t *testing.T) {
+	eachStore(t, func(t *testing.T, database testStore) {
+		gameID := seedGame(t, database)
+		q := NewQueries(database)
+
+		stats, err := q.GetPlayerGameStats(gameID, alice)
+		if err != nil {
+			t.Fatalf("GetPlayerGameStats() error: %v", err)
+		}
+		if stats.PlayerName != "Alice" || stats.Score != 10 || stats.Clicks != 3 || stats.Bullseyes != 2 {
+			t.Errorf("stats = %+v, want Alice's 10 points from 3 clicks, 2 bullseyes", stats)
+		}
+		if stats.BestReaction != 200 || stats.AvgReaction != 300 {
+			t.Errorf("reaction best %d avg %v, want 200 and 300", stats.BestReaction, stats.AvgReaction)
+		}
+		if stats.CPS < 0.25 || stats.CPS > 0.35 {
+			t.Errorf("CPS = %v, want about 3 clicks in 10s", stats.CPS)
+		}
+
+		recap, err := q.GetGameRecap(gameID)
+		if err != nil {
+			t.Fatalf("GetGameRecap() error: %v", err)
+		}
+		if recap.RoomCode != "ABCD" || recap.StartedAt == nil || recap.EndedAt == nil {
+			t.Errorf("recap = %+v, want room ABCD with start and end", recap)
+		}
+		if len(recap.Players) != 2 || recap.Players[0].PlayerID != alice {
+			t.Errorf("recap players = %+v, want Alice then Bob", recap.Players)
+		}
+	})
+}
+
+func TestQueries_LifetimeAndLeaderboard(t *testing.T) {
+	eachStore(t, func(t *testing.T, database testStore) {
+		seedGame(t, database)
+		q := NewQueries(database)
+
+		life, err := q.GetPlayerLifetimeStats(alice)
+		if err != nil {
+			t.Fatalf("GetPlayerLifetimeStats() error: %v", err)
+		}
+		if life.GamesPlayed != 1 || life.TotalScore != 10 || life.WinCount != 1 || life.WinStreak != 1 {
+			t.Errorf("lifetime = %+v, want one game won with 10 points", life)
+		}
+
+		leaders := map[string]struct {
+			first string
+			value int
+		}{
+			"score":     {alice, 10},
+			"reaction":  {bob, 150},
+			"wins":      {alice, 1},
+			"bullseyes": {alice, 2},
+		}
+		for category, want := range leaders {
+			entries, err := q.GetLeaderboard(category, 10)
+			if err != nil {
+				t.Fatalf("GetLeaderboard(%q) error: %v", category, err)
+			}
+			if len(entries) != 2 || entries[0].PlayerID != want.first || entries[0].Value != want.value || entries[0].Rank != 1 {
+				t.Errorf("%s leaderboard = %+v, want %s first with %d", category, entries, want.first, want.value)
+			}
+		}
+		entries, err := q.GetLeaderboard("cps", 10)
+		if err != nil {
+			t.Fatalf("GetLeaderboard(cps) error: %v", err)
+		}
+		if len(entries) != 2 {
+			t.Errorf("cps leaderboard = %+v, want both players", entries)
+		}
+	})
+}
+
+func TestQueries_SpectatorsHaveNoPlacement(t *testing.T) {
+	eachStore(t, func(t *testing.T, database testStore) {
+		gameID := seedGame(t, database)
+		carol := "550e8400-e29b-41d4-a716-446655440103"
+		if err := database.UpsertPlayer(carol, "Carol", "#00ff00"); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.AddGamePlayer(gameID, carol, 0, 0, "spectate"); err != nil {
+			t.Fatal(err)
+		}
+		q := NewQueries(database)
+
+		recap, err := q.GetGameRecap(gameID)
+		if err != nil {
+			t.Fatalf("GetGameRecap() error: %v", err)
+		}
+		if len(recap.Players) != 2 || recap.Players[0].PlayerID != alice {
+			t.Errorf("recap players = %+v, want Alice then Bob without the spectator", recap.Players)
+		}
+		life, err := q.GetPlayerLifetimeStats(carol)
+		if err != nil {
+			t.Fatalf("GetPlayerLifetimeStats() error: %v", err)
+		}
+		if life.GamesPlayed != 0 {
+			t.Errorf("spectator's games played = %d, want 0", life.GamesPlayed)
+		}
+		entries, err := q.GetLeaderboard("score", 10)
+		if err != nil {
+			t.Fatalf("GetLeaderboard(score) error: %v", err)
+		}
+		if len(entries) != 2 {
+			t.Errorf("score leaderboard = %+v, want only the two players", entries)
+		}
+	})
+}
+
+func TestQueries_ReplayAndGhost(t *testing.T) {
+	eachStore(t, func(t *testing.T, database testStore) {
+		gameID := seedGame(t, database)
+		q := NewQueries(database)
+
+		timeline, err := q.GetReplayTimeline(gameID)
+		if err != nil {
+			t.Fatalf("GetReplayTimeline() error: %v", err)
+		}
+		if len(timeline.Players) != 2 || len(timeline.Targets) != 4 || timeline.DurationMs < 10000 {
+			t.Errorf("timeline has %d players, %d targets, %dms; want 2, 4, at least 10000ms",
+				len(timeline.Players), len(timeline.Targets), timeline.DurationMs)
+		}
+		if first := timeline.Targets[0]; first.PlayerID != alice || first.HitMs < 990 || first.HitMs > 1010 {
+			t.Errorf("first target = %+v, want Alice's hit 1s in", first)
+		}
+
+		best, err := q.GetBestRaceableGame(alice)
+		if err != nil || best != gameID {
+			t.Fatalf("GetBestRaceableGame() = %q, %v; want %q", best, err, gameID)
+		}
+		run, err := q.GetGhostRun(gameID, alice)
+		if err != nil {
+			t.Fatalf("GetGhostRun() error: %v", err)
+		}
+		if run.Seed != 7 || len(run.Hits) != 3 || run.Score != 10 {
+			t.Errorf("ghost run = %+v, want seed 7 with Alice's 3 hits for 10", run)
+		}
+	})
+}
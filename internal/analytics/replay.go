@@ -0,0 +1,49 @@
+package analytics
+
+import (
+	"clicktrainer/internal/db"
+	"sort"
+	"time"
+)
+
+// buildReplay turns a round's recorded hits into replay targets and running
+// scores. start is when the round began; if it is zero the earliest spawn is
+// used. The returned duration covers every hit even if the round ran long.
+func buildReplay(start time.Time, durationMs int, clicks []db.ClickEvent) ([]ReplayTarget, []ReplayScore, int) {
+	if start.IsZero() {
+		for _, c := range clicks {
+			if start.IsZero() || c.SpawnedAt.Before(start) {
+				start = c.SpawnedAt
+			}
+		}
+	}
+	offset := func(t time.Time) int {
+		return max(0, int(t.Sub(start).Milliseconds()))
+	}
+
+	sorted := append([]db.ClickEvent(nil), clicks...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ClickedAt.Before(sorted[j].ClickedAt)
+	})
+
+	targets := make([]ReplayTarget, 0, len(sorted))
+	scores := make([]ReplayScore, 0, len(sorted))
+	running := map[string]int{}
+	for _, c := range sorted {
+		hit := offset(c.ClickedAt)
+		targets = append(targets, ReplayTarget{
+			ID:       c.TargetID,
+			X:        c.TargetX,
+			Y:        c.TargetY,
+			Size:     c.TargetSize,
+			SpawnMs:  min(offset(c.SpawnedAt), hit),
+			HitMs:    hit,
+			PlayerID: c.PlayerID,
+			Points:   c.Points,
+		})
+		running[c.PlayerID] += c.Points
+		scores = append(scores, ReplayScore{AtMs: hit, PlayerID: c.PlayerID, Score: running[c.PlayerID]})
+		durationMs = max(durationMs, hit)
+	}
+	return targets, scores, durationMs
+}
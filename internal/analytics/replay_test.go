@@ -0,0 +1,46 @@
+package analytics
+
+import (
+	"clicktrainer/internal/db"
+	"testing"
+	"time"
+)
+
+func TestBuildReplay(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	clicks := []db.ClickEvent{
+		{PlayerID: "bob", TargetID: 2, Points: 4, TargetSize: 60, TargetX: 10, TargetY: 20, SpawnedAt: at(500), ClickedAt: at(1500)},
+		{PlayerID: "alice", TargetID: 1, Points: 3, TargetSize: 80, SpawnedAt: at(0), ClickedAt: at(900)},
+		{PlayerID: "alice", TargetID: 3, Points: 2, TargetSize: 70, SpawnedAt: at(900), ClickedAt: at(61000)},
+	}
+
+	targets, scores, duration := buildReplay(start, 60000, clicks)
+
+	if len(targets) != 3 || targets[0].ID != 1 || targets[1].ID != 2 || targets[2].ID != 3 {
+		t.Fatalf("targets = %+v, want them in hit order", targets)
+	}
+	if got := targets[1]; got.SpawnMs != 500 || got.HitMs != 1500 || got.X != 10 || got.Size != 60 || got.PlayerID != "bob" {
+		t.Errorf("target 2 = %+v, want its geometry and times from the round start", got)
+	}
+	want := []ReplayScore{{900, "alice", 3}, {1500, "bob", 4}, {61000, "alice", 5}}
+	for i, s := range scores {
+		if s != want[i] {
+			t.Errorf("scores[%d] = %+v, want %+v", i, s, want[i])
+		}
+	}
+	if duration != 61000 {
+		t.Errorf("duration = %d, want 61000 so the last hit is included", duration)
+	}
+}
+
+func TestBuildReplay_NoStartTime(t *testing.T) {
+	spawned := time.Now()
+	clicks := []db.ClickEvent{{PlayerID: "p", SpawnedAt: spawned, ClickedAt: spawned.Add(300 * time.Millisecond)}}
+
+	targets, _, _ := buildReplay(time.Time{}, 0, clicks)
+
+	if targets[0].SpawnMs != 0 || targets[0].HitMs != 300 {
+		t.Errorf("target = %+v, want times from the first spawn", targets[0])
+	}
+}
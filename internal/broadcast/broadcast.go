@@ -2,10 +2,20 @@ package broadcast
 
 import (
 	"clicktrainer/internal/events"
+	"slices"
 	"sync"
 )
 
+// ReplaySize is how many recent messages a room keeps for clients that
+// reconnect with Last-Event-ID.
+const ReplaySize = 256
+
+// clientBuffer is how many messages a client can fall behind before it is
+// disconnected.
+const clientBuffer = 10
+
 type HxEventMessage struct {
+	ID    uint64 // room sequence number, starting at 1
 	Event string
 	Msg   string
 }
@@ -13,43 +23,201 @@ type HxEventMessage struct {
 type Broadcaster struct {
 	Mu      sync.Mutex
 	Clients map[chan HxEventMessage]bool
+
+	seq     uint64
+	history []HxEventMessage // the last ReplaySize messages, oldest first
+	closed  bool
+	done    chan struct{} // closed when the bus forwarder exits
+	relay   func(HxEventMessage)
 }
 
+// NewBroadcaster forwards scene changes from the bus to every client until
+// the bus is closed.
 func NewBroadcaster(bus *events.Bus) *Broadcaster {
 	b := &Broadcaster{
 		Clients: make(map[chan HxEventMessage]bool),
+		done:    make(chan struct{}),
 	}
+	sub := bus.Subscribe("broadcaster", 0)
 	go func() {
-		for ev := range bus.SceneChanges {
-			b.BroadcastOOB("sceneChange", ev.Scene)
+		defer close(b.done)
+		for ev := range sub.Events() {
+			if sc, ok := ev.(events.SceneChanged); ok {
+				b.BroadcastOOB("sceneChange", sc.Scene)
+			}
 		}
 	}()
 	return b
 }
 
+// NewMirror returns a broadcaster without a bus, for following a room open on
+// another instance. Its messages come in through Deliver.
+func NewMirror() *Broadcaster {
+	b := &Broadcaster{
+		Clients: make(map[chan HxEventMessage]bool),
+		done:    make(chan struct{}),
+	}
+	close(b.done)
+	return b
+}
+
+// SetRelay sets a function called with every message the broadcaster
+// numbers, in order, e.g. to pass them on to other instances. It is called
+// with Mu held and must not block.
+func (b *Broadcaster) SetRelay(fn func(HxEventMessage)) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	b.relay = fn
+}
+
+// Deliver sends a message numbered by another broadcaster to every client
+// and keeps it for replay. The first message delivered may have any ID;
+// after that, a message that doesn't follow the last one means some were
+// lost, and Deliver drops it and returns false.
+func (b *Broadcaster) Deliver(msg HxEventMessage) bool {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	if b.closed {
+		return true
+	}
+	if b.seq != 0 && msg.ID != b.seq+1 {
+		return false
+	}
+	b.seq = msg.ID
+	b.keepLocked(msg)
+	b.sendLocked(msg)
+	return true
+}
+
+// Subscribe registers a client channel. After Close it returns a channel
+// that is already closed.
 func (b *Broadcaster) Subscribe() chan HxEventMessage {
-	ch := make(chan HxEventMessage, 10)
 	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	return b.subscribeLocked()
+}
+
+// Resume registers a client that last received message lastID and returns
+// the messages it missed. ok is false when some of them are no longer kept,
+// or lastID is from before a restart, and the client needs a full resync.
+func (b *Broadcaster) Resume(lastID uint64) (ch chan HxEventMessage, missed []HxEventMessage, ok bool) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	ch = b.subscribeLocked()
+	if lastID > b.seq {
+		return ch, nil, false
+	}
+	if lastID == b.seq {
+		return ch, nil, true
+	}
+	oldest := b.seq - uint64(len(b.history)) + 1
+	if lastID+1 < oldest {
+		return ch, nil, false
+	}
+	return ch, slices.Clone(b.history[lastID+1-oldest:]), true
+}
+
+// LastID returns the sequence number of the latest message.
+func (b *Broadcaster) LastID() uint64 {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	return b.seq
+}
+
+func (b *Broadcaster) subscribeLocked() chan HxEventMessage {
+	ch := make(chan HxEventMessage, clientBuffer)
+	if b.closed {
+		close(ch)
+		return ch
+	}
 	b.Clients[ch] = true
-	b.Mu.Unlock()
 	return ch
 }
 
 func (b *Broadcaster) Unsubscribe(ch chan HxEventMessage) {
 	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	// Close or a lagging disconnect already closed the channel.
+	if !b.Clients[ch] {
+		return
+	}
 	delete(b.Clients, ch)
-	b.Mu.Unlock()
 	close(ch)
 }
 
+// BroadcastOOB numbers a message, keeps it for replay and sends it to every
+// client. A client too far behind to take it is disconnected instead of
+// silently missing it; its browser reconnects and resumes from its last ID.
 func (b *Broadcaster) BroadcastOOB(event string, message string) {
 	b.Mu.Lock()
 	defer b.Mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.sendLocked(b.recordLocked(event, message))
+}
+
+func (b *Broadcaster) sendLocked(msg HxEventMessage) {
+	for ch := range b.Clients {
+		select {
+		case ch <- msg:
+		default:
+			delete(b.Clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// recordLocked numbers a message, keeps it and relays it.
+func (b *Broadcaster) recordLocked(event, message string) HxEventMessage {
+	b.seq++
+	msg := HxEventMessage{ID: b.seq, Event: event, Msg: message}
+	b.keepLocked(msg)
+	if b.relay != nil {
+		b.relay(msg)
+	}
+	return msg
+}
+
+func (b *Broadcaster) keepLocked(msg HxEventMessage) {
+	if len(b.history) == ReplaySize {
+		copy(b.history, b.history[1:])
+		b.history = b.history[:ReplaySize-1]
+	}
+	b.history = append(b.history, msg)
+}
+
+// Close sends a final event to every client and closes their channels, so
+// their streams end. Later broadcasts are dropped. The bus forwarder stops
+// once the bus itself is closed; Done reports when it has.
+func (b *Broadcaster) Close(event string, message string) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	msg := b.recordLocked(event, message)
 	for ch := range b.Clients {
+		// Make room for the final event rather than lose it to a backlog.
 		select {
-		case ch <- HxEventMessage{Event: event, Msg: message}:
+		case ch <- msg:
 		default:
-			// skip clients with full data channels
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- msg:
+			default:
+			}
 		}
+		close(ch)
+		delete(b.Clients, ch)
 	}
 }
+
+// Done returns a channel closed once the bus forwarder has exited.
+func (b *Broadcaster) Done() <-chan struct{} {
+	return b.done
+}
@@ -69,14 +69,14 @@ func TestBroadcaster_BroadcastOOB(t *testing.T) {
 	b.Unsubscribe(ch2)
 }
 
-func TestBroadcaster_SkipsFullChannels(t *testing.T) {
+func TestBroadcaster_DisconnectsLaggingClients(t *testing.T) {
 	bus := events.NewBus()
 	b := NewBroadcaster(bus)
 
 	ch := b.Subscribe()
 
-	// Fill the channel buffer (capacity 10)
-	for i := 0; i < 10; i++ {
+	// Fill the channel buffer
+	for i := 0; i < clientBuffer; i++ {
 		b.BroadcastOOB("fill", "data")
 	}
 
@@ -94,7 +94,81 @@ func TestBroadcaster_SkipsFullChannels(t *testing.T) {
 		t.Fatal("BroadcastOOB blocked on full channel")
 	}
 
+	// The client keeps what it was sent, then its stream ends so it can
+	// reconnect and resume.
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != clientBuffer {
+		t.Errorf("lagging client received %d messages, want %d", n, clientBuffer)
+	}
+	b.Unsubscribe(ch)
+}
+
+func TestBroadcaster_NumbersMessages(t *testing.T) {
+	b := NewBroadcaster(events.NewBus())
+	ch := b.Subscribe()
+	defer b.Unsubscribe(ch)
+
+	b.BroadcastOOB("a", "1")
+	b.BroadcastOOB("b", "2")
+	if first, second := <-ch, <-ch; first.ID != 1 || second.ID != 2 {
+		t.Errorf("IDs = %d, %d; want 1, 2", first.ID, second.ID)
+	}
+	if b.LastID() != 2 {
+		t.Errorf("LastID() = %d, want 2", b.LastID())
+	}
+}
+
+func TestBroadcaster_Resume(t *testing.T) {
+	b := NewBroadcaster(events.NewBus())
+	for i := range 5 {
+		b.BroadcastOOB("swap", string(rune('a'+i)))
+	}
+
+	ch, missed, ok := b.Resume(3)
+	defer b.Unsubscribe(ch)
+	if !ok || len(missed) != 2 || missed[0].ID != 4 || missed[1].Msg != "e" {
+		t.Errorf("Resume(3) = %+v, %v; want messages 4 and 5", missed, ok)
+	}
+
+	b.BroadcastOOB("swap", "live")
+	if msg := <-ch; msg.ID != 6 {
+		t.Errorf("live message ID = %d, want 6", msg.ID)
+	}
+
+	ch2, missed, ok := b.Resume(6)
+	defer b.Unsubscribe(ch2)
+	if !ok || len(missed) != 0 {
+		t.Errorf("Resume(latest) = %+v, %v; want nothing missed", missed, ok)
+	}
+}
+
+func TestBroadcaster_ResumeNeedsResync(t *testing.T) {
+	b := NewBroadcaster(events.NewBus())
+	for range ReplaySize + 5 {
+		b.BroadcastOOB("swap", "x")
+	}
+
+	// Message 5 has fallen out of the replay buffer.
+	ch, missed, ok := b.Resume(4)
 	b.Unsubscribe(ch)
+	if ok || missed != nil {
+		t.Errorf("Resume(4) = %d messages, %v; want a resync", len(missed), ok)
+	}
+	// The oldest kept message is 6.
+	ch, missed, ok = b.Resume(5)
+	b.Unsubscribe(ch)
+	if !ok || len(missed) != ReplaySize || missed[0].ID != 6 {
+		t.Errorf("Resume(5) = %d messages, %v; want the whole buffer", len(missed), ok)
+	}
+	// An ID from before a restart.
+	ch, _, ok = b.Resume(10_000)
+	b.Unsubscribe(ch)
+	if ok {
+		t.Error("Resume from an unknown future ID should need a resync")
+	}
 }
 
 func TestBroadcaster_SceneChangeForwarding(t *testing.T) {
@@ -103,7 +177,7 @@ func TestBroadcaster_SceneChangeForwarding(t *testing.T) {
 
 	ch := b.Subscribe()
 
-	bus.SceneChanges <- events.SceneChangeEvent{Scene: "combat"}
+	bus.Publish(events.SceneChanged{Scene: "combat"})
 
 	select {
 	case msg := <-ch:
@@ -116,3 +190,80 @@ func TestBroadcaster_SceneChangeForwarding(t *testing.T) {
 
 	b.Unsubscribe(ch)
 }
+
+func TestBroadcaster_Close(t *testing.T) {
+	bus := events.NewBus()
+	b := NewBroadcaster(bus)
+
+	ch := b.Subscribe()
+	for range clientBuffer {
+		b.BroadcastOOB("filler", "x")
+	}
+	b.Close("closed", "bye")
+	b.Close("closed", "again")
+	b.BroadcastOOB("late", "dropped")
+
+	var last HxEventMessage
+	for msg := range ch {
+		last = msg
+	}
+	if last.Event != "closed" || last.Msg != "bye" {
+		t.Errorf("last message = %+v, want the close event", last)
+	}
+
+	// Unsubscribing after Close must not double-close.
+	b.Unsubscribe(ch)
+	if _, ok := <-b.Subscribe(); ok {
+		t.Error("Subscribe after Close should return a closed channel")
+	}
+
+	bus.Close()
+	select {
+	case <-b.Done():
+	case <-time.After(time.Second):
+		t.Fatal("forwarder did not exit after the bus closed")
+	}
+}
+
+func TestBroadcaster_Relay(t *testing.T) {
+	b := NewBroadcaster(events.NewBus())
+	var relayed []HxEventMessage
+	b.SetRelay(func(msg HxEventMessage) { relayed = append(relayed, msg) })
+
+	b.BroadcastOOB("swap", "one")
+	b.Close("closed", "bye")
+
+	if len(relayed) != 2 || relayed[0].ID != 1 || relayed[1].Event != "closed" {
+		t.Errorf("relayed = %+v, want both messages with their IDs", relayed)
+	}
+}
+
+func TestMirror_Deliver(t *testing.T) {
+	m := NewMirror()
+	ch := m.Subscribe()
+
+	// A mirror picks up wherever the room has got to.
+	if !m.Deliver(HxEventMessage{ID: 41, Event: "swap", Msg: "a"}) || !m.Deliver(HxEventMessage{ID: 42, Event: "swap", Msg: "b"}) {
+		t.Fatal("Deliver() of consecutive messages should succeed")
+	}
+	if got := <-ch; got.ID != 41 || got.Msg != "a" {
+		t.Errorf("first message = %+v, want the room's ID kept", got)
+	}
+	<-ch
+	if m.Deliver(HxEventMessage{ID: 44, Event: "swap", Msg: "d"}) {
+		t.Error("Deliver() after a gap should report it")
+	}
+	if m.LastID() != 42 {
+		t.Errorf("LastID() = %d, want 42", m.LastID())
+	}
+
+	_, missed, ok := m.Resume(41)
+	if !ok || len(missed) != 1 || missed[0].ID != 42 {
+		t.Errorf("Resume(41) = %+v, %v; want message 42 replayed", missed, ok)
+	}
+	select {
+	case <-m.Done():
+	default:
+		t.Error("a mirror has no forwarder to wait for")
+	}
+}
@@ -0,0 +1,300 @@
+// Package clickspool keeps click batches the database couldn't take yet in
+// an append-only file, so they survive outages and restarts until they are
+// written.
+package clickspool
+
+import (
+	"bufio"
+	"bytes"
+	"clicktrainer/internal/db"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Batch is clicks written to the database together. Key makes writing it
+// idempotent, so a batch retried after a write that did land isn't counted
+// twice.
+type Batch struct {
+	Key       string          `json:"key"`
+	SpooledAt time.Time       `json:"spooled_at"`
+	Events    []db.ClickEvent `json:"events"`
+}
+
+// Spool is a file of batches, one JSON line each. Batches are appended as
+// they come and removed from the front once written. Batches the database
+// rejects are moved to a dead-letter file next to it, named like the spool
+// with ".rejected" added, to be looked into by hand.
+type Spool struct {
+	path string
+
+	rejectMu sync.Mutex
+	rejected *os.File // opened on the first rejected batch
+
+	drainMu sync.Mutex // one Drain at a time
+
+	mu      sync.Mutex // guards the rest
+	f       *os.File
+	size    int64
+	batches int
+	oldest  time.Time // SpooledAt of the first batch
+}
+
+// Open opens the spool at path, creating it if need be. A last line cut
+// short by a crash is dropped.
+func Open(path string) (*Spool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening click spool: %w", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading click spool: %w", err)
+	}
+	s := &Spool{path: path, f: f}
+	entries, end := parse(data)
+	if end < int64(len(data)) {
+		slog.Warn("dropping incomplete batch at end of click spool", "component", "clickspool", "bytes", int64(len(data))-end)
+		if err := f.Truncate(end); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("truncating click spool: %w", err)
+		}
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("seeking click spool: %w", err)
+	}
+	s.size = end
+	s.count(entries)
+	return s, nil
+}
+
+type entry struct {
+	batch Batch
+	end   int64 // offset just past the batch's line
+}
+
+// parse reads complete lines of data. It returns the batches and where the
+// complete lines end; lines that aren't batches are skipped.
+func parse(data []byte) ([]entry, int64) {
+	var entries []entry
+	var off int64
+	for {
+		i := bytes.IndexByte(data[off:], '\n')
+		if i < 0 {
+			return entries, off
+		}
+		line := data[off : off+int64(i)]
+		off += int64(i) + 1
+		var b Batch
+		if err := json.Unmarshal(line, &b); err != nil {
+			slog.Warn("skipping unreadable line in click spool", "component", "clickspool", "error", err)
+			continue
+		}
+		entries = append(entries, entry{batch: b, end: off})
+	}
+}
+
+// count sets batches and oldest from what is left in the file.
+func (s *Spool) count(entries []entry) {
+	s.batches = len(entries)
+	s.oldest = time.Time{}
+	if len(entries) > 0 {
+		s.oldest = entries[0].batch.SpooledAt
+	}
+}
+
+// Append adds a batch to the end of the spool and syncs it to disk.
+func (s *Spool) Append(b Batch) error {
+	if b.SpooledAt.IsZero() {
+		b.SpooledAt = time.Now()
+	}
+	line, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("encoding click batch: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Write(line); err != nil {
+		// Don't leave half a line for the next batch to follow.
+		_ = s.f.Truncate(s.size)
+		_, _ = s.f.Seek(s.size, io.SeekStart)
+		return fmt.Errorf("appending to click spool: %w", err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("syncing click spool: %w", err)
+	}
+	s.size += int64(len(line))
+	if s.batches == 0 {
+		s.oldest = b.SpooledAt
+	}
+	s.batches++
+	return nil
+}
+
+// rejectedBatch is a line of the dead-letter file.
+type rejectedBatch struct {
+	Batch
+	Error      string    `json:"error"`
+	RejectedAt time.Time `json:"rejected_at"`
+}
+
+// Reject appends b to the dead-letter file with why the database refused
+// it, and syncs it to disk.
+func (s *Spool) Reject(b Batch, cause error) error {
+	line, err := json.Marshal(rejectedBatch{Batch: b, Error: cause.Error(), RejectedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("encoding rejected click batch: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.rejectMu.Lock()
+	defer s.rejectMu.Unlock()
+	if s.rejected == nil {
+		f, err := os.OpenFile(s.path+".rejected", os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return fmt.Errorf("opening rejected click batches: %w", err)
+		}
+		s.rejected = f
+	}
+	if _, err := s.rejected.Write(line); err != nil {
+		return fmt.Errorf("appending rejected click batch: %w", err)
+	}
+	if err := s.rejected.Sync(); err != nil {
+		return fmt.Errorf("syncing rejected click batches: %w", err)
+	}
+	return nil
+}
+
+// Drain passes the spooled batches to write in order and removes the ones
+// written. A batch write rejects with db.ErrRejected is moved to the
+// dead-letter file and draining goes on; any other error stops it there.
+// Batches appended meanwhile are left for next time. It returns how many
+// batches were written and how many were rejected.
+func (s *Spool) Drain(write func(Batch) error) (written, rejected int, err error) {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+
+	s.mu.Lock()
+	size := s.size
+	data := make([]byte, size)
+	_, err = s.f.ReadAt(data, 0)
+	s.mu.Unlock()
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading click spool: %w", err)
+	}
+
+	entries, _ := parse(data)
+	var done int64
+	var writeErr error
+	for _, e := range entries {
+		writeErr = write(e.batch)
+		if errors.Is(writeErr, db.ErrRejected) {
+			slog.Error("database rejected spooled clicks, setting them aside", "component", "clickspool", "error", writeErr, "key", e.batch.Key, "clicks", len(e.batch.Events))
+			if writeErr = s.Reject(e.batch, writeErr); writeErr != nil {
+				break
+			}
+			rejected++
+		} else if writeErr != nil {
+			break
+		} else {
+			written++
+		}
+		done = e.end
+	}
+	if writeErr == nil {
+		done = size // skipped lines go too
+	}
+	if done > 0 {
+		if err := s.removeFront(done); err != nil {
+			return written, rejected, err
+		}
+	}
+	return written, rejected, writeErr
+}
+
+// removeFront removes the first n bytes of the spool. Unless that is all of
+// it, what is left is copied to a new file that replaces the spool.
+func (s *Spool) removeFront(n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n == s.size {
+		if err := s.f.Truncate(0); err != nil {
+			return fmt.Errorf("truncating click spool: %w", err)
+		}
+		if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("seeking click spool: %w", err)
+		}
+		s.size = 0
+		s.count(nil)
+		return nil
+	}
+
+	rest := make([]byte, s.size-n)
+	if _, err := s.f.ReadAt(rest, n); err != nil {
+		return fmt.Errorf("reading click spool: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("compacting click spool: %w", err)
+	}
+	w := bufio.NewWriter(tmp)
+	_, err = w.Write(rest)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("compacting click spool: %w", err)
+	}
+	s.f.Close()
+	s.f = tmp
+	s.size = int64(len(rest))
+	entries, _ := parse(rest)
+	s.count(entries)
+	return nil
+}
+
+// Stats reports how many batches are spooled, the size of the file, and
+// when the oldest batch was spooled (zero if none are).
+func (s *Spool) Stats() (batches int, size int64, oldest time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches, s.size, s.oldest
+}
+
+// Len returns how many batches are spooled.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches
+}
+
+func (s *Spool) Close() error {
+	s.rejectMu.Lock()
+	if s.rejected != nil {
+		s.rejected.Close()
+	}
+	s.rejectMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,176 @@
+package clickspool
+
+import (
+	"clicktrainer/internal/db"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestSpool(t *testing.T, path string) *Spool {
+	t.Helper()
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func batch(key string, at time.Time) Batch {
+	return Batch{Key: key, SpooledAt: at, Events: []db.ClickEvent{{GameID: "g", PlayerID: "p", TargetID: 1, Points: 2}}}
+}
+
+// keys returns the keys of the batches in the spool's file.
+func keys(t *testing.T, s *Spool) []string {
+	t.Helper()
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	entries, _ := parse(data)
+	for _, e := range entries {
+		got = append(got, e.batch.Key)
+	}
+	return got
+}
+
+func TestSpool_AppendAndDrain(t *testing.T) {
+	s := openTestSpool(t, filepath.Join(t.TempDir(), "clicks.spool"))
+	start := time.Now()
+	for i, key := range []string{"a", "b", "c"} {
+		if err := s.Append(batch(key, start.Add(time.Duration(i)*time.Second))); err != nil {
+			t.Fatalf("Append() error: %v", err)
+		}
+	}
+	if n, size, oldest := s.Stats(); n != 3 || size == 0 || !oldest.Equal(start) {
+		t.Errorf("Stats() = %d, %d, %v; want 3 batches from %v", n, size, oldest, start)
+	}
+
+	var got []Batch
+	written, _, err := s.Drain(func(b Batch) error {
+		got = append(got, b)
+		return nil
+	})
+	if err != nil || written != 3 {
+		t.Fatalf("Drain() = %d, %v; want 3 written", written, err)
+	}
+	if got[0].Key != "a" || got[2].Key != "c" || len(got[1].Events) != 1 || got[1].Events[0].Points != 2 {
+		t.Errorf("drained %+v, want a, b, c in order with their events", got)
+	}
+	if n, size, oldest := s.Stats(); n != 0 || size != 0 || !oldest.IsZero() {
+		t.Errorf("Stats() after drain = %d, %d, %v; want empty", n, size, oldest)
+	}
+}
+
+func TestSpool_DrainStopsAtFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clicks.spool")
+	s := openTestSpool(t, path)
+	start := time.Now()
+	for i, key := range []string{"a", "b", "c"} {
+		_ = s.Append(batch(key, start.Add(time.Duration(i)*time.Second)))
+	}
+
+	down := errors.New("database down")
+	written, _, err := s.Drain(func(b Batch) error {
+		if b.Key == "b" {
+			return down
+		}
+		return nil
+	})
+	if written != 1 || !errors.Is(err, down) {
+		t.Fatalf("Drain() = %d, %v; want 1 written then the error", written, err)
+	}
+	if got := keys(t, s); len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Errorf("spooled %v, want [b c]", got)
+	}
+	if n, _, oldest := s.Stats(); n != 2 || !oldest.Equal(start.Add(time.Second)) {
+		t.Errorf("Stats() = %d, %v; want 2 batches from b's time", n, oldest)
+	}
+
+	// What is left survives a restart, and new batches follow it.
+	s.Close()
+	s = openTestSpool(t, path)
+	_ = s.Append(batch("d", time.Now()))
+	if got := keys(t, s); len(got) != 3 || got[0] != "b" || got[2] != "d" {
+		t.Errorf("spooled after reopening %v, want [b c d]", got)
+	}
+}
+
+func TestSpool_DrainSetsRejectedAside(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clicks.spool")
+	s := openTestSpool(t, path)
+	for _, key := range []string{"a", "poison", "c"} {
+		_ = s.Append(batch(key, time.Now()))
+	}
+
+	// A batch the database refuses doesn't hold up the ones behind it.
+	written, rejected, err := s.Drain(func(b Batch) error {
+		if b.Key == "poison" {
+			return fmt.Errorf("%w: foreign key violation", db.ErrRejected)
+		}
+		return nil
+	})
+	if err != nil || written != 2 || rejected != 1 {
+		t.Fatalf("Drain() = %d, %d, %v; want 2 written and 1 rejected", written, rejected, err)
+	}
+	if s.Len() != 0 {
+		t.Errorf("Len() = %d, want an empty spool", s.Len())
+	}
+
+	data, err := os.ReadFile(path + ".rejected")
+	if err != nil {
+		t.Fatalf("reading the dead-letter file: %v", err)
+	}
+	entries, _ := parse(data)
+	if len(entries) != 1 || entries[0].batch.Key != "poison" || len(entries[0].batch.Events) != 1 {
+		t.Errorf("dead-letter file holds %+v, want the poison batch", entries)
+	}
+	if !strings.Contains(string(data), "foreign key violation") {
+		t.Errorf("dead-letter file %q doesn't say why the batch was rejected", data)
+	}
+}
+
+func TestSpool_AppendDuringDrain(t *testing.T) {
+	s := openTestSpool(t, filepath.Join(t.TempDir(), "clicks.spool"))
+	_ = s.Append(batch("a", time.Now()))
+
+	written, _, err := s.Drain(func(b Batch) error {
+		return s.Append(batch("late", time.Now()))
+	})
+	if err != nil || written != 1 {
+		t.Fatalf("Drain() = %d, %v; want 1 written", written, err)
+	}
+	if got := keys(t, s); len(got) != 1 || got[0] != "late" {
+		t.Errorf("spooled %v, want the batch appended during the drain", got)
+	}
+	if s.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", s.Len())
+	}
+}
+
+func TestSpool_DropsTornLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clicks.spool")
+	s := openTestSpool(t, path)
+	_ = s.Append(batch("a", time.Now()))
+	s.Close()
+
+	// A crash in the middle of an append leaves part of a line.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"key":"b","spooled_at":`)
+	f.Close()
+
+	s = openTestSpool(t, path)
+	_ = s.Append(batch("c", time.Now()))
+	if got := keys(t, s); len(got) != 2 || got[0] != "a" || got[1] != "c" {
+		t.Errorf("spooled %v, want [a c] without the torn line", got)
+	}
+}
@@ -6,16 +6,63 @@ import (
 )
 
 type Config struct {
-	Port          string
-	DatabaseURL   string
-	RoundDuration int // seconds
+	Port           string
+	DatabaseURL    string
+	SQLitePath     string // SQLite file to keep analytics in when DATABASE_URL is unset
+	ClickSpoolFile string // file to keep clicks the database can't take yet in
+	ClickKeyDays   int    // days to keep click batch keys; 0 keeps them forever
+	RoundDuration  int    // seconds
+	LateJoinPolicy string // default late-join policy for new rooms
+	PresenceGrace  int    // seconds a disconnected player is kept before removal; 0 disables
+	RoomIdleTTL    int    // minutes without activity before a room is closed; 0 disables
+	RoomExpiryWarn int    // seconds of warning players get before their room is closed
+	AdminToken     string // bearer token for the /admin API; empty disables it
+	TickRate       int    // batched room updates sent per second
+	ShutdownSecs   int    // how long a graceful shutdown may take before giving up
+	SnapshotFile   string // file to keep room snapshots in; empty uses the database
+	SnapshotSecs   int    // seconds between room snapshots; 0 saves only on shutdown
+	JournalDir     string // directory to keep room event journals in; empty uses the database
+	JournalDays    int    // days to keep room journals; 0 keeps them forever
+	InstanceID     string // names this instance in the room directory
+	InstanceURL    string // where other instances reach this one; empty runs alone
+	RoomForward    string // "proxy" or "redirect" requests for rooms on other instances
+
+	// Lobby defaults for new rooms; hosts can change them per room.
+	LobbyMinPlayers  int    // players needed before a round can start
+	AutoStartPercent int    // share of players ready that arms the auto-start; 0 disables
+	AutoStartSecs    int    // auto-start countdown length
+	LobbyIdleTimeout int    // seconds of lobby inactivity before the idle action; 0 disables
+	LobbyIdleAction  string // "spectate" or "unready"
 }
 
 func Load() Config {
 	cfg := Config{
-		Port:          getEnv("PORT", "8080"),
-		DatabaseURL:   os.Getenv("DATABASE_URL"),
-		RoundDuration: getEnvInt("ROUND_DURATION", 60),
+		Port:           getEnv("PORT", "8080"),
+		DatabaseURL:    os.Getenv("DATABASE_URL"),
+		SQLitePath:     os.Getenv("SQLITE_PATH"),
+		ClickSpoolFile: getEnv("CLICK_SPOOL_FILE", "clicks.spool"),
+		ClickKeyDays:   getEnvInt("CLICK_KEY_RETENTION_DAYS", 7),
+		RoundDuration:  getEnvInt("ROUND_DURATION", 60),
+		LateJoinPolicy: getEnv("LATE_JOIN_POLICY", "normal"),
+		PresenceGrace:  getEnvInt("PRESENCE_GRACE", 30),
+		RoomIdleTTL:    getEnvInt("ROOM_IDLE_TTL", 60),
+		RoomExpiryWarn: getEnvInt("ROOM_EXPIRY_WARNING", 120),
+		AdminToken:     os.Getenv("ADMIN_TOKEN"),
+		TickRate:       getEnvInt("TICK_RATE", 20),
+		ShutdownSecs:   getEnvInt("SHUTDOWN_TIMEOUT", 15),
+		SnapshotFile:   os.Getenv("SNAPSHOT_FILE"),
+		SnapshotSecs:   getEnvInt("SNAPSHOT_INTERVAL", 30),
+		JournalDir:     os.Getenv("JOURNAL_DIR"),
+		JournalDays:    getEnvInt("JOURNAL_RETENTION_DAYS", 30),
+		InstanceID:     getEnv("INSTANCE_ID", hostname()),
+		InstanceURL:    os.Getenv("INSTANCE_URL"),
+		RoomForward:    getEnv("ROOM_FORWARD", "proxy"),
+
+		LobbyMinPlayers:  getEnvInt("LOBBY_MIN_PLAYERS", 1),
+		AutoStartPercent: getEnvInt("AUTO_START_PERCENT", 75),
+		AutoStartSecs:    getEnvInt("AUTO_START_SECS", 10),
+		LobbyIdleTimeout: getEnvInt("LOBBY_IDLE_TIMEOUT", 120),
+		LobbyIdleAction:  getEnv("LOBBY_IDLE_ACTION", "spectate"),
 	}
 	return cfg
 }
@@ -27,6 +74,16 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// hostname is the default instance ID, which is unique per pod or container
+// in most deployments.
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "local"
+	}
+	return name
+}
+
 func getEnvInt(key string, fallback int) int {
 	if v := os.Getenv(key); v != "" {
 		if i, err := strconv.Atoi(v); err == nil {
@@ -5,7 +5,28 @@ import "testing"
 func TestLoad_Defaults(t *testing.T) {
 	t.Setenv("PORT", "")
 	t.Setenv("DATABASE_URL", "")
+	t.Setenv("SQLITE_PATH", "")
+	t.Setenv("CLICK_SPOOL_FILE", "")
+	t.Setenv("CLICK_KEY_RETENTION_DAYS", "")
 	t.Setenv("ROUND_DURATION", "")
+	t.Setenv("LATE_JOIN_POLICY", "")
+	t.Setenv("PRESENCE_GRACE", "")
+	t.Setenv("ROOM_IDLE_TTL", "")
+	t.Setenv("ROOM_EXPIRY_WARNING", "")
+	t.Setenv("LOBBY_MIN_PLAYERS", "")
+	t.Setenv("AUTO_START_PERCENT", "")
+	t.Setenv("AUTO_START_SECS", "")
+	t.Setenv("LOBBY_IDLE_TIMEOUT", "")
+	t.Setenv("LOBBY_IDLE_ACTION", "")
+	t.Setenv("TICK_RATE", "")
+	t.Setenv("SHUTDOWN_TIMEOUT", "")
+	t.Setenv("SNAPSHOT_FILE", "")
+	t.Setenv("SNAPSHOT_INTERVAL", "")
+	t.Setenv("JOURNAL_DIR", "")
+	t.Setenv("JOURNAL_RETENTION_DAYS", "")
+	t.Setenv("INSTANCE_ID", "")
+	t.Setenv("INSTANCE_URL", "")
+	t.Setenv("ROOM_FORWARD", "")
 
 	cfg := Load()
 
@@ -15,15 +36,80 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.DatabaseURL != "" {
 		t.Errorf("DatabaseURL = %q, want %q", cfg.DatabaseURL, "")
 	}
+	if cfg.SQLitePath != "" {
+		t.Errorf("SQLitePath = %q, want %q", cfg.SQLitePath, "")
+	}
+	if cfg.ClickSpoolFile != "clicks.spool" {
+		t.Errorf("ClickSpoolFile = %q, want %q", cfg.ClickSpoolFile, "clicks.spool")
+	}
+	if cfg.ClickKeyDays != 7 {
+		t.Errorf("ClickKeyDays = %d, want %d", cfg.ClickKeyDays, 7)
+	}
 	if cfg.RoundDuration != 60 {
 		t.Errorf("RoundDuration = %d, want %d", cfg.RoundDuration, 60)
 	}
+	if cfg.LateJoinPolicy != "normal" {
+		t.Errorf("LateJoinPolicy = %q, want %q", cfg.LateJoinPolicy, "normal")
+	}
+	if cfg.PresenceGrace != 30 {
+		t.Errorf("PresenceGrace = %d, want %d", cfg.PresenceGrace, 30)
+	}
+	if cfg.RoomIdleTTL != 60 {
+		t.Errorf("RoomIdleTTL = %d, want %d", cfg.RoomIdleTTL, 60)
+	}
+	if cfg.RoomExpiryWarn != 120 {
+		t.Errorf("RoomExpiryWarn = %d, want %d", cfg.RoomExpiryWarn, 120)
+	}
+	if cfg.LobbyMinPlayers != 1 {
+		t.Errorf("LobbyMinPlayers = %d, want %d", cfg.LobbyMinPlayers, 1)
+	}
+	if cfg.AutoStartPercent != 75 {
+		t.Errorf("AutoStartPercent = %d, want %d", cfg.AutoStartPercent, 75)
+	}
+	if cfg.AutoStartSecs != 10 {
+		t.Errorf("AutoStartSecs = %d, want %d", cfg.AutoStartSecs, 10)
+	}
+	if cfg.LobbyIdleTimeout != 120 {
+		t.Errorf("LobbyIdleTimeout = %d, want %d", cfg.LobbyIdleTimeout, 120)
+	}
+	if cfg.LobbyIdleAction != "spectate" {
+		t.Errorf("LobbyIdleAction = %q, want %q", cfg.LobbyIdleAction, "spectate")
+	}
+	if cfg.TickRate != 20 {
+		t.Errorf("TickRate = %d, want %d", cfg.TickRate, 20)
+	}
+	if cfg.ShutdownSecs != 15 {
+		t.Errorf("ShutdownSecs = %d, want %d", cfg.ShutdownSecs, 15)
+	}
+	if cfg.SnapshotFile != "" {
+		t.Errorf("SnapshotFile = %q, want %q", cfg.SnapshotFile, "")
+	}
+	if cfg.SnapshotSecs != 30 {
+		t.Errorf("SnapshotSecs = %d, want %d", cfg.SnapshotSecs, 30)
+	}
+	if cfg.JournalDir != "" {
+		t.Errorf("JournalDir = %q, want %q", cfg.JournalDir, "")
+	}
+	if cfg.JournalDays != 30 {
+		t.Errorf("JournalDays = %d, want %d", cfg.JournalDays, 30)
+	}
+	if cfg.InstanceID == "" {
+		t.Error("InstanceID should default to the hostname")
+	}
+	if cfg.InstanceURL != "" {
+		t.Errorf("InstanceURL = %q, want %q", cfg.InstanceURL, "")
+	}
+	if cfg.RoomForward != "proxy" {
+		t.Errorf("RoomForward = %q, want %q", cfg.RoomForward, "proxy")
+	}
 }
 
 func TestLoad_CustomValues(t *testing.T) {
 	t.Setenv("PORT", "3000")
 	t.Setenv("DATABASE_URL", "postgres://localhost/clicktrainer")
 	t.Setenv("ROUND_DURATION", "30")
+	t.Setenv("LATE_JOIN_POLICY", "spectate")
+	t.Setenv("PRESENCE_GRACE", "10")
 
 	cfg := Load()
 
@@ -36,6 +122,12 @@ func TestLoad_CustomValues(t *testing.T) {
 	if cfg.RoundDuration != 30 {
 		t.Errorf("RoundDuration = %d, want %d", cfg.RoundDuration, 30)
 	}
+	if cfg.LateJoinPolicy != "spectate" {
+		t.Errorf("LateJoinPolicy = %q, want %q", cfg.LateJoinPolicy, "spectate")
+	}
+	if cfg.PresenceGrace != 10 {
+		t.Errorf("PresenceGrace = %d, want %d", cfg.PresenceGrace, 10)
+	}
 }
 
 func TestLoad_InvalidRoundDuration(t *testing.T) {
@@ -1,9 +1,30 @@
 package db
 
-import "fmt"
+import (
+	"database/sql"
+	"fmt"
+)
 
 func (d *DB) AwardBadge(playerID, badgeID string, gameID *string) error {
-	_, err := d.conn.Exec(`
+	return awardBadge(d.conn, playerID, badgeID, gameID)
+}
+
+func (d *DB) GetPlayerBadges(playerID string) ([]string, error) {
+	return getPlayerBadges(d.conn, playerID)
+}
+
+func (s *SQLite) AwardBadge(playerID, badgeID string, gameID *string) error {
+	return awardBadge(s.conn, playerID, badgeID, gameID)
+}
+
+func (s *SQLite) GetPlayerBadges(playerID string) ([]string, error) {
+	return getPlayerBadges(s.conn, playerID)
+}
+
+// Both backends share the SQL for badges.
+
+func awardBadge(conn *sql.DB, playerID, badgeID string, gameID *string) error {
+	_, err := conn.Exec(`
 		INSERT INTO player_badges (player_id, badge_id, game_id)
 		VALUES ($1, $2, $3)
 		ON CONFLICT (player_id, badge_id) DO NOTHING
@@ -14,8 +35,8 @@ func (d *DB) AwardBadge(playerID, badgeID string, gameID *string) error {
 	return nil
 }
 
-func (d *DB) GetPlayerBadges(playerID string) ([]string, error) {
-	rows, err := d.conn.Query(`
+func getPlayerBadges(conn *sql.DB, playerID string) ([]string, error) {
+	rows, err := conn.Query(`
 		SELECT badge_id FROM player_badges WHERE player_id = $1 ORDER BY awarded_at
 	`, playerID)
 	if err != nil {
@@ -1,10 +1,20 @@
 package db
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
+// ErrRejected wraps errors recording clicks that retrying won't fix, such as
+// a click for a game or player the database doesn't have.
+var ErrRejected = errors.New("clicks rejected")
+
 type ClickEvent struct {
 	GameID     string
 	PlayerID   string
@@ -19,23 +29,73 @@ type ClickEvent struct {
 }
 
 func (d *DB) RecordClick(ev ClickEvent) error {
-	_, err := d.conn.Exec(`
-		INSERT INTO click_events (game_id, player_id, target_id, points, target_size, target_x, target_y, spawned_at, clicked_at, reaction_ms)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-	`, ev.GameID, ev.PlayerID, ev.TargetID, ev.Points, ev.TargetSize, ev.TargetX, ev.TargetY, ev.SpawnedAt, ev.ClickedAt, ev.ReactionMs)
-	if err != nil {
-		return fmt.Errorf("recording click: %w", err)
-	}
-	return nil
+	return batchRecordClicks(d.conn, "", []ClickEvent{ev}, "recording click")
 }
 
 func (d *DB) BatchRecordClicks(events []ClickEvent) error {
-	tx, err := d.conn.Begin()
+	return batchRecordClicks(d.conn, "", events, "recording click in batch")
+}
+
+// RecordClickBatch records events once per key: a batch whose key has
+// been recorded before is skipped, so retrying a write that may have
+// landed is safe.
+func (d *DB) RecordClickBatch(key string, events []ClickEvent) error {
+	return batchRecordClicks(d.conn, key, events, "recording click in batch")
+}
+
+func (d *DB) PruneClickBatches(cutoff time.Time) (int, error) {
+	return pruneClickBatches(d.conn, cutoff)
+}
+
+func (s *SQLite) RecordClick(ev ClickEvent) error {
+	return batchRecordClicks(s.conn, "", utcClicks([]ClickEvent{ev}), "recording click")
+}
+
+func (s *SQLite) BatchRecordClicks(events []ClickEvent) error {
+	return batchRecordClicks(s.conn, "", utcClicks(events), "recording click in batch")
+}
+
+func (s *SQLite) RecordClickBatch(key string, events []ClickEvent) error {
+	return batchRecordClicks(s.conn, key, utcClicks(events), "recording click in batch")
+}
+
+// PruneClickBatches compares written_at as text, so cutoff is written the
+// way the column's default writes it.
+func (s *SQLite) PruneClickBatches(cutoff time.Time) (int, error) {
+	return pruneClickBatches(s.conn, cutoff.UTC().Format("2006-01-02 15:04:05.000+00:00"))
+}
+
+// utcClicks returns events with their times in UTC, for SQLite.
+func utcClicks(events []ClickEvent) []ClickEvent {
+	out := make([]ClickEvent, len(events))
+	for i, ev := range events {
+		ev.SpawnedAt = ev.SpawnedAt.UTC()
+		ev.ClickedAt = ev.ClickedAt.UTC()
+		out[i] = ev
+	}
+	return out
+}
+
+// batchRecordClicks inserts events in one transaction, unless key is set
+// and already recorded. Both backends share the SQL; what is a prefix for
+// the error of a failed insert.
+func batchRecordClicks(conn *sql.DB, key string, events []ClickEvent, what string) error {
+	tx, err := conn.Begin()
 	if err != nil {
 		return fmt.Errorf("beginning transaction: %w", err)
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	if key != "" {
+		res, err := tx.Exec(`INSERT INTO click_batches (key) VALUES ($1) ON CONFLICT (key) DO NOTHING`, key)
+		if err != nil {
+			return fmt.Errorf("recording click batch key: %w", err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return nil // written before
+		}
+	}
+
 	stmt, err := tx.Prepare(`
 		INSERT INTO click_events (game_id, player_id, target_id, points, target_size, target_x, target_y, spawned_at, clicked_at, reaction_ms)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
@@ -47,9 +107,46 @@ func (d *DB) BatchRecordClicks(events []ClickEvent) error {
 
 	for _, ev := range events {
 		if _, err := stmt.Exec(ev.GameID, ev.PlayerID, ev.TargetID, ev.Points, ev.TargetSize, ev.TargetX, ev.TargetY, ev.SpawnedAt, ev.ClickedAt, ev.ReactionMs); err != nil {
-			return fmt.Errorf("recording click in batch: %w", err)
+			return rejected(fmt.Errorf("%s: %w", what, err))
 		}
 	}
 
-	return tx.Commit()
+	return rejected(tx.Commit())
+}
+
+func pruneClickBatches(conn *sql.DB, cutoff any) (int, error) {
+	res, err := conn.Exec(`DELETE FROM click_batches WHERE written_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("pruning click batch keys: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("pruning click batch keys: %w", err)
+	}
+	return int(n), nil
+}
+
+// rejected wraps err in ErrRejected if the database refused the data itself,
+// for a constraint it breaks or a value it can't store, rather than failing
+// to take it.
+func rejected(err error) error {
+	if err == nil {
+		return nil
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "22", "23": // data exception, integrity constraint violation
+			return fmt.Errorf("%w: %w", ErrRejected, err)
+		}
+		return err
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff { // the primary code of an extended one
+		case sqlite3.SQLITE_CONSTRAINT, sqlite3.SQLITE_MISMATCH, sqlite3.SQLITE_TOOBIG:
+			return fmt.Errorf("%w: %w", ErrRejected, err)
+		}
+	}
+	return err
 }
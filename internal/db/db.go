@@ -12,6 +12,8 @@ import (
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
+// DB is the PostgreSQL Store. Features that only run on PostgreSQL, such as
+// webhooks and the room directory, use it directly.
 type DB struct {
 	conn *sql.DB
 }
@@ -22,6 +24,7 @@ func Connect(dsn string) (*DB, error) {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
 	if err := conn.Ping(); err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("pinging database: %w", err)
 	}
 	slog.Info("connected to PostgreSQL", "component", "db")
@@ -36,6 +39,10 @@ func (d *DB) Ping() error {
 	return d.conn.Ping()
 }
 
+func (d *DB) Dialect() Dialect {
+	return DialectPostgres
+}
+
 func (d *DB) QueryRow(query string, args ...any) *sql.Row {
 	return d.conn.QueryRow(query, args...)
 }
@@ -47,22 +54,3 @@ func (d *DB) Query(query string, args ...any) (*sql.Rows, error) {
 func (d *DB) Exec(query string, args ...any) (sql.Result, error) {
 	return d.conn.Exec(query, args...)
 }
-
-func (d *DB) Migrate() error {
-	entries, err := migrationsFS.ReadDir("migrations")
-	if err != nil {
-		return fmt.Errorf("reading migrations dir: %w", err)
-	}
-
-	for _, entry := range entries {
-		content, err := migrationsFS.ReadFile("migrations/" + entry.Name())
-		if err != nil {
-			return fmt.Errorf("reading migration %s: %w", entry.Name(), err)
-		}
-		if _, err := d.conn.Exec(string(content)); err != nil {
-			return fmt.Errorf("executing migration %s: %w", entry.Name(), err)
-		}
-		slog.Info("applied migration", "component", "db", "migration", entry.Name())
-	}
-	return nil
-}
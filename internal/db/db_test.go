@@ -1,11 +1,33 @@
 package db
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
 
+// eachStore runs a test against every backend: SQLite always, and
+// PostgreSQL when TEST_DATABASE_URL is set.
+func eachStore(t *testing.T, test func(t *testing.T, database Store)) {
+	t.Run("sqlite", func(t *testing.T) { test(t, getTestSQLite(t)) })
+	t.Run("postgres", func(t *testing.T) { test(t, getTestDB(t)) })
+}
+
+func getTestSQLite(t *testing.T) *SQLite {
+	t.Helper()
+	database, err := OpenSQLite(filepath.Join(t.TempDir(), "clicktrainer.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite() error: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate() error: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
 func getTestDB(t *testing.T) *DB {
 	t.Helper()
 	dsn := os.Getenv("TEST_DATABASE_URL")
@@ -22,6 +44,8 @@ func getTestDB(t *testing.T) *DB {
 	t.Cleanup(func() {
 		// Clean up test data; errors here are intentionally ignored.
 		_, _ = database.conn.Exec("DELETE FROM click_events")
+		_, _ = database.conn.Exec("DELETE FROM player_badges")
+		_, _ = database.conn.Exec("DELETE FROM click_batches")
 		_, _ = database.conn.Exec("DELETE FROM game_players")
 		_, _ = database.conn.Exec("DELETE FROM games")
 		_, _ = database.conn.Exec("DELETE FROM players")
@@ -31,10 +55,11 @@ func getTestDB(t *testing.T) *DB {
 }
 
 func TestConnect(t *testing.T) {
-	database := getTestDB(t)
-	if err := database.Ping(); err != nil {
-		t.Errorf("Ping() error: %v", err)
-	}
+	eachStore(t, func(t *testing.T, database Store) {
+		if err := database.Ping(); err != nil {
+			t.Errorf("Ping() error: %v", err)
+		}
+	})
 }
 
 func TestMigrate(t *testing.T) {
@@ -56,166 +81,349 @@ func TestMigrate(t *testing.T) {
 	}
 }
 
-func TestUpsertPlayer(t *testing.T) {
-	database := getTestDB(t)
+func TestMigrate_SQLite(t *testing.T) {
+	database := getTestSQLite(t)
 
-	id := "550e8400-e29b-41d4-a716-446655440000"
-	err := database.UpsertPlayer(id, "Alice", "#ff0000")
-	if err != nil {
-		t.Fatalf("UpsertPlayer() error: %v", err)
+	// Migrating an up-to-date database changes nothing.
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("second Migrate() error: %v", err)
 	}
-
-	// Upsert again with different data
-	err = database.UpsertPlayer(id, "Alice Updated", "#00ff00")
-	if err != nil {
-		t.Fatalf("UpsertPlayer() update error: %v", err)
+	tables := []string{"players", "games", "game_players", "click_events", "player_badges"}
+	for _, table := range tables {
+		var exists bool
+		err := database.conn.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = $1)
+		`, table).Scan(&exists)
+		if err != nil {
+			t.Errorf("checking table %s: %v", table, err)
+		}
+		if !exists {
+			t.Errorf("table %s does not exist", table)
+		}
 	}
+}
 
-	p, err := database.GetPlayer(id)
-	if err != nil {
-		t.Fatalf("GetPlayer() error: %v", err)
-	}
-	if p.Name != "Alice Updated" {
-		t.Errorf("name = %q, want %q", p.Name, "Alice Updated")
-	}
-	if p.Color != "#00ff00" {
-		t.Errorf("color = %q, want %q", p.Color, "#00ff00")
-	}
+func TestUpsertPlayer(t *testing.T) {
+	eachStore(t, func(t *testing.T, database Store) {
+		id := "550e8400-e29b-41d4-a716-446655440000"
+		err := database.UpsertPlayer(id, "Alice", "#ff0000")
+		if err != nil {
+			t.Fatalf("UpsertPlayer() error: %v", err)
+		}
+
+		// Upsert again with different data
+		err = database.UpsertPlayer(id, "Alice Updated", "#00ff00")
+		if err != nil {
+			t.Fatalf("UpsertPlayer() update error: %v", err)
+		}
+
+		p, err := database.GetPlayer(id)
+		if err != nil {
+			t.Fatalf("GetPlayer() error: %v", err)
+		}
+		if p.Name != "Alice Updated" {
+			t.Errorf("name = %q, want %q", p.Name, "Alice Updated")
+		}
+		if p.Color != "#00ff00" {
+			t.Errorf("color = %q, want %q", p.Color, "#00ff00")
+		}
+		if p.CreatedAt.IsZero() {
+			t.Error("created_at should be set")
+		}
+	})
 }
 
 func TestGetPlayer_NotFound(t *testing.T) {
-	database := getTestDB(t)
-
-	_, err := database.GetPlayer("00000000-0000-0000-0000-000000000000")
-	if err == nil {
-		t.Error("GetPlayer() should return error for nonexistent player")
-	}
+	eachStore(t, func(t *testing.T, database Store) {
+		_, err := database.GetPlayer("00000000-0000-0000-0000-000000000000")
+		if err == nil {
+			t.Error("GetPlayer() should return error for nonexistent player")
+		}
+	})
 }
 
 func TestCreateGame(t *testing.T) {
-	database := getTestDB(t)
-
-	// Create a host player first
-	hostID := "550e8400-e29b-41d4-a716-446655440001"
-	if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
-		t.Fatalf("UpsertPlayer: %v", err)
-	}
+	eachStore(t, func(t *testing.T, database Store) {
+		// Create a host player first
+		hostID := "550e8400-e29b-41d4-a716-446655440001"
+		if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
+			t.Fatalf("UpsertPlayer: %v", err)
+		}
 
-	gameID, err := database.CreateGame("ABCD", hostID, 60000)
-	if err != nil {
-		t.Fatalf("CreateGame() error: %v", err)
-	}
-	if gameID == "" {
-		t.Error("CreateGame() returned empty ID")
-	}
+		gameID, err := database.CreateGame("ABCD", hostID, 60000)
+		if err != nil {
+			t.Fatalf("CreateGame() error: %v", err)
+		}
+		if gameID == "" {
+			t.Error("CreateGame() returned empty ID")
+		}
+	})
 }
 
 func TestEndGame(t *testing.T) {
-	database := getTestDB(t)
+	eachStore(t, func(t *testing.T, database Store) {
+		hostID := "550e8400-e29b-41d4-a716-446655440002"
+		if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
+			t.Fatalf("UpsertPlayer: %v", err)
+		}
 
-	hostID := "550e8400-e29b-41d4-a716-446655440002"
-	if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
-		t.Fatalf("UpsertPlayer: %v", err)
-	}
+		gameID, _ := database.CreateGame("EFGH", hostID, 60000)
 
-	gameID, _ := database.CreateGame("EFGH", hostID, 60000)
+		err := database.EndGame(gameID)
+		if err != nil {
+			t.Fatalf("EndGame() error: %v", err)
+		}
 
-	err := database.EndGame(gameID)
-	if err != nil {
-		t.Fatalf("EndGame() error: %v", err)
-	}
+		// Verify ended_at is set
+		var endedAt *time.Time
+		if err := database.QueryRow("SELECT ended_at FROM games WHERE id = $1", gameID).Scan(&endedAt); err != nil {
+			t.Fatalf("querying ended_at: %v", err)
+		}
+		if endedAt == nil {
+			t.Error("ended_at should be set after EndGame()")
+		}
+	})
+}
 
-	// Verify ended_at is set
-	var endedAt *time.Time
-	if err := database.conn.QueryRow("SELECT ended_at FROM games WHERE id = $1", gameID).Scan(&endedAt); err != nil {
-		t.Fatalf("querying ended_at: %v", err)
-	}
-	if endedAt == nil {
-		t.Error("ended_at should be set after EndGame()")
-	}
+func TestSetLayoutSeed(t *testing.T) {
+	eachStore(t, func(t *testing.T, database Store) {
+		hostID := "550e8400-e29b-41d4-a716-446655440009"
+		if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
+			t.Fatalf("UpsertPlayer: %v", err)
+		}
+		gameID, _ := database.CreateGame("SEED", hostID, 60000)
+
+		if err := database.SetLayoutSeed(gameID, -42); err != nil {
+			t.Fatalf("SetLayoutSeed() error: %v", err)
+		}
+		var seed *int64
+		if err := database.QueryRow("SELECT layout_seed FROM games WHERE id = $1", gameID).Scan(&seed); err != nil {
+			t.Fatalf("querying layout_seed: %v", err)
+		}
+		if seed == nil || *seed != -42 {
+			t.Errorf("layout_seed = %v, want -42", seed)
+		}
+	})
 }
 
-func TestAddGamePlayer(t *testing.T) {
-	database := getTestDB(t)
+func TestInterruptGames(t *testing.T) {
+	eachStore(t, func(t *testing.T, database Store) {
+		hostID := "550e8400-e29b-41d4-a716-446655440003"
+		if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
+			t.Fatalf("UpsertPlayer: %v", err)
+		}
+		running, _ := database.CreateGame("IJKL", hostID, 60000)
+		finished, _ := database.CreateGame("MNOP", hostID, 60000)
+		if err := database.EndGame(finished); err != nil {
+			t.Fatalf("EndGame() error: %v", err)
+		}
 
-	hostID := "550e8400-e29b-41d4-a716-446655440003"
-	playerID := "550e8400-e29b-41d4-a716-446655440004"
-	if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
-		t.Fatalf("UpsertPlayer host: %v", err)
-	}
-	if err := database.UpsertPlayer(playerID, "Player", "#ddeeff"); err != nil {
-		t.Fatalf("UpsertPlayer player: %v", err)
-	}
+		if err := database.InterruptGames([]string{running, finished}); err != nil {
+			t.Fatalf("InterruptGames() error: %v", err)
+		}
 
-	gameID, _ := database.CreateGame("IJKL", hostID, 60000)
+		for id, want := range map[string]bool{running: true, finished: false} {
+			var endedAt *time.Time
+			var interrupted bool
+			if err := database.QueryRow("SELECT ended_at, interrupted FROM games WHERE id = $1", id).Scan(&endedAt, &interrupted); err != nil {
+				t.Fatalf("querying game: %v", err)
+			}
+			if endedAt == nil || interrupted != want {
+				t.Errorf("game %s: ended_at = %v, interrupted = %v, want ended and interrupted = %v", id, endedAt, interrupted, want)
+			}
+		}
+	})
+}
 
-	err := database.AddGamePlayer(gameID, playerID, 150, 1)
-	if err != nil {
-		t.Fatalf("AddGamePlayer() error: %v", err)
-	}
+func TestAddGamePlayer(t *testing.T) {
+	eachStore(t, func(t *testing.T, database Store) {
+		hostID := "550e8400-e29b-41d4-a716-446655440003"
+		playerID := "550e8400-e29b-41d4-a716-446655440004"
+		if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
+			t.Fatalf("UpsertPlayer host: %v", err)
+		}
+		if err := database.UpsertPlayer(playerID, "Player", "#ddeeff"); err != nil {
+			t.Fatalf("UpsertPlayer player: %v", err)
+		}
 
-	// Upsert should work
-	err = database.AddGamePlayer(gameID, playerID, 200, 1)
-	if err != nil {
-		t.Fatalf("AddGamePlayer() upsert error: %v", err)
-	}
+		gameID, _ := database.CreateGame("IJKL", hostID, 60000)
+
+		err := database.AddGamePlayer(gameID, playerID, 150, 1, "")
+		if err != nil {
+			t.Fatalf("AddGamePlayer() error: %v", err)
+		}
+
+		// Upsert should work
+		err = database.AddGamePlayer(gameID, playerID, 200, 1, "handicap")
+		if err != nil {
+			t.Fatalf("AddGamePlayer() upsert error: %v", err)
+		}
+	})
 }
 
 func TestRecordClick(t *testing.T) {
-	database := getTestDB(t)
-
-	hostID := "550e8400-e29b-41d4-a716-446655440005"
-	if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
-		t.Fatalf("UpsertPlayer: %v", err)
-	}
+	eachStore(t, func(t *testing.T, database Store) {
+		hostID := "550e8400-e29b-41d4-a716-446655440005"
+		if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
+			t.Fatalf("UpsertPlayer: %v", err)
+		}
 
-	gameID, _ := database.CreateGame("MNOP", hostID, 60000)
-
-	now := time.Now()
-	err := database.RecordClick(ClickEvent{
-		GameID:     gameID,
-		PlayerID:   hostID,
-		TargetID:   1,
-		Points:     3,
-		TargetSize: 75,
-		TargetX:    100,
-		TargetY:    200,
-		SpawnedAt:  now.Add(-500 * time.Millisecond),
-		ClickedAt:  now,
-		ReactionMs: 500,
+		gameID, _ := database.CreateGame("MNOP", hostID, 60000)
+
+		now := time.Now()
+		err := database.RecordClick(ClickEvent{
+			GameID:     gameID,
+			PlayerID:   hostID,
+			TargetID:   1,
+			Points:     3,
+			TargetSize: 75,
+			TargetX:    100,
+			TargetY:    200,
+			SpawnedAt:  now.Add(-500 * time.Millisecond),
+			ClickedAt:  now,
+			ReactionMs: 500,
+		})
+		if err != nil {
+			t.Fatalf("RecordClick() error: %v", err)
+		}
 	})
-	if err != nil {
-		t.Fatalf("RecordClick() error: %v", err)
-	}
 }
 
 func TestBatchRecordClicks(t *testing.T) {
-	database := getTestDB(t)
+	eachStore(t, func(t *testing.T, database Store) {
+		hostID := "550e8400-e29b-41d4-a716-446655440006"
+		if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
+			t.Fatalf("UpsertPlayer: %v", err)
+		}
 
-	hostID := "550e8400-e29b-41d4-a716-446655440006"
-	if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
-		t.Fatalf("UpsertPlayer: %v", err)
-	}
+		gameID, _ := database.CreateGame("QRST", hostID, 60000)
 
-	gameID, _ := database.CreateGame("QRST", hostID, 60000)
+		now := time.Now()
+		events := []ClickEvent{
+			{GameID: gameID, PlayerID: hostID, TargetID: 1, Points: 1, TargetSize: 50, TargetX: 10, TargetY: 20, SpawnedAt: now, ClickedAt: now, ReactionMs: 100},
+			{GameID: gameID, PlayerID: hostID, TargetID: 2, Points: 4, TargetSize: 80, TargetX: 300, TargetY: 200, SpawnedAt: now, ClickedAt: now, ReactionMs: 200},
+			{GameID: gameID, PlayerID: hostID, TargetID: 3, Points: 2, TargetSize: 60, TargetX: 500, TargetY: 350, SpawnedAt: now, ClickedAt: now, ReactionMs: 150},
+		}
 
-	now := time.Now()
-	events := []ClickEvent{
-		{GameID: gameID, PlayerID: hostID, TargetID: 1, Points: 1, TargetSize: 50, TargetX: 10, TargetY: 20, SpawnedAt: now, ClickedAt: now, ReactionMs: 100},
-		{GameID: gameID, PlayerID: hostID, TargetID: 2, Points: 4, TargetSize: 80, TargetX: 300, TargetY: 200, SpawnedAt: now, ClickedAt: now, ReactionMs: 200},
-		{GameID: gameID, PlayerID: hostID, TargetID: 3, Points: 2, TargetSize: 60, TargetX: 500, TargetY: 350, SpawnedAt: now, ClickedAt: now, ReactionMs: 150},
-	}
+		err := database.BatchRecordClicks(events)
+		if err != nil {
+			t.Fatalf("BatchRecordClicks() error: %v", err)
+		}
 
-	err := database.BatchRecordClicks(events)
-	if err != nil {
-		t.Fatalf("BatchRecordClicks() error: %v", err)
-	}
+		var count int
+		if err := database.QueryRow("SELECT COUNT(*) FROM click_events WHERE game_id = $1", gameID).Scan(&count); err != nil {
+			t.Fatalf("querying click count: %v", err)
+		}
+		if count != 3 {
+			t.Errorf("click count = %d, want 3", count)
+		}
+	})
+}
 
-	var count int
-	if err := database.conn.QueryRow("SELECT COUNT(*) FROM click_events WHERE game_id = $1", gameID).Scan(&count); err != nil {
-		t.Fatalf("querying click count: %v", err)
-	}
-	if count != 3 {
-		t.Errorf("click count = %d, want 3", count)
-	}
+func TestRecordClickBatch_Idempotent(t *testing.T) {
+	eachStore(t, func(t *testing.T, database Store) {
+		hostID := "550e8400-e29b-41d4-a716-446655440008"
+		if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
+			t.Fatalf("UpsertPlayer: %v", err)
+		}
+		gameID, _ := database.CreateGame("YZAB", hostID, 60000)
+
+		now := time.Now()
+		events := []ClickEvent{
+			{GameID: gameID, PlayerID: hostID, TargetID: 1, Points: 1, TargetSize: 50, TargetX: 10, TargetY: 20, SpawnedAt: now, ClickedAt: now, ReactionMs: 100},
+			{GameID: gameID, PlayerID: hostID, TargetID: 2, Points: 4, TargetSize: 80, TargetX: 300, TargetY: 200, SpawnedAt: now, ClickedAt: now, ReactionMs: 200},
+		}
+		// The second write of a key is a retry whose first write landed.
+		for _, key := range []string{"batch-1", "batch-1", "batch-2"} {
+			if err := database.RecordClickBatch(key, events); err != nil {
+				t.Fatalf("RecordClickBatch(%q) error: %v", key, err)
+			}
+		}
+
+		var count int
+		if err := database.QueryRow("SELECT COUNT(*) FROM click_events WHERE game_id = $1", gameID).Scan(&count); err != nil {
+			t.Fatalf("querying click count: %v", err)
+		}
+		if count != 4 {
+			t.Errorf("click count = %d, want 4 from two distinct batches", count)
+		}
+	})
+}
+
+func TestPruneClickBatches(t *testing.T) {
+	eachStore(t, func(t *testing.T, database Store) {
+		hostID := "550e8400-e29b-41d4-a716-44665544000a"
+		if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
+			t.Fatalf("UpsertPlayer: %v", err)
+		}
+		gameID, _ := database.CreateGame("CDEF", hostID, 60000)
+		now := time.Now()
+		events := []ClickEvent{{GameID: gameID, PlayerID: hostID, TargetID: 1, Points: 1, SpawnedAt: now, ClickedAt: now}}
+		if err := database.RecordClickBatch("batch-pruned", events); err != nil {
+			t.Fatalf("RecordClickBatch() error: %v", err)
+		}
+
+		if n, err := database.PruneClickBatches(now.Add(-time.Hour)); err != nil || n != 0 {
+			t.Errorf("PruneClickBatches() before the write = %d, %v; want none pruned", n, err)
+		}
+		if n, err := database.PruneClickBatches(now.Add(time.Hour)); err != nil || n != 1 {
+			t.Errorf("PruneClickBatches() after the write = %d, %v; want 1 pruned", n, err)
+		}
+
+		// Once its key is pruned, the batch would be recorded again.
+		if err := database.RecordClickBatch("batch-pruned", events); err != nil {
+			t.Fatalf("RecordClickBatch() error: %v", err)
+		}
+		var count int
+		if err := database.QueryRow("SELECT COUNT(*) FROM click_events WHERE game_id = $1", gameID).Scan(&count); err != nil {
+			t.Fatalf("querying click count: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("click count = %d, want 2", count)
+		}
+	})
+}
+
+func TestRecordClickBatch_RejectsUnknownGame(t *testing.T) {
+	eachStore(t, func(t *testing.T, database Store) {
+		hostID := "550e8400-e29b-41d4-a716-446655440009"
+		if err := database.UpsertPlayer(hostID, "Host", "#aabbcc"); err != nil {
+			t.Fatalf("UpsertPlayer: %v", err)
+		}
+		now := time.Now()
+		events := []ClickEvent{{GameID: "550e8400-e29b-41d4-a716-4466554400ff", PlayerID: hostID, TargetID: 1, Points: 1, SpawnedAt: now, ClickedAt: now}}
+
+		if err := database.RecordClickBatch("batch-unknown-game", events); !errors.Is(err, ErrRejected) {
+			t.Errorf("RecordClickBatch() for an unknown game error = %v, want ErrRejected", err)
+		}
+	})
+}
+
+func TestAwardBadge(t *testing.T) {
+	eachStore(t, func(t *testing.T, database Store) {
+		playerID := "550e8400-e29b-41d4-a716-446655440007"
+		if err := database.UpsertPlayer(playerID, "Player", "#ddeeff"); err != nil {
+			t.Fatalf("UpsertPlayer: %v", err)
+		}
+		gameID, _ := database.CreateGame("UVWX", playerID, 60000)
+
+		if err := database.AwardBadge(playerID, "sharpshooter", &gameID); err != nil {
+			t.Fatalf("AwardBadge() error: %v", err)
+		}
+		if err := database.AwardBadge(playerID, "veteran", nil); err != nil {
+			t.Fatalf("AwardBadge() without game error: %v", err)
+		}
+		// A badge is only awarded once.
+		if err := database.AwardBadge(playerID, "sharpshooter", nil); err != nil {
+			t.Fatalf("AwardBadge() again error: %v", err)
+		}
+
+		badges, err := database.GetPlayerBadges(playerID)
+		if err != nil {
+			t.Fatalf("GetPlayerBadges() error: %v", err)
+		}
+		if len(badges) != 2 || badges[0] != "sharpshooter" || badges[1] != "veteran" {
+			t.Errorf("badges = %v, want [sharpshooter veteran]", badges)
+		}
+	})
 }
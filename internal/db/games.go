@@ -1,8 +1,13 @@
 package db
 
 import (
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type GameRecord struct {
@@ -28,6 +33,17 @@ func (d *DB) CreateGame(roomCode, hostID string, roundDurationMs int) (string, e
 	return id, nil
 }
 
+// SetLayoutSeed records the seed the game's targets were placed from.
+func (d *DB) SetLayoutSeed(gameID string, seed int64) error {
+	_, err := d.conn.Exec(`
+		UPDATE games SET layout_seed = $2 WHERE id = $1
+	`, gameID, seed)
+	if err != nil {
+		return fmt.Errorf("setting layout seed: %w", err)
+	}
+	return nil
+}
+
 func (d *DB) EndGame(gameID string) error {
 	_, err := d.conn.Exec(`
 		UPDATE games SET ended_at = now() WHERE id = $1
@@ -38,12 +54,96 @@ func (d *DB) EndGame(gameID string) error {
 	return nil
 }
 
-func (d *DB) AddGamePlayer(gameID, playerID string, finalScore, rank int) error {
+// InterruptGames ends games that were still in progress when the server
+// stopped, marking them interrupted. Games that already ended are left
+// alone.
+func (d *DB) InterruptGames(gameIDs []string) error {
+	if len(gameIDs) == 0 {
+		return nil
+	}
 	_, err := d.conn.Exec(`
-		INSERT INTO game_players (game_id, player_id, final_score, rank)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (game_id, player_id) DO UPDATE SET final_score = $3, rank = $4
-	`, gameID, playerID, finalScore, rank)
+		UPDATE games SET ended_at = now(), interrupted = true
+		WHERE id = ANY($1) AND ended_at IS NULL
+	`, pq.Array(gameIDs))
+	if err != nil {
+		return fmt.Errorf("interrupting games: %w", err)
+	}
+	return nil
+}
+
+// AddGamePlayer records a player's result. lateJoinPolicy is the policy
+// applied to a player who joined mid-round, or empty if they joined on time.
+// A rank of 0 is no placement, for a spectator.
+func (d *DB) AddGamePlayer(gameID, playerID string, finalScore, rank int, lateJoinPolicy string) error {
+	return addGamePlayer(d.conn, gameID, playerID, finalScore, rank, lateJoinPolicy)
+}
+
+func (s *SQLite) CreateGame(roomCode, hostID string, roundDurationMs int) (string, error) {
+	id := uuid.NewString()
+	_, err := s.conn.Exec(`
+		INSERT INTO games (id, room_code, host_id, round_duration_ms, started_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, id, roomCode, hostID, roundDurationMs, sqliteNow())
+	if err != nil {
+		return "", fmt.Errorf("creating game: %w", err)
+	}
+	return id, nil
+}
+
+func (s *SQLite) SetLayoutSeed(gameID string, seed int64) error {
+	_, err := s.conn.Exec(`
+		UPDATE games SET layout_seed = $2 WHERE id = $1
+	`, gameID, seed)
+	if err != nil {
+		return fmt.Errorf("setting layout seed: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) EndGame(gameID string) error {
+	_, err := s.conn.Exec(`
+		UPDATE games SET ended_at = $2 WHERE id = $1
+	`, gameID, sqliteNow())
+	if err != nil {
+		return fmt.Errorf("ending game: %w", err)
+	}
+	return nil
+}
+
+// InterruptGames passes the IDs as a JSON array, for want of SQL arrays.
+func (s *SQLite) InterruptGames(gameIDs []string) error {
+	if len(gameIDs) == 0 {
+		return nil
+	}
+	ids, err := json.Marshal(gameIDs)
+	if err != nil {
+		return fmt.Errorf("interrupting games: %w", err)
+	}
+	_, err = s.conn.Exec(`
+		UPDATE games SET ended_at = $1, interrupted = true
+		WHERE id IN (SELECT value FROM json_each($2)) AND ended_at IS NULL
+	`, sqliteNow(), string(ids))
+	if err != nil {
+		return fmt.Errorf("interrupting games: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) AddGamePlayer(gameID, playerID string, finalScore, rank int, lateJoinPolicy string) error {
+	return addGamePlayer(s.conn, gameID, playerID, finalScore, rank, lateJoinPolicy)
+}
+
+// Both backends share the SQL for game results.
+func addGamePlayer(conn *sql.DB, gameID, playerID string, finalScore, rank int, lateJoinPolicy string) error {
+	var policy *string
+	if lateJoinPolicy != "" {
+		policy = &lateJoinPolicy
+	}
+	_, err := conn.Exec(`
+		INSERT INTO game_players (game_id, player_id, final_score, rank, late_join_policy)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (game_id, player_id) DO UPDATE SET final_score = $3, rank = $4, late_join_policy = $5
+	`, gameID, playerID, finalScore, rank, policy)
 	if err != nil {
 		return fmt.Errorf("adding game player: %w", err)
 	}
@@ -0,0 +1,361 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMigrationModified is returned when a migration's file no longer matches
+// what was applied. Applied migrations must not be edited; add a new one.
+var ErrMigrationModified = errors.New("applied migration has been modified")
+
+// ErrIrreversible is returned by Down for a migration without a down file.
+var ErrIrreversible = errors.New("migration has no down file")
+
+// migrationLockKey is the Postgres advisory lock held while migrating, so
+// instances starting together take turns.
+const migrationLockKey = 72_616_001
+
+// migrationFile matches NNN_name.sql and NNN_name.down.sql.
+var migrationFile = regexp.MustCompile(`^(\d+)_(.+?)(\.down)?\.sql$`)
+
+// Migration is one numbered change to the schema. Down undoes Up, or is
+// empty if it can't be undone.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // of Up
+}
+
+// MigrationStatus is a migration and whether it has been applied. A
+// migration applied by a newer build has no Up or Down here.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+	Modified  bool // applied from a different file
+	Unknown   bool // applied, but not in this build
+}
+
+// Migrator applies numbered migrations in order, recording each in
+// schema_migrations with a checksum. Each migration runs in a transaction
+// along with its record, so it applies completely or not at all.
+type Migrator struct {
+	conn       *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+func (d *DB) Migrator() (*Migrator, error) {
+	return newMigrator(d.conn, DialectPostgres, migrationsFS, "migrations")
+}
+
+func (s *SQLite) Migrator() (*Migrator, error) {
+	return newMigrator(s.conn, DialectSQLite, sqliteMigrationsFS, "migrations_sqlite")
+}
+
+// Migrate applies the migrations not yet applied.
+func (d *DB) Migrate() error {
+	m, err := d.Migrator()
+	if err != nil {
+		return err
+	}
+	return m.Up()
+}
+
+func (s *SQLite) Migrate() error {
+	m, err := s.Migrator()
+	if err != nil {
+		return err
+	}
+	return m.Up()
+}
+
+func newMigrator(conn *sql.DB, dialect Dialect, fsys fs.FS, dir string) (*Migrator, error) {
+	migrations, err := loadMigrations(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{conn: conn, dialect: dialect, migrations: migrations}, nil
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations dir: %w", err)
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %s: %w", entry.Name(), err)
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] != "" {
+			m.Down = string(content)
+		} else {
+			m.Up = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has a down file but no up file", m.Version, m.Name)
+		}
+		m.Checksum = checksum(m.Up)
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// checksum ignores carriage returns, so a checkout's line endings don't
+// count as an edit.
+func checksum(sql string) string {
+	sum := sha256.Sum256([]byte(strings.ReplaceAll(sql, "\r", "")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Migration) label() string {
+	return fmt.Sprintf("%03d_%s", m.Version, m.Name)
+}
+
+// Up applies the migrations not yet applied, in order. It refuses to start
+// if an applied migration has been modified.
+func (m *Migrator) Up() error {
+	return m.locked(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if rec, ok := applied[mig.Version]; ok && rec.Checksum != mig.Checksum {
+				return fmt.Errorf("%w: %s", ErrMigrationModified, mig.label())
+			}
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			raced := false
+			err := m.inTx(ctx, conn, func(tx *sql.Tx) error {
+				if done, err := isApplied(ctx, tx, mig.Version); err != nil || done {
+					raced = done
+					return err
+				}
+				if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, `
+					INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)
+				`, mig.Version, mig.Name, mig.Checksum, time.Now().UTC())
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("applying migration %s: %w", mig.label(), err)
+			}
+			if raced {
+				continue
+			}
+			slog.Info("applied migration", "component", "db", "migration", mig.label())
+		}
+		return nil
+	})
+}
+
+// Down undoes the latest steps applied migrations, newest first.
+func (m *Migrator) Down(steps int) error {
+	return m.locked(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for _, v := range versions[:max(0, min(steps, len(versions)))] {
+			mig := m.find(v)
+			if mig == nil {
+				return fmt.Errorf("%w: %03d_%s is not in this build", ErrIrreversible, v, applied[v].Name)
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("%w: %s", ErrIrreversible, mig.label())
+			}
+			if applied[v].Checksum != mig.Checksum {
+				return fmt.Errorf("%w: %s", ErrMigrationModified, mig.label())
+			}
+			raced := false
+			err := m.inTx(ctx, conn, func(tx *sql.Tx) error {
+				if done, err := isApplied(ctx, tx, v); err != nil || !done {
+					raced = !done
+					return err
+				}
+				if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, v)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("undoing migration %s: %w", mig.label(), err)
+			}
+			if raced {
+				continue
+			}
+			slog.Info("undid migration", "component", "db", "migration", mig.label())
+		}
+		return nil
+	})
+}
+
+// Status lists every migration this build has or the database has applied,
+// in order.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.locked(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			st := MigrationStatus{Migration: mig}
+			if rec, ok := applied[mig.Version]; ok {
+				st.AppliedAt = &rec.AppliedAt
+				st.Modified = rec.Checksum != mig.Checksum
+				delete(applied, mig.Version)
+			}
+			statuses = append(statuses, st)
+		}
+		for _, rec := range applied {
+			appliedAt := rec.AppliedAt
+			statuses = append(statuses, MigrationStatus{
+				Migration: Migration{Version: rec.Version, Name: rec.Name, Checksum: rec.Checksum},
+				AppliedAt: &appliedAt,
+				Unknown:   true,
+			})
+		}
+		return nil
+	})
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, err
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+type appliedMigration struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("reading applied migrations: %w", err)
+	}
+	defer rows.Close()
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("reading applied migrations: %w", err)
+		}
+		applied[a.Version] = a
+	}
+	return applied, rows.Err()
+}
+
+// locked runs fn on one connection, creating schema_migrations first.
+// Postgres instances take an advisory lock so only one migrates at a time.
+// SQLite has no such lock: each migration rechecks in its transaction, which
+// holds the write lock from BEGIN under _txlock=immediate.
+func (m *Migrator) locked(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("getting connection: %w", err)
+	}
+	defer conn.Close()
+
+	if m.dialect == DialectPostgres {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+			return fmt.Errorf("taking migration lock: %w", err)
+		}
+		defer func() {
+			if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockKey); err != nil {
+				slog.Warn("releasing migration lock failed", "component", "db", "error", err)
+			}
+		}()
+	}
+	timestamp := "TIMESTAMPTZ"
+	if m.dialect == DialectSQLite {
+		timestamp = "TIMESTAMP"
+	}
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at `+timestamp+` NOT NULL
+		)
+	`); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+	return fn(ctx, conn)
+}
+
+// isApplied reports whether a migration is recorded, as seen from tx.
+func isApplied(ctx context.Context, tx *sql.Tx, version int) (bool, error) {
+	var n int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = $1`, version).Scan(&n)
+	return n > 0, err
+}
+
+func (m *Migrator) inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
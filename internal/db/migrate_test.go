@@ -0,0 +1,231 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/001_first.sql":      {Data: []byte("CREATE TABLE a (x INT);\n")},
+		"m/001_first.down.sql": {Data: []byte("DROP TABLE a;\n")},
+		"m/002_second.sql":     {Data: []byte("CREATE TABLE b (x INT);\r\n")},
+		"m/README.md":          {Data: []byte("not a migration")},
+	}
+	migrations, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatalf("loadMigrations() error: %v", err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations, want 2", len(migrations))
+	}
+	first, second := migrations[0], migrations[1]
+	if first.Version != 1 || first.Name != "first" || first.Down != "DROP TABLE a;\n" {
+		t.Errorf("first = %+v, want version 1 with its down file", first)
+	}
+	if second.Version != 2 || second.Name != "second" || second.Down != "" {
+		t.Errorf("second = %+v, want version 2 without a down file", second)
+	}
+	if second.Checksum != checksum("CREATE TABLE b (x INT);\n") {
+		t.Error("checksum should ignore carriage returns")
+	}
+
+	for name, bad := range map[string]fstest.MapFS{
+		"down without up": {"m/001_a.down.sql": {Data: []byte("DROP TABLE a;")}},
+		"two names":       {"m/001_a.sql": {Data: []byte("SELECT 1;")}, "m/001_b.sql": {Data: []byte("SELECT 1;")}},
+	} {
+		if _, err := loadMigrations(bad, "m"); err == nil {
+			t.Errorf("%s: loadMigrations() should fail", name)
+		}
+	}
+}
+
+func TestMigrator_UpAndStatus(t *testing.T) {
+	eachStore(t, func(t *testing.T, database Store) {
+		m, err := database.(interface{ Migrator() (*Migrator, error) }).Migrator()
+		if err != nil {
+			t.Fatalf("Migrator() error: %v", err)
+		}
+		// The test database is already migrated; again changes nothing.
+		if err := m.Up(); err != nil {
+			t.Fatalf("Up() error: %v", err)
+		}
+		statuses, err := m.Status()
+		if err != nil {
+			t.Fatalf("Status() error: %v", err)
+		}
+		if len(statuses) != len(m.migrations) {
+			t.Fatalf("got %d statuses, want %d", len(statuses), len(m.migrations))
+		}
+		for _, st := range statuses {
+			if st.AppliedAt == nil || st.Modified || st.Unknown {
+				t.Errorf("%s: applied %v, modified %v, unknown %v; want applied as is", st.label(), st.AppliedAt, st.Modified, st.Unknown)
+			}
+		}
+	})
+}
+
+// sqliteMigrator returns a migrator for fsys on a fresh SQLite database.
+func sqliteMigrator(t *testing.T, fsys fstest.MapFS) (*SQLite, *Migrator) {
+	t.Helper()
+	database, err := OpenSQLite(filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite() error: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	m, err := newMigrator(database.conn, DialectSQLite, fsys, "m")
+	if err != nil {
+		t.Fatalf("newMigrator() error: %v", err)
+	}
+	return database, m
+}
+
+func tableExists(t *testing.T, database *SQLite, table string) bool {
+	t.Helper()
+	var exists bool
+	err := database.conn.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = $1)
+	`, table).Scan(&exists)
+	if err != nil {
+		t.Fatalf("checking table %s: %v", table, err)
+	}
+	return exists
+}
+
+func TestMigrator_Modified(t *testing.T) {
+	fsys := fstest.MapFS{"m/001_first.sql": {Data: []byte("CREATE TABLE a (x INT);")}}
+	database, m := sqliteMigrator(t, fsys)
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+
+	fsys["m/001_first.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE a (x INT, y INT);")}
+	fsys["m/002_second.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE b (x INT);")}
+	edited, err := newMigrator(database.conn, DialectSQLite, fsys, "m")
+	if err != nil {
+		t.Fatalf("newMigrator() error: %v", err)
+	}
+	if err := edited.Up(); !errors.Is(err, ErrMigrationModified) {
+		t.Fatalf("Up() error = %v, want ErrMigrationModified", err)
+	}
+	if tableExists(t, database, "b") {
+		t.Error("no migration should run once an applied one is found modified")
+	}
+	statuses, err := edited.Status()
+	if err != nil {
+		t.Fatalf("Status() error: %v", err)
+	}
+	if !statuses[0].Modified || statuses[1].AppliedAt != nil {
+		t.Errorf("statuses = %+v, want the first modified and the second pending", statuses)
+	}
+}
+
+func TestMigrator_Down(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/001_first.sql":       {Data: []byte("CREATE TABLE a (x INT);")},
+		"m/002_second.sql":      {Data: []byte("CREATE TABLE b (x INT); ALTER TABLE a ADD COLUMN y INT;")},
+		"m/002_second.down.sql": {Data: []byte("DROP TABLE b; ALTER TABLE a DROP COLUMN y;")},
+	}
+	database, m := sqliteMigrator(t, fsys)
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+
+	if err := m.Down(1); err != nil {
+		t.Fatalf("Down(1) error: %v", err)
+	}
+	if tableExists(t, database, "b") || !tableExists(t, database, "a") {
+		t.Error("Down(1) should undo only the second migration")
+	}
+	statuses, _ := m.Status()
+	if statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Errorf("statuses = %+v, want the second pending again", statuses)
+	}
+
+	if err := m.Down(1); !errors.Is(err, ErrIrreversible) {
+		t.Errorf("Down(1) error = %v, want ErrIrreversible for a migration without a down file", err)
+	}
+	if !tableExists(t, database, "a") {
+		t.Error("an irreversible migration should be left applied")
+	}
+
+	// Up brings the undone migration back.
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up() error: %v", err)
+	}
+	if !tableExists(t, database, "b") {
+		t.Error("Up() should reapply the second migration")
+	}
+}
+
+func TestMigrator_FailedMigrationRollsBack(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/001_first.sql":  {Data: []byte("CREATE TABLE a (x INT);")},
+		"m/002_broken.sql": {Data: []byte("CREATE TABLE b (x INT); INSERT INTO missing VALUES (1);")},
+	}
+	database, m := sqliteMigrator(t, fsys)
+	if err := m.Up(); err == nil {
+		t.Fatal("Up() should fail on the broken migration")
+	}
+	if !tableExists(t, database, "a") {
+		t.Error("the migration before the broken one should stay applied")
+	}
+	if tableExists(t, database, "b") {
+		t.Error("the broken migration should be rolled back entirely")
+	}
+	statuses, _ := m.Status()
+	if statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Errorf("statuses = %+v, want only the first recorded", statuses)
+	}
+}
+
+func TestMigrator_Concurrent(t *testing.T) {
+	// Two handles on one file stand in for two processes starting together.
+	migrateTwice := func(t *testing.T, open func() (interface{ Migrate() error }, func())) {
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i := range errs {
+			database, done := open()
+			defer done()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = database.Migrate()
+			}()
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("Migrate() %d error: %v", i, err)
+			}
+		}
+	}
+
+	t.Run("sqlite", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "concurrent.db")
+		migrateTwice(t, func() (interface{ Migrate() error }, func()) {
+			database, err := OpenSQLite(path)
+			if err != nil {
+				t.Fatalf("OpenSQLite() error: %v", err)
+			}
+			return database, func() { database.Close() }
+		})
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_DATABASE_URL")
+		if dsn == "" {
+			t.Skip("TEST_DATABASE_URL not set, skipping database tests")
+		}
+		migrateTwice(t, func() (interface{ Migrate() error }, func()) {
+			database, err := Connect(dsn)
+			if err != nil {
+				t.Fatalf("Connect() error: %v", err)
+			}
+			return database, func() { database.Close() }
+		})
+	})
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS click_events;
+DROP TABLE IF EXISTS game_players;
+DROP TABLE IF EXISTS games;
+DROP TABLE IF EXISTS players;
@@ -0,0 +1 @@
+ALTER TABLE game_players DROP COLUMN IF EXISTS late_join_policy;
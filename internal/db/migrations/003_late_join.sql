@@ -0,0 +1,2 @@
+-- Late-join policy applied to players who joined mid-round (NULL if on time).
+ALTER TABLE game_players ADD COLUMN IF NOT EXISTS late_join_policy TEXT;
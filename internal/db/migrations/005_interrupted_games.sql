@@ -0,0 +1,3 @@
+-- Games cut short by a server shutdown: ended_at is set but no results
+-- were recorded.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS interrupted BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,7 @@
+-- The latest snapshot of open rooms, restored at startup. There is only
+-- ever one row.
+CREATE TABLE IF NOT EXISTS room_snapshots (
+    id INT PRIMARY KEY CHECK (id = 1),
+    saved_at TIMESTAMPTZ NOT NULL,
+    data JSONB NOT NULL
+);
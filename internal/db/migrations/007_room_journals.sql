@@ -0,0 +1,10 @@
+-- Per-room event journals. Each row is a gzip-compressed chunk of JSON
+-- lines; a journal is its chunks in id order.
+CREATE TABLE IF NOT EXISTS room_journal_chunks (
+    id BIGSERIAL PRIMARY KEY,
+    journal_id TEXT NOT NULL,
+    chunk BYTEA NOT NULL,
+    written_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_journal_chunks_journal ON room_journal_chunks(journal_id, id);
@@ -0,0 +1 @@
+ALTER TABLE games DROP COLUMN IF EXISTS layout_seed;
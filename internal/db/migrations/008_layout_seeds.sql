@@ -0,0 +1,3 @@
+-- The seed each game's targets were placed from, so the layout can be
+-- played again in a ghost race. Games from before seeding have none.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS layout_seed BIGINT;
@@ -0,0 +1,11 @@
+-- Which instance owns each open room code, when several instances share
+-- the database. A claim lapses once its owner stops renewing it.
+CREATE TABLE IF NOT EXISTS room_directory (
+    code TEXT PRIMARY KEY,
+    instance_id TEXT NOT NULL,
+    instance_url TEXT NOT NULL,
+    claimed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    renewed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_directory_instance ON room_directory(instance_id);
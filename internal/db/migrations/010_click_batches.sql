@@ -0,0 +1,6 @@
+-- Keys of the click batches written so far. A batch retried after its
+-- write landed is recognised by its key and not recorded twice.
+CREATE TABLE IF NOT EXISTS click_batches (
+    key TEXT PRIMARY KEY,
+    written_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_click_batches_written_at;
@@ -0,0 +1,3 @@
+-- Keys are pruned by age once no spooled batch can still be retried with
+-- them.
+CREATE INDEX IF NOT EXISTS idx_click_batches_written_at ON click_batches(written_at);
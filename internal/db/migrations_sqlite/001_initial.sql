@@ -0,0 +1,55 @@
+-- The record of play, as the PostgreSQL migrations leave it. Player and game
+-- IDs are UUIDs from the server; times are UTC, written so they sort as text.
+CREATE TABLE IF NOT EXISTS players (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    color TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS games (
+    id TEXT PRIMARY KEY,
+    room_code TEXT NOT NULL,
+    host_id TEXT REFERENCES players(id),
+    started_at TIMESTAMP,
+    ended_at TIMESTAMP,
+    round_duration_ms INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    interrupted BOOLEAN NOT NULL DEFAULT false,
+    layout_seed INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS game_players (
+    game_id TEXT NOT NULL REFERENCES games(id),
+    player_id TEXT NOT NULL REFERENCES players(id),
+    final_score INTEGER NOT NULL DEFAULT 0,
+    rank INTEGER NOT NULL DEFAULT 0,
+    late_join_policy TEXT,
+    PRIMARY KEY (game_id, player_id)
+);
+
+CREATE TABLE IF NOT EXISTS click_events (
+    id INTEGER PRIMARY KEY,
+    game_id TEXT NOT NULL REFERENCES games(id),
+    player_id TEXT NOT NULL REFERENCES players(id),
+    target_id INTEGER NOT NULL,
+    points INTEGER NOT NULL,
+    target_size INTEGER NOT NULL,
+    target_x INTEGER NOT NULL,
+    target_y INTEGER NOT NULL,
+    spawned_at TIMESTAMP NOT NULL,
+    clicked_at TIMESTAMP NOT NULL,
+    reaction_ms INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_click_events_game_id ON click_events(game_id);
+CREATE INDEX IF NOT EXISTS idx_click_events_player_id ON click_events(player_id);
+CREATE INDEX IF NOT EXISTS idx_games_ended_at ON games(ended_at);
+
+CREATE TABLE IF NOT EXISTS player_badges (
+    player_id TEXT NOT NULL REFERENCES players(id),
+    badge_id TEXT NOT NULL,
+    awarded_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    game_id TEXT REFERENCES games(id),
+    PRIMARY KEY (player_id, badge_id)
+);
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"database/sql"
 	"fmt"
 	"time"
 )
@@ -13,7 +14,25 @@ type PlayerRecord struct {
 }
 
 func (d *DB) UpsertPlayer(id, name, color string) error {
-	_, err := d.conn.Exec(`
+	return upsertPlayer(d.conn, id, name, color)
+}
+
+func (d *DB) GetPlayer(id string) (*PlayerRecord, error) {
+	return getPlayer(d.conn, id)
+}
+
+func (s *SQLite) UpsertPlayer(id, name, color string) error {
+	return upsertPlayer(s.conn, id, name, color)
+}
+
+func (s *SQLite) GetPlayer(id string) (*PlayerRecord, error) {
+	return getPlayer(s.conn, id)
+}
+
+// Both backends share the SQL for players.
+
+func upsertPlayer(conn *sql.DB, id, name, color string) error {
+	_, err := conn.Exec(`
 		INSERT INTO players (id, name, color)
 		VALUES ($1, $2, $3)
 		ON CONFLICT (id) DO UPDATE SET name = $2, color = $3
@@ -24,9 +43,9 @@ func (d *DB) UpsertPlayer(id, name, color string) error {
 	return nil
 }
 
-func (d *DB) GetPlayer(id string) (*PlayerRecord, error) {
+func getPlayer(conn *sql.DB, id string) (*PlayerRecord, error) {
 	var p PlayerRecord
-	err := d.conn.QueryRow(`
+	err := conn.QueryRow(`
 		SELECT id, name, color, created_at FROM players WHERE id = $1
 	`, id).Scan(&p.ID, &p.Name, &p.Color, &p.CreatedAt)
 	if err != nil {
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations_sqlite/*.sql
+var sqliteMigrationsFS embed.FS
+
+// SQLite is the Store for running as a single binary: the record of play is
+// kept in a local file by an embedded, pure-Go SQLite.
+type SQLite struct {
+	conn *sql.DB
+}
+
+// OpenSQLite opens the database file at path, creating it if need be.
+// Writers wait for each other rather than fail, and times are written in a
+// form SQLite's date functions read.
+func OpenSQLite(path string) (*SQLite, error) {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Set("_txlock", "immediate")
+	params.Set("_time_format", "sqlite")
+	conn, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	slog.Info("opened SQLite database", "component", "db", "path", path)
+	return &SQLite{conn: conn}, nil
+}
+
+func (s *SQLite) Close() error {
+	return s.conn.Close()
+}
+
+func (s *SQLite) Ping() error {
+	return s.conn.Ping()
+}
+
+func (s *SQLite) Dialect() Dialect {
+	return DialectSQLite
+}
+
+func (s *SQLite) QueryRow(query string, args ...any) *sql.Row {
+	return s.conn.QueryRow(query, args...)
+}
+
+func (s *SQLite) Query(query string, args ...any) (*sql.Rows, error) {
+	return s.conn.Query(query, args...)
+}
+
+func (s *SQLite) Exec(query string, args ...any) (sql.Result, error) {
+	return s.conn.Exec(query, args...)
+}
+
+// sqliteNow stands in for Postgres's now(). Times are kept in UTC so they
+// sort as text.
+func sqliteNow() time.Time {
+	return time.Now().UTC()
+}
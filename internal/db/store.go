@@ -0,0 +1,65 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Players, Games, Clicks and Badges keep the record of play that analytics
+// is built from. DB keeps them in PostgreSQL and SQLite in a local file.
+type Players interface {
+	UpsertPlayer(id, name, color string) error
+	GetPlayer(id string) (*PlayerRecord, error)
+}
+
+type Games interface {
+	CreateGame(roomCode, hostID string, roundDurationMs int) (string, error)
+	SetLayoutSeed(gameID string, seed int64) error
+	EndGame(gameID string) error
+	InterruptGames(gameIDs []string) error
+	AddGamePlayer(gameID, playerID string, finalScore, rank int, lateJoinPolicy string) error
+}
+
+type Clicks interface {
+	RecordClick(ev ClickEvent) error
+	BatchRecordClicks(events []ClickEvent) error
+	RecordClickBatch(key string, events []ClickEvent) error
+	// PruneClickBatches deletes the keys of batches written before cutoff
+	// and returns how many it deleted.
+	PruneClickBatches(cutoff time.Time) (int, error)
+}
+
+type Badges interface {
+	AwardBadge(playerID, badgeID string, gameID *string) error
+	GetPlayerBadges(playerID string) ([]string, error)
+}
+
+// Dialect names the SQL a Store speaks.
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+// Store is a database of the record of play. Analytics reads it with SQL of
+// its own: both backends take $n placeholders, and Dialect tells the
+// queries apart where their SQL differs.
+type Store interface {
+	Players
+	Games
+	Clicks
+	Badges
+
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+	Dialect() Dialect
+	Migrate() error
+	Ping() error
+	Close() error
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*SQLite)(nil)
+)
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrUnavailable is returned by a Supervisor's writes while no database is
+// attached.
+var ErrUnavailable = errors.New("database unavailable")
+
+// SupervisorOptions configures a Supervisor.
+type SupervisorOptions struct {
+	Backoff    time.Duration // delay before the first retry, doubled each time; default 1s
+	MaxBackoff time.Duration // cap on the retry delay; default 30s
+	PingEvery  time.Duration // how often an attached database is checked; default 5s
+
+	// OnAttach runs each time the database answers after being away, before
+	// it is attached; this is where it is migrated. An error leaves it
+	// detached until the next try.
+	OnAttach func(Store) error
+	// OnChange is called after the database is attached or detached.
+	OnChange func(attached bool)
+}
+
+func (o SupervisorOptions) withDefaults() SupervisorOptions {
+	if o.Backoff <= 0 {
+		o.Backoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 30 * time.Second
+	}
+	if o.PingEvery <= 0 {
+		o.PingEvery = 5 * time.Second
+	}
+	return o
+}
+
+// Supervisor keeps a database attached for as long as it is reachable. It
+// opens the database in the background, retrying with backoff until it
+// answers, then pings it; while pings fail the database is detached, and it
+// is attached again once they pass.
+type Supervisor struct {
+	open func() (Store, error)
+	opts SupervisorOptions
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{} // closed when run returns; nil before Start
+
+	mu       sync.RWMutex
+	store    Store // nil until opened
+	attached bool
+	err      error // why the database isn't attached
+}
+
+var _ Clicks = (*Supervisor)(nil)
+
+func NewSupervisor(open func() (Store, error), opts SupervisorOptions) *Supervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Supervisor{
+		open:   open,
+		opts:   opts.withDefaults(),
+		ctx:    ctx,
+		cancel: cancel,
+		err:    ErrUnavailable,
+	}
+}
+
+// Start tries to attach the database straight away, so a reachable one is
+// attached when Start returns, then keeps watching it in the background.
+func (s *Supervisor) Start() {
+	err := s.try()
+	s.done = make(chan struct{})
+	go s.run(err)
+}
+
+func (s *Supervisor) run(err error) {
+	defer close(s.done)
+	backoff := s.opts.Backoff
+	for {
+		wait := s.opts.PingEvery
+		if err != nil {
+			wait = backoff
+			backoff = min(backoff*2, s.opts.MaxBackoff)
+			slog.Warn("database unavailable, retrying", "component", "db", "error", err, "retry_in", wait)
+		} else {
+			backoff = s.opts.Backoff
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		err = s.try()
+	}
+}
+
+// try opens the database if it hasn't been yet, pings it, and attaches or
+// detaches it by the result. Only Start and run call it, one at a time.
+func (s *Supervisor) try() error {
+	s.mu.RLock()
+	store, attached := s.store, s.attached
+	s.mu.RUnlock()
+
+	if store == nil {
+		opened, err := s.open()
+		if err != nil {
+			s.setErr(err)
+			return err
+		}
+		s.mu.Lock()
+		s.store = opened
+		s.mu.Unlock()
+		store = opened
+	}
+	if err := store.Ping(); err != nil {
+		if attached {
+			slog.Error("database unreachable, detaching it", "component", "db", "error", err)
+			s.set(false, err)
+		} else {
+			s.setErr(err)
+		}
+		return err
+	}
+	if attached {
+		return nil
+	}
+	if s.opts.OnAttach != nil {
+		if err := s.opts.OnAttach(store); err != nil {
+			s.setErr(err)
+			return err
+		}
+	}
+	slog.Info("database attached", "component", "db", "dialect", store.Dialect())
+	s.set(true, nil)
+	return nil
+}
+
+func (s *Supervisor) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *Supervisor) set(attached bool, err error) {
+	s.mu.Lock()
+	s.attached, s.err = attached, err
+	s.mu.Unlock()
+	if s.opts.OnChange != nil {
+		s.opts.OnChange(attached)
+	}
+}
+
+// Store returns the attached database, or nil while it is unavailable.
+func (s *Supervisor) Store() Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.attached {
+		return nil
+	}
+	return s.store
+}
+
+// Err returns why the database isn't attached, or nil if it is.
+func (s *Supervisor) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
+
+// Close stops watching the database and closes it.
+func (s *Supervisor) Close() error {
+	s.cancel()
+	if s.done != nil {
+		<-s.done
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attached, s.err = false, ErrUnavailable
+	if s.store == nil {
+		return nil
+	}
+	return s.store.Close()
+}
+
+func (s *Supervisor) RecordClick(ev ClickEvent) error {
+	store := s.Store()
+	if store == nil {
+		return ErrUnavailable
+	}
+	return store.RecordClick(ev)
+}
+
+func (s *Supervisor) BatchRecordClicks(events []ClickEvent) error {
+	store := s.Store()
+	if store == nil {
+		return ErrUnavailable
+	}
+	return store.BatchRecordClicks(events)
+}
+
+func (s *Supervisor) RecordClickBatch(key string, events []ClickEvent) error {
+	store := s.Store()
+	if store == nil {
+		return ErrUnavailable
+	}
+	return store.RecordClickBatch(key, events)
+}
+
+func (s *Supervisor) PruneClickBatches(cutoff time.Time) (int, error) {
+	store := s.Store()
+	if store == nil {
+		return 0, ErrUnavailable
+	}
+	return store.PruneClickBatches(cutoff)
+}
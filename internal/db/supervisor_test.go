@@ -0,0 +1,116 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// unreliableStore fails pings while down.
+type unreliableStore struct {
+	Store
+	down atomic.Bool
+}
+
+func (u *unreliableStore) Ping() error {
+	if u.down.Load() {
+		return errors.New("connection refused")
+	}
+	return u.Store.Ping()
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSupervisor_AttachesLateAndDetaches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "supervised.db")
+	var opens, attaches, detaches atomic.Int32
+	var store *unreliableStore
+	sup := NewSupervisor(func() (Store, error) {
+		if opens.Add(1) <= 2 {
+			return nil, errors.New("no route to host")
+		}
+		database, err := OpenSQLite(path)
+		if err != nil {
+			return nil, err
+		}
+		store = &unreliableStore{Store: database}
+		return store, nil
+	}, SupervisorOptions{
+		Backoff:   10 * time.Millisecond,
+		PingEvery: 10 * time.Millisecond,
+		OnAttach:  func(s Store) error { return s.Migrate() },
+		OnChange: func(attached bool) {
+			if attached {
+				attaches.Add(1)
+			} else {
+				detaches.Add(1)
+			}
+		},
+	})
+	sup.Start()
+	defer sup.Close()
+
+	// Unreachable at start: nothing is attached and writes say so.
+	if sup.Store() != nil || sup.Err() == nil {
+		t.Fatal("Store() should be nil with Err() set while the database can't be opened")
+	}
+	if err := sup.RecordClickBatch("k", nil); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("RecordClickBatch() error = %v, want ErrUnavailable", err)
+	}
+
+	waitFor(t, "the database to attach", func() bool { return sup.Store() != nil })
+	if sup.Err() != nil || attaches.Load() != 1 {
+		t.Errorf("Err() = %v after %d attaches, want attached once", sup.Err(), attaches.Load())
+	}
+	var migrated bool
+	if err := sup.Store().QueryRow(`SELECT COUNT(*) > 0 FROM schema_migrations`).Scan(&migrated); err != nil || !migrated {
+		t.Errorf("the database should be migrated when attached: %v", err)
+	}
+
+	store.down.Store(true)
+	waitFor(t, "the database to detach", func() bool { return sup.Store() == nil })
+	if sup.Err() == nil || detaches.Load() != 1 {
+		t.Errorf("Err() = %v after %d detaches, want detached once with the ping's error", sup.Err(), detaches.Load())
+	}
+
+	store.down.Store(false)
+	waitFor(t, "the database to attach again", func() bool { return sup.Store() != nil })
+	if opens.Load() != 3 || attaches.Load() != 2 {
+		t.Errorf("opened %d times and attached %d, want the same database attached again", opens.Load(), attaches.Load())
+	}
+}
+
+func TestSupervisor_FailedAttachRetries(t *testing.T) {
+	database, err := OpenSQLite(filepath.Join(t.TempDir(), "supervised.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite() error: %v", err)
+	}
+	var tries atomic.Int32
+	sup := NewSupervisor(func() (Store, error) { return database, nil }, SupervisorOptions{
+		Backoff: 10 * time.Millisecond,
+		OnAttach: func(s Store) error {
+			if tries.Add(1) == 1 {
+				return errors.New("migration interrupted")
+			}
+			return s.Migrate()
+		},
+	})
+	sup.Start()
+	defer sup.Close()
+
+	if sup.Store() != nil {
+		t.Fatal("a database whose attach failed shouldn't be attached")
+	}
+	waitFor(t, "the database to attach", func() bool { return sup.Store() != nil })
+}
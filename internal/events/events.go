@@ -1,15 +1,264 @@
 package events
 
-type SceneChangeEvent struct {
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Event is something that happened in a room. Type names the event for
+// logs, metrics and webhook payloads.
+type Event interface {
+	Type() string
+}
+
+type SceneChanged struct {
 	Scene string
 }
 
+type PlayerJoined struct {
+	PlayerID string
+	Name     string
+	Color    string
+	LateJoin bool
+}
+
+type PlayerLeft struct {
+	PlayerID string
+}
+
+type PlayerReady struct {
+	PlayerID string
+	Ready    bool
+}
+
+type RoundStarted struct {
+	Duration int // seconds
+	Targets  int
+}
+
+type TargetSpawned struct {
+	TargetID int
+	X, Y     int
+	Size     int
+	Color    string
+}
+
+type TargetKilled struct {
+	TargetID int
+	PlayerID string
+	Points   int
+}
+
+// ScoreChanged is a player's score moving. Delta is what was added, after
+// any late-join handicap; Score is the new total.
+type ScoreChanged struct {
+	PlayerID string
+	Delta    int
+	Score    int
+}
+
+type RoundEnded struct {
+	GameID  string         // empty when games aren't recorded
+	Results []PlayerResult // ranked, best first
+}
+
+// PlayerResult is one player's standing at the end of a round.
+type PlayerResult struct {
+	PlayerID string
+	Name     string
+	Score    int
+}
+
+type BadgeAwarded struct {
+	PlayerID string
+	BadgeID  string
+	GameID   string // empty for lifetime badges
+}
+
+// PersonalBest is a player beating their best recorded game score. It is
+// not published for a player's first game.
+type PersonalBest struct {
+	PlayerID string
+	Name     string
+	Score    int
+	Previous int
+	GameID   string
+}
+
+// LeaderboardChanged is a change in who holds the top places of a
+// leaderboard category after a game is recorded.
+type LeaderboardChanged struct {
+	Category string
+	Top      []Standing // best first
+}
+
+// Standing is one place on a leaderboard.
+type Standing struct {
+	Rank     int
+	PlayerID string
+	Name     string
+	Value    int
+}
+
+func (SceneChanged) Type() string       { return "scene_changed" }
+func (PlayerJoined) Type() string       { return "player_joined" }
+func (PlayerLeft) Type() string         { return "player_left" }
+func (PlayerReady) Type() string        { return "player_ready" }
+func (RoundStarted) Type() string       { return "round_started" }
+func (TargetSpawned) Type() string      { return "target_spawned" }
+func (TargetKilled) Type() string       { return "target_killed" }
+func (ScoreChanged) Type() string       { return "score_changed" }
+func (RoundEnded) Type() string         { return "round_ended" }
+func (BadgeAwarded) Type() string       { return "badge_awarded" }
+func (PersonalBest) Type() string       { return "personal_best" }
+func (LeaderboardChanged) Type() string { return "leaderboard_changed" }
+
+// DefaultBuffer is the queue length given to a subscriber that doesn't ask
+// for one.
+const DefaultBuffer = 64
+
+// Bus fans events out to any number of subscribers. Publishing never
+// blocks: a subscriber whose queue is full misses the event, which is
+// counted against it.
 type Bus struct {
-	SceneChanges chan SceneChangeEvent
+	mu        sync.RWMutex
+	subs      map[*Subscription]struct{}
+	recorders []Recorder
+	closed    bool
+	onDrop    func(subscriber string, ev Event)
+}
+
+// Recorder sees every event on a bus, for consumers that can't afford to
+// miss any. Record is called on the publisher's goroutine, possibly by
+// several publishers at once, so it must be safe for concurrent use and
+// must not block or publish. Close is called once, after the last event,
+// when the bus is closed.
+type Recorder interface {
+	Record(ev Event)
+	Close()
 }
 
 func NewBus() *Bus {
 	return &Bus{
-		SceneChanges: make(chan SceneChangeEvent, 10),
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription is one subscriber's queue of events.
+type Subscription struct {
+	name    string
+	ch      chan Event
+	bus     *Bus
+	dropped atomic.Uint64
+}
+
+// Events returns the subscriber's queue. It is closed when the subscription
+// or the bus is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+func (s *Subscription) Name() string {
+	return s.name
+}
+
+// Dropped returns how many events this subscriber missed because its queue
+// was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close unsubscribes and closes the queue.
+func (s *Subscription) Close() {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	close(s.ch)
+}
+
+// Subscribe adds a named subscriber with a queue of the given length (or
+// DefaultBuffer if not positive). After Close it returns a subscription
+// whose queue is already closed.
+func (b *Bus) Subscribe(name string, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	s := &Subscription{name: name, ch: make(chan Event, buffer), bus: b}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.ch)
+		return s
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// AddRecorder attaches r to the bus. On a closed bus r is closed at once.
+func (b *Bus) AddRecorder(r Recorder) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		r.Close()
+		return
+	}
+	b.recorders = append(b.recorders, r)
+	b.mu.Unlock()
+}
+
+// OnDrop sets a function called whenever a subscriber misses an event.
+func (b *Bus) OnDrop(fn func(subscriber string, ev Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onDrop = fn
+}
+
+// Publish queues ev for every subscriber. Events published after Close are
+// discarded.
+func (b *Bus) Publish(ev Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, r := range b.recorders {
+		r.Record(ev)
+	}
+	for s := range b.subs {
+		select {
+		case s.ch <- ev:
+		default:
+			s.dropped.Add(1)
+			if b.onDrop != nil {
+				b.onDrop(s.name, ev)
+			}
+		}
+	}
+}
+
+// Close closes every subscriber's queue so their consumers stop, then
+// closes the recorders. It is safe to call more than once.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	for s := range b.subs {
+		close(s.ch)
+	}
+	b.subs = nil
+	recorders := b.recorders
+	b.recorders = nil
+	b.mu.Unlock()
+
+	// Outside the lock: recorders may write out what they hold.
+	for _, r := range recorders {
+		r.Close()
 	}
 }
@@ -10,39 +10,123 @@ func TestNewBus(t *testing.T) {
 	if bus == nil {
 		t.Fatal("NewBus() returned nil")
 	}
-	if bus.SceneChanges == nil {
-		t.Fatal("SceneChanges channel is nil")
-	}
 }
 
-func TestBus_SendReceive(t *testing.T) {
+func TestBus_PublishToSubscribers(t *testing.T) {
 	bus := NewBus()
-	ev := SceneChangeEvent{Scene: "combat"}
+	a := bus.Subscribe("a", 4)
+	b := bus.Subscribe("b", 4)
 
-	go func() {
-		bus.SceneChanges <- ev
-	}()
+	bus.Publish(SceneChanged{Scene: "combat"})
 
-	select {
-	case received := <-bus.SceneChanges:
-		if received.Scene != "combat" {
-			t.Errorf("received Scene = %q, want %q", received.Scene, "combat")
+	for _, sub := range []*Subscription{a, b} {
+		select {
+		case ev := <-sub.Events():
+			sc, ok := ev.(SceneChanged)
+			if !ok || sc.Scene != "combat" {
+				t.Errorf("%s received %#v, want SceneChanged{combat}", sub.Name(), ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s timed out waiting for event", sub.Name())
 		}
-	case <-time.After(1 * time.Second):
-		t.Fatal("timed out waiting for event")
 	}
 }
 
-func TestBus_Buffered(t *testing.T) {
+func TestBus_OverflowIsCountedPerSubscriber(t *testing.T) {
+	bus := NewBus()
+	slow := bus.Subscribe("slow", 1)
+	fast := bus.Subscribe("fast", 10)
+
+	var drops []string
+	bus.OnDrop(func(name string, ev Event) { drops = append(drops, name+":"+ev.Type()) })
+
+	// Must not block even though "slow" never reads.
+	for i := range 3 {
+		bus.Publish(TargetSpawned{TargetID: i})
+	}
+
+	if slow.Dropped() != 2 {
+		t.Errorf("slow dropped = %d, want 2", slow.Dropped())
+	}
+	if fast.Dropped() != 0 {
+		t.Errorf("fast dropped = %d, want 0", fast.Dropped())
+	}
+	if len(fast.Events()) != 3 {
+		t.Errorf("fast queued = %d, want 3", len(fast.Events()))
+	}
+	if len(drops) != 2 || drops[0] != "slow:target_spawned" {
+		t.Errorf("drop hook calls = %v, want two for slow", drops)
+	}
+}
+
+func TestSubscription_Close(t *testing.T) {
 	bus := NewBus()
+	sub := bus.Subscribe("a", 0)
+	sub.Close()
+	sub.Close()
 
-	// Should be able to send up to 10 without blocking
-	for i := 0; i < 10; i++ {
-		bus.SceneChanges <- SceneChangeEvent{Scene: "test"}
+	if _, ok := <-sub.Events(); ok {
+		t.Error("queue should be closed")
+	}
+	// Must not panic on the closed queue.
+	bus.Publish(PlayerLeft{PlayerID: "p1"})
+}
+
+func TestBus_Close(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe("a", 4)
+	bus.Publish(SceneChanged{Scene: "combat"})
+	bus.Close()
+	bus.Close()
+
+	// Queued events are still delivered, then the queue ends.
+	if ev, ok := <-sub.Events(); !ok || ev.(SceneChanged).Scene != "combat" {
+		t.Errorf("first receive = %#v, %v; want the queued event", ev, ok)
+	}
+	if _, ok := <-sub.Events(); ok {
+		t.Error("queue should be closed")
+	}
+
+	// Must not panic.
+	bus.Publish(SceneChanged{Scene: "lobby"})
+	sub.Close()
+	if _, ok := <-bus.Subscribe("late", 1).Events(); ok {
+		t.Error("Subscribe after Close should return a closed queue")
+	}
+}
+
+// recorder keeps every event it sees.
+type recorder struct {
+	events []Event
+	closed int
+}
+
+func (r *recorder) Record(ev Event) { r.events = append(r.events, ev) }
+func (r *recorder) Close()          { r.closed++ }
+
+func TestBus_RecorderSeesEverything(t *testing.T) {
+	bus := NewBus()
+	rec := &recorder{}
+	bus.AddRecorder(rec)
+	bus.Subscribe("slow", 1) // fills up and drops
+
+	for i := range 5 {
+		bus.Publish(TargetKilled{TargetID: i})
+	}
+	bus.Close()
+	bus.Close()
+	bus.Publish(PlayerLeft{PlayerID: "p1"})
+
+	if len(rec.events) != 5 || rec.events[4].(TargetKilled).TargetID != 4 {
+		t.Errorf("recorded %v, want all 5 kills in order", rec.events)
+	}
+	if rec.closed != 1 {
+		t.Errorf("recorder closed %d times, want once", rec.closed)
 	}
 
-	// Drain
-	for i := 0; i < 10; i++ {
-		<-bus.SceneChanges
+	late := &recorder{}
+	bus.AddRecorder(late)
+	if late.closed != 1 {
+		t.Error("a recorder added after Close should be closed at once")
 	}
 }
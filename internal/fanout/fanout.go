@@ -0,0 +1,94 @@
+// Package fanout carries room messages between server instances, so that
+// clients connected to any instance follow a room open on another.
+package fanout
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned by Publish and Subscribe once the backend is closed.
+var ErrClosed = errors.New("fanout backend is closed")
+
+// Handler receives the payloads published on a topic.
+type Handler func(payload []byte)
+
+// Backend delivers each payload published on a topic to every subscriber of
+// that topic, on every instance sharing the backend. Payloads one instance
+// publishes to a topic arrive in the order it published them.
+type Backend interface {
+	Publish(topic string, payload []byte) error
+	// Subscribe calls fn with every payload published on topic until
+	// cancel is called. fn is never called concurrently with itself, and
+	// must not call Subscribe.
+	Subscribe(topic string, fn Handler) (cancel func(), err error)
+	Close() error
+}
+
+// Local is a Backend within one process: Publish calls the topic's
+// subscribers before it returns. Servers sharing one behave like instances
+// sharing a database.
+type Local struct {
+	mu     sync.Mutex
+	topics map[string]map[*subscriber]bool
+	closed bool
+}
+
+type subscriber struct {
+	mu sync.Mutex // one call at a time
+	fn Handler
+}
+
+func NewLocal() *Local {
+	return &Local{topics: make(map[string]map[*subscriber]bool)}
+}
+
+func (l *Local) Publish(topic string, payload []byte) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return ErrClosed
+	}
+	subs := make([]*subscriber, 0, len(l.topics[topic]))
+	for sub := range l.topics[topic] {
+		subs = append(subs, sub)
+	}
+	l.mu.Unlock()
+
+	// Call out unlocked, so handlers can publish in turn.
+	for _, sub := range subs {
+		sub.mu.Lock()
+		sub.fn(payload)
+		sub.mu.Unlock()
+	}
+	return nil
+}
+
+func (l *Local) Subscribe(topic string, fn Handler) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, ErrClosed
+	}
+	sub := &subscriber{fn: fn}
+	if l.topics[topic] == nil {
+		l.topics[topic] = make(map[*subscriber]bool)
+	}
+	l.topics[topic][sub] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.topics[topic], sub)
+		if len(l.topics[topic]) == 0 {
+			delete(l.topics, topic)
+		}
+	}, nil
+}
+
+func (l *Local) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.topics = make(map[string]map[*subscriber]bool)
+	return nil
+}
@@ -0,0 +1,49 @@
+package fanout
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLocal_DeliversToTopicSubscribers(t *testing.T) {
+	l := NewLocal()
+	var a, b []string
+	cancelA, _ := l.Subscribe("room:A", func(p []byte) { a = append(a, string(p)) })
+	l.Subscribe("room:B", func(p []byte) { b = append(b, string(p)) })
+
+	l.Publish("room:A", []byte("one"))
+	l.Publish("room:B", []byte("two"))
+	l.Publish("room:A", []byte("three"))
+	cancelA()
+	l.Publish("room:A", []byte("four"))
+
+	if !slices.Equal(a, []string{"one", "three"}) {
+		t.Errorf("room:A got %q, want its messages in order until cancelled", a)
+	}
+	if !slices.Equal(b, []string{"two"}) {
+		t.Errorf("room:B got %q", b)
+	}
+}
+
+func TestLocal_HandlersCanPublish(t *testing.T) {
+	l := NewLocal()
+	var got []string
+	l.Subscribe("in", func(p []byte) { l.Publish("out", append([]byte("re: "), p...)) })
+	l.Subscribe("out", func(p []byte) { got = append(got, string(p)) })
+
+	l.Publish("in", []byte("click"))
+	if !slices.Equal(got, []string{"re: click"}) {
+		t.Errorf("got %q, want the reply", got)
+	}
+}
+
+func TestLocal_Close(t *testing.T) {
+	l := NewLocal()
+	l.Close()
+	if err := l.Publish("t", nil); err != ErrClosed {
+		t.Errorf("Publish() after Close = %v, want ErrClosed", err)
+	}
+	if _, err := l.Subscribe("t", func([]byte) {}); err != ErrClosed {
+		t.Errorf("Subscribe() after Close = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,90 @@
+package fanout
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// frameSize is the most payload bytes one notification carries. Postgres
+// caps a NOTIFY payload at 8000 bytes, and the header needs the rest.
+const frameSize = 7000
+
+// maxPartial is how many part-received payloads an assembler holds before it
+// gives up on all of them.
+const maxPartial = 1024
+
+// split cuts a payload into frames of the form "<id> <index>/<count> <data>",
+// each small enough for one notification. Cuts fall between characters, as
+// Postgres rejects invalid text.
+func split(id string, payload []byte) []string {
+	var chunks [][]byte
+	for len(payload) > frameSize {
+		end := frameSize
+		for end > 0 && !utf8.RuneStart(payload[end]) {
+			end--
+		}
+		chunks = append(chunks, payload[:end])
+		payload = payload[end:]
+	}
+	chunks = append(chunks, payload)
+
+	frames := make([]string, len(chunks))
+	for i, c := range chunks {
+		frames[i] = fmt.Sprintf("%s %d/%d %s", id, i, len(chunks), c)
+	}
+	return frames
+}
+
+// assembler puts payloads back together from their frames. Frames of
+// different payloads may interleave.
+type assembler struct {
+	partial map[string][]string
+}
+
+func newAssembler() *assembler {
+	return &assembler{partial: make(map[string][]string)}
+}
+
+// add takes one frame and returns the payload once all its frames are in.
+func (a *assembler) add(frame string) (payload []byte, done bool, err error) {
+	id, rest, ok1 := strings.Cut(frame, " ")
+	pos, data, ok2 := strings.Cut(rest, " ")
+	idx, count, ok3 := strings.Cut(pos, "/")
+	i, err1 := strconv.Atoi(idx)
+	n, err2 := strconv.Atoi(count)
+	if !ok1 || !ok2 || !ok3 || err1 != nil || err2 != nil || n < 1 || i < 0 || i >= n {
+		return nil, false, fmt.Errorf("malformed frame %.40q", frame)
+	}
+	if n == 1 {
+		return []byte(data), true, nil
+	}
+
+	parts := a.partial[id]
+	if parts == nil {
+		if len(a.partial) >= maxPartial {
+			a.reset()
+		}
+		parts = make([]string, n)
+		a.partial[id] = parts
+	}
+	if len(parts) != n {
+		delete(a.partial, id)
+		return nil, false, fmt.Errorf("frame count of %s changed from %d to %d", id, len(parts), n)
+	}
+	// An empty last chunk can't happen, so an empty part is a missing one.
+	parts[i] = data
+	for _, p := range parts {
+		if p == "" {
+			return nil, false, nil
+		}
+	}
+	delete(a.partial, id)
+	return []byte(strings.Join(parts, "")), true, nil
+}
+
+// reset drops part-received payloads, e.g. after a reconnect loses frames.
+func (a *assembler) reset() {
+	clear(a.partial)
+}
@@ -0,0 +1,73 @@
+package fanout
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplit_SmallPayloadIsOneFrame(t *testing.T) {
+	frames := split("s-1", []byte(`{"a":1}`))
+	if len(frames) != 1 || frames[0] != `s-1 0/1 {"a":1}` {
+		t.Errorf("split() = %q, want one frame", frames)
+	}
+}
+
+func TestSplit_CutsBetweenCharacters(t *testing.T) {
+	// Two-byte runes offset by one byte, so a plain cut would split one.
+	payload := []byte("x" + strings.Repeat("é", frameSize))
+	frames := split("s-1", payload)
+	if len(frames) != 3 {
+		t.Fatalf("split() made %d frames, want 3", len(frames))
+	}
+	for i, f := range frames {
+		if !utf8.ValidString(f) || len(f) > 8000 {
+			t.Errorf("frame %d is %d bytes, valid text %v; want valid text under the notify limit", i, len(f), utf8.ValidString(f))
+		}
+	}
+}
+
+func TestAssembler_Reassembles(t *testing.T) {
+	big := []byte(strings.Repeat("abcdefghij", 2*frameSize/10+7))
+	a := split("s-1", big)
+	b := split("s-2", []byte("small"))
+	c := split("s-3", big)
+
+	asm := newAssembler()
+	var got []string
+	// Frames of different payloads interleave; each comes out whole.
+	for _, f := range []string{a[0], c[0], b[0], a[1], c[1], c[2], a[2]} {
+		payload, done, err := asm.add(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done {
+			got = append(got, string(payload))
+		}
+	}
+	if len(got) != 3 || got[0] != "small" || got[1] != string(big) || got[2] != string(big) {
+		t.Errorf("got %d payloads, want small then both big ones intact", len(got))
+	}
+	if len(asm.partial) != 0 {
+		t.Errorf("%d partial payloads left, want none", len(asm.partial))
+	}
+}
+
+func TestAssembler_ResetDropsPartials(t *testing.T) {
+	frames := split("s-1", []byte(strings.Repeat("z", frameSize+1)))
+	asm := newAssembler()
+	asm.add(frames[0])
+	asm.reset()
+	if _, done, _ := asm.add(frames[1]); done {
+		t.Error("a payload missing frames from before the reset shouldn't complete")
+	}
+}
+
+func TestAssembler_RejectsMalformedFrames(t *testing.T) {
+	asm := newAssembler()
+	for _, f := range []string{"", "s-1", "s-1 x/1 data", "s-1 2/2 data", "s-1 0/0 data"} {
+		if _, _, err := asm.add(f); err == nil {
+			t.Errorf("add(%q) should fail", f)
+		}
+	}
+}
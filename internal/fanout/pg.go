@@ -0,0 +1,234 @@
+package fanout
+
+import (
+	"bytes"
+	"clicktrainer/internal/db"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// ErrNotText is returned by PG.Publish for payloads Postgres can't carry in a
+// notification: anything but UTF-8 without NUL bytes. JSON is fine.
+var ErrNotText = errors.New("fanout payload is not text")
+
+// ErrBacklog is returned by PG.Publish when the database has fallen too far
+// behind to take more.
+var ErrBacklog = errors.New("fanout backlog is full")
+
+const (
+	pgQueueSize  = 4096 // payloads waiting to be sent
+	pgBatchSize  = 256  // most frames sent in one statement
+	pgPingPeriod = 90 * time.Second
+)
+
+// PG is a Backend on Postgres LISTEN/NOTIFY. Each topic is a channel, which
+// instances listen on while they have subscribers. Payloads too big for one
+// notification go as several, sent together and put back together on the
+// other side.
+//
+// Publish queues the payload and returns; one goroutine sends the queue in
+// order, so the order of an instance's payloads survives. Notifications are
+// lost while a listener is reconnecting; subscribers that care must notice
+// the gap themselves.
+type PG struct {
+	DB *db.DB
+
+	listener *pq.Listener
+	sender   string // prefixes payload IDs, unique to this backend
+	seq      atomic.Uint64
+	queue    chan pgPayload
+	sent     chan struct{} // closed when the queue has been sent
+
+	listenMu sync.Mutex // serialises LISTEN and UNLISTEN
+	mu       sync.Mutex // guards topics and closed; never held across a query
+	topics   map[string]map[*subscriber]bool
+	closed   bool
+}
+
+type pgPayload struct {
+	topic  string
+	frames []string
+}
+
+// NewPG starts a backend publishing through database and listening on a
+// connection of its own to dsn.
+func NewPG(database *db.DB, dsn string) *PG {
+	nonce := make([]byte, 4)
+	_, _ = rand.Read(nonce)
+	p := &PG{
+		DB:     database,
+		sender: hex.EncodeToString(nonce),
+		queue:  make(chan pgPayload, pgQueueSize),
+		sent:   make(chan struct{}),
+		topics: make(map[string]map[*subscriber]bool),
+	}
+	p.listener = pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("fanout listener connection problem", "component", "fanout", "event", ev, "error", err)
+		}
+	})
+	go p.send()
+	go p.listen()
+	return p
+}
+
+func (p *PG) Publish(topic string, payload []byte) error {
+	if !utf8.Valid(payload) || bytes.IndexByte(payload, 0) >= 0 {
+		return ErrNotText
+	}
+	id := fmt.Sprintf("%s-%d", p.sender, p.seq.Add(1))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	select {
+	case p.queue <- pgPayload{topic: topic, frames: split(id, payload)}:
+		return nil
+	default:
+		return ErrBacklog
+	}
+}
+
+// send notifies the queued payloads in batches. The frames of a batch go in
+// one statement, so they are delivered together and in order.
+func (p *PG) send() {
+	defer close(p.sent)
+	for first := range p.queue {
+		channels, frames := []string{}, []string{}
+		add := func(pl pgPayload) {
+			for _, f := range pl.frames {
+				channels = append(channels, pl.topic)
+				frames = append(frames, f)
+			}
+		}
+		add(first)
+	more:
+		for len(frames) < pgBatchSize {
+			select {
+			case pl, ok := <-p.queue:
+				if !ok {
+					break more
+				}
+				add(pl)
+			default:
+				break more
+			}
+		}
+		_, err := p.DB.Exec(`SELECT pg_notify(c, f) FROM unnest($1::text[], $2::text[]) AS t(c, f)`,
+			pq.Array(channels), pq.Array(frames))
+		if err != nil {
+			slog.Error("publishing room messages failed", "component", "fanout", "frames", len(frames), "error", err)
+		}
+	}
+}
+
+// listen hands each payload to its topic's subscribers, one at a time.
+func (p *PG) listen() {
+	asm := newAssembler()
+	ping := time.NewTicker(pgPingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case n, ok := <-p.listener.Notify:
+			if !ok {
+				return
+			}
+			if n == nil {
+				// Reconnected; frames sent meanwhile are gone.
+				asm.reset()
+				continue
+			}
+			payload, done, err := asm.add(n.Extra)
+			if err != nil {
+				slog.Warn("dropping bad fanout frame", "component", "fanout", "topic", n.Channel, "error", err)
+				continue
+			}
+			if done {
+				p.dispatch(n.Channel, payload)
+			}
+		case <-ping.C:
+			go func() { _ = p.listener.Ping() }()
+		}
+	}
+}
+
+func (p *PG) dispatch(topic string, payload []byte) {
+	p.mu.Lock()
+	subs := make([]*subscriber, 0, len(p.topics[topic]))
+	for sub := range p.topics[topic] {
+		subs = append(subs, sub)
+	}
+	p.mu.Unlock()
+	for _, sub := range subs {
+		sub.fn(payload)
+	}
+}
+
+// Subscribe and its cancel wait on the database, so they don't hold mu:
+// the listener can't answer while dispatch is stuck waiting for it.
+func (p *PG) Subscribe(topic string, fn Handler) (func(), error) {
+	p.listenMu.Lock()
+	defer p.listenMu.Unlock()
+	p.mu.Lock()
+	closed, first := p.closed, len(p.topics[topic]) == 0
+	p.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	if first {
+		if err := p.listener.Listen(topic); err != nil && !errors.Is(err, pq.ErrChannelAlreadyOpen) {
+			return nil, fmt.Errorf("listening on %s: %w", topic, err)
+		}
+	}
+
+	sub := &subscriber{fn: fn}
+	p.mu.Lock()
+	if p.topics[topic] == nil {
+		p.topics[topic] = make(map[*subscriber]bool)
+	}
+	p.topics[topic][sub] = true
+	p.mu.Unlock()
+
+	return func() {
+		p.listenMu.Lock()
+		defer p.listenMu.Unlock()
+		p.mu.Lock()
+		last := p.topics[topic][sub] && len(p.topics[topic]) == 1
+		delete(p.topics[topic], sub)
+		if len(p.topics[topic]) == 0 {
+			delete(p.topics, topic)
+		}
+		closed := p.closed
+		p.mu.Unlock()
+		if !last || closed {
+			return
+		}
+		if err := p.listener.Unlisten(topic); err != nil && !errors.Is(err, pq.ErrChannelNotOpen) {
+			slog.Warn("unlistening failed", "component", "fanout", "topic", topic, "error", err)
+		}
+	}, nil
+}
+
+// Close sends what is queued, then stops listening.
+func (p *PG) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+	<-p.sent
+	return p.listener.Close()
+}
@@ -0,0 +1,71 @@
+package fanout
+
+import (
+	"clicktrainer/internal/db"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getTestBackend(t *testing.T) *PG {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping database tests")
+	}
+	database, err := db.Connect(dsn)
+	if err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	p := NewPG(database, dsn)
+	t.Cleanup(func() {
+		p.Close()
+		database.Close()
+	})
+	return p
+}
+
+func TestPG_DeliversInOrderAcrossBackends(t *testing.T) {
+	pub := getTestBackend(t)
+	sub := getTestBackend(t)
+
+	got := make(chan string, 100)
+	cancel, err := sub.Subscribe("room:TEST:out", func(p []byte) { got <- string(p) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	big := strings.Repeat("é", 3*frameSize)
+	var want []string
+	for i := range 20 {
+		msg := fmt.Sprintf("msg %d", i)
+		if i%5 == 0 {
+			msg += big
+		}
+		want = append(want, msg)
+		if err := pub.Publish("room:TEST:out", []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, w := range want {
+		select {
+		case g := <-got:
+			if g != w {
+				t.Fatalf("message %d = %.20q (%d bytes), want %.20q (%d bytes)", i, g, len(g), w, len(w))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message %d never arrived", i)
+		}
+	}
+}
+
+func TestPG_RejectsBinary(t *testing.T) {
+	p := getTestBackend(t)
+	if err := p.Publish("t", []byte{'a', 0, 'b'}); err != ErrNotText {
+		t.Errorf("Publish() = %v, want ErrNotText", err)
+	}
+}
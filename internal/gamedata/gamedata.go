@@ -2,9 +2,12 @@ package gamedata
 
 import (
 	"clicktrainer/internal/events"
+	"clicktrainer/internal/ghost"
 	"clicktrainer/internal/players"
 	"clicktrainer/internal/targets"
+	"math/rand"
 	"sync"
+	"time"
 )
 
 type Scene string
@@ -15,10 +18,68 @@ const (
 	SceneRecap  = Scene("recap")
 )
 
+// LateJoinPolicy decides how a player who joins while a round is running
+// takes part in that round.
+type LateJoinPolicy string
+
+const (
+	// LateJoinNormal lets late joiners play the rest of the round as usual.
+	LateJoinNormal = LateJoinPolicy("normal")
+	// LateJoinSpectate makes late joiners watch until the next round.
+	LateJoinSpectate = LateJoinPolicy("spectate")
+	// LateJoinHandicap scales late joiners' points by the share of the
+	// round they missed.
+	LateJoinHandicap = LateJoinPolicy("handicap")
+)
+
+// maxHandicap caps the points multiplier for players joining near the end.
+const maxHandicap = 3.0
+
+// ParseLateJoinPolicy validates a policy name.
+func ParseLateJoinPolicy(s string) (LateJoinPolicy, bool) {
+	switch p := LateJoinPolicy(s); p {
+	case LateJoinNormal, LateJoinSpectate, LateJoinHandicap:
+		return p, true
+	}
+	return "", false
+}
+
+// IdleAction decides what happens to a lobby player who hasn't done
+// anything for the idle timeout.
+type IdleAction string
+
+const (
+	// IdleUnready clears an idle player's ready flag.
+	IdleUnready = IdleAction("unready")
+	// IdleSpectate moves an idle, unready player to spectators so they no
+	// longer hold up the lobby.
+	IdleSpectate = IdleAction("spectate")
+)
+
+// ParseIdleAction validates an idle action name.
+func ParseIdleAction(s string) (IdleAction, bool) {
+	switch a := IdleAction(s); a {
+	case IdleUnready, IdleSpectate:
+		return a, true
+	}
+	return "", false
+}
+
+// LobbySettings control when a round starts without everyone being ready.
+type LobbySettings struct {
+	MinPlayers       int        // players needed before a round can start; values below 1 mean 1
+	AutoStartPercent int        // share of players that must be ready to arm the auto-start; 0 disables
+	AutoStartSecs    int        // length of the auto-start countdown
+	IdleTimeoutSecs  int        // lobby inactivity before IdleAction applies; 0 disables
+	IdleAction       IdleAction // what happens to idle players
+}
+
 type Config struct {
 	RoundDuration  int // seconds
 	InitialTargets int
 	CountdownSecs  int
+	LateJoin       LateJoinPolicy // default policy for new rooms
+	Lobby          LobbySettings  // default lobby settings for new rooms
 }
 
 func DefaultConfig() Config {
@@ -26,26 +87,74 @@ func DefaultConfig() Config {
 		RoundDuration:  60,
 		InitialTargets: 3,
 		CountdownSecs:  3,
+		LateJoin:       LateJoinNormal,
+		Lobby: LobbySettings{
+			MinPlayers:       1,
+			AutoStartPercent: 75,
+			AutoStartSecs:    10,
+			IdleTimeoutSecs:  120,
+			IdleAction:       IdleSpectate,
+		},
 	}
 }
 
+// LobbyAction is what the lobby should do given who is ready.
+type LobbyAction int
+
+const (
+	LobbyWait      LobbyAction = iota // not enough players ready
+	LobbyAutoStart                    // enough are ready to run the auto-start countdown
+	LobbyStartNow                     // everyone is ready
+)
+
 type GameData struct {
 	Scene       Scene
 	Player      *players.Player
 	Players     []*players.Player
 	Targets     []*targets.Target
 	TimeLeft    int
+	RoundEndsAt int64 // round deadline in Unix ms for client-side rendering; 0 while paused
 	Rankings    []*players.Player
 	RoomCode    string
-	PlayerCount int // total players (for conditional rendering)
-	PlayerRank  int // current player's 1-based rank (combat only)
+	HostName    string // display name of the room host (lobby status line)
+	Locked      bool   // room is closed to new players
+	Paused      bool   // host has paused the round
+	PlayerCount int    // total players (for conditional rendering)
+	PlayerRank  int    // current player's 1-based rank (combat only)
+	LateJoin    LateJoinPolicy
+	Lobby       LobbySettings
+	AutoStartAt int64      // pending auto-start deadline in Unix ms; 0 if none
+	AutoStartIn int        // seconds left on a pending auto-start
+	ExpiresAt   int64      // announced room expiry in Unix ms; 0 if none
+	ExpiresIn   int        // seconds left before the room expires
+	Notice      string     // message shown in the lobby until the next round starts
+	Ghost       *ghost.Run // run being raced; nil outside ghost races
+	Recap       Recap      // populated in the recap scene
+}
+
+// Recap is the end-of-round summary shown to players.
+type Recap struct {
+	Rankings   []*players.Player // players who took part, best first
+	Spectators []*players.Player // late joiners who watched the round
+	LateJoin   LateJoinPolicy
+	Ghost      *ghost.Result // how the race went, in ghost races
 }
 
 type Game struct {
 	mu            sync.Mutex
 	scene         Scene
-	timeLeft      int
 	currentGameID string
+	lateJoin      LateJoinPolicy
+	lobby         LobbySettings
+	notice        string        // lobby message; cleared when a round starts
+	inRound       bool          // StartRound has run and the round hasn't ended
+	epoch         uint64        // changes at every round boundary; see Epoch
+	roundEndsAt   time.Time     // round deadline; zero while the clock is paused
+	frozenLeft    time.Duration // time left when the clock was paused
+	layoutSeed    int64         // target layout of the current or next round
+	ghost         *ghost.Run    // run raced in every round; nil if none
+	race          *ghost.Race   // the latest round against the ghost
+	reset         chan struct{} // closed by ResetToLobby; see Reset
 	Players       *players.Store
 	Targets       *targets.Store
 	Events        *events.Bus
@@ -53,35 +162,41 @@ type Game struct {
 }
 
 func NewGame(ps *players.Store, ts *targets.Store, bus *events.Bus, cfg Config) *Game {
+	lateJoin := cfg.LateJoin
+	if lateJoin == "" {
+		lateJoin = LateJoinNormal
+	}
 	return &Game{
-		scene:   SceneLobby,
-		Players: ps,
-		Targets: ts,
-		Events:  bus,
-		Config:  cfg,
+		scene:    SceneLobby,
+		lateJoin: lateJoin,
+		lobby:    cfg.Lobby,
+		Players:  ps,
+		Targets:  ts,
+		Events:   bus,
+		Config:   cfg,
 	}
 }
 
 func (g *Game) Get(id string) GameData {
 	g.mu.Lock()
 	scene := g.scene
-	timeLeft := g.timeLeft
+	timeLeft := secondsCeil(g.timeLeftLocked())
+	endsAt := g.roundEndsAt
+	lateJoin := g.lateJoin
+	lobby := g.lobby
+	notice := g.notice
+	run := g.ghost
 	g.mu.Unlock()
 
 	count := g.Players.Count()
-	topN := 5
-	if count >= 10 {
-		topN = 3
-	}
-
 	var playerList []*players.Player
 	if scene == SceneLobby {
 		playerList = g.Players.GetList()
 	} else {
-		playerList = g.Players.GetTopPlayers(topN)
+		playerList = g.Players.GetTopPlayers(ScoreboardSize(count))
 	}
 
-	return GameData{
+	data := GameData{
 		Scene:       scene,
 		Player:      g.Players.Get(id),
 		Players:     playerList,
@@ -89,7 +204,177 @@ func (g *Game) Get(id string) GameData {
 		TimeLeft:    timeLeft,
 		PlayerCount: count,
 		PlayerRank:  g.Players.GetPlayerRank(id),
+		LateJoin:    lateJoin,
+		Lobby:       lobby,
+		Notice:      notice,
+		Ghost:       run,
+	}
+	if !endsAt.IsZero() {
+		data.RoundEndsAt = endsAt.UnixMilli()
+	}
+	if scene == SceneRecap {
+		data.Recap = g.Recap()
+	}
+	return data
+}
+
+func (g *Game) LateJoinPolicy() LateJoinPolicy {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.lateJoin
+}
+
+func (g *Game) SetLateJoinPolicy(p LateJoinPolicy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lateJoin = p
+}
+
+func (g *Game) LobbySettings() LobbySettings {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.lobby
+}
+
+func (g *Game) SetLobbySettings(ls LobbySettings) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lobby = ls
+}
+
+// Notice returns the message shown in the lobby, or "" if there is none.
+func (g *Game) Notice() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.notice
+}
+
+// SetNotice sets a message shown in the lobby until the next round starts,
+// such as why the last one was cut short.
+func (g *Game) SetNotice(msg string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.notice = msg
+}
+
+// LobbyAction decides whether the lobby should start a round. Away players
+// and spectators are left out of the count.
+func (g *Game) LobbyAction() LobbyAction {
+	if g.Scene() != SceneLobby {
+		return LobbyWait
+	}
+	ls := g.LobbySettings()
+	ready, eligible := g.Players.ReadyCounts()
+	if ready == 0 || eligible < max(ls.MinPlayers, 1) {
+		return LobbyWait
+	}
+	if ready == eligible {
+		return LobbyStartNow
+	}
+	if ls.AutoStartPercent > 0 && ready*100 >= ls.AutoStartPercent*eligible {
+		return LobbyAutoStart
+	}
+	return LobbyWait
+}
+
+// AddPlayer registers a player and, if a round is already running, applies
+// the room's late-join policy to them.
+func (g *Game) AddPlayer(id, name string) *players.Player {
+	player := g.Players.Add(id, name)
+
+	g.mu.Lock()
+	midRound := g.scene == SceneCombat && g.inRound
+	policy := g.lateJoin
+	elapsed := time.Duration(g.Config.RoundDuration)*time.Second - g.timeLeftLocked()
+	g.mu.Unlock()
+
+	if midRound {
+		switch policy {
+		case LateJoinSpectate:
+			player = g.Players.MarkLateJoin(id, string(policy), true, 0)
+		case LateJoinHandicap:
+			player = g.Players.MarkLateJoin(id, string(policy), false, handicapFor(g.Config.RoundDuration, elapsed))
+		default:
+			player = g.Players.MarkLateJoin(id, string(LateJoinNormal), false, 0)
+		}
+	}
+	g.Events.Publish(events.PlayerJoined{PlayerID: id, Name: name, Color: player.Color, LateJoin: midRound})
+	return player
+}
+
+// SetReady sets a player's ready flag. Returns nil if the player doesn't
+// exist.
+func (g *Game) SetReady(id string, ready bool) *players.Player {
+	player := g.Players.SetReady(id, ready)
+	if player != nil {
+		g.Events.Publish(events.PlayerReady{PlayerID: id, Ready: ready})
+	}
+	return player
+}
+
+// handicapFor returns the points multiplier for a player who missed elapsed
+// of a round lasting durationSecs: full round / time remaining, capped.
+func handicapFor(durationSecs int, elapsed time.Duration) float64 {
+	total := time.Duration(durationSecs) * time.Second
+	remaining := total - elapsed
+	if remaining <= 0 || float64(total)/float64(remaining) > maxHandicap {
+		return maxHandicap
+	}
+	if remaining >= total {
+		return 1
+	}
+	return float64(total) / float64(remaining)
+}
+
+// ScoreboardSize is how many players the in-round scoreboard shows in a room
+// of count players.
+func ScoreboardSize(count int) int {
+	if count >= 10 {
+		return 3
+	}
+	return 5
+}
+
+// Recap summarises the round: ranked participants and any spectators.
+func (g *Game) Recap() Recap {
+	recap := Recap{LateJoin: g.LateJoinPolicy(), Spectators: g.Spectators()}
+	recap.Rankings = g.rankParticipants()
+	g.mu.Lock()
+	race := g.race
+	g.mu.Unlock()
+	if race != nil {
+		recap.Ghost = race.Result(g.Config.RoundDuration * 1000)
+	}
+	return recap
+}
+
+// Spectators returns the players watching the round rather than taking
+// part in it.
+func (g *Game) Spectators() []*players.Player {
+	var spectators []*players.Player
+	for _, p := range g.Players.GetList() {
+		if p.Spectator {
+			spectators = append(spectators, p)
+		}
+	}
+	return spectators
+}
+
+// rankParticipants returns the players who took part in the round, in
+// scoreboard order. Spectators are left out.
+func (g *Game) rankParticipants() []*players.Player {
+	return g.Players.Ranked()
+}
+
+// Reset returns a channel closed the next time the game goes back to the
+// lobby, so whoever runs a round can abandon it.
+func (g *Game) Reset() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.reset == nil {
+		g.reset = make(chan struct{})
 	}
+	return g.reset
 }
 
 func (g *Game) Scene() Scene {
@@ -102,19 +387,119 @@ func (g *Game) SetScene(s Scene) {
 	g.mu.Lock()
 	g.scene = s
 	g.mu.Unlock()
-	g.Events.SceneChanges <- events.SceneChangeEvent{Scene: string(s)}
+	g.Events.Publish(events.SceneChanged{Scene: string(s)})
 }
 
-func (g *Game) SetTimeLeft(t int) {
+// BeginCombat moves the game from the lobby into combat. It returns false
+// if the game has already left the lobby, so concurrent start requests
+// (everyone readying at once, a host force-start) only start one round.
+func (g *Game) BeginCombat() bool {
+	g.mu.Lock()
+	if g.scene != SceneLobby {
+		g.mu.Unlock()
+		return false
+	}
+	g.scene = SceneCombat
+	if g.ghost != nil {
+		g.layoutSeed = g.ghost.Seed
+	} else {
+		g.layoutSeed = rand.Int63()
+	}
+	g.mu.Unlock()
+	g.Events.Publish(events.SceneChanged{Scene: string(SceneCombat)})
+	return true
+}
+
+// LayoutSeed returns the seed the round's targets are placed from. It is
+// chosen when the game leaves the lobby; recording it lets the round's
+// layout be played again.
+func (g *Game) LayoutSeed() int64 {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	g.timeLeft = t
+	return g.layoutSeed
 }
 
+// SetGhost makes every round from the next one on a race against run, on
+// run's target layout. A nil run ends ghost racing.
+func (g *Game) SetGhost(run *ghost.Run) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ghost = run
+}
+
+// Ghost returns the run being raced, or nil.
+func (g *Game) Ghost() *ghost.Run {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.ghost
+}
+
+// RaceScore records a player's new score against the ghost. It does
+// nothing unless the round is a ghost race.
+func (g *Game) RaceScore(score int) {
+	g.mu.Lock()
+	race := g.race
+	elapsed := time.Duration(g.Config.RoundDuration)*time.Second - g.timeLeftLocked()
+	g.mu.Unlock()
+	if race != nil {
+		race.Record(int(elapsed.Milliseconds()), score)
+	}
+}
+
+// TimeLeft returns the whole seconds left in the round, rounded up.
 func (g *Game) TimeLeft() int {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	return g.timeLeft
+	return secondsCeil(g.timeLeftLocked())
+}
+
+// RoundEndsAt returns the round deadline. ok is false if no round is running
+// or its clock is paused.
+func (g *Game) RoundEndsAt() (endsAt time.Time, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.roundEndsAt, g.inRound && !g.roundEndsAt.IsZero()
+}
+
+// PauseClock freezes the round clock. Returns false if it isn't running.
+func (g *Game) PauseClock() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.inRound || g.roundEndsAt.IsZero() {
+		return false
+	}
+	g.frozenLeft = max(time.Until(g.roundEndsAt), 0)
+	g.roundEndsAt = time.Time{}
+	return true
+}
+
+// ResumeClock restarts a paused round clock, pushing the deadline back by
+// however long it was paused. Returns false if it wasn't paused.
+func (g *Game) ResumeClock() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.inRound || !g.roundEndsAt.IsZero() {
+		return false
+	}
+	g.roundEndsAt = time.Now().Add(g.frozenLeft)
+	g.frozenLeft = 0
+	return true
+}
+
+func (g *Game) timeLeftLocked() time.Duration {
+	switch {
+	case !g.inRound:
+		return 0
+	case g.roundEndsAt.IsZero():
+		return g.frozenLeft
+	default:
+		return max(time.Until(g.roundEndsAt), 0)
+	}
+}
+
+// secondsCeil rounds d up to whole seconds.
+func secondsCeil(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
 }
 
 func (g *Game) SetCurrentGameID(id string) {
@@ -129,31 +514,71 @@ func (g *Game) CurrentGameID() string {
 	return g.currentGameID
 }
 
+// Epoch identifies the current round. It changes whenever a round starts,
+// ends or is reset, so work scheduled during a round can tell that the round
+// has moved on and drop itself.
+func (g *Game) Epoch() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.epoch
+}
+
+// SpawnTarget adds a target to the round identified by epoch. It adds
+// nothing and returns false if that round is no longer running.
+func (g *Game) SpawnTarget(epoch uint64) (*targets.Target, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.inRound || g.epoch != epoch {
+		return nil, false
+	}
+	return g.Targets.Add(), true
+}
+
 func (g *Game) StartRound() {
+	g.mu.Lock()
+	seed := g.layoutSeed
+	g.race = nil
+	if g.ghost != nil {
+		g.race = ghost.NewRace(g.ghost)
+	}
+	g.mu.Unlock()
 	g.Targets.Clear()
+	g.Targets.Seed(seed)
+	spawned := make([]events.Event, 0, g.Config.InitialTargets)
 	for i := 0; i < g.Config.InitialTargets; i++ {
-		g.Targets.Add()
+		t := g.Targets.Add()
+		spawned = append(spawned, events.TargetSpawned{TargetID: t.ID, X: t.X, Y: t.Y, Size: t.Size, Color: t.Color})
 	}
 	g.mu.Lock()
-	g.timeLeft = g.Config.RoundDuration
+	g.epoch++
+	g.inRound = true
+	g.notice = ""
+	g.roundEndsAt = time.Now().Add(time.Duration(g.Config.RoundDuration) * time.Second)
+	g.frozenLeft = 0
 	g.mu.Unlock()
+
+	g.Events.Publish(events.RoundStarted{Duration: g.Config.RoundDuration, Targets: g.Config.InitialTargets})
+	for _, ev := range spawned {
+		g.Events.Publish(ev)
+	}
 }
 
 func (g *Game) EndRound() []*players.Player {
 	g.mu.Lock()
 	g.scene = SceneRecap
+	g.epoch++
+	g.inRound = false
+	g.roundEndsAt = time.Time{}
+	g.frozenLeft = 0
 	g.mu.Unlock()
-	g.Events.SceneChanges <- events.SceneChangeEvent{Scene: string(SceneRecap)}
-
-	ranked := g.Players.GetList()
-	// Sort by score descending
-	for i := 0; i < len(ranked); i++ {
-		for j := i + 1; j < len(ranked); j++ {
-			if ranked[j].Score > ranked[i].Score {
-				ranked[i], ranked[j] = ranked[j], ranked[i]
-			}
-		}
+	g.Events.Publish(events.SceneChanged{Scene: string(SceneRecap)})
+
+	ranked := g.rankParticipants()
+	results := make([]events.PlayerResult, len(ranked))
+	for i, p := range ranked {
+		results[i] = events.PlayerResult{PlayerID: p.ID, Name: p.Name, Score: p.Score}
 	}
+	g.Events.Publish(events.RoundEnded{GameID: g.CurrentGameID(), Results: results})
 	return ranked
 }
 
@@ -162,7 +587,14 @@ func (g *Game) ResetToLobby() {
 	g.Players.ResetAll()
 	g.mu.Lock()
 	g.scene = SceneLobby
-	g.timeLeft = 0
+	g.epoch++
+	g.inRound = false
+	g.roundEndsAt = time.Time{}
+	g.frozenLeft = 0
+	if g.reset != nil {
+		close(g.reset)
+		g.reset = nil
+	}
 	g.mu.Unlock()
-	g.Events.SceneChanges <- events.SceneChangeEvent{Scene: string(SceneLobby)}
+	g.Events.Publish(events.SceneChanged{Scene: string(SceneLobby)})
 }
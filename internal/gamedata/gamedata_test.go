@@ -2,8 +2,10 @@ package gamedata
 
 import (
 	"clicktrainer/internal/events"
+	"clicktrainer/internal/ghost"
 	"clicktrainer/internal/players"
 	"clicktrainer/internal/targets"
+	"strings"
 	"testing"
 	"time"
 )
@@ -26,11 +28,6 @@ func TestNewGame_StartsInLobby(t *testing.T) {
 func TestGame_SetScene(t *testing.T) {
 	g := newTestGame()
 
-	// Drain the event in background
-	go func() {
-		<-g.Events.SceneChanges
-	}()
-
 	g.SetScene(SceneCombat)
 	if g.Scene() != SceneCombat {
 		t.Errorf("scene = %q, want %q", g.Scene(), SceneCombat)
@@ -40,12 +37,13 @@ func TestGame_SetScene(t *testing.T) {
 func TestGame_SetScene_SendsEvent(t *testing.T) {
 	g := newTestGame()
 
-	go g.SetScene(SceneCombat)
+	sub := g.Events.Subscribe("test", 0)
+	g.SetScene(SceneCombat)
 
 	select {
-	case ev := <-g.Events.SceneChanges:
-		if ev.Scene != string(SceneCombat) {
-			t.Errorf("event scene = %q, want %q", ev.Scene, SceneCombat)
+	case ev := <-sub.Events():
+		if sc, ok := ev.(events.SceneChanged); !ok || sc.Scene != string(SceneCombat) {
+			t.Errorf("event = %#v, want scene %q", ev, SceneCombat)
 		}
 	case <-time.After(1 * time.Second):
 		t.Fatal("timed out waiting for scene change event")
@@ -91,6 +89,42 @@ func TestGame_StartRound(t *testing.T) {
 	}
 }
 
+func TestGame_PauseClock(t *testing.T) {
+	g := newTestGame()
+
+	if g.PauseClock() {
+		t.Error("PauseClock should fail outside a round")
+	}
+	g.StartRound()
+	endsAt, ok := g.RoundEndsAt()
+	if !ok || time.Until(endsAt) > time.Duration(g.Config.RoundDuration)*time.Second {
+		t.Fatalf("RoundEndsAt = %v, %v; want a deadline within the round duration", endsAt, ok)
+	}
+
+	if !g.PauseClock() {
+		t.Fatal("PauseClock should succeed during a round")
+	}
+	if _, ok := g.RoundEndsAt(); ok {
+		t.Error("RoundEndsAt should be unavailable while paused")
+	}
+	left := g.TimeLeft()
+	time.Sleep(20 * time.Millisecond)
+	if g.TimeLeft() != left {
+		t.Errorf("TimeLeft moved from %d to %d while paused", left, g.TimeLeft())
+	}
+
+	if !g.ResumeClock() {
+		t.Fatal("ResumeClock should succeed while paused")
+	}
+	resumed, ok := g.RoundEndsAt()
+	if !ok || !resumed.After(endsAt) {
+		t.Errorf("deadline after resume = %v, want later than %v", resumed, endsAt)
+	}
+	if g.ResumeClock() {
+		t.Error("ResumeClock should fail when the clock is running")
+	}
+}
+
 func TestGame_EndRound(t *testing.T) {
 	g := newTestGame()
 	g.Players.Add("p1", "Alice")
@@ -98,11 +132,6 @@ func TestGame_EndRound(t *testing.T) {
 	g.Players.UpdateScore("p1", 50)
 	g.Players.UpdateScore("p2", 100)
 
-	// Drain the event
-	go func() {
-		<-g.Events.SceneChanges
-	}()
-
 	rankings := g.EndRound()
 
 	if g.Scene() != SceneRecap {
@@ -126,11 +155,6 @@ func TestGame_ResetToLobby(t *testing.T) {
 	g.Players.SetReady("p1", true)
 	g.Targets.Add()
 
-	// Drain the event
-	go func() {
-		<-g.Events.SceneChanges
-	}()
-
 	g.ResetToLobby()
 
 	if g.Scene() != SceneLobby {
@@ -154,6 +178,50 @@ func TestGame_ResetToLobby(t *testing.T) {
 	}
 }
 
+func TestGame_EpochChangesAtRoundBoundaries(t *testing.T) {
+	g := newTestGame()
+	seen := map[uint64]bool{g.Epoch(): true}
+	for _, step := range []struct {
+		name string
+		fn   func()
+	}{
+		{"StartRound", g.StartRound},
+		{"EndRound", func() { g.EndRound() }},
+		{"ResetToLobby", g.ResetToLobby},
+		{"StartRound again", g.StartRound},
+	} {
+		step.fn()
+		if seen[g.Epoch()] {
+			t.Errorf("%s reused epoch %d", step.name, g.Epoch())
+		}
+		seen[g.Epoch()] = true
+	}
+}
+
+func TestGame_SpawnTarget(t *testing.T) {
+	g := newTestGame()
+	if _, ok := g.SpawnTarget(g.Epoch()); ok {
+		t.Error("SpawnTarget should add nothing outside a round")
+	}
+
+	g.StartRound()
+	stale := g.Epoch()
+	if _, ok := g.SpawnTarget(stale); !ok {
+		t.Fatal("SpawnTarget should add a target to the running round")
+	}
+
+	g.EndRound()
+	g.ResetToLobby()
+	g.StartRound()
+	before := len(g.Targets.GetList())
+	if _, ok := g.SpawnTarget(stale); ok || len(g.Targets.GetList()) != before {
+		t.Error("a spawn from an earlier round should not reach the new one")
+	}
+	if _, ok := g.SpawnTarget(g.Epoch()); !ok {
+		t.Error("SpawnTarget should accept the current round's epoch")
+	}
+}
+
 func TestDefaultConfig(t *testing.T) {
 	cfg := DefaultConfig()
 	if cfg.RoundDuration != 60 {
@@ -166,3 +234,233 @@ func TestDefaultConfig(t *testing.T) {
 		t.Errorf("CountdownSecs = %d, want 3", cfg.CountdownSecs)
 	}
 }
+
+// startTestRound puts the game into a running round.
+func startTestRound(t *testing.T, g *Game) {
+	t.Helper()
+	if !g.BeginCombat() {
+		t.Fatal("BeginCombat() = false, want true")
+	}
+	g.StartRound()
+}
+
+func TestGame_AddPlayer_OnTime(t *testing.T) {
+	g := newTestGame()
+	g.SetLateJoinPolicy(LateJoinSpectate)
+
+	p := g.AddPlayer("p1", "Alice")
+	if p.LateJoin != "" || p.Spectator {
+		t.Errorf("lobby join should not be late: %+v", p)
+	}
+}
+
+func TestGame_AddPlayer_Spectate(t *testing.T) {
+	g := newTestGame()
+	g.SetLateJoinPolicy(LateJoinSpectate)
+	g.AddPlayer("p1", "Alice")
+	startTestRound(t, g)
+
+	p := g.AddPlayer("p2", "Bob")
+	if !p.Spectator || p.LateJoin != string(LateJoinSpectate) {
+		t.Errorf("late joiner should spectate: %+v", p)
+	}
+	if g.Players.UpdateScore("p2", 3) != nil {
+		t.Error("spectator should not be able to score")
+	}
+
+	recap := g.Recap()
+	if len(recap.Rankings) != 1 || recap.Rankings[0].ID != "p1" {
+		t.Errorf("rankings should only contain p1, got %d", len(recap.Rankings))
+	}
+	if len(recap.Spectators) != 1 || recap.Spectators[0].ID != "p2" {
+		t.Error("spectators should contain p2")
+	}
+
+	g.ResetToLobby()
+	if p := g.Players.Get("p2"); p.Spectator || p.LateJoin != "" {
+		t.Error("spectator should become a normal player in the lobby")
+	}
+}
+
+func TestGame_AddPlayer_Handicap(t *testing.T) {
+	g := newTestGame()
+	g.SetLateJoinPolicy(LateJoinHandicap)
+	startTestRound(t, g)
+
+	p := g.AddPlayer("p1", "Alice")
+	if p.LateJoin != string(LateJoinHandicap) || p.Handicap < 1 {
+		t.Errorf("late joiner should get a handicap: %+v", p)
+	}
+}
+
+func TestGame_AddPlayer_Normal(t *testing.T) {
+	g := newTestGame()
+	startTestRound(t, g)
+
+	p := g.AddPlayer("p1", "Alice")
+	if p.LateJoin != string(LateJoinNormal) || p.Spectator || p.Handicap != 0 {
+		t.Errorf("late joiner should be marked but play normally: %+v", p)
+	}
+}
+
+func TestHandicapFor(t *testing.T) {
+	tests := []struct {
+		elapsed time.Duration
+		want    float64
+	}{
+		{0, 1},
+		{30 * time.Second, 2},
+		{50 * time.Second, maxHandicap},
+		{90 * time.Second, maxHandicap},
+	}
+	for _, tt := range tests {
+		if got := handicapFor(60, tt.elapsed); got != tt.want {
+			t.Errorf("handicapFor(60, %v) = %v, want %v", tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestParseLateJoinPolicy(t *testing.T) {
+	if p, ok := ParseLateJoinPolicy("spectate"); !ok || p != LateJoinSpectate {
+		t.Errorf("ParseLateJoinPolicy(spectate) = %q, %v", p, ok)
+	}
+	if _, ok := ParseLateJoinPolicy("bogus"); ok {
+		t.Error("ParseLateJoinPolicy(bogus) should fail")
+	}
+}
+
+func TestGame_LobbyAction(t *testing.T) {
+	g := newTestGame()
+	g.SetLobbySettings(LobbySettings{MinPlayers: 3, AutoStartPercent: 50})
+	for _, id := range []string{"a", "b", "c", "d"} {
+		g.Players.Add(id, id)
+	}
+
+	if got := g.LobbyAction(); got != LobbyWait {
+		t.Errorf("nobody ready: action = %d, want LobbyWait", got)
+	}
+
+	g.Players.SetReady("a", true)
+	if got := g.LobbyAction(); got != LobbyWait {
+		t.Errorf("1/4 ready: action = %d, want LobbyWait", got)
+	}
+
+	g.Players.SetReady("b", true)
+	if got := g.LobbyAction(); got != LobbyAutoStart {
+		t.Errorf("2/4 ready: action = %d, want LobbyAutoStart", got)
+	}
+
+	// Spectators don't count towards the threshold or the minimum.
+	g.Players.SetSpectator("c", true)
+	g.Players.SetSpectator("d", true)
+	if got := g.LobbyAction(); got != LobbyWait {
+		t.Errorf("below minimum: action = %d, want LobbyWait", got)
+	}
+
+	g.SetLobbySettings(LobbySettings{MinPlayers: 2})
+	if got := g.LobbyAction(); got != LobbyStartNow {
+		t.Errorf("all eligible ready: action = %d, want LobbyStartNow", got)
+	}
+}
+
+func TestParseIdleAction(t *testing.T) {
+	for _, s := range []string{"unready", "spectate"} {
+		if _, ok := ParseIdleAction(s); !ok {
+			t.Errorf("ParseIdleAction(%q) should be valid", s)
+		}
+	}
+	if _, ok := ParseIdleAction("kick"); ok {
+		t.Error("ParseIdleAction(\"kick\") should be invalid")
+	}
+}
+
+func TestGame_PublishesRoundEvents(t *testing.T) {
+	g := newTestGame()
+	sub := g.Events.Subscribe("test", 0)
+
+	g.AddPlayer("p1", "Alice")
+	g.BeginCombat()
+	g.StartRound()
+	g.Players.UpdateScore("p1", 3)
+	g.EndRound()
+	g.Events.Close()
+
+	var types []string
+	var ended events.RoundEnded
+	for ev := range sub.Events() {
+		types = append(types, ev.Type())
+		if re, ok := ev.(events.RoundEnded); ok {
+			ended = re
+		}
+	}
+
+	want := []string{"player_joined", "scene_changed", "round_started"}
+	for range g.Config.InitialTargets {
+		want = append(want, "target_spawned")
+	}
+	want = append(want, "scene_changed", "round_ended")
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", types, want)
+	}
+	if len(ended.Results) != 1 || ended.Results[0].PlayerID != "p1" || ended.Results[0].Score != 3 {
+		t.Errorf("RoundEnded results = %+v, want p1 with 3 points", ended.Results)
+	}
+}
+
+func TestGame_NoticeLastsUntilNextRound(t *testing.T) {
+	g := newTestGame()
+	g.SetNotice("The last round was cut short")
+	if got := g.Get("").Notice; got != "The last round was cut short" {
+		t.Errorf("Get().Notice = %q, want the notice", got)
+	}
+	g.StartRound()
+	if got := g.Notice(); got != "" {
+		t.Errorf("Notice() after StartRound = %q, want it cleared", got)
+	}
+}
+
+func TestGame_GhostRace(t *testing.T) {
+	run := ghost.NewRun("g1", "p0", "Ghost", "#999", 42, []ghost.Hit{{AtMs: 0, Points: 3}})
+
+	// The ghost's round, played again on the same seed.
+	recorded := newTestGame()
+	recorded.Targets.Seed(42)
+	recorded.Targets.Clear()
+	want := make(map[int]targets.Target)
+	for i := 0; i < recorded.Config.InitialTargets; i++ {
+		tg := recorded.Targets.Add()
+		want[tg.ID] = *tg
+	}
+
+	g := newTestGame()
+	g.SetGhost(run)
+	g.Players.Add("p1", "Alice")
+	g.BeginCombat()
+	if g.LayoutSeed() != 42 {
+		t.Fatalf("LayoutSeed() = %d, want the ghost's", g.LayoutSeed())
+	}
+	g.StartRound()
+	for _, tg := range g.Targets.GetList() {
+		if w := want[tg.ID]; tg.X != w.X || tg.Y != w.Y || tg.Size != w.Size {
+			t.Errorf("target %d = %+v, want the ghost's %+v", tg.ID, *tg, w)
+		}
+	}
+
+	g.RaceScore(4)
+	g.EndRound()
+	res := g.Recap().Ghost
+	if res == nil || res.Name != "Ghost" || res.Lead != 1 {
+		t.Errorf("Recap().Ghost = %+v, want a lead of 1 over the ghost", res)
+	}
+}
+
+func TestGame_NoGhost(t *testing.T) {
+	g := newTestGame()
+	g.BeginCombat()
+	g.StartRound()
+	g.RaceScore(4)
+	g.EndRound()
+	if res := g.Recap().Ghost; res != nil {
+		t.Errorf("Recap().Ghost = %+v, want nil without a ghost", res)
+	}
+}
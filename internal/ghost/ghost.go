@@ -0,0 +1,167 @@
+// Package ghost lets a player race a recorded run. The round replays the
+// run's seeded target layout, and the ghost's hits come at the times they
+// were recorded.
+package ghost
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Hit is one target the ghost took.
+type Hit struct {
+	AtMs   int `json:"at_ms"` // since the round started
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Size   int `json:"size"`
+	Points int `json:"points"`
+}
+
+// Run is a recorded run that can be raced.
+type Run struct {
+	GameID   string `json:"game_id"`
+	PlayerID string `json:"player_id"`
+	Name     string `json:"name"`
+	Color    string `json:"color"`
+	Score    int    `json:"score"` // the points of all hits
+	Seed     int64  `json:"seed"`  // the round's target layout
+	Hits     []Hit  `json:"hits"`  // in time order
+}
+
+// NewRun builds a run from its hits, putting them in time order and adding
+// up the score.
+func NewRun(gameID, playerID, name, color string, seed int64, hits []Hit) *Run {
+	sorted := append([]Hit(nil), hits...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].AtMs < sorted[j].AtMs })
+	run := &Run{GameID: gameID, PlayerID: playerID, Name: name, Color: color, Seed: seed, Hits: sorted}
+	for _, h := range sorted {
+		run.Score += h.Points
+	}
+	return run
+}
+
+// ScoreAt returns the ghost's score ms into the round.
+func (r *Run) ScoreAt(ms int) int {
+	score := 0
+	for _, h := range r.Hits {
+		if h.AtMs > ms {
+			break
+		}
+		score += h.Points
+	}
+	return score
+}
+
+// Point is a score or lead from AtMs on.
+type Point struct {
+	AtMs  int
+	Value int
+}
+
+// Race follows a player through one round against a ghost.
+type Race struct {
+	Ghost *Run
+
+	mu    sync.Mutex
+	steps []Point // the player's score after each change, in time order
+}
+
+func NewRace(run *Run) *Race {
+	return &Race{Ghost: run}
+}
+
+// Record notes the player's score ms into the round.
+func (r *Race) Record(ms, score int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n := len(r.steps); n > 0 && ms < r.steps[n-1].AtMs {
+		ms = r.steps[n-1].AtMs
+	}
+	r.steps = append(r.steps, Point{AtMs: ms, Value: score})
+}
+
+// Lead returns the player's lead over the ghost, negative when behind,
+// from the start of the round to durationMs. There is a point at the start,
+// at every change of either score and at the end.
+func (r *Race) Lead(durationMs int) []Point {
+	r.mu.Lock()
+	steps := append([]Point(nil), r.steps...)
+	r.mu.Unlock()
+
+	times := []int{0, durationMs}
+	for _, s := range steps {
+		times = append(times, s.AtMs)
+	}
+	for _, h := range r.Ghost.Hits {
+		times = append(times, h.AtMs)
+	}
+	sort.Ints(times)
+
+	lead := make([]Point, 0, len(times))
+	score, next := 0, 0
+	for i, t := range times {
+		if t > durationMs || (i > 0 && t == times[i-1]) {
+			continue
+		}
+		for next < len(steps) && steps[next].AtMs <= t {
+			score = steps[next].Value
+			next++
+		}
+		lead = append(lead, Point{AtMs: t, Value: score - r.Ghost.ScoreAt(t)})
+	}
+	return lead
+}
+
+// Chart size for Result.Points.
+const (
+	ChartWidth  = 300
+	ChartHeight = 100
+)
+
+// Result is how a race went, for the recap.
+type Result struct {
+	Name       string // the ghost's
+	Color      string
+	GhostScore int
+	Lead       int    // at the end; negative when the ghost won
+	Margin     int    // Lead without the sign
+	MaxLead    int    // furthest ahead the player got
+	MaxDeficit int    // furthest behind the player fell, as a positive number
+	Points     string // SVG polyline of the lead over time, ChartWidth by ChartHeight
+	ZeroY      int    // y of the level line
+}
+
+// Result sums up a race that lasted durationMs.
+func (r *Race) Result(durationMs int) *Result {
+	lead := r.Lead(durationMs)
+	res := &Result{
+		Name:       r.Ghost.Name,
+		Color:      r.Ghost.Color,
+		GhostScore: r.Ghost.ScoreAt(durationMs),
+		ZeroY:      ChartHeight / 2,
+	}
+	for _, p := range lead {
+		res.MaxLead = max(res.MaxLead, p.Value)
+		res.MaxDeficit = max(res.MaxDeficit, -p.Value)
+	}
+	if n := len(lead); n > 0 {
+		res.Lead = lead[n-1].Value
+	}
+	res.Margin = max(res.Lead, -res.Lead)
+
+	// Scores move in steps, so the line does too: across, then up or down.
+	scale := max(res.MaxLead, res.MaxDeficit, 1)
+	x := func(ms int) int { return ms * ChartWidth / max(durationMs, 1) }
+	y := func(v int) int { return res.ZeroY - v*(ChartHeight/2-4)/scale }
+	var pts strings.Builder
+	for i, p := range lead {
+		if i > 0 && lead[i-1].Value != p.Value {
+			fmt.Fprintf(&pts, "%d,%d ", x(p.AtMs), y(lead[i-1].Value))
+		}
+		fmt.Fprintf(&pts, "%d,%d ", x(p.AtMs), y(p.Value))
+	}
+	res.Points = strings.TrimSpace(pts.String())
+	return res
+}
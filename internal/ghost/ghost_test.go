@@ -0,0 +1,61 @@
+package ghost
+
+import (
+	"slices"
+	"testing"
+)
+
+func sampleRun() *Run {
+	return NewRun("g1", "p1", "Alice", "#f00", 42, []Hit{
+		{AtMs: 3000, Points: 2},
+		{AtMs: 1000, Points: 3},
+	})
+}
+
+func TestNewRun(t *testing.T) {
+	run := sampleRun()
+	if run.Hits[0].AtMs != 1000 || run.Score != 5 {
+		t.Errorf("run = %+v, want hits in time order and a score of 5", run)
+	}
+}
+
+func TestRun_ScoreAt(t *testing.T) {
+	run := sampleRun()
+	for ms, want := range map[int]int{0: 0, 999: 0, 1000: 3, 2999: 3, 3000: 5, 60000: 5} {
+		if got := run.ScoreAt(ms); got != want {
+			t.Errorf("ScoreAt(%d) = %d, want %d", ms, got, want)
+		}
+	}
+}
+
+func TestRace_Lead(t *testing.T) {
+	race := NewRace(sampleRun())
+	race.Record(2000, 4)
+	race.Record(5000, 6)
+
+	got := race.Lead(10000)
+	want := []Point{{0, 0}, {1000, -3}, {2000, 1}, {3000, -1}, {5000, 1}, {10000, 1}}
+	if !slices.Equal(got, want) {
+		t.Errorf("Lead() = %v, want %v", got, want)
+	}
+}
+
+func TestRace_Result(t *testing.T) {
+	race := NewRace(sampleRun())
+	race.Record(2000, 4)
+
+	res := race.Result(4000)
+
+	if res.Lead != -1 || res.Margin != 1 || res.GhostScore != 5 {
+		t.Errorf("result = %+v, want the ghost ahead by 1 on 5", res)
+	}
+	if res.MaxLead != 1 || res.MaxDeficit != 3 {
+		t.Errorf("max lead/deficit = %d/%d, want 1/3", res.MaxLead, res.MaxDeficit)
+	}
+	// Starts level at the left edge, steps with each hit and ends at the
+	// right edge a third of the way down to the biggest deficit.
+	want := "0,50 75,50 75,96 150,96 150,35 225,35 225,65 300,65"
+	if res.Points != want {
+		t.Errorf("points = %q, want %q", res.Points, want)
+	}
+}
@@ -0,0 +1,77 @@
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const fileExt = ".jsonl.gz"
+
+// FileStore keeps each journal in its own gzip file in a directory. The
+// files can be read with zcat.
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore creates dir if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating journal directory: %w", err)
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+func (f *FileStore) path(id string) string {
+	return filepath.Join(f.Dir, filepath.Base(id)+fileExt)
+}
+
+func (f *FileStore) Append(id string, chunk []byte) error {
+	file, err := os.OpenFile(f.path(id), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening journal: %w", err)
+	}
+	if _, err := file.Write(chunk); err != nil {
+		file.Close()
+		return fmt.Errorf("appending to journal: %w", err)
+	}
+	return file.Close()
+}
+
+func (f *FileStore) Open(id string) (io.ReadCloser, error) {
+	file, err := os.Open(f.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening journal: %w", err)
+	}
+	return file, nil
+}
+
+func (f *FileStore) Prune(cutoff time.Time) (int, error) {
+	entries, err := os.ReadDir(f.Dir)
+	if err != nil {
+		return 0, fmt.Errorf("listing journals: %w", err)
+	}
+	pruned := 0
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), fileExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(f.Dir, e.Name())); err != nil {
+			return pruned, fmt.Errorf("deleting journal: %w", err)
+		}
+		pruned++
+	}
+	return pruned, nil
+}
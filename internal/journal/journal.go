@@ -0,0 +1,230 @@
+// Package journal keeps an append-only record of every event in a room, in
+// compressed JSON lines, from which the room's game state can be rebuilt.
+package journal
+
+import (
+	"bytes"
+	"clicktrainer/internal/events"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultFlushInterval is how long a Writer holds events before writing
+// them out.
+const DefaultFlushInterval = time.Second
+
+// ErrNotFound is returned for a journal that doesn't exist.
+var ErrNotFound = errors.New("journal not found")
+
+// Store keeps journals as sequences of gzip members, each holding some
+// JSON lines. Read as one stream they decompress to the whole journal.
+type Store interface {
+	// Append adds a compressed chunk to the end of a journal, creating the
+	// journal if needed.
+	Append(id string, chunk []byte) error
+	// Open returns a journal's chunks, in order, as one stream.
+	Open(id string) (io.ReadCloser, error)
+	// Prune deletes journals last written before cutoff and returns how
+	// many it deleted.
+	Prune(cutoff time.Time) (int, error)
+}
+
+// ID names the journal of a room. Codes are reused once a room closes, so
+// the room's creation time is part of it; a room restored after a restart
+// keeps its creation time and carries on the same journal.
+func ID(code string, createdAt time.Time) string {
+	return code + "-" + strconv.FormatInt(createdAt.UnixMilli(), 10)
+}
+
+// Entry is one line of a journal.
+type Entry struct {
+	Seq   uint64 // 1 for the first event in the journal
+	At    time.Time
+	Event events.Event
+}
+
+type entryJSON struct {
+	Seq  uint64          `json:"seq"`
+	At   time.Time       `json:"at"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func (e Entry) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(e.Event)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(entryJSON{Seq: e.Seq, At: e.At, Type: e.Event.Type(), Data: data})
+}
+
+func (e *Entry) UnmarshalJSON(b []byte) error {
+	var raw entryJSON
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	decode, ok := decoders[raw.Type]
+	if !ok {
+		return fmt.Errorf("unknown event type %q", raw.Type)
+	}
+	ev, err := decode(raw.Data)
+	if err != nil {
+		return fmt.Errorf("decoding %s: %w", raw.Type, err)
+	}
+	*e = Entry{Seq: raw.Seq, At: raw.At, Event: ev}
+	return nil
+}
+
+var decoders = map[string]func(json.RawMessage) (events.Event, error){
+	events.SceneChanged{}.Type():       decodeAs[events.SceneChanged],
+	events.PlayerJoined{}.Type():       decodeAs[events.PlayerJoined],
+	events.PlayerLeft{}.Type():         decodeAs[events.PlayerLeft],
+	events.PlayerReady{}.Type():        decodeAs[events.PlayerReady],
+	events.RoundStarted{}.Type():       decodeAs[events.RoundStarted],
+	events.TargetSpawned{}.Type():      decodeAs[events.TargetSpawned],
+	events.TargetKilled{}.Type():       decodeAs[events.TargetKilled],
+	events.ScoreChanged{}.Type():       decodeAs[events.ScoreChanged],
+	events.RoundEnded{}.Type():         decodeAs[events.RoundEnded],
+	events.BadgeAwarded{}.Type():       decodeAs[events.BadgeAwarded],
+	events.PersonalBest{}.Type():       decodeAs[events.PersonalBest],
+	events.LeaderboardChanged{}.Type(): decodeAs[events.LeaderboardChanged],
+}
+
+func decodeAs[T events.Event](data json.RawMessage) (events.Event, error) {
+	var ev T
+	err := json.Unmarshal(data, &ev)
+	return ev, err
+}
+
+// Read returns every entry of a journal, oldest first.
+func Read(store Store, id string) ([]Entry, error) {
+	rc, err := store.Open(id)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		return nil, fmt.Errorf("reading journal %s: %w", id, err)
+	}
+	var entries []Entry
+	dec := json.NewDecoder(zr)
+	for {
+		var e Entry
+		err := dec.Decode(&e)
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, fmt.Errorf("reading journal %s: %w", id, err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// Writer appends one room's events to its journal. It is an
+// events.Recorder: events are buffered and written as a compressed chunk
+// at most a flush interval after they happen, and when the bus closes. A
+// chunk that fails to write is kept and retried with the next one.
+type Writer struct {
+	store    Store
+	id       string
+	interval time.Duration
+
+	mu      sync.Mutex
+	seq     uint64
+	buf     []byte      // JSON lines not yet written
+	pending *time.Timer // flush scheduled for buffered events
+	closed  bool
+
+	flushMu sync.Mutex // keeps chunks in order
+}
+
+func NewWriter(store Store, id string, interval time.Duration) *Writer {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	return &Writer{store: store, id: id, interval: interval}
+}
+
+// Record adds an event to the journal.
+func (w *Writer) Record(ev events.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.seq++
+	line, err := json.Marshal(Entry{Seq: w.seq, At: time.Now(), Event: ev})
+	if err != nil {
+		slog.Error("journal entry not encodable", "component", "journal", "journal", w.id, "type", ev.Type(), "error", err)
+		return
+	}
+	w.buf = append(append(w.buf, line...), '\n')
+	w.scheduleLocked()
+}
+
+func (w *Writer) scheduleLocked() {
+	if w.pending == nil {
+		w.pending = time.AfterFunc(w.interval, func() {
+			if err := w.Flush(); err != nil {
+				slog.Error("writing journal failed", "component", "journal", "journal", w.id, "error", err)
+			}
+		})
+	}
+}
+
+// Flush writes buffered events now.
+func (w *Writer) Flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	if w.pending != nil {
+		w.pending.Stop()
+		w.pending = nil
+	}
+	lines := w.buf
+	w.buf = nil
+	w.mu.Unlock()
+	if len(lines) == 0 {
+		return nil
+	}
+
+	var chunk bytes.Buffer
+	zw := gzip.NewWriter(&chunk)
+	if _, err := zw.Write(lines); err != nil {
+		return fmt.Errorf("compressing journal: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("compressing journal: %w", err)
+	}
+	if err := w.store.Append(w.id, chunk.Bytes()); err != nil {
+		// Put the lines back in front of anything recorded since.
+		w.mu.Lock()
+		w.buf = append(lines, w.buf...)
+		if !w.closed {
+			w.scheduleLocked()
+		}
+		w.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close writes what is left and stops recording.
+func (w *Writer) Close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	if err := w.Flush(); err != nil {
+		slog.Error("writing journal failed", "component", "journal", "journal", w.id, "error", err)
+	}
+}
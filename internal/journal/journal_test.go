@@ -0,0 +1,120 @@
+package journal
+
+import (
+	"clicktrainer/internal/events"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newFileStore(t *testing.T) *FileStore {
+	t.Helper()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestWriter_RoundTrip(t *testing.T) {
+	store := newFileStore(t)
+	bus := events.NewBus()
+	w := NewWriter(store, "ABCD-1", time.Hour)
+	bus.AddRecorder(w)
+
+	bus.Publish(events.PlayerJoined{PlayerID: "p1", Name: "Alice", Color: "#fff"})
+	bus.Publish(events.TargetSpawned{TargetID: 1, X: 10, Y: 20, Size: 60, Color: "#000"})
+	if err := w.Flush(); err != nil { // a second chunk follows
+		t.Fatal(err)
+	}
+	bus.Publish(events.TargetKilled{TargetID: 1, PlayerID: "p1", Points: 3})
+	bus.Close() // writes the rest
+
+	entries, err := Read(store, "ABCD-1")
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("read %d entries, want 3", len(entries))
+	}
+	for i, e := range entries {
+		if e.Seq != uint64(i+1) || e.At.IsZero() {
+			t.Errorf("entry %d = seq %d at %v, want seq %d with a time", i, e.Seq, e.At, i+1)
+		}
+	}
+	if ev, ok := entries[1].Event.(events.TargetSpawned); !ok || ev.Size != 60 || ev.X != 10 {
+		t.Errorf("entry 2 = %#v, want the spawn with its geometry", entries[1].Event)
+	}
+	if ev, ok := entries[2].Event.(events.TargetKilled); !ok || ev.Points != 3 {
+		t.Errorf("entry 3 = %#v, want the kill", entries[2].Event)
+	}
+}
+
+func TestRead_Missing(t *testing.T) {
+	if _, err := Read(newFileStore(t), "nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() error = %v, want ErrNotFound", err)
+	}
+}
+
+// flakyStore fails the first append.
+type flakyStore struct {
+	*FileStore
+	failed bool
+}
+
+func (f *flakyStore) Append(id string, chunk []byte) error {
+	if !f.failed {
+		f.failed = true
+		return errors.New("disk full")
+	}
+	return f.FileStore.Append(id, chunk)
+}
+
+func TestWriter_RetriesFailedChunk(t *testing.T) {
+	store := &flakyStore{FileStore: newFileStore(t)}
+	w := NewWriter(store, "ABCD-1", time.Hour)
+	w.Record(events.PlayerJoined{PlayerID: "p1"})
+	if err := w.Flush(); err == nil {
+		t.Fatal("Flush() should report the failed write")
+	}
+	w.Record(events.PlayerLeft{PlayerID: "p1"})
+	w.Close()
+
+	entries, err := Read(store, "ABCD-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Event.Type() != "player_joined" {
+		t.Errorf("entries = %+v, want the failed chunk written before the next", entries)
+	}
+}
+
+func TestFileStore_Prune(t *testing.T) {
+	store := newFileStore(t)
+	for _, id := range []string{"OLD-1", "NEW-2"} {
+		if err := store.Append(id, []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(store.Dir, "OLD-1"+fileExt), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := store.Prune(time.Now().Add(-24 * time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("Prune() = %d, %v; want 1", n, err)
+	}
+	if _, err := store.Open("OLD-1"); !errors.Is(err, ErrNotFound) {
+		t.Error("the old journal should be gone")
+	}
+	rc, err := store.Open("NEW-2")
+	if err != nil {
+		t.Fatal("the recent journal should be kept")
+	}
+	io.Copy(io.Discard, rc)
+	rc.Close()
+}
@@ -0,0 +1,68 @@
+package journal
+
+import (
+	"bytes"
+	"clicktrainer/internal/db"
+	"fmt"
+	"io"
+	"time"
+)
+
+// PGStore keeps journals in PostgreSQL, one row per chunk.
+type PGStore struct {
+	DB *db.DB
+}
+
+func NewPGStore(database *db.DB) *PGStore {
+	return &PGStore{DB: database}
+}
+
+func (p *PGStore) Append(id string, chunk []byte) error {
+	_, err := p.DB.Exec(`INSERT INTO room_journal_chunks (journal_id, chunk) VALUES ($1, $2)`, id, chunk)
+	if err != nil {
+		return fmt.Errorf("appending to journal: %w", err)
+	}
+	return nil
+}
+
+func (p *PGStore) Open(id string) (io.ReadCloser, error) {
+	rows, err := p.DB.Query(`SELECT chunk FROM room_journal_chunks WHERE journal_id = $1 ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+	defer rows.Close()
+
+	var all bytes.Buffer
+	for rows.Next() {
+		var chunk []byte
+		if err := rows.Scan(&chunk); err != nil {
+			return nil, err
+		}
+		all.Write(chunk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if all.Len() == 0 {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(&all), nil
+}
+
+func (p *PGStore) Prune(cutoff time.Time) (int, error) {
+	var pruned int
+	err := p.DB.QueryRow(`
+		WITH expired AS (
+			SELECT journal_id FROM room_journal_chunks
+			GROUP BY journal_id
+			HAVING max(written_at) < $1
+		), deleted AS (
+			DELETE FROM room_journal_chunks WHERE journal_id IN (SELECT journal_id FROM expired)
+		)
+		SELECT count(*) FROM expired
+	`, cutoff).Scan(&pruned)
+	if err != nil {
+		return 0, fmt.Errorf("pruning journals: %w", err)
+	}
+	return pruned, nil
+}
@@ -0,0 +1,73 @@
+package journal
+
+import (
+	"clicktrainer/internal/db"
+	"clicktrainer/internal/events"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func getTestStore(t *testing.T) *PGStore {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping database tests")
+	}
+	database, err := db.Connect(dsn)
+	if err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate() error: %v", err)
+	}
+	t.Cleanup(func() {
+		// Clean up test data; errors here are intentionally ignored.
+		_, _ = database.Exec("DELETE FROM room_journal_chunks")
+		database.Close()
+	})
+	return NewPGStore(database)
+}
+
+func TestPGStore_RoundTrip(t *testing.T) {
+	store := getTestStore(t)
+	w := NewWriter(store, "ABCD-1", time.Hour)
+	w.Record(events.PlayerJoined{PlayerID: "p1", Name: "Alice"})
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	w.Record(events.ScoreChanged{PlayerID: "p1", Delta: 3, Score: 3})
+	w.Close()
+
+	entries, err := Read(store, "ABCD-1")
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	if len(entries) != 2 || entries[1].Event.(events.ScoreChanged).Score != 3 {
+		t.Errorf("entries = %+v, want both chunks in order", entries)
+	}
+}
+
+func TestPGStore_Prune(t *testing.T) {
+	store := getTestStore(t)
+	for _, id := range []string{"OLD-1", "NEW-2"} {
+		if err := store.Append(id, []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.DB.Exec(`UPDATE room_journal_chunks SET written_at = now() - interval '2 days' WHERE journal_id = 'OLD-1'`); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := store.Prune(time.Now().Add(-24 * time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("Prune() = %d, %v; want 1", n, err)
+	}
+	if _, err := store.Open("OLD-1"); !errors.Is(err, ErrNotFound) {
+		t.Error("the old journal should be gone")
+	}
+	if _, err := store.Open("NEW-2"); err != nil {
+		t.Errorf("the recent journal should be kept: %v", err)
+	}
+}
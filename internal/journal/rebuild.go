@@ -0,0 +1,41 @@
+package journal
+
+import (
+	"clicktrainer/internal/events"
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/players"
+	"clicktrainer/internal/targets"
+)
+
+// Rebuild replays a journal into a new game: its players, ready flags,
+// scores, scene and live targets as they stood after the last entry.
+// Late-join status and handicaps aren't journaled; recorded score changes
+// already include any handicap.
+func Rebuild(entries []Entry, cfg gamedata.Config) *gamedata.Game {
+	g := gamedata.NewGame(players.NewStore(), targets.NewStore(), events.NewBus(), cfg)
+	for _, e := range entries {
+		switch ev := e.Event.(type) {
+		case events.PlayerJoined:
+			g.Players.Restore(players.Player{ID: ev.PlayerID, Name: ev.Name, Color: ev.Color, JoinedAt: e.At})
+		case events.PlayerLeft:
+			g.Players.Remove(ev.PlayerID)
+		case events.PlayerReady:
+			g.Players.SetReady(ev.PlayerID, ev.Ready)
+		case events.SceneChanged:
+			if gamedata.Scene(ev.Scene) == gamedata.SceneLobby {
+				g.ResetToLobby() // the only way back to the lobby
+			} else {
+				g.SetScene(gamedata.Scene(ev.Scene))
+			}
+		case events.RoundStarted:
+			g.Targets.Clear()
+		case events.TargetSpawned:
+			g.Targets.Restore(targets.Target{ID: ev.TargetID, X: ev.X, Y: ev.Y, Size: ev.Size, Color: ev.Color, SpawnedAt: e.At})
+		case events.TargetKilled:
+			g.Targets.Kill(ev.TargetID)
+		case events.ScoreChanged:
+			g.Players.UpdateScore(ev.PlayerID, ev.Delta)
+		}
+	}
+	return g
+}
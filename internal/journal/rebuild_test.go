@@ -0,0 +1,103 @@
+package journal
+
+import (
+	"clicktrainer/internal/events"
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/players"
+	"clicktrainer/internal/targets"
+	"slices"
+	"testing"
+	"time"
+)
+
+// kill takes a target the way the server does.
+func kill(g *gamedata.Game, playerID string, targetID, points int) {
+	if !g.Targets.Kill(targetID) {
+		return
+	}
+	gained, score, ok := g.Players.AddPoints(playerID, points)
+	if !ok {
+		return
+	}
+	g.Events.Publish(events.TargetKilled{TargetID: targetID, PlayerID: playerID, Points: points})
+	g.Events.Publish(events.ScoreChanged{PlayerID: playerID, Delta: gained, Score: score})
+}
+
+func TestRebuild_MatchesLiveGame(t *testing.T) {
+	store := newFileStore(t)
+	cfg := gamedata.Config{RoundDuration: 60, InitialTargets: 3, CountdownSecs: 0}
+	live := gamedata.NewGame(players.NewStore(), targets.NewStore(), events.NewBus(), cfg)
+	w := NewWriter(store, "ABCD-1", time.Hour)
+	live.Events.AddRecorder(w)
+
+	live.AddPlayer("p1", "Alice")
+	live.AddPlayer("p2", "Bob")
+	live.AddPlayer("p3", "Carol")
+	live.SetReady("p1", true)
+	live.SetReady("p2", true)
+	live.BeginCombat()
+	live.StartRound()
+	ids := []int{}
+	for _, tg := range live.Targets.GetList() {
+		ids = append(ids, tg.ID)
+	}
+	slices.Sort(ids)
+	kill(live, "p2", ids[0], 3)
+	kill(live, "p1", ids[1], 3)
+	live.Players.Remove("p3")
+	live.Events.Publish(events.PlayerLeft{PlayerID: "p3"})
+
+	check := func(stage string) {
+		t.Helper()
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := Read(store, "ABCD-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Rebuild(entries, cfg)
+		if got.Scene() != live.Scene() {
+			t.Errorf("%s: scene = %s, want %s", stage, got.Scene(), live.Scene())
+		}
+		if got.Players.Count() != live.Players.Count() {
+			t.Errorf("%s: %d players, want %d", stage, got.Players.Count(), live.Players.Count())
+		}
+		for _, want := range live.Players.GetList() {
+			p := got.Players.Get(want.ID)
+			if p == nil || p.Name != want.Name || p.Color != want.Color || p.Score != want.Score || p.Ready != want.Ready {
+				t.Errorf("%s: player %s = %+v, want %+v", stage, want.ID, p, want)
+			}
+		}
+		if g, l := standings(got), standings(live); !slices.Equal(g, l) {
+			t.Errorf("%s: ranking = %v, want %v", stage, g, l)
+		}
+		if g, l := targetIDs(got), targetIDs(live); !slices.Equal(g, l) {
+			t.Errorf("%s: live targets = %v, want %v", stage, g, l)
+		}
+	}
+	check("mid-round")
+
+	live.EndRound()
+	check("recap")
+
+	live.ResetToLobby()
+	check("lobby")
+}
+
+func standings(g *gamedata.Game) []string {
+	var ids []string
+	for _, p := range g.Players.Ranked() {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func targetIDs(g *gamedata.Game) []int {
+	var ids []int
+	for _, t := range g.Targets.GetList() {
+		ids = append(ids, t.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -14,11 +14,14 @@ type Metrics struct {
 	// SSE / WebSocket
 	SSEConnectionsActive    prometheus.Gauge
 	SSEMessagesPublished    *prometheus.CounterVec
+	SSEResumesTotal         *prometheus.CounterVec
 	WSConnectionsActive     prometheus.Gauge
 
 	// Rooms & Players
 	RoomsCreatedTotal    prometheus.Counter
 	RoomsActive          prometheus.Gauge
+	RoomsExpiredTotal    *prometheus.CounterVec
+	RoomsForwardedTotal  *prometheus.CounterVec
 	PlayersRegisteredTotal prometheus.Counter
 	PlayersActive        prometheus.Gauge
 
@@ -35,6 +38,16 @@ type Metrics struct {
 	ClickBufferDepth      prometheus.Gauge
 	ClickBatchFlushesTotal prometheus.Counter
 	DBWriteErrorsTotal    *prometheus.CounterVec
+	DBAttached            prometheus.Gauge
+	ClickBatchesSpooledTotal *prometheus.CounterVec
+	ClickBatchesRejectedTotal prometheus.Counter
+	ClickSpoolBatches     prometheus.Gauge
+	ClickSpoolBytes       prometheus.Gauge
+	ClickSpoolAgeSeconds  prometheus.Gauge
+
+	// Room event bus
+	EventsPublishedTotal *prometheus.CounterVec
+	EventsDroppedTotal   *prometheus.CounterVec
 
 	// Frontend (received via POST /telemetry)
 	FrontendJSErrorsTotal        prometheus.Counter
@@ -73,6 +86,11 @@ func New() *Metrics {
 			Help: "Total SSE messages published by event type.",
 		}, []string{"event_type"}),
 
+		SSEResumesTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "sse_resumes_total",
+			Help: "SSE reconnects with Last-Event-ID, by whether missed messages were replayed or a full resync was sent.",
+		}, []string{"result"}),
+
 		WSConnectionsActive: promauto.NewGauge(prometheus.GaugeOpts{
 			Name: "ws_connections_active",
 			Help: "Number of active WebSocket connections.",
@@ -88,6 +106,15 @@ func New() *Metrics {
 			Help: "Current number of active rooms.",
 		}),
 
+		RoomsExpiredTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "rooms_expired_total",
+			Help: "Total rooms closed for inactivity, by reason.",
+		}, []string{"reason"}),
+		RoomsForwardedTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "rooms_forwarded_requests_total",
+			Help: "Total requests sent on to the instance that owns their room, by mode.",
+		}, []string{"mode"}),
+
 		PlayersRegisteredTotal: promauto.NewCounter(prometheus.CounterOpts{
 			Name: "players_registered_total",
 			Help: "Total players registered.",
@@ -150,6 +177,46 @@ func New() *Metrics {
 			Help: "Total database write errors by operation.",
 		}, []string{"operation"}),
 
+		DBAttached: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "db_attached",
+			Help: "1 while the database is attached, 0 while it is unavailable.",
+		}),
+
+		ClickBatchesSpooledTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "click_batches_spooled_total",
+			Help: "Total click batches spooled to disk for a later retry, by reason.",
+		}, []string{"reason"}),
+
+		ClickBatchesRejectedTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "click_batches_rejected_total",
+			Help: "Total click batches the database rejected, moved to the spool's dead-letter file.",
+		}),
+
+		ClickSpoolBatches: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "click_spool_batches",
+			Help: "Click batches waiting in the spool.",
+		}),
+
+		ClickSpoolBytes: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "click_spool_bytes",
+			Help: "Size of the click spool file in bytes.",
+		}),
+
+		ClickSpoolAgeSeconds: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "click_spool_oldest_age_seconds",
+			Help: "Age of the oldest click batch in the spool; 0 when it is empty.",
+		}),
+
+		EventsPublishedTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "room_events_total",
+			Help: "Total room events seen by the metrics subscriber, by type.",
+		}, []string{"type"}),
+
+		EventsDroppedTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "room_events_dropped_total",
+			Help: "Total room events a subscriber missed because its queue was full, by subscriber.",
+		}, []string{"subscriber"}),
+
 		FrontendJSErrorsTotal: promauto.NewCounter(prometheus.CounterOpts{
 			Name: "frontend_js_errors_total",
 			Help: "Total JavaScript errors reported by clients.",
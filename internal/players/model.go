@@ -1,9 +1,19 @@
 package players
 
+import "time"
+
 type Player struct {
-	ID    string
-	Name  string
-	Color string
-	Score int
-	Ready bool
+	ID       string
+	Name     string
+	Color    string
+	Score    int
+	Ready    bool
+	JoinedAt time.Time
+	Away     bool      // no live connection; removed if they don't come back
+	LastSeen time.Time // last lobby activity, for the idle timeout
+
+	// Late-join state; cleared when the room returns to the lobby.
+	LateJoin  string  // late-join policy applied when joining mid-round; empty if on time
+	Spectator bool    // watching the current round, cannot score
+	Handicap  float64 // multiplier applied to points scored; 0 means none
 }
@@ -0,0 +1,227 @@
+package players
+
+import "math/rand/v2"
+
+// RankChange is a player moving on the scoreboard. A rank of 0 means
+// unranked: not yet in the store, removed, or spectating.
+type RankChange struct {
+	PlayerID string
+	Old, New int
+}
+
+// rankKey orders players on the scoreboard: higher score first, then
+// whoever reached that score first. Sequence numbers are unique, so no two
+// players ever tie.
+type rankKey struct {
+	score int
+	seq   uint64 // when the score was reached; lower is earlier
+	id    string
+}
+
+// before reports whether a ranks above b.
+func (a rankKey) before(b rankKey) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	if a.seq != b.seq {
+		return a.seq < b.seq
+	}
+	return a.id < b.id
+}
+
+// ranking is an order-statistic treap over the players taking part in the
+// round. Inserts, removals and rank lookups are O(log n); reading the top n
+// is O(n + log n).
+type ranking struct {
+	root *rankNode
+	keys map[string]rankKey
+	seq  uint64
+}
+
+type rankNode struct {
+	key         rankKey
+	player      *Player
+	prio        uint32
+	size        int
+	left, right *rankNode
+}
+
+func newRanking() *ranking {
+	return &ranking{keys: make(map[string]rankKey)}
+}
+
+func (r *ranking) len() int {
+	return r.root.count()
+}
+
+func (n *rankNode) count() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *rankNode) fix() {
+	n.size = 1 + n.left.count() + n.right.count()
+}
+
+// split divides t into the nodes ranking above k and the rest.
+func split(t *rankNode, k rankKey) (above, rest *rankNode) {
+	if t == nil {
+		return nil, nil
+	}
+	if t.key.before(k) {
+		t.right, rest = split(t.right, k)
+		t.fix()
+		return t, rest
+	}
+	above, t.left = split(t.left, k)
+	t.fix()
+	return above, t
+}
+
+// merge joins two treaps where every node of a ranks above every node of b.
+func merge(a, b *rankNode) *rankNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.prio > b.prio {
+		a.right = merge(a.right, b)
+		a.fix()
+		return a
+	}
+	b.left = merge(a, b.left)
+	b.fix()
+	return b
+}
+
+// erase removes the node with key k from t.
+func erase(t *rankNode, k rankKey) *rankNode {
+	if t == nil {
+		return nil
+	}
+	switch {
+	case t.key == k:
+		return merge(t.left, t.right)
+	case k.before(t.key):
+		t.left = erase(t.left, k)
+	default:
+		t.right = erase(t.right, k)
+	}
+	t.fix()
+	return t
+}
+
+// rankOf returns a player's 1-based position, or 0 if they aren't ranked.
+func (r *ranking) rankOf(id string) int {
+	k, ok := r.keys[id]
+	if !ok {
+		return 0
+	}
+	rank := 1
+	for t := r.root; t != nil; {
+		if t.key.before(k) {
+			rank += t.left.count() + 1
+			t = t.right
+		} else {
+			t = t.left
+		}
+	}
+	return rank
+}
+
+// at returns the player in the 1-based position rank, or nil.
+func (r *ranking) at(rank int) *Player {
+	t := r.root
+	for t != nil {
+		left := t.left.count()
+		switch {
+		case rank <= left:
+			t = t.left
+		case rank == left+1:
+			return t.player
+		default:
+			rank -= left + 1
+			t = t.right
+		}
+	}
+	return nil
+}
+
+// top returns the first n players in order.
+func (r *ranking) top(n int) []*Player {
+	list := make([]*Player, 0, min(n, r.len()))
+	var walk func(t *rankNode)
+	walk = func(t *rankNode) {
+		if t == nil || len(list) == n {
+			return
+		}
+		walk(t.left)
+		if len(list) < n {
+			list = append(list, t.player)
+		}
+		walk(t.right)
+	}
+	walk(r.root)
+	return list
+}
+
+// put ranks p at its current score, as having just reached it, and returns
+// every player whose position changed.
+func (r *ranking) put(p *Player) []RankChange {
+	old := r.rankOf(p.ID)
+	r.detach(p.ID)
+	r.seq++
+	k := rankKey{score: p.Score, seq: r.seq, id: p.ID}
+	r.keys[p.ID] = k
+	above, rest := split(r.root, k)
+	r.root = merge(merge(above, &rankNode{key: k, player: p, prio: rand.Uint32(), size: 1}), rest)
+	return r.moved(p.ID, old, r.rankOf(p.ID))
+}
+
+// remove unranks a player and returns every player whose position changed.
+func (r *ranking) remove(id string) []RankChange {
+	old := r.rankOf(id)
+	if old == 0 {
+		return nil
+	}
+	r.detach(id)
+	return r.moved(id, old, 0)
+}
+
+func (r *ranking) detach(id string) {
+	if k, ok := r.keys[id]; ok {
+		r.root = erase(r.root, k)
+		delete(r.keys, id)
+	}
+}
+
+// moved lists the changes caused by one player going from rank was to
+// rank now: the player itself and everyone shifted one place by it.
+func (r *ranking) moved(id string, was, now int) []RankChange {
+	if was == now {
+		return nil
+	}
+	changes := []RankChange{{PlayerID: id, Old: was, New: now}}
+	// The positions now held by someone who shifted, and which way.
+	from, to, shift := 0, 0, 0
+	switch {
+	case was == 0: // inserted: everyone below moved down
+		from, to, shift = now+1, r.len(), 1
+	case now == 0: // removed: everyone below moved up
+		from, to, shift = was, r.len(), -1
+	case now < was: // overtook the players in between
+		from, to, shift = now+1, was, 1
+	default: // fell behind the players in between
+		from, to, shift = was, now-1, -1
+	}
+	for rank := from; rank <= to; rank++ {
+		if p := r.at(rank); p != nil {
+			changes = append(changes, RankChange{PlayerID: p.ID, Old: rank - shift, New: rank})
+		}
+	}
+	return changes
+}
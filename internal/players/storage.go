@@ -2,26 +2,80 @@ package players
 
 import (
 	"clicktrainer/internal/utility"
-	"sort"
+	"math"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Store struct {
 	mu      sync.Mutex
 	players map[string]*Player
+	ranking *ranking // players who can score, best first
+	onRank  func([]RankChange)
 }
 
 func NewStore() *Store {
 	return &Store{
 		players: make(map[string]*Player),
+		ranking: newRanking(),
 	}
 }
 
-func (s *Store) Add(id string, name string) *Player {
+// OnRankChange sets a function called with every batch of scoreboard moves,
+// after the change that caused them. It runs on the caller's goroutine,
+// outside the store's lock.
+func (s *Store) OnRankChange(fn func([]RankChange)) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	player := &Player{ID: id, Name: name, Color: utility.RandomColorHex()}
+	s.onRank = fn
+}
+
+// unlockAndNotify releases the store's lock and reports changes, if any.
+func (s *Store) unlockAndNotify(changes []RankChange) {
+	fn := s.onRank
+	s.mu.Unlock()
+	if fn != nil && len(changes) > 0 {
+		fn(changes)
+	}
+}
+
+// setRanked ranks or unranks a player to match their spectator status.
+func (s *Store) setRanked(p *Player) []RankChange {
+	if p.Spectator {
+		return s.ranking.remove(p.ID)
+	}
+	if s.ranking.rankOf(p.ID) > 0 {
+		return nil
+	}
+	return s.ranking.put(p)
+}
+
+func (s *Store) Add(id string, name string) *Player {
+	s.mu.Lock()
+	now := time.Now()
+	player := &Player{ID: id, Name: name, Color: utility.RandomColorHex(), JoinedAt: now, LastSeen: now}
 	s.players[id] = player
+	changes := s.ranking.put(player)
+	s.unlockAndNotify(changes)
+	return player
+}
+
+// Restore puts back a player saved before a restart, score and round state
+// included, and ranks them below anyone already on their score.
+func (s *Store) Restore(p Player) *Player {
+	s.mu.Lock()
+	player := &p
+	player.LastSeen = time.Now()
+	s.players[p.ID] = player
+	var changes []RankChange
+	if player.Spectator {
+		changes = s.ranking.remove(p.ID)
+	} else {
+		changes = s.ranking.put(player)
+	}
+	s.unlockAndNotify(changes)
 	return player
 }
 
@@ -41,55 +95,188 @@ func (s *Store) GetList() []*Player {
 	return playerList
 }
 
+// GetTopPlayers returns the n best players taking part in the round, best
+// first. Higher scores rank first; on equal scores, whoever got there first.
 func (s *Store) GetTopPlayers(n int) []*Player {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	list := make([]*Player, 0, len(s.players))
-	for _, p := range s.players {
-		list = append(list, p)
-	}
-	sort.Slice(list, func(i, j int) bool {
-		return list[i].Score > list[j].Score
-	})
-	if len(list) > n {
-		list = list[:n]
-	}
-	return list
+	return s.ranking.top(n)
 }
 
-func (s *Store) UpdateScore(id string, points int) *Player {
+// Ranked returns every player taking part in the round, in the order of
+// GetTopPlayers.
+func (s *Store) Ranked() []*Player {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if p, e := s.players[id]; e {
+	return s.ranking.top(s.ranking.len())
+}
+
+// UpdateScore adds points to a player's score, scaled by any late-join
+// handicap. Spectators cannot score; nil is returned for them as for unknown
+// players.
+func (s *Store) UpdateScore(id string, points int) *Player {
+	s.mu.Lock()
+	p, e := s.players[id]
+	if !e || p.Spectator {
+		s.mu.Unlock()
+		return nil
+	}
+	s.addLocked(p, points)
+	return p
+}
+
+// AddPoints is UpdateScore reporting what was actually added and the new
+// total, read together. ok is false if the player can't score.
+func (s *Store) AddPoints(id string, points int) (gained, score int, ok bool) {
+	s.mu.Lock()
+	p, e := s.players[id]
+	if !e || p.Spectator {
+		s.mu.Unlock()
+		return 0, 0, false
+	}
+	gained, score = s.addLocked(p, points)
+	return gained, score, true
+}
+
+// addLocked scores points for p, then releases the store's lock and reports
+// any rank changes. It returns the points added after the handicap and the
+// new score.
+func (s *Store) addLocked(p *Player, points int) (gained, score int) {
+	if p.Handicap > 0 {
+		points = int(math.Round(float64(points) * p.Handicap))
+	}
+	var changes []RankChange
+	if points != 0 {
 		p.Score += points
-		return p
+		changes = s.ranking.put(p)
 	}
-	return nil
+	score = p.Score
+	s.unlockAndNotify(changes)
+	return points, score
+}
+
+// MarkLateJoin records how a player who joined mid-round is treated for the
+// rest of that round.
+func (s *Store) MarkLateJoin(id, policy string, spectator bool, handicap float64) *Player {
+	s.mu.Lock()
+	p, e := s.players[id]
+	if !e {
+		s.mu.Unlock()
+		return nil
+	}
+	p.LateJoin = policy
+	p.Spectator = spectator
+	p.Handicap = handicap
+	s.unlockAndNotify(s.setRanked(p))
+	return p
+}
+
+// CanScore reports whether the player exists and is taking part in the round.
+func (s *Store) CanScore(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, e := s.players[id]
+	return e && !p.Spectator
 }
 
 func (s *Store) SetReady(id string, isReady bool) *Player {
+	s.mu.Lock()
+	p, e := s.players[id]
+	if !e {
+		s.mu.Unlock()
+		return nil
+	}
+	p.Ready = isReady
+	p.LastSeen = time.Now()
+	if isReady {
+		// Readying up brings an idle spectator back into the game.
+		p.Spectator = false
+	}
+	s.unlockAndNotify(s.setRanked(p))
+	return p
+}
+
+// Touch records activity from a player, resetting their idle timeout.
+func (s *Store) Touch(id string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if p, e := s.players[id]; e {
-		p.Ready = isReady
-		return p
+	if p, ok := s.players[id]; ok {
+		p.LastSeen = time.Now()
 	}
-	return nil
 }
 
-func (s *Store) AllReady() bool {
+// ReadyCounts returns how many players are ready out of those eligible to
+// play. Away players and spectators are not eligible.
+func (s *Store) ReadyCounts() (ready, eligible int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.players {
+		if p.Away || p.Spectator {
+			continue
+		}
+		eligible++
+		if p.Ready {
+			ready++
+		}
+	}
+	return ready, eligible
+}
+
+// IdleSince returns eligible players with no activity since the given time.
+func (s *Store) IdleSince(t time.Time) []*Player {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if len(s.players) == 0 {
-		return false
+	var idle []*Player
+	for _, p := range s.players {
+		if !p.Away && !p.Spectator && p.LastSeen.Before(t) {
+			idle = append(idle, p)
+		}
+	}
+	return idle
+}
+
+// SetSpectator moves a player to or from the spectators. Returns nil if the
+// player doesn't exist.
+func (s *Store) SetSpectator(id string, spectator bool) *Player {
+	s.mu.Lock()
+	p, ok := s.players[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil
 	}
+	p.Spectator = spectator
+	s.unlockAndNotify(s.setRanked(p))
+	return p
+}
 
+func (s *Store) AllReady() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Away players and spectators don't hold up the room.
+	present := 0
 	for _, player := range s.players {
+		if player.Away || player.Spectator {
+			continue
+		}
 		if !player.Ready {
 			return false
 		}
+		present++
 	}
-	return true
+	return present > 0
+}
+
+// SetAway flags a player as disconnected or back. Returns nil if the player
+// doesn't exist.
+func (s *Store) SetAway(id string, away bool) *Player {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	player, ok := s.players[id]
+	if !ok {
+		return nil
+	}
+	player.Away = away
+	return player
 }
 
 func (s *Store) ValidateSession(sessionId string) bool {
@@ -101,44 +288,82 @@ func (s *Store) ValidateSession(sessionId string) bool {
 
 func (s *Store) Remove(id string) bool {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	_, exists := s.players[id]
 	if exists {
 		delete(s.players, id)
 	}
+	s.unlockAndNotify(s.ranking.remove(id))
 	return exists
 }
 
+// Oldest returns the player who has been in the store the longest, or nil if
+// the store is empty. Used to pick a successor when the host leaves.
+func (s *Store) Oldest() *Player {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var oldest *Player
+	for _, p := range s.players {
+		if oldest == nil || p.JoinedAt.Before(oldest.JoinedAt) ||
+			(p.JoinedAt.Equal(oldest.JoinedAt) && p.ID < oldest.ID) {
+			oldest = p
+		}
+	}
+	return oldest
+}
+
 func (s *Store) Count() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return len(s.players)
 }
 
+// GetPlayerRank returns a player's 1-based place on the scoreboard, or 0 if
+// they aren't taking part in the round.
 func (s *Store) GetPlayerRank(id string) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	list := make([]*Player, 0, len(s.players))
-	for _, p := range s.players {
-		list = append(list, p)
-	}
-	sort.Slice(list, func(i, j int) bool {
-		return list[i].Score > list[j].Score
-	})
-	for i, p := range list {
-		if p.ID == id {
-			return i + 1
-		}
+	return s.ranking.rankOf(id)
+}
+
+// Standing returns a player's score and rank, read together under the
+// store's lock. ok is false for unknown players.
+func (s *Store) Standing(id string) (score, rank int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.players[id]
+	if !ok {
+		return 0, 0, false
 	}
-	return 0
+	return p.Score, s.ranking.rankOf(id), true
 }
 
+// ResetAll clears every player's round state. The ranking is rebuilt in
+// join order without reporting changes; callers re-render the whole scene.
 func (s *Store) ResetAll() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	now := time.Now()
 	for id, p := range s.players {
+		p.LastSeen = now
 		p.Score = 0
 		p.Ready = false
+		p.LateJoin = ""
+		p.Spectator = false
+		p.Handicap = 0
 		s.players[id] = p
 	}
+	byJoin := make([]*Player, 0, len(s.players))
+	for _, p := range s.players {
+		byJoin = append(byJoin, p)
+	}
+	slices.SortFunc(byJoin, func(a, b *Player) int {
+		if c := a.JoinedAt.Compare(b.JoinedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	s.ranking = newRanking()
+	for _, p := range byJoin {
+		s.ranking.put(p)
+	}
 }
@@ -1,8 +1,12 @@
 package players
 
 import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewStore(t *testing.T) {
@@ -135,6 +139,27 @@ func TestStore_AllReady(t *testing.T) {
 	}
 }
 
+func TestStore_AllReady_IgnoresAway(t *testing.T) {
+	s := NewStore()
+	s.Add("id1", "Alice")
+	s.Add("id2", "Bob")
+	s.SetReady("id1", true)
+
+	s.SetAway("id2", true)
+	if !s.AllReady() {
+		t.Error("AllReady should ignore away players")
+	}
+
+	s.SetAway("id1", true)
+	if s.AllReady() {
+		t.Error("AllReady should be false when every player is away")
+	}
+
+	if p := s.SetAway("nonexistent", true); p != nil {
+		t.Error("SetAway should return nil for nonexistent player")
+	}
+}
+
 func TestStore_ValidateSession(t *testing.T) {
 	s := NewStore()
 	s.Add("id1", "Alice")
@@ -233,3 +258,237 @@ func TestStore_ConcurrentAccess(t *testing.T) {
 		t.Errorf("concurrent Score = %d, want 100", p.Score)
 	}
 }
+
+func TestStore_Oldest(t *testing.T) {
+	s := NewStore()
+	if s.Oldest() != nil {
+		t.Error("Oldest() on empty store should be nil")
+	}
+
+	s.Add("id1", "Alice")
+	time.Sleep(2 * time.Millisecond)
+	s.Add("id2", "Bob")
+
+	if got := s.Oldest(); got == nil || got.ID != "id1" {
+		t.Errorf("Oldest() = %v, want id1", got)
+	}
+
+	s.Remove("id1")
+	if got := s.Oldest(); got == nil || got.ID != "id2" {
+		t.Errorf("Oldest() after removal = %v, want id2", got)
+	}
+}
+
+func TestStore_UpdateScore_Handicap(t *testing.T) {
+	s := NewStore()
+	s.Add("id1", "Alice")
+	s.MarkLateJoin("id1", "handicap", false, 1.5)
+
+	p := s.UpdateScore("id1", 4)
+	if p.Score != 6 {
+		t.Errorf("score = %d, want 6", p.Score)
+	}
+	if gained, score, ok := s.AddPoints("id1", 2); gained != 3 || score != 9 || !ok {
+		t.Errorf("AddPoints() = %d, %d, %v; want 3, 9, true", gained, score, ok)
+	}
+}
+
+func TestStore_Spectator(t *testing.T) {
+	s := NewStore()
+	s.Add("id1", "Alice")
+	s.Add("id2", "Bob")
+	s.MarkLateJoin("id2", "spectate", true, 0)
+
+	if s.CanScore("id2") {
+		t.Error("spectator should not be able to score")
+	}
+	if s.UpdateScore("id2", 3) != nil {
+		t.Error("UpdateScore should return nil for a spectator")
+	}
+	if top := s.GetTopPlayers(5); len(top) != 1 || top[0].ID != "id1" {
+		t.Error("spectators should be left off the scoreboard")
+	}
+
+	s.ResetAll()
+	if !s.CanScore("id2") {
+		t.Error("ResetAll should clear spectator status")
+	}
+}
+
+func TestStore_IdleSince(t *testing.T) {
+	s := NewStore()
+	s.Add("id1", "Alice")
+	s.Add("id2", "Bob")
+	s.Add("id3", "Carol")
+	s.SetSpectator("id3", true)
+
+	cutoff := time.Now().Add(time.Second)
+	s.Get("id1").LastSeen = cutoff.Add(time.Second)
+
+	idle := s.IdleSince(cutoff)
+	if len(idle) != 1 || idle[0].ID != "id2" {
+		t.Errorf("IdleSince = %v, want only id2", idle)
+	}
+}
+
+func TestStore_SetReady_ClearsSpectator(t *testing.T) {
+	s := NewStore()
+	s.Add("id1", "Alice")
+	s.SetSpectator("id1", true)
+
+	p := s.SetReady("id1", true)
+	if p.Spectator {
+		t.Error("readying up should clear the spectator flag")
+	}
+	if ready, eligible := s.ReadyCounts(); ready != 1 || eligible != 1 {
+		t.Errorf("ReadyCounts = %d/%d, want 1/1", ready, eligible)
+	}
+}
+
+func TestStore_RankingTieBreak(t *testing.T) {
+	s := NewStore()
+	s.Add("id1", "Alice")
+	s.Add("id2", "Bob")
+	s.Add("id3", "Carol")
+
+	// Equal scores keep join order until someone scores.
+	if got := ids(s.GetTopPlayers(3)); !slices.Equal(got, []string{"id1", "id2", "id3"}) {
+		t.Errorf("initial order = %v, want join order", got)
+	}
+
+	s.UpdateScore("id3", 2)
+	s.UpdateScore("id1", 2)
+	s.UpdateScore("id2", 1)
+	// id3 reached 2 first, so stays ahead of id1.
+	if got := ids(s.Ranked()); !slices.Equal(got, []string{"id3", "id1", "id2"}) {
+		t.Errorf("order = %v, want [id3 id1 id2]", got)
+	}
+	if r := s.GetPlayerRank("id1"); r != 2 {
+		t.Errorf("rank of id1 = %d, want 2", r)
+	}
+	if got := ids(s.GetTopPlayers(2)); !slices.Equal(got, []string{"id3", "id1"}) {
+		t.Errorf("top 2 = %v, want [id3 id1]", got)
+	}
+}
+
+func TestStore_RankChanges(t *testing.T) {
+	s := NewStore()
+	var got []RankChange
+	s.OnRankChange(func(c []RankChange) { got = append(got, c...) })
+
+	for i := 1; i <= 4; i++ {
+		s.Add(fmt.Sprintf("id%d", i), "")
+	}
+	s.UpdateScore("id1", 4)
+	s.UpdateScore("id2", 3)
+	s.UpdateScore("id3", 2)
+	s.UpdateScore("id4", 1)
+	got = nil
+
+	// id4 overtakes id2 and id3; id1 is untouched.
+	s.UpdateScore("id4", 3)
+	want := []RankChange{{"id4", 4, 2}, {"id2", 2, 3}, {"id3", 3, 4}}
+	if !slices.Equal(got, want) {
+		t.Errorf("overtake changes = %v, want %v", got, want)
+	}
+
+	got = nil
+	s.UpdateScore("id1", 1) // still first
+	if len(got) != 0 {
+		t.Errorf("score without a move reported %v", got)
+	}
+
+	s.Remove("id4")
+	want = []RankChange{{"id4", 2, 0}, {"id2", 3, 2}, {"id3", 4, 3}}
+	if !slices.Equal(got, want) {
+		t.Errorf("remove changes = %v, want %v", got, want)
+	}
+
+	got = nil
+	s.SetSpectator("id1", true)
+	s.SetSpectator("id1", false)
+	want = []RankChange{{"id1", 1, 0}, {"id2", 2, 1}, {"id3", 3, 2}, {"id1", 0, 1}, {"id2", 1, 2}, {"id3", 2, 3}}
+	if !slices.Equal(got, want) {
+		t.Errorf("spectator changes = %v, want %v", got, want)
+	}
+}
+
+func TestStore_RankingStaysOrdered(t *testing.T) {
+	s := NewStore()
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range 50 {
+		s.Add(fmt.Sprintf("id%02d", i), "")
+	}
+	for range 2000 {
+		id := fmt.Sprintf("id%02d", rng.IntN(50))
+		switch rng.IntN(10) {
+		case 0:
+			s.SetSpectator(id, rng.IntN(2) == 0)
+		default:
+			s.UpdateScore(id, 1+rng.IntN(4))
+		}
+	}
+
+	playing := 0
+	for _, p := range s.GetList() {
+		if !p.Spectator {
+			playing++
+		}
+	}
+	ranked := s.Ranked()
+	if len(ranked) != playing {
+		t.Fatalf("ranked %d players, want %d", len(ranked), playing)
+	}
+	for i, p := range ranked {
+		if i > 0 && p.Score > ranked[i-1].Score {
+			t.Fatalf("rank %d has score %d above rank %d's %d", i+1, p.Score, i, ranked[i-1].Score)
+		}
+		if r := s.GetPlayerRank(p.ID); r != i+1 {
+			t.Fatalf("GetPlayerRank(%s) = %d, want %d", p.ID, r, i+1)
+		}
+	}
+}
+
+func TestStore_Restore(t *testing.T) {
+	s := NewStore()
+	// Restored in scoreboard order; ties keep it.
+	s.Restore(Player{ID: "id1", Name: "Alice", Score: 5})
+	s.Restore(Player{ID: "id2", Name: "Bob", Score: 5, LateJoin: "handicap", Handicap: 2})
+	s.Restore(Player{ID: "id3", Name: "Carol", Spectator: true})
+
+	if got := ids(s.Ranked()); !slices.Equal(got, []string{"id1", "id2"}) {
+		t.Errorf("ranked = %v, want [id1 id2]", got)
+	}
+	if p := s.UpdateScore("id2", 1); p == nil || p.Score != 7 {
+		t.Errorf("UpdateScore with restored handicap = %+v, want score 7", p)
+	}
+	if p := s.Get("id3"); p == nil || p.LastSeen.IsZero() || s.CanScore("id3") {
+		t.Errorf("restored spectator = %+v, want present, seen and unable to score", p)
+	}
+}
+
+func ids(list []*Player) []string {
+	out := make([]string, len(list))
+	for i, p := range list {
+		out[i] = p.ID
+	}
+	return out
+}
+
+func BenchmarkStore_UpdateScore(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("players=%d", n), func(b *testing.B) {
+			s := NewStore()
+			for i := range n {
+				s.Add(fmt.Sprintf("id%d", i), "")
+			}
+			b.ResetTimer()
+			for i := range b.N {
+				id := fmt.Sprintf("id%d", i%n)
+				s.UpdateScore(id, 1)
+				s.GetPlayerRank(id)
+				s.GetTopPlayers(5)
+			}
+		})
+	}
+}
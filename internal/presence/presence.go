@@ -0,0 +1,180 @@
+package presence
+
+import (
+	"sync"
+	"time"
+)
+
+// Hooks are called, outside the tracker's lock, as a player's connections
+// come and go. Any hook may be nil.
+type Hooks struct {
+	Away    func(playerID string) // no connection for AwayAfter
+	Back    func(playerID string) // reconnected after being marked away
+	Expired func(playerID string) // no connection for RemoveAfter
+}
+
+type entry struct {
+	conns   int
+	away    bool
+	gen     int // bumped on every connect so stale timers can tell they are stale
+	awayT   *time.Timer
+	expireT *time.Timer
+}
+
+// Tracker counts each player's live SSE and WebSocket connections. When a
+// player's last connection drops, they are marked away after AwayAfter and
+// expired after RemoveAfter unless they reconnect first. A zero RemoveAfter
+// disables tracking.
+type Tracker struct {
+	mu          sync.Mutex
+	awayAfter   time.Duration
+	removeAfter time.Duration
+	hooks       Hooks
+	players     map[string]*entry
+	stopped     bool
+}
+
+func NewTracker(awayAfter, removeAfter time.Duration, hooks Hooks) *Tracker {
+	if awayAfter > removeAfter {
+		awayAfter = removeAfter
+	}
+	return &Tracker{
+		awayAfter:   awayAfter,
+		removeAfter: removeAfter,
+		hooks:       hooks,
+		players:     make(map[string]*entry),
+	}
+}
+
+func (t *Tracker) enabled() bool {
+	return t.removeAfter > 0 && !t.stopped
+}
+
+// Track starts watching a newly registered player. If they never open a
+// connection they go through the same away/expire steps as a disconnect.
+func (t *Tracker) Track(playerID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.enabled() {
+		return
+	}
+	if _, ok := t.players[playerID]; ok {
+		return
+	}
+	e := &entry{}
+	t.players[playerID] = e
+	t.scheduleLocked(playerID, e)
+}
+
+// Connect records a new connection for the player and cancels any pending
+// away/expire timers.
+func (t *Tracker) Connect(playerID string) {
+	t.mu.Lock()
+	if !t.enabled() {
+		t.mu.Unlock()
+		return
+	}
+	e, ok := t.players[playerID]
+	if !ok {
+		e = &entry{}
+		t.players[playerID] = e
+	}
+	e.conns++
+	e.gen++
+	stopTimers(e)
+	wasAway := e.away
+	e.away = false
+	t.mu.Unlock()
+
+	if wasAway && t.hooks.Back != nil {
+		t.hooks.Back(playerID)
+	}
+}
+
+// Disconnect records a closed connection. When the player's last connection
+// closes, the away and expire timers start.
+func (t *Tracker) Disconnect(playerID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.enabled() {
+		return
+	}
+	e, ok := t.players[playerID]
+	if !ok || e.conns == 0 {
+		return
+	}
+	e.conns--
+	if e.conns == 0 {
+		t.scheduleLocked(playerID, e)
+	}
+}
+
+// Forget stops tracking a player who has left the room.
+func (t *Tracker) Forget(playerID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.players[playerID]; ok {
+		stopTimers(e)
+		delete(t.players, playerID)
+	}
+}
+
+// Connected reports whether the player has at least one live connection.
+func (t *Tracker) Connected(playerID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.players[playerID]
+	return ok && e.conns > 0
+}
+
+// Stop cancels every pending timer. The tracker ignores all calls afterwards.
+func (t *Tracker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range t.players {
+		stopTimers(e)
+	}
+	t.players = make(map[string]*entry)
+	t.stopped = true
+}
+
+func (t *Tracker) scheduleLocked(playerID string, e *entry) {
+	stopTimers(e)
+	gen := e.gen
+	e.awayT = time.AfterFunc(t.awayAfter, func() { t.fire(playerID, gen, false) })
+	e.expireT = time.AfterFunc(t.removeAfter, func() { t.fire(playerID, gen, true) })
+}
+
+func (t *Tracker) fire(playerID string, gen int, expire bool) {
+	t.mu.Lock()
+	e, ok := t.players[playerID]
+	if !ok || t.stopped || e.gen != gen || e.conns > 0 {
+		t.mu.Unlock()
+		return
+	}
+	var hook func(string)
+	if expire {
+		delete(t.players, playerID)
+		stopTimers(e)
+		hook = t.hooks.Expired
+	} else if !e.away {
+		e.away = true
+		hook = t.hooks.Away
+	}
+	t.mu.Unlock()
+
+	if hook != nil {
+		hook(playerID)
+	}
+}
+
+func stopTimers(e *entry) {
+	if e.awayT != nil {
+		e.awayT.Stop()
+		e.awayT = nil
+	}
+	if e.expireT != nil {
+		e.expireT.Stop()
+		e.expireT = nil
+	}
+}
@@ -0,0 +1,135 @@
+package presence
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects hook calls for assertions.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) hooks() Hooks {
+	add := func(kind string) func(string) {
+		return func(id string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.events = append(r.events, kind+":"+id)
+		}
+	}
+	return Hooks{Away: add("away"), Back: add("back"), Expired: add("expired")}
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+// waitFor polls until the recorder holds want events or the deadline passes.
+func (r *recorder) waitFor(t *testing.T, want int) []string {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if got := r.get(); len(got) >= want {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return r.get()
+}
+
+func TestTracker_DisconnectAwayThenExpire(t *testing.T) {
+	rec := &recorder{}
+	tr := NewTracker(10*time.Millisecond, 40*time.Millisecond, rec.hooks())
+
+	tr.Connect("p1")
+	tr.Disconnect("p1")
+
+	got := rec.waitFor(t, 2)
+	if len(got) != 2 || got[0] != "away:p1" || got[1] != "expired:p1" {
+		t.Errorf("events = %v, want [away:p1 expired:p1]", got)
+	}
+}
+
+func TestTracker_ReconnectWithinGrace(t *testing.T) {
+	rec := &recorder{}
+	tr := NewTracker(10*time.Millisecond, 80*time.Millisecond, rec.hooks())
+
+	tr.Connect("p1")
+	tr.Disconnect("p1")
+	rec.waitFor(t, 1)
+	tr.Connect("p1")
+
+	time.Sleep(120 * time.Millisecond)
+	got := rec.get()
+	if len(got) != 2 || got[0] != "away:p1" || got[1] != "back:p1" {
+		t.Errorf("events = %v, want [away:p1 back:p1]", got)
+	}
+	if !tr.Connected("p1") {
+		t.Error("p1 should be connected")
+	}
+}
+
+func TestTracker_OtherConnectionKeepsPlayer(t *testing.T) {
+	rec := &recorder{}
+	tr := NewTracker(10*time.Millisecond, 20*time.Millisecond, rec.hooks())
+
+	// SSE and WebSocket both open; closing one must not start the timers.
+	tr.Connect("p1")
+	tr.Connect("p1")
+	tr.Disconnect("p1")
+
+	time.Sleep(50 * time.Millisecond)
+	if got := rec.get(); len(got) != 0 {
+		t.Errorf("events = %v, want none", got)
+	}
+}
+
+func TestTracker_TrackNeverConnected(t *testing.T) {
+	rec := &recorder{}
+	tr := NewTracker(5*time.Millisecond, 20*time.Millisecond, rec.hooks())
+
+	tr.Track("p1")
+
+	got := rec.waitFor(t, 2)
+	if len(got) != 2 || got[1] != "expired:p1" {
+		t.Errorf("events = %v, want player to expire", got)
+	}
+}
+
+func TestTracker_ForgetAndStop(t *testing.T) {
+	rec := &recorder{}
+	tr := NewTracker(5*time.Millisecond, 10*time.Millisecond, rec.hooks())
+
+	tr.Track("p1")
+	tr.Forget("p1")
+	tr.Track("p2")
+	tr.Stop()
+	tr.Track("p3")
+
+	time.Sleep(40 * time.Millisecond)
+	if got := rec.get(); len(got) != 0 {
+		t.Errorf("events = %v, want none", got)
+	}
+}
+
+func TestTracker_ZeroGraceDisabled(t *testing.T) {
+	rec := &recorder{}
+	tr := NewTracker(0, 0, rec.hooks())
+
+	tr.Track("p1")
+	tr.Connect("p1")
+	tr.Disconnect("p1")
+
+	time.Sleep(20 * time.Millisecond)
+	if got := rec.get(); len(got) != 0 {
+		t.Errorf("events = %v, want none", got)
+	}
+	if tr.Connected("p1") {
+		t.Error("disabled tracker should not record connections")
+	}
+}
@@ -0,0 +1,76 @@
+package rooms
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNoOwner is returned by Directory.Owner for a code no instance holds.
+var ErrNoOwner = errors.New("room code has no owner")
+
+// Instance is one server process sharing a directory.
+type Instance struct {
+	ID  string
+	URL string // where other instances reach it; empty when running alone
+}
+
+// Directory records which instance owns each room code. A store claims a
+// code before opening a room under it, so instances sharing a directory
+// never hand out the same code.
+type Directory interface {
+	// Claim makes owner the owner of code, or renews its claim. It reports
+	// false if another instance holds the code.
+	Claim(code string, owner Instance) (bool, error)
+	// Renew tells the directory the instance still has these rooms open.
+	// Claims that aren't renewed may lapse.
+	Renew(instanceID string, codes []string) error
+	// Release gives up the code if instanceID holds it.
+	Release(code, instanceID string) error
+	// Owner returns the instance holding code, or ErrNoOwner.
+	Owner(code string) (Instance, error)
+}
+
+// MemoryDirectory is a Directory for a single process. It is the default,
+// and stores sharing one behave like instances sharing a database.
+type MemoryDirectory struct {
+	mu     sync.Mutex
+	owners map[string]Instance
+}
+
+func NewMemoryDirectory() *MemoryDirectory {
+	return &MemoryDirectory{owners: make(map[string]Instance)}
+}
+
+func (d *MemoryDirectory) Claim(code string, owner Instance) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cur, ok := d.owners[code]; ok && cur.ID != owner.ID {
+		return false, nil
+	}
+	d.owners[code] = owner
+	return true, nil
+}
+
+// Renew does nothing; claims held in memory don't lapse.
+func (d *MemoryDirectory) Renew(instanceID string, codes []string) error {
+	return nil
+}
+
+func (d *MemoryDirectory) Release(code, instanceID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cur, ok := d.owners[code]; ok && cur.ID == instanceID {
+		delete(d.owners, code)
+	}
+	return nil
+}
+
+func (d *MemoryDirectory) Owner(code string) (Instance, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	owner, ok := d.owners[code]
+	if !ok {
+		return Instance{}, ErrNoOwner
+	}
+	return owner, nil
+}
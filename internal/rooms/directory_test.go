@@ -0,0 +1,208 @@
+package rooms
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemoryDirectory_Claim(t *testing.T) {
+	d := NewMemoryDirectory()
+	a := Instance{ID: "a", URL: "http://a"}
+	b := Instance{ID: "b", URL: "http://b"}
+
+	if ok, _ := d.Claim("ABCD", a); !ok {
+		t.Fatal("first claim should succeed")
+	}
+	if ok, _ := d.Claim("ABCD", b); ok {
+		t.Error("another instance shouldn't take a held code")
+	}
+	if ok, _ := d.Claim("ABCD", a); !ok {
+		t.Error("the owner should be able to claim again")
+	}
+	if owner, err := d.Owner("ABCD"); err != nil || owner != a {
+		t.Errorf("Owner() = %+v, %v; want %+v", owner, err, a)
+	}
+
+	d.Release("ABCD", "b")
+	if _, err := d.Owner("ABCD"); err != nil {
+		t.Error("only the owner can release a code")
+	}
+	d.Release("ABCD", "a")
+	if _, err := d.Owner("ABCD"); !errors.Is(err, ErrNoOwner) {
+		t.Errorf("Owner() after release error = %v, want ErrNoOwner", err)
+	}
+}
+
+// busyDirectory refuses the first few claims, as if the codes were open on
+// other instances.
+type busyDirectory struct {
+	*MemoryDirectory
+	busy int
+}
+
+func (d *busyDirectory) Claim(code string, owner Instance) (bool, error) {
+	if d.busy > 0 {
+		d.busy--
+		return false, nil
+	}
+	return d.MemoryDirectory.Claim(code, owner)
+}
+
+func TestStore_CreateSkipsCodesClaimedElsewhere(t *testing.T) {
+	s := NewStore(testConfig())
+	dir := &busyDirectory{MemoryDirectory: NewMemoryDirectory(), busy: 3}
+	s.SetDirectory(dir, Instance{ID: "a"})
+
+	room, err := s.Create("host-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir.busy != 0 {
+		t.Errorf("%d claims left unrefused, want every refusal retried", dir.busy)
+	}
+	if owner, _ := dir.Owner(room.Code); owner.ID != "a" {
+		t.Errorf("owner = %+v, want the creating instance", owner)
+	}
+
+	dir.busy = 100
+	if _, err := s.Create("host-2"); err == nil {
+		t.Error("Create() should give up when no code can be claimed")
+	}
+}
+
+func TestStore_ReleasesClosedRooms(t *testing.T) {
+	dir := NewMemoryDirectory()
+	s := NewStore(testConfig())
+	s.SetDirectory(dir, Instance{ID: "a"})
+	deleted, _ := s.Create("p1")
+	open, _ := s.Create("p2")
+
+	s.Delete(deleted.Code)
+	if _, err := dir.Owner(deleted.Code); !errors.Is(err, ErrNoOwner) {
+		t.Error("a deleted room's code should be released")
+	}
+	if _, err := dir.Owner(open.Code); err != nil {
+		t.Error("an open room's code should stay claimed")
+	}
+
+	s.CloseAll("/", "test")
+	if _, err := dir.Owner(open.Code); !errors.Is(err, ErrNoOwner) {
+		t.Error("CloseAll should release every code")
+	}
+}
+
+func TestStore_RestoreSkipsCodesOwnedElsewhere(t *testing.T) {
+	dir := NewMemoryDirectory()
+	a := NewStore(testConfig())
+	a.SetDirectory(dir, Instance{ID: "a"})
+	b := NewStore(testConfig())
+	b.SetDirectory(dir, Instance{ID: "b"})
+
+	room, _ := a.Create("p1")
+	snap := a.Snapshot()
+	if got := b.Restore(snap); len(got) != 0 {
+		t.Errorf("Restore() = %v, want a room open on another instance skipped", got)
+	}
+
+	a.Delete(room.Code)
+	if got := b.Restore(snap); len(got) != 1 {
+		t.Fatalf("Restore() = %v, want the room once its code is free", got)
+	}
+	if owner, _ := b.Owner(room.Code); owner.ID != "b" {
+		t.Errorf("owner = %+v, want the restoring instance", owner)
+	}
+}
+
+func TestStore_AwaitDirectory(t *testing.T) {
+	a := NewStore(testConfig())
+	room, _ := a.Create("p1")
+	snap := a.Snapshot()
+
+	s := NewStore(testConfig())
+	s.AwaitDirectory()
+	if _, err := s.Create("host-1"); !errors.Is(err, ErrNoDirectory) {
+		t.Fatalf("Create() error = %v, want ErrNoDirectory while waiting for the directory", err)
+	}
+	if got := s.Restore(snap); len(got) != 0 {
+		t.Errorf("Restore() = %v, want nothing restored while waiting for the directory", got)
+	}
+
+	dir := NewMemoryDirectory()
+	s.SetDirectory(dir, Instance{ID: "b"})
+	if got := s.Restore(snap); len(got) != 1 {
+		t.Fatalf("Restore() = %v, want the room once the directory is set", got)
+	}
+	if owner, _ := dir.Owner(room.Code); owner.ID != "b" {
+		t.Errorf("owner = %+v, want the code claimed in the new directory", owner)
+	}
+	if _, err := s.Create("host-1"); err != nil {
+		t.Errorf("Create() error = %v once the directory is set", err)
+	}
+}
+
+// slowDirectory holds each claim until it is let through, as a shared
+// directory's round trip would.
+type slowDirectory struct {
+	*MemoryDirectory
+	claiming chan string
+	proceed  chan struct{}
+}
+
+func (d *slowDirectory) Claim(code string, owner Instance) (bool, error) {
+	d.claiming <- code
+	<-d.proceed
+	return d.MemoryDirectory.Claim(code, owner)
+}
+
+func TestStore_CreateClaimsOutsideTheLock(t *testing.T) {
+	s := NewStore(testConfig())
+	dir := &slowDirectory{MemoryDirectory: NewMemoryDirectory(), claiming: make(chan string), proceed: make(chan struct{})}
+	s.SetDirectory(dir, Instance{ID: "a"})
+
+	type result struct {
+		room *Room
+		err  error
+	}
+	created := make(chan result)
+	go func() {
+		room, err := s.Create("host-1")
+		created <- result{room, err}
+	}()
+	code := <-dir.claiming
+
+	// The store answers while the claim is in flight, and closing it then
+	// gives the claim back once it lands.
+	if rooms := s.List(); len(rooms) != 0 {
+		t.Errorf("List() = %v while the claim is in flight, want no rooms yet", rooms)
+	}
+	s.CloseAll("/", "test")
+	close(dir.proceed)
+	if r := <-created; !errors.Is(r.err, ErrClosed) {
+		t.Fatalf("Create() = %v, %v; want ErrClosed for a store closed during the claim", r.room, r.err)
+	}
+	if _, err := dir.Owner(code); !errors.Is(err, ErrNoOwner) {
+		t.Errorf("Owner(%q) error = %v, want the claim released", code, err)
+	}
+}
+
+func TestStore_RestoreClaimsOutsideTheLock(t *testing.T) {
+	a := NewStore(testConfig())
+	room, _ := a.Create("p1")
+	snap := a.Snapshot()
+
+	s := NewStore(testConfig())
+	dir := &slowDirectory{MemoryDirectory: NewMemoryDirectory(), claiming: make(chan string), proceed: make(chan struct{})}
+	s.SetDirectory(dir, Instance{ID: "b"})
+	restored := make(chan []*Room)
+	go func() { restored <- s.Restore(snap) }()
+	<-dir.claiming
+
+	// The store answers while the claim is in flight.
+	if rooms := s.List(); len(rooms) != 0 {
+		t.Errorf("List() = %v while the claim is in flight, want no rooms yet", rooms)
+	}
+	close(dir.proceed)
+	if got := <-restored; len(got) != 1 || got[0].Code != room.Code || s.Get(room.Code) == nil {
+		t.Errorf("Restore() = %v, want the room restored once its claim lands", got)
+	}
+}
@@ -3,7 +3,12 @@ package rooms
 import (
 	"clicktrainer/internal/broadcast"
 	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/presence"
+	"clicktrainer/internal/round"
+	"clicktrainer/internal/tick"
 	"clicktrainer/internal/wshub"
+	"context"
+	"sync"
 	"time"
 )
 
@@ -12,6 +17,187 @@ type Room struct {
 	Game        *gamedata.Game
 	Broadcaster *broadcast.Broadcaster
 	Hub         *wshub.Hub
+	Presence    *presence.Tracker
+	Round       *round.Controller
+	Tick        *tick.Loop // batches score, target and cursor updates
 	CreatedAt   time.Time
 	HostID      string
+
+	mu          sync.Mutex
+	locked      bool
+	banned      map[string]bool
+	autoStart   *time.Timer
+	autoStartAt time.Time
+	cancel      context.CancelFunc // ends the room's lifetime context
+	closeOnce   sync.Once
+	lastActive  time.Time
+	expiryWarn  time.Time // announced expiry deadline; zero if no warning
+}
+
+// ClosedEvent is the final SSE event sent to a room's clients when it is
+// closed; its data is where they should go next.
+const ClosedEvent = "roomClosed"
+
+// Host returns the ID of the player holding host rights.
+func (r *Room) Host() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.HostID
+}
+
+// IsHost reports whether the given player holds host rights.
+func (r *Room) IsHost(playerID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return playerID != "" && r.HostID == playerID
+}
+
+// SetHost hands host rights to the given player.
+func (r *Room) SetHost(playerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.HostID = playerID
+}
+
+// ClaimHost makes the given player host if nobody holds host rights yet.
+// Returns true if the claim succeeded.
+func (r *Room) ClaimHost(playerID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.HostID != "" {
+		return false
+	}
+	r.HostID = playerID
+	return true
+}
+
+// Locked reports whether the room is closed to new players.
+func (r *Room) Locked() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.locked
+}
+
+func (r *Room) SetLocked(locked bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.locked = locked
+}
+
+// Ban blocks a player ID from registering in this room again.
+func (r *Room) Ban(playerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.banned == nil {
+		r.banned = make(map[string]bool)
+	}
+	r.banned[playerID] = true
+}
+
+func (r *Room) IsBanned(playerID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.banned[playerID]
+}
+
+// ArmAutoStart schedules fn to run after d unless a countdown is already
+// pending. It returns the pending deadline and whether this call armed it.
+func (r *Room) ArmAutoStart(d time.Duration, fn func()) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.autoStart != nil {
+		return r.autoStartAt, false
+	}
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		r.mu.Lock()
+		current := r.autoStart == t
+		if current {
+			r.autoStart = nil
+			r.autoStartAt = time.Time{}
+		}
+		r.mu.Unlock()
+		// A countdown cancelled after its timer fired must not run.
+		if current {
+			fn()
+		}
+	})
+	r.autoStart = t
+	r.autoStartAt = time.Now().Add(d)
+	return r.autoStartAt, true
+}
+
+// CancelAutoStart stops a pending auto-start countdown. Returns false if
+// none was pending.
+func (r *Room) CancelAutoStart() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.autoStart == nil {
+		return false
+	}
+	r.autoStart.Stop()
+	r.autoStart = nil
+	r.autoStartAt = time.Time{}
+	return true
+}
+
+// AutoStartAt returns the pending auto-start deadline, or zero if none.
+func (r *Room) AutoStartAt() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.autoStartAt
+}
+
+// Touch records activity in the room, pushing back its expiry.
+func (r *Room) Touch() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastActive = time.Now()
+}
+
+func (r *Room) LastActive() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastActive
+}
+
+// ExpiryWarning returns the expiry deadline players have been warned about,
+// or zero if no warning is pending.
+func (r *Room) ExpiryWarning() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.expiryWarn
+}
+
+// KeepAlive records activity and withdraws any pending expiry warning.
+// Returns true if a warning was pending.
+func (r *Room) KeepAlive() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastActive = time.Now()
+	warned := !r.expiryWarn.IsZero()
+	r.expiryWarn = time.Time{}
+	return warned
+}
+
+// Close tears the room down: it stops presence timers, a pending auto-start
+// and any round in progress, ends every SSE stream with a ClosedEvent and
+// disconnects WebSocket clients. It is safe to call more than once.
+func (r *Room) Close() {
+	r.CloseWith("/?closed=1", "room closed")
+}
+
+// CloseWith is Close, sending SSE clients to next and giving WebSocket
+// clients reason as the close reason. Only the first call has any effect.
+func (r *Room) CloseWith(next, reason string) {
+	r.closeOnce.Do(func() {
+		r.Presence.Stop()
+		r.CancelAutoStart()
+		if r.cancel != nil {
+			r.cancel()
+		}
+		r.Game.Events.Close()
+		r.Broadcaster.Close(ClosedEvent, next)
+		r.Hub.CloseAll(reason)
+	})
 }
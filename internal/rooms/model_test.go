@@ -0,0 +1,137 @@
+package rooms
+
+import (
+	"clicktrainer/internal/broadcast"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRoom_ClaimHost(t *testing.T) {
+	s := NewStore(testConfig())
+	room, _ := s.Create("")
+
+	if !room.ClaimHost("p1") {
+		t.Fatal("first ClaimHost should succeed")
+	}
+	if room.ClaimHost("p2") {
+		t.Error("second ClaimHost should fail while a host is set")
+	}
+	if !room.IsHost("p1") {
+		t.Error("p1 should be host")
+	}
+	if room.IsHost("") {
+		t.Error("empty ID should never be host")
+	}
+
+	room.SetHost("p2")
+	if room.Host() != "p2" {
+		t.Errorf("Host() = %q, want %q", room.Host(), "p2")
+	}
+}
+
+func TestRoom_Lock(t *testing.T) {
+	s := NewStore(testConfig())
+	room, _ := s.Create("host")
+
+	if room.Locked() {
+		t.Error("new room should be unlocked")
+	}
+	room.SetLocked(true)
+	if !room.Locked() {
+		t.Error("room should be locked")
+	}
+}
+
+func TestRoom_Ban(t *testing.T) {
+	s := NewStore(testConfig())
+	room, _ := s.Create("host")
+
+	room.Ban("p1")
+	if !room.IsBanned("p1") {
+		t.Error("p1 should be banned")
+	}
+	if room.IsBanned("p2") {
+		t.Error("p2 should not be banned")
+	}
+}
+
+func TestRoom_AutoStart(t *testing.T) {
+	s := NewStore(testConfig())
+	room, _ := s.Create("host")
+
+	fired := make(chan struct{}, 2)
+	fn := func() { fired <- struct{}{} }
+
+	if _, armed := room.ArmAutoStart(time.Hour, fn); !armed {
+		t.Fatal("first ArmAutoStart should arm")
+	}
+	if _, armed := room.ArmAutoStart(time.Millisecond, fn); armed {
+		t.Error("ArmAutoStart should not re-arm a pending countdown")
+	}
+	if room.AutoStartAt().IsZero() {
+		t.Error("AutoStartAt should be set while pending")
+	}
+	if !room.CancelAutoStart() {
+		t.Error("CancelAutoStart should report a pending countdown")
+	}
+	if room.CancelAutoStart() {
+		t.Error("second CancelAutoStart should report nothing pending")
+	}
+
+	room.ArmAutoStart(time.Millisecond, fn)
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("auto-start did not fire")
+	}
+	if !room.AutoStartAt().IsZero() {
+		t.Error("AutoStartAt should be cleared after firing")
+	}
+}
+
+// waitGoroutines polls until the goroutine count drops back to n.
+func waitGoroutines(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := runtime.NumGoroutine(); got > n {
+		t.Errorf("goroutines = %d, want at most %d after Close", got, n)
+	}
+}
+
+func TestRoom_CloseReleasesGoroutines(t *testing.T) {
+	s := NewStore(testConfig())
+	baseline := runtime.NumGoroutine()
+
+	room, _ := s.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	ch := room.Broadcaster.Subscribe()
+	room.Game.BeginCombat()
+	room.Round.Start()
+	room.ArmAutoStart(time.Hour, func() {})
+
+	s.Delete(room.Code)
+	room.Close()
+
+	var last broadcast.HxEventMessage
+	for msg := range ch {
+		last = msg
+	}
+	if last.Event != ClosedEvent {
+		t.Errorf("last event = %q, want %q", last.Event, ClosedEvent)
+	}
+	select {
+	case <-room.Round.Done():
+	case <-time.After(time.Second):
+		t.Fatal("round did not stop")
+	}
+	select {
+	case <-room.Broadcaster.Done():
+	case <-time.After(time.Second):
+		t.Fatal("broadcaster did not stop")
+	}
+	waitGoroutines(t, baseline)
+}
@@ -0,0 +1,87 @@
+package rooms
+
+import (
+	"clicktrainer/internal/db"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultClaimTTL is how long a claim in a PGDirectory lasts without being
+// renewed. Stores renew their rooms on every expiry sweep, well inside it.
+const DefaultClaimTTL = 1 * time.Minute
+
+// PGDirectory is a Directory in PostgreSQL, shared by every instance using
+// the database. A claim the owner stops renewing, because it crashed, lapses
+// after TTL and the code can be claimed again.
+type PGDirectory struct {
+	DB  *db.DB
+	TTL time.Duration
+}
+
+func NewPGDirectory(database *db.DB) *PGDirectory {
+	return &PGDirectory{DB: database, TTL: DefaultClaimTTL}
+}
+
+func (p *PGDirectory) Claim(code string, owner Instance) (bool, error) {
+	var claimed string
+	err := p.DB.QueryRow(`
+		INSERT INTO room_directory (code, instance_id, instance_url) VALUES ($1, $2, $3)
+		ON CONFLICT (code) DO UPDATE SET
+			instance_id = EXCLUDED.instance_id,
+			instance_url = EXCLUDED.instance_url,
+			claimed_at = CASE WHEN room_directory.instance_id = EXCLUDED.instance_id
+				THEN room_directory.claimed_at ELSE now() END,
+			renewed_at = now()
+		WHERE room_directory.instance_id = EXCLUDED.instance_id
+			OR room_directory.renewed_at < now() - make_interval(secs => $4)
+		RETURNING code
+	`, code, owner.ID, owner.URL, p.TTL.Seconds()).Scan(&claimed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("claiming room code: %w", err)
+	}
+	return true, nil
+}
+
+func (p *PGDirectory) Renew(instanceID string, codes []string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+	_, err := p.DB.Exec(`
+		UPDATE room_directory SET renewed_at = now()
+		WHERE instance_id = $1 AND code = ANY($2)
+	`, instanceID, pq.Array(codes))
+	if err != nil {
+		return fmt.Errorf("renewing room codes: %w", err)
+	}
+	return nil
+}
+
+func (p *PGDirectory) Release(code, instanceID string) error {
+	_, err := p.DB.Exec(`DELETE FROM room_directory WHERE code = $1 AND instance_id = $2`, code, instanceID)
+	if err != nil {
+		return fmt.Errorf("releasing room code: %w", err)
+	}
+	return nil
+}
+
+func (p *PGDirectory) Owner(code string) (Instance, error) {
+	var owner Instance
+	err := p.DB.QueryRow(`
+		SELECT instance_id, instance_url FROM room_directory
+		WHERE code = $1 AND renewed_at >= now() - make_interval(secs => $2)
+	`, code, p.TTL.Seconds()).Scan(&owner.ID, &owner.URL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Instance{}, ErrNoOwner
+	}
+	if err != nil {
+		return Instance{}, fmt.Errorf("looking up room owner: %w", err)
+	}
+	return owner, nil
+}
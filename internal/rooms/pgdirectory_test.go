@@ -0,0 +1,92 @@
+package rooms
+
+import (
+	"clicktrainer/internal/db"
+	"errors"
+	"os"
+	"testing"
+)
+
+func getTestDirectory(t *testing.T) *PGDirectory {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping database tests")
+	}
+	database, err := db.Connect(dsn)
+	if err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate() error: %v", err)
+	}
+	t.Cleanup(func() {
+		// Clean up test data; errors here are intentionally ignored.
+		_, _ = database.Exec("DELETE FROM room_directory")
+		database.Close()
+	})
+	return NewPGDirectory(database)
+}
+
+func TestPGDirectory_Claim(t *testing.T) {
+	d := getTestDirectory(t)
+	a := Instance{ID: "a", URL: "http://a:8080"}
+	b := Instance{ID: "b", URL: "http://b:8080"}
+
+	if ok, err := d.Claim("ABCD", a); err != nil || !ok {
+		t.Fatalf("Claim() = %v, %v; want true", ok, err)
+	}
+	if ok, err := d.Claim("ABCD", b); err != nil || ok {
+		t.Errorf("Claim() by another instance = %v, %v; want false", ok, err)
+	}
+	if ok, err := d.Claim("ABCD", a); err != nil || !ok {
+		t.Errorf("Claim() by the owner again = %v, %v; want true", ok, err)
+	}
+	if owner, err := d.Owner("ABCD"); err != nil || owner != a {
+		t.Errorf("Owner() = %+v, %v; want %+v", owner, err, a)
+	}
+
+	if err := d.Release("ABCD", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Owner("ABCD"); err != nil {
+		t.Error("only the owner can release a code")
+	}
+	if err := d.Release("ABCD", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Owner("ABCD"); !errors.Is(err, ErrNoOwner) {
+		t.Errorf("Owner() after release error = %v, want ErrNoOwner", err)
+	}
+}
+
+func TestPGDirectory_LapsedClaims(t *testing.T) {
+	d := getTestDirectory(t)
+	a := Instance{ID: "a", URL: "http://a:8080"}
+	b := Instance{ID: "b", URL: "http://b:8080"}
+	d.Claim("ABCD", a)
+	d.Claim("EFGH", a)
+	lapse := func() {
+		t.Helper()
+		if _, err := d.DB.Exec(`UPDATE room_directory SET renewed_at = now() - interval '1 hour'`); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lapse()
+	if err := d.Renew("a", []string{"ABCD"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Owner("ABCD"); err != nil {
+		t.Errorf("a renewed claim should hold: %v", err)
+	}
+	if _, err := d.Owner("EFGH"); !errors.Is(err, ErrNoOwner) {
+		t.Errorf("Owner() of a lapsed claim error = %v, want ErrNoOwner", err)
+	}
+	if ok, err := d.Claim("EFGH", b); err != nil || !ok {
+		t.Errorf("Claim() of a lapsed code = %v, %v; want true", ok, err)
+	}
+	if owner, _ := d.Owner("EFGH"); owner != b {
+		t.Errorf("owner = %+v, want %+v", owner, b)
+	}
+}
@@ -0,0 +1,148 @@
+package rooms
+
+import (
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/players"
+	"clicktrainer/internal/snapshot"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// InterruptedNotice is shown in the lobby of a room that was restored after
+// a restart cut its round short.
+const InterruptedNotice = "The server restarted during your round, so it was cancelled. Ready up to play again."
+
+// Snapshot captures the given rooms for saving.
+func Snapshot(list []*Room) snapshot.Snapshot {
+	snap := snapshot.Snapshot{Version: snapshot.Version, SavedAt: time.Now()}
+	for _, room := range list {
+		snap.Rooms = append(snap.Rooms, room.snapshot())
+	}
+	return snap
+}
+
+// Snapshot captures every open room.
+func (s *Store) Snapshot() snapshot.Snapshot {
+	return Snapshot(s.List())
+}
+
+func (r *Room) snapshot() snapshot.Room {
+	r.mu.Lock()
+	sr := snapshot.Room{
+		Code:       r.Code,
+		HostID:     r.HostID,
+		CreatedAt:  r.CreatedAt,
+		LastActive: r.lastActive,
+		Locked:     r.locked,
+	}
+	for id := range r.banned {
+		sr.Banned = append(sr.Banned, id)
+	}
+	r.mu.Unlock()
+	slices.Sort(sr.Banned)
+
+	g := r.Game
+	sr.Scene = g.Scene()
+	sr.Notice = g.Notice()
+	sr.LateJoin = g.LateJoinPolicy()
+	sr.Lobby = g.LobbySettings()
+	sr.Ghost = g.Ghost()
+
+	// Scoreboard order first, so restoring them in turn keeps ties in
+	// place; then the spectators, who aren't ranked.
+	list := g.Players.Ranked()
+	var rest []*players.Player
+	for _, p := range g.Players.GetList() {
+		if !slices.Contains(list, p) {
+			rest = append(rest, p)
+		}
+	}
+	slices.SortFunc(rest, func(a, b *players.Player) int {
+		if c := a.JoinedAt.Compare(b.JoinedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	for _, p := range append(list, rest...) {
+		sr.Players = append(sr.Players, snapshot.Player{
+			ID:        p.ID,
+			Name:      p.Name,
+			Color:     p.Color,
+			Score:     p.Score,
+			JoinedAt:  p.JoinedAt,
+			LateJoin:  p.LateJoin,
+			Spectator: p.Spectator,
+			Handicap:  p.Handicap,
+		})
+	}
+	return sr
+}
+
+// Restore reopens the rooms in a snapshot under their old codes, skipping
+// any code already in use here or on another instance, and returns them.
+// Players are tracked as if they had just disconnected, so whoever doesn't
+// come back is removed after the presence grace period. A room saved
+// mid-round comes back to the lobby with scores cleared and
+// InterruptedNotice shown.
+func (s *Store) Restore(snap snapshot.Snapshot) []*Room {
+	var restored []*Room
+	for _, sr := range snap.Rooms {
+		if sr.Code == "" {
+			continue
+		}
+		room, err := s.open(sr.Code, sr.HostID, &sr)
+		switch {
+		case errors.Is(err, errCodeTaken):
+			continue
+		case errors.Is(err, ErrClosed), errors.Is(err, ErrNoDirectory):
+			return restored
+		case err != nil:
+			slog.Error("claiming restored room code failed", "component", "rooms", "room_code", sr.Code, "error", err)
+			continue
+		}
+		restored = append(restored, room)
+	}
+	return restored
+}
+
+func (r *Room) restore(sr snapshot.Room) {
+	if !sr.LastActive.IsZero() {
+		r.lastActive = sr.LastActive
+	}
+	r.locked = sr.Locked
+	for _, id := range sr.Banned {
+		r.banned[id] = true
+	}
+
+	g := r.Game
+	if sr.LateJoin != "" {
+		g.SetLateJoinPolicy(sr.LateJoin)
+	}
+	g.SetLobbySettings(sr.Lobby)
+	g.SetNotice(sr.Notice)
+	g.SetGhost(sr.Ghost)
+	for _, p := range sr.Players {
+		g.Players.Restore(players.Player{
+			ID:        p.ID,
+			Name:      p.Name,
+			Color:     p.Color,
+			Score:     p.Score,
+			JoinedAt:  p.JoinedAt,
+			LateJoin:  p.LateJoin,
+			Spectator: p.Spectator,
+			Handicap:  p.Handicap,
+		})
+		r.Presence.Track(p.ID)
+	}
+
+	switch sr.Scene {
+	case gamedata.SceneCombat:
+		g.ResetToLobby()
+		g.SetNotice(InterruptedNotice)
+	case gamedata.SceneRecap:
+		g.SetScene(gamedata.SceneRecap)
+	}
+}
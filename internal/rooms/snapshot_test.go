@@ -0,0 +1,123 @@
+package rooms
+
+import (
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/ghost"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStore_SnapshotRestore(t *testing.T) {
+	old := NewStore(testConfig())
+	room, _ := old.Create("p1")
+	g := room.Game
+	g.Players.Add("p1", "Alice")
+	g.Players.Add("p2", "Bob")
+	g.Players.Add("p3", "Carol")
+	g.Players.SetSpectator("p3", true)
+	g.Players.UpdateScore("p2", 3)
+	g.Players.UpdateScore("p1", 3)
+	g.SetScene(gamedata.SceneRecap)
+	g.SetLateJoinPolicy(gamedata.LateJoinSpectate)
+	room.SetLocked(true)
+	room.Ban("p9")
+	g.SetGhost(ghost.NewRun("g1", "p0", "Ghost", "#999", 42, nil))
+
+	s := NewStore(testConfig())
+	var created []string
+	s.SetOnCreate(func(r *Room) { created = append(created, r.Code) })
+	restored := s.Restore(old.Snapshot())
+	old.CloseAll("/", "test")
+
+	if len(restored) != 1 || s.Get(room.Code) != restored[0] {
+		t.Fatalf("Restore() = %v, want the room back under code %s", restored, room.Code)
+	}
+	r := restored[0]
+	if !slices.Equal(created, []string{room.Code}) {
+		t.Errorf("OnCreate ran for %v, want the restored room", created)
+	}
+	if r.Host() != "p1" || !r.Locked() || !r.IsBanned("p9") {
+		t.Errorf("host %q, locked %v, p9 banned %v; want p1, true, true", r.Host(), r.Locked(), r.IsBanned("p9"))
+	}
+	if r.Game.Scene() != gamedata.SceneRecap || r.Game.LateJoinPolicy() != gamedata.LateJoinSpectate {
+		t.Errorf("scene %s, late join %s; want recap, spectate", r.Game.Scene(), r.Game.LateJoinPolicy())
+	}
+	// p2 reached 3 first and stays ahead.
+	var order []string
+	for _, p := range r.Game.Recap().Rankings {
+		order = append(order, p.ID)
+	}
+	if !slices.Equal(order, []string{"p2", "p1"}) {
+		t.Errorf("recap order = %v, want [p2 p1]", order)
+	}
+	if p := r.Game.Players.Get("p3"); p == nil || !p.Spectator {
+		t.Errorf("p3 = %+v, want restored as a spectator", p)
+	}
+	if run := r.Game.Ghost(); run == nil || run.Seed != 42 {
+		t.Errorf("Ghost() = %+v, want the race to carry on", run)
+	}
+}
+
+func TestStore_RestoreMidRoundAsLobby(t *testing.T) {
+	old := NewStore(testConfig())
+	room, _ := old.Create("p1")
+	room.Game.Players.Add("p1", "Alice")
+	room.Game.Players.UpdateScore("p1", 5)
+	room.Game.Players.SetReady("p1", true)
+	room.Game.SetScene(gamedata.SceneCombat)
+	snap := old.Snapshot()
+	old.CloseAll("/", "test")
+
+	s := NewStore(testConfig())
+	r := s.Restore(snap)[0]
+	if r.Game.Scene() != gamedata.SceneLobby {
+		t.Errorf("scene = %s, want lobby", r.Game.Scene())
+	}
+	if p := r.Game.Players.Get("p1"); p == nil || p.Score != 0 || p.Ready {
+		t.Errorf("p1 = %+v, want back with round state cleared", p)
+	}
+	if r.Game.Notice() != InterruptedNotice {
+		t.Errorf("notice = %q, want the interrupted-round notice", r.Game.Notice())
+	}
+}
+
+func TestStore_RestoreSkipsTakenCodes(t *testing.T) {
+	s := NewStore(testConfig())
+	room, _ := s.Create("p1")
+	snap := s.Snapshot()
+	if got := s.Restore(snap); len(got) != 0 || s.Get(room.Code) != room {
+		t.Errorf("Restore() over a live room = %v, want it left alone", got)
+	}
+
+	s.CloseAll("/", "test")
+	if got := s.Restore(snap); len(got) != 0 {
+		t.Errorf("Restore() after CloseAll = %v, want nothing", got)
+	}
+}
+
+func TestStore_RestoredPlayersExpireIfAbsent(t *testing.T) {
+	old := NewStore(testConfig())
+	room, _ := old.Create("p1")
+	room.Game.Players.Add("p1", "Alice")
+	snap := old.Snapshot()
+	old.CloseAll("/", "test")
+
+	s := NewStore(testConfig())
+	expired := make(chan string, 1)
+	s.SetPresence(PresenceConfig{
+		AwayAfter:   time.Millisecond,
+		RemoveAfter: 10 * time.Millisecond,
+		Expired:     func(_ *Room, id string) { expired <- id },
+	})
+	r := s.Restore(snap)[0]
+	defer r.Close()
+	select {
+	case id := <-expired:
+		if id != "p1" {
+			t.Errorf("expired %s, want p1", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a restored player who never reconnects should expire")
+	}
+}
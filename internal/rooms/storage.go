@@ -5,63 +5,322 @@ import (
 	"clicktrainer/internal/events"
 	"clicktrainer/internal/gamedata"
 	"clicktrainer/internal/players"
+	"clicktrainer/internal/presence"
+	"clicktrainer/internal/round"
+	"clicktrainer/internal/snapshot"
 	"clicktrainer/internal/targets"
+	"clicktrainer/internal/tick"
 	"clicktrainer/internal/wshub"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 )
 
-const staleTTL = 1 * time.Hour
+// DefaultIdleTTL is how long a room may go without activity before it is
+// closed, unless the store is configured otherwise.
+const DefaultIdleTTL = 1 * time.Hour
+
+const expirySweepInterval = 15 * time.Second
+
+// Expiry reasons, reported to ExpiryConfig.Expired.
+const (
+	ExpiredIdle  = "idle"  // players are in the room but nothing is happening
+	ExpiredEmpty = "empty" // nobody registered
+)
+
+// ErrClosed is returned by Create once the store has been shut down.
+var ErrClosed = errors.New("room store is closed")
+
+// ErrNoDirectory is returned by Create while the store waits for the
+// directory it shares room codes through.
+var ErrNoDirectory = errors.New("room directory is unavailable")
 
 type Store struct {
-	mu    sync.Mutex
-	rooms map[string]*Room
-	cfg   gamedata.Config
+	mu       sync.Mutex
+	rooms    map[string]*Room
+	pending  map[string]bool // codes Create is claiming, not yet in rooms
+	closed   bool            // CloseAll has run; no new rooms
+	cfg      gamedata.Config
+	presence PresenceConfig
+	expiry   ExpiryConfig
+	hooks    func(room *Room) round.Hooks
+	onCreate func(room *Room)
+	tickRate int
+	tickFor  func(room *Room) tick.FlushFunc
+	dir      Directory
+	dirWait  bool // AwaitDirectory has run and SetDirectory hasn't
+	self     Instance
+}
+
+// PresenceConfig controls how rooms react to players whose connections drop.
+// A zero RemoveAfter disables presence tracking.
+type PresenceConfig struct {
+	AwayAfter   time.Duration
+	RemoveAfter time.Duration
+	Away        func(room *Room, playerID string)
+	Back        func(room *Room, playerID string)
+	Expired     func(room *Room, playerID string)
+}
+
+// ExpiryConfig controls when rooms without activity are closed. Warn is
+// called once a room is within WarnBefore of expiring, and again with a zero
+// deadline if activity resumes first. A zero IdleTTL disables expiry.
+type ExpiryConfig struct {
+	IdleTTL    time.Duration
+	WarnBefore time.Duration
+	Warn       func(room *Room, expiresAt time.Time)
+	Expired    func(room *Room, reason string)
 }
 
 func NewStore(cfg gamedata.Config) *Store {
 	s := &Store{
-		rooms: make(map[string]*Room),
-		cfg:   cfg,
+		rooms:   make(map[string]*Room),
+		pending: make(map[string]bool),
+		cfg:     cfg,
+		expiry:  ExpiryConfig{IdleTTL: DefaultIdleTTL},
+		dir:     NewMemoryDirectory(),
+		self:    Instance{ID: "local"},
 	}
-	go s.sweepStale()
+	go s.sweepExpired()
 	return s
 }
 
-func (s *Store) Create(hostID string) (*Room, error) {
+// SetPresence configures presence tracking for rooms created afterwards.
+func (s *Store) SetPresence(cfg PresenceConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.presence = cfg
+}
+
+// SetOnCreate sets a function run for every room created afterwards, before
+// Create returns it, e.g. to attach event subscribers.
+func (s *Store) SetOnCreate(fn func(room *Room)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onCreate = fn
+}
+
+// SetExpiry configures when idle rooms are closed.
+func (s *Store) SetExpiry(cfg ExpiryConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expiry = cfg
+}
+
+// SetRoundHooks sets how rooms created afterwards build the hooks for their
+// round controller.
+func (s *Store) SetRoundHooks(fn func(room *Room) round.Hooks) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = fn
+}
+
+// SetTick sets how often rooms created afterwards send batched updates, in
+// ticks per second, and how they build the function that sends them.
+func (s *Store) SetTick(rate int, flushFor func(room *Room) tick.FlushFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tickRate = rate
+	s.tickFor = flushFor
+}
+
+// SetDirectory sets where the store claims room codes, and the instance it
+// claims them as. It should be called before any room is created.
+func (s *Store) SetDirectory(dir Directory, self Instance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir = dir
+	s.self = self
+	s.dirWait = false
+}
+
+// AwaitDirectory stops the store opening rooms until SetDirectory is
+// called, so an instance whose shared directory is unreachable doesn't
+// hand out codes the other instances don't know about.
+func (s *Store) AwaitDirectory() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirWait = true
+}
+
+// Self returns the instance the store claims room codes as.
+func (s *Store) Self() Instance {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.self
+}
 
+// Owner returns the instance that holds code in the directory, which may be
+// this one, or ErrNoOwner.
+func (s *Store) Owner(code string) (Instance, error) {
+	s.mu.Lock()
+	dir := s.dir
+	s.mu.Unlock()
+	return dir.Owner(code)
+}
+
+// errCodeTaken means a room code is open here or on another instance.
+var errCodeTaken = errors.New("room code taken")
+
+// Create opens a room under a new code.
+func (s *Store) Create(hostID string) (*Room, error) {
 	// Try up to 10 times to generate a unique code
 	for range 10 {
 		code, err := GenerateCode()
 		if err != nil {
 			return nil, fmt.Errorf("generating room code: %w", err)
 		}
-		if _, exists := s.rooms[code]; exists {
+		room, err := s.open(code, hostID, nil)
+		if errors.Is(err, errCodeTaken) {
 			continue
 		}
+		return room, err
+	}
+	return nil, fmt.Errorf("failed to generate unique room code after 10 attempts")
+}
 
-		ps := players.NewStore()
-		ts := targets.NewStore()
-		bus := events.NewBus()
-		game := gamedata.NewGame(ps, ts, bus, s.cfg)
-		b := broadcast.NewBroadcaster(bus)
-		hub := wshub.NewHub()
-
-		room := &Room{
-			Code:        code,
-			Game:        game,
-			Broadcaster: b,
-			Hub:         hub,
-			CreatedAt:   time.Now(),
-			HostID:      hostID,
+// open opens a room under code, restored from sr if it isn't nil. The code
+// is reserved in the store, then claimed in the directory and the room's
+// hooks run without holding s.mu, since with a shared directory the claim
+// is a database round trip. A claim the store can't use by the time it
+// lands, because the store was closed or its directory changed meanwhile,
+// is released. It returns errCodeTaken if the code is open here or on
+// another instance.
+func (s *Store) open(code, hostID string, sr *snapshot.Room) (*Room, error) {
+	s.mu.Lock()
+	if err := s.createErrLocked(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if _, exists := s.rooms[code]; exists || s.pending[code] {
+		s.mu.Unlock()
+		return nil, errCodeTaken
+	}
+	s.pending[code] = true
+	dir, self := s.dir, s.self
+	s.mu.Unlock()
+
+	claimed, err := dir.Claim(code, self)
+	if err != nil || !claimed {
+		s.unreserve(code)
+		if err != nil {
+			return nil, fmt.Errorf("claiming room code: %w", err)
 		}
-		s.rooms[code] = room
-		return room, nil
+		return nil, errCodeTaken
+	}
+
+	s.mu.Lock()
+	if err := s.createErrLocked(); err != nil || s.dir != dir {
+		delete(s.pending, code)
+		s.mu.Unlock()
+		s.releaseFrom(dir, self, code)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errCodeTaken // claimed in a directory the store no longer uses
+	}
+	room := s.newRoomLocked(code, hostID)
+	onCreate := s.onCreate
+	s.mu.Unlock()
+
+	if sr != nil {
+		// Keep the creation time first so hooks such as the journal pick
+		// up where the room left off, then let them see the restore.
+		room.CreatedAt = sr.CreatedAt
+	}
+	if onCreate != nil {
+		onCreate(room)
+	}
+	if sr != nil {
+		room.restore(*sr)
+	}
+
+	s.mu.Lock()
+	delete(s.pending, code)
+	if s.closed {
+		s.mu.Unlock()
+		s.releaseFrom(dir, self, code)
+		room.Close()
+		return nil, ErrClosed
+	}
+	s.rooms[code] = room
+	s.mu.Unlock()
+	return room, nil
+}
+
+// createErrLocked returns why the store can't open rooms, if it can't. The
+// caller holds s.mu.
+func (s *Store) createErrLocked() error {
+	if s.closed {
+		return ErrClosed
+	}
+	if s.dirWait {
+		return ErrNoDirectory
+	}
+	return nil
+}
+
+func (s *Store) unreserve(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, code)
+}
+
+// newRoomLocked builds a room with the store's current settings. The caller
+// holds s.mu and adds the room to the store.
+func (s *Store) newRoomLocked(code, hostID string) *Room {
+	now := time.Now()
+	ps := players.NewStore()
+	ts := targets.NewStore()
+	bus := events.NewBus()
+	game := gamedata.NewGame(ps, ts, bus, s.cfg)
+	b := broadcast.NewBroadcaster(bus)
+	hub := wshub.NewHub()
+
+	room := &Room{
+		Code:        code,
+		Game:        game,
+		Broadcaster: b,
+		Hub:         hub,
+		CreatedAt:   now,
+		HostID:      hostID,
+		banned:      make(map[string]bool),
+		lastActive:  now,
+	}
+	room.Presence = presence.NewTracker(s.presence.AwayAfter, s.presence.RemoveAfter, s.presenceHooks(room))
+	ctx, cancel := context.WithCancel(context.Background())
+	room.cancel = cancel
+	var hooks round.Hooks = round.NopHooks{}
+	if s.hooks != nil {
+		hooks = s.hooks(room)
+	}
+	room.Round = round.New(ctx, game, hooks)
+	flush := func(tick.Batch) {}
+	if s.tickFor != nil {
+		flush = s.tickFor(room)
+	}
+	room.Tick = tick.New(ctx, s.tickRate, flush)
+	ps.OnRankChange(room.Tick.Rank)
+	return room
+}
+
+// presenceHooks binds the store's presence callbacks to a room.
+func (s *Store) presenceHooks(room *Room) presence.Hooks {
+	cfg := s.presence
+	bind := func(fn func(*Room, string)) func(string) {
+		if fn == nil {
+			return nil
+		}
+		return func(playerID string) { fn(room, playerID) }
+	}
+	return presence.Hooks{
+		Away:    bind(cfg.Away),
+		Back:    bind(cfg.Back),
+		Expired: bind(cfg.Expired),
 	}
-	return nil, fmt.Errorf("failed to generate unique room code after 10 attempts")
 }
 
 func (s *Store) Get(code string) *Room {
@@ -70,10 +329,68 @@ func (s *Store) Get(code string) *Room {
 	return s.rooms[code]
 }
 
+// Delete removes a room and closes it.
 func (s *Store) Delete(code string) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	room, ok := s.rooms[code]
 	delete(s.rooms, code)
+	s.mu.Unlock()
+	if ok {
+		s.release(code)
+		room.Close()
+	}
+}
+
+// release gives up the codes of rooms the store has closed.
+func (s *Store) release(codes ...string) {
+	s.mu.Lock()
+	dir, self := s.dir, s.self
+	s.mu.Unlock()
+	s.releaseFrom(dir, self, codes...)
+}
+
+func (s *Store) releaseFrom(dir Directory, self Instance, codes ...string) {
+	for _, code := range codes {
+		if err := dir.Release(code, self.ID); err != nil {
+			slog.Error("releasing room code failed", "component", "rooms", "room_code", code, "error", err)
+		}
+	}
+}
+
+// renewClaims tells the directory the store's rooms are still open.
+func (s *Store) renewClaims() {
+	s.mu.Lock()
+	dir, self := s.dir, s.self
+	codes := make([]string, 0, len(s.rooms))
+	for code := range s.rooms {
+		codes = append(codes, code)
+	}
+	s.mu.Unlock()
+	if err := dir.Renew(self.ID, codes); err != nil {
+		slog.Error("renewing room codes failed", "component", "rooms", "error", err)
+	}
+}
+
+// CloseAll stops the store creating rooms, then removes and closes every
+// room, sending its clients to next with the given reason. It returns the
+// rooms it closed.
+func (s *Store) CloseAll(next, reason string) []*Room {
+	s.mu.Lock()
+	s.closed = true
+	closed := make([]*Room, 0, len(s.rooms))
+	codes := make([]string, 0, len(s.rooms))
+	for code, room := range s.rooms {
+		closed = append(closed, room)
+		codes = append(codes, code)
+		delete(s.rooms, code)
+	}
+	s.mu.Unlock()
+	s.release(codes...)
+
+	for _, room := range closed {
+		room.CloseWith(next, reason)
+	}
+	return closed
 }
 
 func (s *Store) List() []*Room {
@@ -86,17 +403,70 @@ func (s *Store) List() []*Room {
 	return list
 }
 
-func (s *Store) sweepStale() {
-	ticker := time.NewTicker(5 * time.Minute)
+func (s *Store) sweepExpired() {
+	ticker := time.NewTicker(expirySweepInterval)
 	defer ticker.Stop()
-	for range ticker.C {
-		s.mu.Lock()
-		now := time.Now()
-		for code, room := range s.rooms {
-			if now.Sub(room.CreatedAt) > staleTTL {
-				delete(s.rooms, code)
+	for now := range ticker.C {
+		s.ExpireIdle(now)
+		s.renewClaims()
+	}
+}
+
+// ExpireIdle closes rooms that have gone without activity for the idle TTL
+// and warns rooms that are close to it.
+func (s *Store) ExpireIdle(now time.Time) {
+	type expiry struct {
+		room   *Room
+		reason string
+	}
+	var expired []expiry
+	var warned []*Room
+
+	s.mu.Lock()
+	cfg := s.expiry
+	if cfg.IdleTTL <= 0 {
+		s.mu.Unlock()
+		return
+	}
+	for code, room := range s.rooms {
+		room.mu.Lock()
+		idle := now.Sub(room.lastActive)
+		switch {
+		case idle >= cfg.IdleTTL:
+			reason := ExpiredIdle
+			if room.Game.Players.Count() == 0 {
+				reason = ExpiredEmpty
+			}
+			expired = append(expired, expiry{room, reason})
+			delete(s.rooms, code)
+		case cfg.WarnBefore > 0 && idle >= cfg.IdleTTL-cfg.WarnBefore:
+			if room.expiryWarn.IsZero() {
+				room.expiryWarn = room.lastActive.Add(cfg.IdleTTL)
+				warned = append(warned, room)
 			}
+		case !room.expiryWarn.IsZero():
+			// Activity resumed since the warning.
+			room.expiryWarn = time.Time{}
+			warned = append(warned, room)
 		}
-		s.mu.Unlock()
+		room.mu.Unlock()
+	}
+	s.mu.Unlock()
+
+	// Call out and close outside the lock; closing writes to client
+	// connections.
+	for _, e := range expired {
+		s.release(e.room.Code)
+	}
+	for _, room := range warned {
+		if cfg.Warn != nil {
+			cfg.Warn(room, room.ExpiryWarning())
+		}
+	}
+	for _, e := range expired {
+		if cfg.Expired != nil {
+			cfg.Expired(e.room, e.reason)
+		}
+		e.room.Close()
 	}
 }
@@ -2,8 +2,10 @@ package rooms
 
 import (
 	"clicktrainer/internal/gamedata"
+	"errors"
 	"sync"
 	"testing"
+	"time"
 )
 
 func testConfig() gamedata.Config {
@@ -76,6 +78,29 @@ func TestStore_Delete(t *testing.T) {
 	}
 }
 
+func TestStore_CloseAll(t *testing.T) {
+	s := NewStore(testConfig())
+	room, _ := s.Create("host-1")
+	ch := room.Broadcaster.Subscribe()
+
+	if closed := s.CloseAll("/?restarting=1", "server restarting"); len(closed) != 1 || closed[0] != room {
+		t.Fatalf("CloseAll returned %v, want the one room", closed)
+	}
+	if s.Get(room.Code) != nil {
+		t.Error("closed room should be removed")
+	}
+	var last string
+	for msg := range ch {
+		last = msg.Msg
+	}
+	if last != "/?restarting=1" {
+		t.Errorf("last message = %q, want the restart page", last)
+	}
+	if _, err := s.Create("host-2"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Create after CloseAll error = %v, want ErrClosed", err)
+	}
+}
+
 func TestStore_List(t *testing.T) {
 	s := NewStore(testConfig())
 	if _, err := s.Create("host-1"); err != nil {
@@ -129,3 +154,92 @@ func TestStore_RoomIsolation(t *testing.T) {
 		t.Error("room2 should only have Bob")
 	}
 }
+
+func TestStore_ExpireIdle(t *testing.T) {
+	s := NewStore(testConfig())
+	var warnings []time.Time
+	var reasons []string
+	s.SetExpiry(ExpiryConfig{
+		IdleTTL:    time.Minute,
+		WarnBefore: 10 * time.Second,
+		Warn:       func(_ *Room, at time.Time) { warnings = append(warnings, at) },
+		Expired:    func(_ *Room, reason string) { reasons = append(reasons, reason) },
+	})
+
+	room, _ := s.Create("")
+	start := room.LastActive()
+
+	s.ExpireIdle(start.Add(30 * time.Second))
+	if len(warnings) != 0 {
+		t.Fatalf("warnings = %v, want none before the warning window", warnings)
+	}
+
+	s.ExpireIdle(start.Add(55 * time.Second))
+	s.ExpireIdle(start.Add(56 * time.Second))
+	if len(warnings) != 1 || !warnings[0].Equal(start.Add(time.Minute)) {
+		t.Fatalf("warnings = %v, want one for %v", warnings, start.Add(time.Minute))
+	}
+	if !room.ExpiryWarning().Equal(warnings[0]) {
+		t.Errorf("ExpiryWarning = %v, want %v", room.ExpiryWarning(), warnings[0])
+	}
+
+	s.ExpireIdle(start.Add(61 * time.Second))
+	if s.Get(room.Code) != nil {
+		t.Error("idle room should have expired")
+	}
+	if len(reasons) != 1 || reasons[0] != ExpiredEmpty {
+		t.Errorf("reasons = %v, want [%s]", reasons, ExpiredEmpty)
+	}
+
+	// A room with players expires as idle.
+	room, _ = s.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	s.ExpireIdle(room.LastActive().Add(time.Hour))
+	if len(reasons) != 2 || reasons[1] != ExpiredIdle {
+		t.Errorf("reasons = %v, want the second to be %s", reasons, ExpiredIdle)
+	}
+}
+
+func TestStore_ExpireIdle_ActivityClearsWarning(t *testing.T) {
+	s := NewStore(testConfig())
+	var warnings []time.Time
+	s.SetExpiry(ExpiryConfig{
+		IdleTTL:    time.Minute,
+		WarnBefore: 10 * time.Second,
+		Warn:       func(_ *Room, at time.Time) { warnings = append(warnings, at) },
+	})
+	room, _ := s.Create("host")
+
+	s.ExpireIdle(room.LastActive().Add(55 * time.Second))
+	if !room.KeepAlive() {
+		t.Error("KeepAlive should report the pending warning")
+	}
+	if room.KeepAlive() {
+		t.Error("second KeepAlive should report no warning")
+	}
+
+	// Activity other than a keep-alive clears the warning on the next sweep.
+	s.ExpireIdle(room.LastActive().Add(55 * time.Second))
+	room.Touch()
+	s.ExpireIdle(room.LastActive())
+	if len(warnings) != 3 || !warnings[2].IsZero() {
+		t.Errorf("warnings = %v, want the last one cleared", warnings)
+	}
+	if !room.ExpiryWarning().IsZero() {
+		t.Error("ExpiryWarning should be cleared after activity")
+	}
+	if s.Get(room.Code) == nil {
+		t.Error("active room should not expire")
+	}
+}
+
+func TestStore_ExpireIdle_Disabled(t *testing.T) {
+	s := NewStore(testConfig())
+	s.SetExpiry(ExpiryConfig{})
+	room, _ := s.Create("")
+
+	s.ExpireIdle(time.Now().Add(24 * time.Hour))
+	if s.Get(room.Code) == nil {
+		t.Error("rooms should not expire when expiry is disabled")
+	}
+}
@@ -0,0 +1,322 @@
+package round
+
+import (
+	"clicktrainer/internal/events"
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/players"
+	"clicktrainer/internal/targets"
+	"context"
+	"sync"
+	"time"
+)
+
+// RespawnDelay is how long a killed target stays gone before a new one
+// appears.
+const RespawnDelay = 500 * time.Millisecond
+
+// Hooks are the side effects of a round: broadcasting and persistence. They
+// are called from the controller's goroutine, except TargetSpawned and
+// PauseChanged. PauseChanged is called by whoever paused or resumed.
+// TargetSpawned is called from a respawn timer or by whoever resumed, with
+// the controller locked so that it always comes before the round ends; it
+// must not call back into the controller.
+//
+// The controller only reports deadlines; clients render the countdown and
+// the round clock themselves.
+type Hooks interface {
+	CountdownStarted(endsAt time.Time)
+	// RoundStarting runs before the targets are placed, e.g. to create the
+	// game record that clicks will refer to.
+	RoundStarting()
+	// RoundStarted runs once the round clock is running; the deadline is
+	// available from Game.RoundEndsAt.
+	RoundStarted()
+	TargetSpawned(t *targets.Target)
+	PauseChanged(paused bool)
+	RoundEnded(rankings []*players.Player)
+}
+
+// NopHooks does nothing; it lets a controller run without side effects.
+type NopHooks struct{}
+
+func (NopHooks) CountdownStarted(time.Time)    {}
+func (NopHooks) RoundStarting()                {}
+func (NopHooks) RoundStarted()                 {}
+func (NopHooks) TargetSpawned(*targets.Target) {}
+func (NopHooks) PauseChanged(bool)             {}
+func (NopHooks) RoundEnded([]*players.Player)  {}
+
+// Phase is where the controller is in a round.
+type Phase int
+
+const (
+	PhaseIdle      Phase = iota // no round running
+	PhaseCountdown              // pre-round countdown
+	PhaseRunning                // round clock running
+	PhaseEnding                 // end-of-round steps in progress
+)
+
+// Controller owns a room's round lifecycle: the countdown, the round clock,
+// target respawns and the end-of-round steps. It runs until its context is
+// cancelled, which abandons any round in progress, as does the game going
+// back to the lobby.
+//
+// Both the countdown and the round clock are deadlines checked against the
+// monotonic clock, so they don't drift however slowly broadcasts go out.
+type Controller struct {
+	ctx   context.Context
+	game  *gamedata.Game
+	hooks Hooks
+
+	mu            sync.Mutex
+	phase         Phase
+	paused        bool
+	countdownEnds time.Time           // countdown deadline; zero while paused
+	countdownLeft time.Duration       // countdown left when paused
+	deferred      int                 // respawns that came due while paused
+	timers        map[int]*time.Timer // pending respawns
+	nextTimer     int
+	wake          chan struct{} // signalled on pause and resume
+	done          chan struct{} // closed when the current round goroutine exits
+}
+
+func New(ctx context.Context, game *gamedata.Game, hooks Hooks) *Controller {
+	done := make(chan struct{})
+	close(done)
+	return &Controller{
+		ctx:    ctx,
+		game:   game,
+		hooks:  hooks,
+		timers: make(map[int]*time.Timer),
+		wake:   make(chan struct{}, 1),
+		done:   done,
+	}
+}
+
+// Start runs a round in the background: countdown, clock, then the
+// end-of-round steps. Returns false if a round is already running or the
+// controller has been shut down.
+func (c *Controller) Start() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.phase != PhaseIdle || c.ctx.Err() != nil {
+		return false
+	}
+	c.phase = PhaseCountdown
+	c.paused = false
+	c.countdownEnds = time.Now().Add(time.Duration(c.game.Config.CountdownSecs) * time.Second)
+	c.done = make(chan struct{})
+	go c.run(c.done, c.game.Reset())
+	return true
+}
+
+// Done returns a channel closed once the current round has finished or been
+// abandoned.
+func (c *Controller) Done() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done
+}
+
+func (c *Controller) Phase() Phase {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.phase
+}
+
+func (c *Controller) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// CountdownEndsAt returns the pre-round countdown deadline. ok is false
+// outside the countdown or while it is paused.
+func (c *Controller) CountdownEndsAt() (endsAt time.Time, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.countdownEnds, c.phase == PhaseCountdown && !c.countdownEnds.IsZero()
+}
+
+// Pause stops the countdown or round clock. Returns false if there is
+// nothing to pause.
+func (c *Controller) Pause() bool {
+	return c.setPaused(true)
+}
+
+// Resume restarts a paused countdown or round clock, spawning any targets
+// that came due while paused.
+func (c *Controller) Resume() bool {
+	return c.setPaused(false)
+}
+
+func (c *Controller) setPaused(paused bool) bool {
+	c.mu.Lock()
+	if c.phase != PhaseCountdown && c.phase != PhaseRunning {
+		c.mu.Unlock()
+		return false
+	}
+	if c.paused == paused {
+		c.mu.Unlock()
+		return false
+	}
+	c.paused = paused
+	switch {
+	case c.phase == PhaseRunning && paused:
+		c.game.PauseClock()
+	case c.phase == PhaseRunning:
+		c.game.ResumeClock()
+	case paused:
+		c.countdownLeft = max(time.Until(c.countdownEnds), 0)
+		c.countdownEnds = time.Time{}
+	default:
+		c.countdownEnds = time.Now().Add(c.countdownLeft)
+	}
+	deferred, epoch := 0, c.game.Epoch()
+	if !paused {
+		deferred, c.deferred = c.deferred, 0
+	}
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	c.hooks.PauseChanged(paused)
+	if deferred > 0 {
+		c.mu.Lock()
+		for range deferred {
+			c.spawnLocked(epoch)
+		}
+		c.mu.Unlock()
+	}
+	return true
+}
+
+// Respawn schedules a replacement target after RespawnDelay. Respawns are
+// tied to the round they were scheduled in and are dropped if it has ended
+// by the time they fall due, even if another round has started since.
+func (c *Controller) Respawn() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.phase != PhaseRunning {
+		return
+	}
+	id, epoch := c.nextTimer, c.game.Epoch()
+	c.nextTimer++
+	c.timers[id] = time.AfterFunc(RespawnDelay, func() { c.spawn(id, epoch) })
+}
+
+func (c *Controller) spawn(id int, epoch uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.timers, id)
+	if c.phase != PhaseRunning || c.ctx.Err() != nil || c.game.Epoch() != epoch {
+		return
+	}
+	if c.paused {
+		c.deferred++
+		return
+	}
+	c.spawnLocked(epoch)
+}
+
+// spawnLocked adds a target to the round identified by epoch and announces
+// it. Holding the lock keeps the announcement ahead of the round's end.
+func (c *Controller) spawnLocked(epoch uint64) {
+	if t, ok := c.game.SpawnTarget(epoch); ok {
+		c.targetSpawned(t)
+	}
+}
+
+func (c *Controller) targetSpawned(t *targets.Target) {
+	c.game.Events.Publish(events.TargetSpawned{TargetID: t.ID, X: t.X, Y: t.Y, Size: t.Size, Color: t.Color})
+	c.hooks.TargetSpawned(t)
+}
+
+func (c *Controller) run(done chan struct{}, reset <-chan struct{}) {
+	defer close(done)
+	defer c.finish()
+
+	if c.game.Config.CountdownSecs > 0 {
+		if endsAt, ok := c.CountdownEndsAt(); ok {
+			c.hooks.CountdownStarted(endsAt)
+		}
+		if !c.waitUntil(c.CountdownEndsAt, reset) {
+			return
+		}
+	}
+
+	c.hooks.RoundStarting()
+	if c.ctx.Err() != nil {
+		return
+	}
+	c.mu.Lock()
+	c.game.StartRound()
+	c.phase = PhaseRunning
+	if c.paused {
+		// Paused during RoundStarting; start the clock frozen.
+		c.game.PauseClock()
+	}
+	c.mu.Unlock()
+	c.hooks.RoundStarted()
+
+	if !c.waitUntil(c.game.RoundEndsAt, reset) {
+		return
+	}
+
+	c.mu.Lock()
+	c.phase = PhaseEnding
+	c.mu.Unlock()
+	rankings := c.game.EndRound()
+	c.hooks.RoundEnded(rankings)
+}
+
+// finish returns the controller to idle and drops pending respawns.
+func (c *Controller) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.phase = PhaseIdle
+	c.paused = false
+	c.deferred = 0
+	for _, t := range c.timers {
+		t.Stop()
+	}
+	c.timers = make(map[int]*time.Timer)
+}
+
+// waitUntil blocks until the deadline reported by deadline has passed.
+// While the deadline is unavailable (the clock is paused) it waits to be
+// woken. Returns false if the context was cancelled or the game was reset
+// to the lobby first.
+func (c *Controller) waitUntil(deadline func() (time.Time, bool), reset <-chan struct{}) bool {
+	for {
+		endsAt, ok := deadline()
+		if !ok {
+			select {
+			case <-c.ctx.Done():
+				return false
+			case <-reset:
+				return false
+			case <-c.wake:
+			}
+			continue
+		}
+		left := time.Until(endsAt)
+		if left <= 0 {
+			return true
+		}
+		timer := time.NewTimer(left)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return false
+		case <-reset:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		case <-c.wake:
+			timer.Stop()
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package round
+
+import (
+	"clicktrainer/internal/events"
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/players"
+	"clicktrainer/internal/targets"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a Hooks implementation that counts calls.
+type recorder struct {
+	mu        sync.Mutex
+	countdown []time.Time
+	spawned   int
+	pauses    []bool
+	started   bool
+	ended     bool
+}
+
+func (r *recorder) CountdownStarted(endsAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.countdown = append(r.countdown, endsAt)
+}
+func (r *recorder) RoundStarting() {}
+func (r *recorder) RoundStarted() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = true
+}
+func (r *recorder) TargetSpawned(*targets.Target) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spawned++
+}
+func (r *recorder) PauseChanged(paused bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pauses = append(r.pauses, paused)
+}
+func (r *recorder) RoundEnded([]*players.Player) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ended = true
+}
+
+func (r *recorder) spawnCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.spawned
+}
+
+func newTestController(t *testing.T, ctx context.Context, countdown, duration int) (*Controller, *gamedata.Game, *recorder) {
+	t.Helper()
+	game := gamedata.NewGame(players.NewStore(), targets.NewStore(), events.NewBus(), gamedata.Config{
+		RoundDuration:  duration,
+		InitialTargets: 2,
+		CountdownSecs:  countdown,
+	})
+	rec := &recorder{}
+	c := New(ctx, game, rec)
+	game.BeginCombat()
+	return c, game, rec
+}
+
+func waitDone(t *testing.T, c *Controller) {
+	t.Helper()
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("round did not finish")
+	}
+}
+
+func TestController_RunsFullRound(t *testing.T) {
+	c, game, rec := newTestController(t, context.Background(), 1, 1)
+
+	start := time.Now()
+	if !c.Start() {
+		t.Fatal("Start should succeed")
+	}
+	if c.Start() {
+		t.Error("Start should fail while a round is running")
+	}
+	waitDone(t, c)
+
+	if len(rec.countdown) != 1 || rec.countdown[0].Sub(start) < 900*time.Millisecond {
+		t.Errorf("countdown deadlines = %v, want one about 1s after start", rec.countdown)
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Second {
+		t.Errorf("round finished after %v, want at least countdown + duration", elapsed)
+	}
+	if !rec.started || !rec.ended {
+		t.Errorf("started = %v, ended = %v, want both", rec.started, rec.ended)
+	}
+	if game.Scene() != gamedata.SceneRecap {
+		t.Errorf("scene = %q, want %q", game.Scene(), gamedata.SceneRecap)
+	}
+	if c.Phase() != PhaseIdle {
+		t.Errorf("phase = %d, want idle", c.Phase())
+	}
+}
+
+func TestController_CancelAbandonsRound(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c, _, rec := newTestController(t, ctx, 0, 60)
+
+	c.Start()
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+	waitDone(t, c)
+
+	if rec.ended {
+		t.Error("cancelled round should not run the end-of-round steps")
+	}
+	if c.Start() {
+		t.Error("Start should fail once the context is cancelled")
+	}
+}
+
+func TestController_ResetAbandonsRound(t *testing.T) {
+	for _, countdown := range []int{0, 60} {
+		c, game, rec := newTestController(t, context.Background(), countdown, 60)
+
+		c.Start()
+		time.Sleep(30 * time.Millisecond)
+		game.ResetToLobby()
+		waitDone(t, c)
+
+		if rec.ended {
+			t.Errorf("countdown %d: a round reset to the lobby should not run the end-of-round steps", countdown)
+		}
+		game.BeginCombat()
+		if !c.Start() {
+			t.Errorf("countdown %d: Start should succeed once the reset round is abandoned", countdown)
+		}
+	}
+}
+
+func TestController_PauseFreezesDeadline(t *testing.T) {
+	c, game, rec := newTestController(t, context.Background(), 0, 1)
+
+	c.Start()
+	time.Sleep(50 * time.Millisecond)
+	if !c.Pause() {
+		t.Fatal("Pause should succeed during a round")
+	}
+	if c.Pause() {
+		t.Error("second Pause should report no change")
+	}
+	if _, ok := game.RoundEndsAt(); ok {
+		t.Error("RoundEndsAt should be unavailable while paused")
+	}
+
+	// The round would have ended by now without the pause.
+	time.Sleep(1200 * time.Millisecond)
+	if c.Phase() != PhaseRunning || game.TimeLeft() != 1 {
+		t.Fatalf("phase = %d, time left = %d; want the round frozen with 1s left", c.Phase(), game.TimeLeft())
+	}
+
+	resumed := time.Now()
+	if !c.Resume() {
+		t.Fatal("Resume should succeed while paused")
+	}
+	endsAt, ok := game.RoundEndsAt()
+	if !ok || endsAt.Sub(resumed) < 800*time.Millisecond {
+		t.Errorf("deadline after resume = %v, want pushed back by the pause", endsAt.Sub(resumed))
+	}
+	waitDone(t, c)
+
+	if !rec.ended {
+		t.Error("resumed round should finish")
+	}
+	if len(rec.pauses) != 2 || !rec.pauses[0] || rec.pauses[1] {
+		t.Errorf("pause events = %v, want [true false]", rec.pauses)
+	}
+}
+
+func TestController_PauseCountdown(t *testing.T) {
+	c, _, _ := newTestController(t, context.Background(), 1, 1)
+
+	c.Start()
+	if _, ok := c.CountdownEndsAt(); !ok {
+		t.Fatal("countdown deadline should be set")
+	}
+	c.Pause()
+	if _, ok := c.CountdownEndsAt(); ok {
+		t.Error("countdown deadline should be unavailable while paused")
+	}
+	time.Sleep(1200 * time.Millisecond)
+	if c.Phase() != PhaseCountdown {
+		t.Errorf("phase = %d, want the countdown held while paused", c.Phase())
+	}
+	c.Resume()
+	waitDone(t, c)
+}
+
+func TestController_PauseWithoutRound(t *testing.T) {
+	c, _, _ := newTestController(t, context.Background(), 0, 1)
+	if c.Pause() || c.Resume() {
+		t.Error("Pause and Resume should fail with no round running")
+	}
+}
+
+func TestController_RespawnDeferredWhilePaused(t *testing.T) {
+	c, _, rec := newTestController(t, context.Background(), 0, 100)
+
+	c.Start()
+	time.Sleep(15 * time.Millisecond)
+	c.Pause()
+	c.Respawn()
+	time.Sleep(RespawnDelay + 100*time.Millisecond)
+	if rec.spawnCount() != 0 {
+		t.Fatalf("spawned %d targets while paused, want 0", rec.spawnCount())
+	}
+
+	c.Resume()
+	if rec.spawnCount() != 1 {
+		t.Errorf("spawned %d targets on resume, want 1", rec.spawnCount())
+	}
+}
+
+func TestController_RespawnDroppedAfterRound(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c, game, rec := newTestController(t, ctx, 0, 100)
+
+	c.Start()
+	time.Sleep(15 * time.Millisecond)
+	c.Respawn()
+	before := len(game.Targets.GetList())
+	cancel()
+	waitDone(t, c)
+
+	time.Sleep(RespawnDelay + 100*time.Millisecond)
+	if rec.spawnCount() != 0 || len(game.Targets.GetList()) != before {
+		t.Error("respawn should be dropped once the round is over")
+	}
+}
+
+func TestController_RespawnDroppedInLaterRound(t *testing.T) {
+	c, game, rec := newTestController(t, context.Background(), 0, 100)
+
+	c.Start()
+	time.Sleep(15 * time.Millisecond)
+	stale := game.Epoch()
+
+	// The round ends and another starts while a respawn is in flight.
+	game.EndRound()
+	game.ResetToLobby()
+	game.StartRound()
+	before := len(game.Targets.GetList())
+
+	c.spawn(-1, stale)
+	if rec.spawnCount() != 0 || len(game.Targets.GetList()) != before {
+		t.Error("a respawn from an earlier round should be dropped")
+	}
+}
+
+// TestController_LateRespawnsDoNotLeak ends a round with respawns still
+// pending and starts the next one straight away. Run it with -race.
+func TestController_LateRespawnsDoNotLeak(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c, game, rec := newTestController(t, ctx, 0, 1)
+
+	c.Start()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-c.Done():
+				return
+			default:
+				c.Respawn()
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	waitDone(t, c)
+	wg.Wait()
+	firstRound := rec.spawnCount()
+
+	game.ResetToLobby()
+	game.BeginCombat()
+	if !c.Start() {
+		t.Fatal("second round should start")
+	}
+	time.Sleep(RespawnDelay + 100*time.Millisecond)
+
+	if n := rec.spawnCount(); n != firstRound {
+		t.Errorf("%d respawns from the first round leaked into the second", n-firstRound)
+	}
+	if n := len(game.Targets.GetList()); n != game.Config.InitialTargets {
+		t.Errorf("second round has %d targets, want %d", n, game.Config.InitialTargets)
+	}
+}
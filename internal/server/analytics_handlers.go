@@ -2,18 +2,47 @@ package server
 
 import (
 	"clicktrainer/internal/analytics"
+	"clicktrainer/internal/db"
+	"clicktrainer/internal/targets"
 	"log/slog"
 	"net/http"
 	"strings"
+
+	"github.com/google/uuid"
 )
 
-func (s *Server) handleAnalyticsDashboard(w http.ResponseWriter, r *http.Request) {
+// analyticsDB returns the database analytics reads, or answers the request
+// itself when there is none. A page says so with the unavailable page while
+// the database is away; partial and JSON responses get a plain error.
+func (s *Server) analyticsDB(w http.ResponseWriter, page bool) db.Store {
 	if s.DB == nil {
 		http.Error(w, "Analytics requires a database connection", http.StatusServiceUnavailable)
+		return nil
+	}
+	database := s.DB.Store()
+	if database != nil {
+		return database
+	}
+	w.Header().Set("Retry-After", "30")
+	if !page {
+		http.Error(w, "Analytics is temporarily unavailable", http.StatusServiceUnavailable)
+		return nil
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if err := s.Tmpl.ExecuteTemplate(w, "analytics-unavailable", nil); err != nil {
+		slog.Error("template error", "handler", "analytics_unavailable", "error", err)
+	}
+	return nil
+}
+
+func (s *Server) handleAnalyticsDashboard(w http.ResponseWriter, r *http.Request) {
+	database := s.analyticsDB(w, true)
+	if database == nil {
 		return
 	}
 
-	q := analytics.NewQueries(s.DB)
+	q := analytics.NewQueries(database)
 
 	data := struct {
 		PlayerStats *analytics.PlayerLifetimeStats
@@ -42,12 +71,12 @@ func (s *Server) handleAnalyticsDashboard(w http.ResponseWriter, r *http.Request
 }
 
 func (s *Server) handleAnalyticsLeaderboard(w http.ResponseWriter, r *http.Request) {
-	if s.DB == nil {
-		http.Error(w, "Analytics requires a database connection", http.StatusServiceUnavailable)
+	database := s.analyticsDB(w, false)
+	if database == nil {
 		return
 	}
 
-	q := analytics.NewQueries(s.DB)
+	q := analytics.NewQueries(database)
 	category := r.URL.Query().Get("cat")
 	if category == "" {
 		category = "score"
@@ -66,8 +95,8 @@ func (s *Server) handleAnalyticsLeaderboard(w http.ResponseWriter, r *http.Reque
 }
 
 func (s *Server) handleAnalyticsPlayer(w http.ResponseWriter, r *http.Request) {
-	if s.DB == nil {
-		http.Error(w, "Analytics requires a database connection", http.StatusServiceUnavailable)
+	database := s.analyticsDB(w, true)
+	if database == nil {
 		return
 	}
 
@@ -79,7 +108,7 @@ func (s *Server) handleAnalyticsPlayer(w http.ResponseWriter, r *http.Request) {
 	}
 	playerID := parts[3]
 
-	q := analytics.NewQueries(s.DB)
+	q := analytics.NewQueries(database)
 	stats, err := q.GetPlayerLifetimeStats(playerID)
 	if err != nil {
 		slog.Error("player stats query failed", "handler", "analytics_player", "player_id", playerID, "error", err)
@@ -94,8 +123,8 @@ func (s *Server) handleAnalyticsPlayer(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleAnalyticsGame(w http.ResponseWriter, r *http.Request) {
-	if s.DB == nil {
-		http.Error(w, "Analytics requires a database connection", http.StatusServiceUnavailable)
+	database := s.analyticsDB(w, true)
+	if database == nil {
 		return
 	}
 
@@ -107,7 +136,7 @@ func (s *Server) handleAnalyticsGame(w http.ResponseWriter, r *http.Request) {
 	}
 	gameID := parts[3]
 
-	q := analytics.NewQueries(s.DB)
+	q := analytics.NewQueries(database)
 	recap, err := q.GetGameRecap(gameID)
 	if err != nil {
 		slog.Error("game recap query failed", "handler", "analytics_game", "game_id", gameID, "error", err)
@@ -120,3 +149,45 @@ func (s *Server) handleAnalyticsGame(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error rendering game recap", http.StatusInternalServerError)
 	}
 }
+
+func (s *Server) handleAnalyticsReplay(w http.ResponseWriter, r *http.Request) {
+	database := s.analyticsDB(w, true)
+	if database == nil {
+		return
+	}
+
+	// Game IDs are UUIDs; anything else can't be a game and mustn't reach
+	// the page's script.
+	gameID := r.PathValue("id")
+	if _, err := uuid.Parse(gameID); err != nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	// The page plays back the timeline it fetches from /analytics/game/{id}/timeline.
+	data := struct {
+		GameID                string
+		GameWidth, GameHeight int
+	}{gameID, targets.GameWidth, targets.GameHeight}
+	if err := s.Tmpl.ExecuteTemplate(w, "analytics-replay", data); err != nil {
+		slog.Error("template error", "handler", "analytics_replay", "error", err)
+		http.Error(w, "Error rendering replay", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleAnalyticsTimeline(w http.ResponseWriter, r *http.Request) {
+	database := s.analyticsDB(w, false)
+	if database == nil {
+		return
+	}
+
+	gameID := r.PathValue("id")
+	q := analytics.NewQueries(database)
+	timeline, err := q.GetReplayTimeline(gameID)
+	if err != nil {
+		slog.Error("replay timeline query failed", "handler", "analytics_timeline", "game_id", gameID, "error", err)
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, timeline)
+}
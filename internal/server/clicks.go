@@ -0,0 +1,256 @@
+package server
+
+import (
+	"clicktrainer/internal/clickspool"
+	"clicktrainer/internal/db"
+	"clicktrainer/internal/metrics"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Spooled batches are retried after clickRetryMin, doubling after each
+// failure up to clickRetryMax. At most clickOverflowMax clicks wait to be
+// spooled while the buffer is full; more are dropped.
+const (
+	clickRetryMin    = time.Second
+	clickRetryMax    = time.Minute
+	clickOverflowMax = 10000
+)
+
+// clickKeyPruneInterval is how often old click batch keys are deleted.
+const clickKeyPruneInterval = time.Hour
+
+// clickOverflow gathers clicks the full buffer can't take, so the writer
+// spools them together rather than request handlers syncing the spool
+// once per click.
+type clickOverflow struct {
+	mu     sync.Mutex
+	events []db.ClickEvent
+}
+
+// add keeps ev for the writer, reporting false if too many are waiting.
+func (o *clickOverflow) add(ev db.ClickEvent) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.events) >= clickOverflowMax {
+		return false
+	}
+	o.events = append(o.events, ev)
+	return true
+}
+
+// take returns the clicks waiting and forgets them.
+func (o *clickOverflow) take() []db.ClickEvent {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	events := o.events
+	o.events = nil
+	return events
+}
+
+// clickBatchWriter writes clicks from buffer to the database in batches,
+// and spools what gathers in overflow while buffer is full. With a spool, a
+// batch the database doesn't take is kept there and retried with backoff;
+// new batches queue behind it until the spool is written out, and a signal
+// on wake, sent when the database comes back, retries it straight away.
+// Every batch has a key, so one retried after a write that did land isn't
+// recorded twice. A batch the database rejects outright, such as one for a
+// game it doesn't have, goes to the spool's dead-letter file rather than
+// holding up the rest.
+func clickBatchWriter(database db.Clicks, spool *clickspool.Spool, buffer chan db.ClickEvent, overflow *clickOverflow, flushSignal chan chan struct{}, wake <-chan struct{}, m *metrics.Metrics) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	batch := make([]db.ClickEvent, 0, 50)
+	backoff := clickRetryMin
+	var retryAt time.Time
+
+	writeBatch := func() {
+		if m != nil {
+			m.ClickBufferDepth.Set(float64(len(buffer)))
+		}
+		if len(batch) == 0 {
+			return
+		}
+		b := clickspool.Batch{Key: uuid.NewString(), Events: slices.Clone(batch)}
+		batch = batch[:0]
+		if spool != nil && spool.Len() > 0 {
+			spoolClicks(spool, b, "backlog", m)
+			return
+		}
+		if err := database.RecordClickBatch(b.Key, b.Events); err != nil {
+			slog.Error("RecordClickBatch failed", "component", "batch_writer", "error", err, "clicks", len(b.Events))
+			if m != nil {
+				m.DBWriteErrorsTotal.WithLabelValues("batch_record_clicks").Inc()
+			}
+			switch {
+			case spool == nil:
+			case errors.Is(err, db.ErrRejected):
+				rejectClicks(spool, b, err, m)
+			default:
+				spoolClicks(spool, b, "db_error", m)
+				retryAt = time.Now().Add(backoff)
+			}
+			return
+		}
+		if m != nil {
+			m.ClickBatchFlushesTotal.Inc()
+		}
+	}
+
+	spoolOverflow := func() {
+		if spool == nil {
+			return
+		}
+		if events := overflow.take(); len(events) > 0 {
+			spoolClicks(spool, clickspool.Batch{Key: uuid.NewString(), Events: events}, "buffer_full", m)
+		}
+	}
+
+	// retry writes out the spool, backing off while the database keeps
+	// failing.
+	retry := func() {
+		if spool == nil || spool.Len() == 0 {
+			return
+		}
+		written, rejected, err := spool.Drain(func(b clickspool.Batch) error {
+			return database.RecordClickBatch(b.Key, b.Events)
+		})
+		if m != nil {
+			m.ClickBatchFlushesTotal.Add(float64(written))
+			m.ClickBatchesRejectedTotal.Add(float64(rejected))
+		}
+		if err != nil {
+			backoff = min(backoff*2, clickRetryMax)
+			retryAt = time.Now().Add(backoff)
+			slog.Warn("retrying spooled clicks failed", "component", "batch_writer", "error", err, "written", written, "pending", spool.Len(), "next_retry", backoff)
+			return
+		}
+		slog.Info("spooled clicks written", "component", "batch_writer", "batches", written, "rejected", rejected)
+		backoff = clickRetryMin
+		retryAt = time.Time{}
+	}
+
+	for {
+		select {
+		case ev := <-buffer:
+			batch = append(batch, ev)
+			if len(batch) >= 50 {
+				writeBatch()
+			}
+		case <-ticker.C:
+			writeBatch()
+			spoolOverflow()
+			if !time.Now().Before(retryAt) {
+				retry()
+			}
+			setSpoolMetrics(spool, m)
+		case <-wake:
+			backoff = clickRetryMin
+			retry()
+			setSpoolMetrics(spool, m)
+		case done := <-flushSignal:
+			// Drain any remaining events from the buffer channel
+		drain:
+			for {
+				select {
+				case ev := <-buffer:
+					batch = append(batch, ev)
+				default:
+					break drain
+				}
+			}
+			writeBatch()
+			spoolOverflow()
+			retry() // one last try; what is left stays spooled for next time
+			setSpoolMetrics(spool, m)
+			close(done)
+		}
+	}
+}
+
+// spoolClicks keeps b in the spool for a later retry. Only if that fails
+// too are the clicks lost.
+func spoolClicks(spool *clickspool.Spool, b clickspool.Batch, reason string, m *metrics.Metrics) {
+	if err := spool.Append(b); err != nil {
+		slog.Error("spooling clicks failed, dropping them", "component", "batch_writer", "error", err, "clicks", len(b.Events))
+		if m != nil {
+			m.DBWriteErrorsTotal.WithLabelValues("spool_clicks").Inc()
+		}
+		return
+	}
+	if m != nil {
+		m.ClickBatchesSpooledTotal.WithLabelValues(reason).Inc()
+	}
+}
+
+// rejectClicks moves b, which the database refused, to the spool's
+// dead-letter file, since retrying it would only fail again.
+func rejectClicks(spool *clickspool.Spool, b clickspool.Batch, cause error, m *metrics.Metrics) {
+	if err := spool.Reject(b, cause); err != nil {
+		slog.Error("setting rejected clicks aside failed, dropping them", "component", "batch_writer", "error", err, "clicks", len(b.Events))
+		if m != nil {
+			m.DBWriteErrorsTotal.WithLabelValues("reject_clicks").Inc()
+		}
+		return
+	}
+	if m != nil {
+		m.ClickBatchesRejectedTotal.Inc()
+	}
+}
+
+// pruneClickBatches deletes click batch keys older than retention, once at
+// start and then every clickKeyPruneInterval.
+func (s *Server) pruneClickBatches(retention time.Duration) {
+	ticker := time.NewTicker(clickKeyPruneInterval)
+	defer ticker.Stop()
+	for {
+		n, err := s.DB.PruneClickBatches(clickKeyCutoff(time.Now(), retention, s.ClickSpool))
+		switch {
+		case errors.Is(err, db.ErrUnavailable):
+			// Pruned next time.
+		case err != nil:
+			slog.Error("pruning click batch keys failed", "component", "batch_writer", "error", err)
+		case n > 0:
+			slog.Info("pruned click batch keys", "component", "batch_writer", "keys", n)
+		}
+		if s.draining.Load() {
+			return
+		}
+		<-ticker.C
+	}
+}
+
+// clickKeyCutoff is when keys written before may be pruned: retention ago,
+// or earlier if the spool holds a batch older than that, which may yet be
+// retried after a write that landed. The hour's margin covers a key
+// written just before its batch was spooled, and clocks that disagree.
+func clickKeyCutoff(now time.Time, retention time.Duration, spool *clickspool.Spool) time.Time {
+	cutoff := now.Add(-retention)
+	if spool == nil {
+		return cutoff
+	}
+	if _, _, oldest := spool.Stats(); !oldest.IsZero() && oldest.Add(-time.Hour).Before(cutoff) {
+		return oldest.Add(-time.Hour)
+	}
+	return cutoff
+}
+
+func setSpoolMetrics(spool *clickspool.Spool, m *metrics.Metrics) {
+	if spool == nil || m == nil {
+		return
+	}
+	batches, size, oldest := spool.Stats()
+	var age time.Duration
+	if !oldest.IsZero() {
+		age = time.Since(oldest)
+	}
+	m.ClickSpoolBatches.Set(float64(batches))
+	m.ClickSpoolBytes.Set(float64(size))
+	m.ClickSpoolAgeSeconds.Set(age.Seconds())
+}
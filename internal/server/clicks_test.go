@@ -0,0 +1,184 @@
+package server
+
+import (
+	"clicktrainer/internal/clickspool"
+	"clicktrainer/internal/db"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyClicks fails writes while down. With lostAck, the next write lands
+// but reports an error anyway, as when a connection drops before the
+// commit is acknowledged.
+type flakyClicks struct {
+	db.Clicks
+	mu      sync.Mutex
+	down    bool
+	lostAck bool
+}
+
+func (f *flakyClicks) RecordClickBatch(key string, events []db.ClickEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return errors.New("connection refused")
+	}
+	if f.lostAck {
+		f.lostAck = false
+		if err := f.Clicks.RecordClickBatch(key, events); err != nil {
+			return err
+		}
+		return errors.New("connection reset")
+	}
+	return f.Clicks.RecordClickBatch(key, events)
+}
+
+func (f *flakyClicks) set(down, lostAck bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down, f.lostAck = down, lostAck
+}
+
+func TestClickBatchWriter_SpoolsAndRetries(t *testing.T) {
+	dir := t.TempDir()
+	database, err := db.OpenSQLite(filepath.Join(dir, "clicks.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite() error: %v", err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate() error: %v", err)
+	}
+	if err := database.UpsertPlayer("p1", "Ann", "#f00"); err != nil {
+		t.Fatal(err)
+	}
+	gameID, err := database.CreateGame("ROOM", "p1", 60000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool, err := clickspool.Open(filepath.Join(dir, "clicks.spool"))
+	if err != nil {
+		t.Fatalf("clickspool.Open() error: %v", err)
+	}
+	defer spool.Close()
+
+	clicks := &flakyClicks{Clicks: database, down: true}
+	buffer := make(chan db.ClickEvent, 10)
+	flushSignal := make(chan chan struct{})
+	overflow := &clickOverflow{}
+	go clickBatchWriter(clicks, spool, buffer, overflow, flushSignal, nil, nil)
+
+	sendTo := func(game string, n int) {
+		now := time.Now()
+		for i := range n {
+			buffer <- db.ClickEvent{GameID: game, PlayerID: "p1", TargetID: i, Points: 1, SpawnedAt: now, ClickedAt: now}
+		}
+		done := make(chan struct{})
+		flushSignal <- done
+		<-done
+	}
+	send := func(n int) { sendTo(gameID, n) }
+	recorded := func() int {
+		t.Helper()
+		var n int
+		if err := database.QueryRow(`SELECT COUNT(*) FROM click_events`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// While the database is down, batches wait in the spool in order.
+	send(3)
+	send(2)
+	if spool.Len() != 2 || recorded() != 0 {
+		t.Fatalf("spooled %d batches with %d clicks recorded, want 2 and none", spool.Len(), recorded())
+	}
+
+	// The first retry lands but looks like a failure, so it is retried
+	// again; its key keeps it from being recorded twice.
+	clicks.set(false, true)
+	send(0)
+	if spool.Len() != 2 {
+		t.Errorf("spooled %d batches after a lost acknowledgement, want 2", spool.Len())
+	}
+	send(0)
+	if spool.Len() != 0 {
+		t.Errorf("spooled %d batches once the database is back, want none", spool.Len())
+	}
+	if n := recorded(); n != 5 {
+		t.Errorf("recorded %d clicks, want 5", n)
+	}
+
+	// With the spool empty, batches go straight to the database.
+	send(1)
+	if n := recorded(); n != 6 || spool.Len() != 0 {
+		t.Errorf("recorded %d clicks with %d batches spooled, want 6 and none", n, spool.Len())
+	}
+
+	// A batch the database rejects is set aside, not retried forever in
+	// front of the ones spooled after it.
+	clicks.set(true, false)
+	sendTo("no-such-game", 2)
+	send(1)
+	clicks.set(false, false)
+	send(0)
+	if n := recorded(); n != 7 || spool.Len() != 0 {
+		t.Errorf("recorded %d clicks with %d batches spooled, want 7 and none", n, spool.Len())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "clicks.spool.rejected")); err != nil {
+		t.Errorf("the rejected batch wasn't set aside: %v", err)
+	}
+
+	// Straight from the buffer, too.
+	sendTo("no-such-game", 1)
+	if n := recorded(); n != 7 || spool.Len() != 0 {
+		t.Errorf("recorded %d clicks with %d batches spooled, want 7 and none", n, spool.Len())
+	}
+
+	// Clicks the full buffer couldn't take are spooled together.
+	clicks.set(true, false)
+	now := time.Now()
+	for i := range 3 {
+		overflow.add(db.ClickEvent{GameID: gameID, PlayerID: "p1", TargetID: i, Points: 1, SpawnedAt: now, ClickedAt: now})
+	}
+	send(0)
+	if spool.Len() != 1 {
+		t.Errorf("spooled %d batches for 3 overflowing clicks, want 1", spool.Len())
+	}
+	clicks.set(false, false)
+	send(0)
+	if n := recorded(); n != 10 || spool.Len() != 0 {
+		t.Errorf("recorded %d clicks with %d batches spooled, want 10 and none", n, spool.Len())
+	}
+}
+
+func TestClickKeyCutoff(t *testing.T) {
+	now := time.Now()
+	week := 7 * 24 * time.Hour
+	if got := clickKeyCutoff(now, week, nil); !got.Equal(now.Add(-week)) {
+		t.Errorf("cutoff without a spool = %v, want a week ago", got)
+	}
+
+	spool, err := clickspool.Open(filepath.Join(t.TempDir(), "clicks.spool"))
+	if err != nil {
+		t.Fatalf("clickspool.Open() error: %v", err)
+	}
+	defer spool.Close()
+	if got := clickKeyCutoff(now, week, spool); !got.Equal(now.Add(-week)) {
+		t.Errorf("cutoff with an empty spool = %v, want a week ago", got)
+	}
+
+	// A batch spooled longer than the retention keeps its key, and those
+	// written since.
+	spooledAt := now.Add(-10 * 24 * time.Hour)
+	if err := spool.Append(clickspool.Batch{Key: "old", SpooledAt: spooledAt}); err != nil {
+		t.Fatal(err)
+	}
+	if got := clickKeyCutoff(now, week, spool); !got.Equal(spooledAt.Add(-time.Hour)) {
+		t.Errorf("cutoff with an old batch spooled = %v, want an hour before it", got)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"clicktrainer/internal/events"
+	"clicktrainer/internal/journal"
+	"clicktrainer/internal/metrics"
+	"clicktrainer/internal/rooms"
+)
+
+// onRoomCreated attaches the server's event subscribers to a new room. They
+// stop when the room's bus is closed.
+func (s *Server) onRoomCreated(room *rooms.Room) {
+	if s.Metrics != nil {
+		room.Game.Events.OnDrop(func(subscriber string, _ events.Event) {
+			s.Metrics.EventsDroppedTotal.WithLabelValues(subscriber).Inc()
+		})
+		room.Game.Events.AddRecorder(eventCounter{s.Metrics})
+	}
+	if s.Webhooks != nil {
+		go s.forwardWebhooks(room, room.Game.Events.Subscribe("webhooks", 0))
+	}
+	if journals := s.journals(); journals != nil {
+		id := journal.ID(room.Code, room.CreatedAt)
+		room.Game.Events.AddRecorder(journal.NewWriter(journals, id, 0))
+	}
+	if s.fanout() != nil {
+		s.relayRoom(room)
+	}
+}
+
+// eventCounter turns room events into metrics. It records rather than
+// subscribes, so a burst of events can't make the counts fall behind.
+type eventCounter struct {
+	m *metrics.Metrics
+}
+
+func (c eventCounter) Record(ev events.Event) {
+	c.m.EventsPublishedTotal.WithLabelValues(ev.Type()).Inc()
+	switch ev.(type) {
+	case events.TargetSpawned:
+		c.m.TargetsSpawnedTotal.Inc()
+	case events.TargetKilled:
+		c.m.TargetsKilledTotal.Inc()
+	}
+}
+
+func (eventCounter) Close() {}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"clicktrainer/internal/events"
+	"clicktrainer/internal/metrics"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// nextEvent waits for the next event of type T on sub, skipping others.
+func nextEvent[T events.Event](t *testing.T, sub *events.Subscription) T {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev := <-sub.Events():
+			if want, ok := ev.(T); ok {
+				return want
+			}
+		case <-timeout:
+			var zero T
+			t.Fatalf("timed out waiting for %s", zero.Type())
+			return zero
+		}
+	}
+}
+
+func TestServer_PublishesPlayerEvents(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.Players.Add("p2", "Bob")
+	sub := room.Game.Events.Subscribe("test", 0)
+	target := room.Game.Targets.Add()
+
+	if !srv.processClick(room, "p2", target.ID, 2) {
+		t.Fatal("click should count")
+	}
+	killed := nextEvent[events.TargetKilled](t, sub)
+	if killed.TargetID != target.ID || killed.PlayerID != "p2" || killed.Points != 2 {
+		t.Errorf("TargetKilled = %+v, want target %d by p2 for 2", killed, target.ID)
+	}
+
+	srv.removePlayer(room, "p2")
+	if left := nextEvent[events.PlayerLeft](t, sub); left.PlayerID != "p2" {
+		t.Errorf("PlayerLeft = %+v, want p2", left)
+	}
+}
+
+func TestServer_CountsEveryTargetEvent(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	srv.Metrics = &metrics.Metrics{
+		EventsPublishedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "events"}, []string{"type"}),
+		EventsDroppedTotal:   prometheus.NewCounterVec(prometheus.CounterOpts{Name: "dropped"}, []string{"subscriber"}),
+		TargetsSpawnedTotal:  prometheus.NewCounter(prometheus.CounterOpts{Name: "spawned"}),
+		TargetsKilledTotal:   prometheus.NewCounter(prometheus.CounterOpts{Name: "killed"}),
+	}
+
+	room, _ := srv.Rooms.Create("host")
+	// More than a subscriber's buffer, published faster than one could
+	// drain it.
+	n := 2 * events.DefaultBuffer
+	for i := range n {
+		room.Game.Events.Publish(events.TargetSpawned{TargetID: i})
+		room.Game.Events.Publish(events.TargetKilled{TargetID: i, PlayerID: "host"})
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(srv.Metrics.TargetsSpawnedTotal, srv.Metrics.TargetsKilledTotal)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error: %v", err)
+	}
+	for _, f := range families {
+		if got := f.GetMetric()[0].GetCounter().GetValue(); got != float64(n) {
+			t.Errorf("%s = %v, want %d", f.GetName(), got, n)
+		}
+	}
+	if len(families) != 2 {
+		t.Errorf("gathered %d counters, want 2", len(families))
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"clicktrainer/internal/rooms"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// expiryConfig wires idle-room expiry to the server's warnings and metrics.
+func (s *Server) expiryConfig(ttl, warnBefore time.Duration) rooms.ExpiryConfig {
+	return rooms.ExpiryConfig{
+		IdleTTL:    ttl,
+		WarnBefore: warnBefore,
+		Warn:       s.onExpiryWarning,
+		Expired:    s.onRoomExpired,
+	}
+}
+
+func (s *Server) onExpiryWarning(room *rooms.Room, expiresAt time.Time) {
+	if expiresAt.IsZero() {
+		slog.Info("room expiry withdrawn", "room_code", room.Code)
+	} else {
+		slog.Info("room expiring", "room_code", room.Code, "expires_at", expiresAt)
+	}
+	s.broadcastExpiry(room)
+}
+
+func (s *Server) onRoomExpired(room *rooms.Room, reason string) {
+	slog.Info("room expired", "room_code", room.Code, "reason", reason, "last_active", room.LastActive())
+	if s.Metrics != nil {
+		s.Metrics.RoomsExpiredTotal.WithLabelValues(reason).Inc()
+	}
+}
+
+// broadcastExpiry pushes the expiry warning (or clears it) to every client.
+func (s *Server) broadcastExpiry(room *rooms.Room) {
+	var buf bytes.Buffer
+	if err := s.Tmpl.ExecuteTemplate(&buf, "roomExpiry", s.roomView(room, "")); err != nil {
+		slog.Error("template error", "handler", "room_expiry", "error", err)
+		return
+	}
+	oob := fmt.Sprintf(`<div id="room_expiry" hx-swap-oob="innerHTML">%s</div>`, buf.String())
+	room.Broadcaster.BroadcastOOB("swap", oob)
+}
+
+func (s *Server) handleHostExpiry(w http.ResponseWriter, r *http.Request) {
+	room := s.getRoom(r)
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusBadRequest)
+		return
+	}
+	idCookie, err := r.Cookie("player_id")
+	if err != nil || !room.IsHost(idCookie.Value) || room.ExpiryWarning().IsZero() {
+		// Only the host can keep the room open.
+		return
+	}
+	if err := s.Tmpl.ExecuteTemplate(w, "hostKeepAlive", nil); err != nil {
+		slog.Error("template error", "handler", "host_expiry", "error", err)
+	}
+}
+
+func (s *Server) handleHostKeepAlive(w http.ResponseWriter, r *http.Request) {
+	room, hostID, ok := s.requireHost(w, r)
+	if !ok {
+		return
+	}
+	if room.KeepAlive() {
+		slog.Info("room kept alive", "handler", "host_keepalive", "room_code", room.Code, "host_id", hostID)
+		s.broadcastExpiry(room)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"clicktrainer/internal/rooms"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoomExpiry_WarnKeepAliveExpire(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	srv.Rooms.SetExpiry(srv.expiryConfig(time.Minute, 10*time.Second))
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.Players.Add("p2", "Bob")
+	ch := room.Broadcaster.Subscribe()
+
+	srv.Rooms.ExpireIdle(room.LastActive().Add(55 * time.Second))
+	select {
+	case msg := <-ch:
+		if !strings.Contains(msg.Msg, `id="room_expiry"`) || !strings.Contains(msg.Msg, "data-deadline") {
+			t.Errorf("warning = %q, want the expiry banner", msg.Msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no expiry warning broadcast")
+	}
+
+	getExpiry := func(playerID string) string {
+		req, _ := http.NewRequest("GET", ts.URL+"/room/host/expiry", nil)
+		req.AddCookie(&http.Cookie{Name: "room_code", Value: room.Code})
+		req.AddCookie(&http.Cookie{Name: "player_id", Value: playerID})
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	if body := getExpiry("host"); !strings.Contains(body, "/room/host/keepalive") {
+		t.Errorf("host expiry controls = %q, want a keep-alive button", body)
+	}
+	if body := getExpiry("p2"); body != "" {
+		t.Errorf("non-host expiry controls = %q, want none", body)
+	}
+
+	resp := postAs(t, ts, room, "p2", "/room/host/keepalive", nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("non-host keepalive: status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+	resp = postAs(t, ts, room, "host", "/room/host/keepalive", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("keepalive: status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if !room.ExpiryWarning().IsZero() {
+		t.Error("keepalive should withdraw the warning")
+	}
+
+	srv.Rooms.ExpireIdle(room.LastActive().Add(time.Hour))
+	if srv.Rooms.Get(room.Code) != nil {
+		t.Fatal("room should have expired")
+	}
+	var last string
+	for msg := range ch {
+		last = msg.Event
+	}
+	if last != rooms.ClosedEvent {
+		t.Errorf("last event = %q, want %q", last, rooms.ClosedEvent)
+	}
+}
+
+func TestRoomExpiry_ActivityKeepsRoom(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	srv.Rooms.SetExpiry(srv.expiryConfig(time.Minute, 10*time.Second))
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	created := room.LastActive()
+
+	time.Sleep(10 * time.Millisecond)
+	postAs(t, ts, room, "host", "/room/ready", nil)
+	if !room.LastActive().After(created) {
+		t.Error("readying up should count as activity")
+	}
+}
@@ -0,0 +1,318 @@
+package server
+
+import (
+	"clicktrainer/internal/broadcast"
+	"clicktrainer/internal/rooms"
+	"clicktrainer/internal/wshub"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/coder/websocket"
+)
+
+// A room's owner publishes everything its clients are sent on the room's out
+// topic. Instances with clients of the room follow that topic, and publish
+// what their clients do on the in topic for the owner to apply.
+func roomOutTopic(code string) string { return "room:" + code + ":out" }
+func roomInTopic(code string) string  { return "room:" + code + ":in" }
+
+// roomMessage is a message from a room to its clients: an event stream
+// message, or a WebSocket message for everyone but Except. One topic carries
+// both so they stay in order.
+type roomMessage struct {
+	SSE    *broadcast.HxEventMessage `json:"sse,omitempty"`
+	WS     json.RawMessage           `json:"ws,omitempty"`
+	Except string                    `json:"except,omitempty"`
+}
+
+// Kinds of clientMessage.
+const (
+	clientConnect    = "connect"
+	clientDisconnect = "disconnect"
+	clientWS         = "ws"
+)
+
+// clientMessage is something a player connected to another instance did.
+type clientMessage struct {
+	PlayerID string               `json:"player_id"`
+	Kind     string               `json:"kind"`
+	WS       *wshub.ClientMessage `json:"ws,omitempty"`
+}
+
+// relayRoom publishes a new room's messages for other instances and applies
+// what their clients do, until the room closes.
+func (s *Server) relayRoom(room *rooms.Room) {
+	out := roomOutTopic(room.Code)
+	publish := func(m roomMessage) {
+		data, err := json.Marshal(m)
+		if err == nil {
+			err = s.fanout().Publish(out, data)
+		}
+		if err != nil {
+			slog.Warn("relaying room message failed", "component", "fanout", "room_code", room.Code, "error", err)
+		}
+	}
+	room.Broadcaster.SetRelay(func(msg broadcast.HxEventMessage) { publish(roomMessage{SSE: &msg}) })
+	room.Hub.SetRelay(func(except string, data []byte) { publish(roomMessage{WS: data, Except: except}) })
+
+	cancel, err := s.fanout().Subscribe(roomInTopic(room.Code), func(payload []byte) {
+		s.applyClientMessage(room, payload)
+	})
+	if err != nil {
+		slog.Error("following room clients on other instances failed", "component", "fanout", "room_code", room.Code, "error", err)
+		return
+	}
+	go func() {
+		<-room.Broadcaster.Done()
+		cancel()
+	}()
+}
+
+func (s *Server) applyClientMessage(room *rooms.Room, payload []byte) {
+	var m clientMessage
+	if err := json.Unmarshal(payload, &m); err != nil {
+		slog.Warn("invalid client message from another instance", "component", "fanout", "room_code", room.Code, "error", err)
+		return
+	}
+	if room.Game.Players.Get(m.PlayerID) == nil {
+		return
+	}
+	switch m.Kind {
+	case clientConnect:
+		room.Presence.Connect(m.PlayerID)
+		room.Touch()
+	case clientDisconnect:
+		room.Presence.Disconnect(m.PlayerID)
+	case clientWS:
+		if m.WS != nil {
+			s.handleClientMessage(room, m.PlayerID, *m.WS)
+		}
+	}
+}
+
+// publishClient tells a room's owner what a player connected here did.
+func (s *Server) publishClient(code string, m clientMessage) {
+	data, err := json.Marshal(m)
+	if err == nil {
+		err = s.fanout().Publish(roomInTopic(code), data)
+	}
+	if err != nil {
+		slog.Warn("relaying client message failed", "component", "fanout", "room_code", code, "error", err)
+	}
+}
+
+// mirror follows a room open on another instance for the clients connected
+// to this one.
+type mirror struct {
+	code   string
+	hub    *wshub.Hub
+	users  int    // guarded by Server.mirrorMu
+	cancel func() // guarded by Server.mirrorMu
+
+	mu sync.Mutex
+	b  *broadcast.Broadcaster
+}
+
+func (m *mirror) broadcaster() *broadcast.Broadcaster {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.b
+}
+
+// receive passes a room message to the clients here. If messages went
+// missing on the way, the clients' pages are reloaded from the owner rather
+// than left out of step, and the mirror starts over.
+func (m *mirror) receive(payload []byte) {
+	var msg roomMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		slog.Warn("invalid room message from another instance", "component", "fanout", "room_code", m.code, "error", err)
+		return
+	}
+	if msg.WS != nil {
+		m.hub.Deliver(msg.Except, msg.WS)
+	}
+	if msg.SSE == nil {
+		return
+	}
+	b := m.broadcaster()
+	if msg.SSE.Event == rooms.ClosedEvent {
+		b.Close(msg.SSE.Event, msg.SSE.Msg)
+		m.hub.CloseAll("room closed")
+		return
+	}
+	if b.Deliver(*msg.SSE) {
+		return
+	}
+	slog.Warn("room messages lost between instances, reloading clients", "component", "fanout", "room_code", m.code, "last_id", b.LastID(), "got_id", msg.SSE.ID)
+	fresh := broadcast.NewMirror()
+	fresh.Deliver(*msg.SSE)
+	m.mu.Lock()
+	m.b = fresh
+	m.mu.Unlock()
+	b.Close(rooms.ClosedEvent, "/room/"+m.code)
+}
+
+// followRoom returns the mirror of a room open on another instance, starting
+// it for the first client. Every call is matched by unfollowRoom.
+func (s *Server) followRoom(code string) (*mirror, error) {
+	s.mirrorMu.Lock()
+	defer s.mirrorMu.Unlock()
+	if m := s.mirrors[code]; m != nil {
+		m.users++
+		return m, nil
+	}
+	m := &mirror{code: code, hub: wshub.NewHub(), b: broadcast.NewMirror(), users: 1}
+	cancel, err := s.fanout().Subscribe(roomOutTopic(code), m.receive)
+	if err != nil {
+		return nil, err
+	}
+	m.cancel = cancel
+	if s.mirrors == nil {
+		s.mirrors = make(map[string]*mirror)
+	}
+	s.mirrors[code] = m
+	return m, nil
+}
+
+func (s *Server) unfollowRoom(m *mirror) {
+	s.mirrorMu.Lock()
+	defer s.mirrorMu.Unlock()
+	m.users--
+	if m.users > 0 {
+		return
+	}
+	m.cancel()
+	delete(s.mirrors, m.code)
+}
+
+// handleMirrorEvents is handleEvents for a room open on another instance.
+// Presence goes to the owner, which ignores players it doesn't know. A
+// client resuming from further back than the mirror holds reloads its page.
+func (s *Server) handleMirrorEvents(w http.ResponseWriter, r *http.Request, code string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	m, err := s.followRoom(code)
+	if err != nil {
+		slog.Error("following room failed", "component", "fanout", "room_code", code, "error", err)
+		http.Error(w, "The room's server can't be reached", http.StatusBadGateway)
+		return
+	}
+	defer s.unfollowRoom(m)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	b := m.broadcaster()
+	var msgChan chan broadcast.HxEventMessage
+	var missed []broadcast.HxEventMessage
+	reload := false
+	if lastID, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		var ok bool
+		msgChan, missed, ok = b.Resume(lastID)
+		reload = !ok
+	} else {
+		msgChan = b.Subscribe()
+	}
+	defer b.Unsubscribe(msgChan)
+
+	if idCookie, err := r.Cookie("player_id"); err == nil {
+		playerID := idCookie.Value
+		s.publishClient(code, clientMessage{PlayerID: playerID, Kind: clientConnect})
+		defer s.publishClient(code, clientMessage{PlayerID: playerID, Kind: clientDisconnect})
+	}
+	if s.Metrics != nil {
+		s.Metrics.SSEConnectionsActive.Inc()
+		defer s.Metrics.SSEConnectionsActive.Dec()
+	}
+
+	flusher.Flush()
+	if reload {
+		writeSSE(w, broadcast.HxEventMessage{Event: rooms.ClosedEvent, Msg: "/room/" + code})
+		flusher.Flush()
+		return
+	}
+	for _, msg := range missed {
+		writeSSE(w, msg)
+	}
+	flusher.Flush()
+	s.pumpSSE(w, r, flusher, msgChan)
+}
+
+// handleMirrorWebSocket is handleWebSocket for a room open on another
+// instance: what the player sends goes to the owner, and what the room sends
+// comes back through the mirror.
+func (s *Server) handleMirrorWebSocket(w http.ResponseWriter, r *http.Request, code string) {
+	idCookie, err := r.Cookie("player_id")
+	if err != nil {
+		http.Error(w, "Not Registered", http.StatusBadRequest)
+		return
+	}
+	playerID := idCookie.Value
+	m, err := s.followRoom(code)
+	if err != nil {
+		slog.Error("following room failed", "component", "fanout", "room_code", code, "error", err)
+		http.Error(w, "The room's server can't be reached", http.StatusBadGateway)
+		return
+	}
+	defer s.unfollowRoom(m)
+
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		slog.Error("WebSocket accept failed", "room_code", code, "error", err)
+		return
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	client := &wshub.Client{
+		PlayerID: playerID,
+		Conn:     conn,
+		Send:     make(chan []byte, 16),
+	}
+	m.hub.Register(client)
+	s.publishClient(code, clientMessage{PlayerID: playerID, Kind: clientConnect})
+	if s.Metrics != nil {
+		s.Metrics.WSConnectionsActive.Inc()
+	}
+	defer func() {
+		m.hub.Unregister(playerID)
+		s.publishClient(code, clientMessage{PlayerID: playerID, Kind: clientDisconnect})
+		if s.Metrics != nil {
+			s.Metrics.WSConnectionsActive.Dec()
+		}
+	}()
+
+	ctx := r.Context()
+	go client.WritePump(ctx)
+
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			if websocket.CloseStatus(err) == websocket.StatusNormalClosure ||
+				websocket.CloseStatus(err) == websocket.StatusGoingAway ||
+				errors.Is(err, net.ErrClosed) || // closed with the room
+				ctx.Err() != nil {
+				return
+			}
+			slog.Error("WebSocket read error", "room_code", code, "player_id", playerID, "error", err)
+			return
+		}
+		var msg wshub.ClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			slog.Warn("invalid WebSocket message", "player_id", playerID, "error", err)
+			continue
+		}
+		s.publishClient(code, clientMessage{PlayerID: playerID, Kind: clientWS, WS: &msg})
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"clicktrainer/internal/broadcast"
+	"clicktrainer/internal/rooms"
+	"clicktrainer/internal/wshub"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// waitFor polls cond for up to a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFanout_EventsFromAnotherInstance(t *testing.T) {
+	a, b, tsA, _ := newFanoutPair(t)
+	b.Rooms.SetPresence(b.presenceConfig(time.Minute))
+	room, _ := b.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+
+	stream := openStream(t, tsA, room.Code, "host", "")
+	waitFor(t, "the owner to see the player connect", func() bool { return room.Presence.Connected("host") })
+	if mirrorOf(a, room.Code) == nil {
+		t.Fatal("the stream should be served from a mirror, not proxied")
+	}
+
+	room.Broadcaster.BroadcastOOB("swap", "one")
+	room.Broadcaster.BroadcastOOB("swap", "two")
+	for _, want := range []sseEvent{{id: "1", event: "swap", data: "one"}, {id: "2", event: "swap", data: "two"}} {
+		if ev := nextSSE(t, stream); ev != want {
+			t.Errorf("event = %+v, want %+v with the owner's IDs", ev, want)
+		}
+	}
+
+	b.Rooms.Delete(room.Code)
+	if ev := nextSSE(t, stream); ev.event != rooms.ClosedEvent {
+		t.Errorf("event = %+v, want the room's close", ev)
+	}
+}
+
+func TestFanout_LostMessagesReloadThePage(t *testing.T) {
+	a, b, tsA, _ := newFanoutPair(t)
+	room, _ := b.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+
+	stream := openStream(t, tsA, room.Code, "host", "")
+	room.Broadcaster.BroadcastOOB("swap", "one")
+	nextSSE(t, stream)
+
+	// Message 2 never arrives.
+	mirrorOf(a, room.Code).receive(mustJSON(t, roomMessage{SSE: &broadcast.HxEventMessage{ID: 3, Event: "swap", Msg: "three"}}))
+	if ev := nextSSE(t, stream); ev.event != rooms.ClosedEvent || ev.data != "/room/"+room.Code {
+		t.Errorf("event = %+v, want the page reloaded", ev)
+	}
+}
+
+func TestFanout_WebSocketThroughAnotherInstance(t *testing.T) {
+	a, b, tsA, _ := newFanoutPair(t)
+	b.Rooms.SetPresence(b.presenceConfig(time.Minute))
+	room, _ := b.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.Players.Add("p2", "Bob")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	header := http.Header{}
+	header.Set("Cookie", "room_code="+room.Code+"; player_id=p2")
+	conn, _, err := websocket.Dial(ctx, strings.Replace(tsA.URL, "http://", "ws://", 1)+"/room/ws", &websocket.DialOptions{HTTPHeader: header})
+	if err != nil {
+		t.Fatalf("WebSocket dial error: %v", err)
+	}
+	defer conn.CloseNow()
+	waitFor(t, "the owner to see the player connect", func() bool { return room.Presence.Connected("p2") })
+	if mirrorOf(a, room.Code) == nil {
+		t.Fatal("the WebSocket should be served from a mirror, not proxied")
+	}
+
+	room.Hub.Broadcast(wshub.ServerMessage{Type: "ping", PlayerID: "host"})
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got wshub.ServerMessage
+	if err := json.Unmarshal(data, &got); err != nil || got.Type != "ping" {
+		t.Errorf("message = %s, want the owner's broadcast", data)
+	}
+
+	since := time.Now()
+	if err := conn.Write(ctx, websocket.MessageText, []byte(`{"t":"move","x":10,"y":20}`)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the owner to apply the move", func() bool {
+		for _, p := range room.Game.Players.IdleSince(since) {
+			if p.ID == "p2" {
+				return false
+			}
+		}
+		return true
+	})
+
+	conn.Close(websocket.StatusNormalClosure, "")
+	waitFor(t, "the owner to see the player go", func() bool { return !room.Presence.Connected("p2") })
+	waitFor(t, "the mirror to stop", func() bool { return mirrorOf(a, room.Code) == nil })
+}
+
+func mirrorOf(s *Server, code string) *mirror {
+	s.mirrorMu.Lock()
+	defer s.mirrorMu.Unlock()
+	return s.mirrors[code]
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"clicktrainer/internal/rooms"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// Ways to send on a request for a room open on another instance.
+const (
+	ForwardProxy    = "proxy"    // serve it through this instance
+	ForwardRedirect = "redirect" // send the browser to the owner's URL
+)
+
+// forwardedHeader marks a request one instance has proxied to another, so
+// it is never sent on a second time.
+const forwardedHeader = "X-Clicktrainer-Forwarded-By"
+
+// roomCodePattern is the route whose path names a room.
+const roomCodePattern = "GET /room/{code}"
+
+// forwardRooms sends requests for rooms open on another instance on to that
+// instance, by proxy or redirect as RoomForward says. The room is the one in
+// the path for /room/{code} and the room_code cookie for the rest of /room.
+// Everything else is served by mux.
+//
+// With a fan-out backend, a proxying instance serves event streams and
+// WebSockets for other instances' rooms itself, from a mirror of the room.
+func (s *Server) forwardRooms(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		code := requestRoomCode(pattern, r)
+		owner, ok := s.remoteOwner(code, r)
+		if !ok {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		if s.fanout() != nil && s.RoomForward != ForwardRedirect {
+			switch pattern {
+			case "GET /room/events":
+				s.handleMirrorEvents(w, r, code)
+				return
+			case "GET /room/ws":
+				s.handleMirrorWebSocket(w, r, code)
+				return
+			}
+		}
+		if s.RoomForward == ForwardRedirect {
+			if s.Metrics != nil {
+				s.Metrics.RoomsForwardedTotal.WithLabelValues(ForwardRedirect).Inc()
+			}
+			http.Redirect(w, r, strings.TrimSuffix(owner.URL, "/")+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+			return
+		}
+		proxy, err := s.proxyTo(owner)
+		if err != nil {
+			slog.Error("bad instance URL in room directory", "component", "forward", "instance", owner.ID, "url", owner.URL, "error", err)
+			http.Error(w, "The room's server can't be reached", http.StatusBadGateway)
+			return
+		}
+		if s.Metrics != nil {
+			s.Metrics.RoomsForwardedTotal.WithLabelValues(ForwardProxy).Inc()
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// requestRoomCode returns the code of the room a request is for, or "" if
+// it isn't for a room.
+func requestRoomCode(pattern string, r *http.Request) string {
+	if pattern == roomCodePattern {
+		return strings.ToUpper(strings.TrimPrefix(r.URL.Path, "/room/"))
+	}
+	if r.URL.Path != "/room" && !strings.HasPrefix(r.URL.Path, "/room/") {
+		return ""
+	}
+	cookie, err := r.Cookie("room_code")
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// remoteOwner returns the instance a room is open on when that is another
+// instance. Requests that were already forwarded are always served here.
+func (s *Server) remoteOwner(code string, r *http.Request) (rooms.Instance, bool) {
+	if code == "" || r.Header.Get(forwardedHeader) != "" || s.Rooms.Get(code) != nil {
+		return rooms.Instance{}, false
+	}
+	owner, err := s.Rooms.Owner(code)
+	if err != nil {
+		if !errors.Is(err, rooms.ErrNoOwner) {
+			slog.Error("room directory lookup failed", "component", "forward", "room_code", code, "error", err)
+		}
+		return rooms.Instance{}, false
+	}
+	if owner.ID == s.Rooms.Self().ID || owner.URL == "" {
+		return rooms.Instance{}, false
+	}
+	return owner, true
+}
+
+// proxyTo returns the reverse proxy for an instance, building it the first
+// time. The public Host is kept so cookies and redirects from the owner stay
+// on the address the browser used, and responses are flushed as they come
+// for the event stream.
+func (s *Server) proxyTo(owner rooms.Instance) (*httputil.ReverseProxy, error) {
+	if p, ok := s.proxies.Load(owner.URL); ok {
+		return p.(*httputil.ReverseProxy), nil
+	}
+	target, err := url.Parse(owner.URL)
+	if err != nil {
+		return nil, err
+	}
+	self := s.Rooms.Self().ID
+	p := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.Out.Host = pr.In.Host
+			pr.SetXForwarded()
+			pr.Out.Header.Set(forwardedHeader, self)
+		},
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Warn("proxying to room owner failed", "component", "forward", "instance", owner.ID, "error", err)
+			http.Error(w, "The room's server can't be reached", http.StatusBadGateway)
+		},
+	}
+	actual, _ := s.proxies.LoadOrStore(owner.URL, p)
+	return actual.(*httputil.ReverseProxy), nil
+}
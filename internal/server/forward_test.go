@@ -0,0 +1,134 @@
+package server
+
+import (
+	"clicktrainer/internal/fanout"
+	"clicktrainer/internal/rooms"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newInstancePair starts two test servers sharing a room directory, as two
+// instances sharing a database would.
+func newInstancePair(t *testing.T) (a, b *Server, tsA, tsB *httptest.Server) {
+	t.Helper()
+	dir := rooms.NewMemoryDirectory()
+	a, tsA = newTestServer(t)
+	b, tsB = newTestServer(t)
+	t.Cleanup(tsA.Close)
+	t.Cleanup(tsB.Close)
+	a.Rooms.SetDirectory(dir, rooms.Instance{ID: "a", URL: tsA.URL})
+	b.Rooms.SetDirectory(dir, rooms.Instance{ID: "b", URL: tsB.URL})
+	return a, b, tsA, tsB
+}
+
+// newFanoutPair is newInstancePair with a shared fan-out backend, so each
+// instance serves the event streams and WebSockets of the other's rooms.
+func newFanoutPair(t *testing.T) (a, b *Server, tsA, tsB *httptest.Server) {
+	t.Helper()
+	a, b, tsA, tsB = newInstancePair(t)
+	backend := fanout.NewLocal()
+	a.Fanout = backend
+	b.Fanout = backend
+	return a, b, tsA, tsB
+}
+
+func TestForward_ProxiesToOwner(t *testing.T) {
+	_, b, tsA, _ := newInstancePair(t)
+	room, _ := b.Rooms.Create("")
+
+	client := newClientWithJar(t)
+	resp, err := client.Get(tsA.URL + "/room/" + room.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), room.Code) {
+		t.Fatalf("GET /room/{code} = %d, want the owner's join page", resp.StatusCode)
+	}
+
+	// The owner's cookie lands on the address the browser used, so the rest
+	// of the room's requests follow it there.
+	resp, err = client.PostForm(tsA.URL+"/room/register", url.Values{"name": {"Alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if room.Game.Players.Count() != 1 {
+		t.Fatalf("owner has %d players, want the registration proxied", room.Game.Players.Count())
+	}
+
+	player := room.Game.Players.GetList()[0]
+	stream := openStream(t, tsA, room.Code, player.ID, "")
+	room.Broadcaster.BroadcastOOB("swap", "hello")
+	if ev := nextSSE(t, stream); ev.data != "hello" {
+		t.Errorf("event = %+v, want the owner's stream", ev)
+	}
+}
+
+func TestForward_Redirect(t *testing.T) {
+	a, b, tsA, tsB := newInstancePair(t)
+	a.RoomForward = ForwardRedirect
+	room, _ := b.Rooms.Create("")
+
+	client := newClientWithJar(t)
+	resp, err := client.Get(tsA.URL + "/room/" + room.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	want := tsB.URL + "/room/" + room.Code
+	if resp.StatusCode != http.StatusTemporaryRedirect || resp.Header.Get("Location") != want {
+		t.Errorf("GET /room/{code} = %d to %q, want %d to %q", resp.StatusCode, resp.Header.Get("Location"), http.StatusTemporaryRedirect, want)
+	}
+}
+
+func TestForward_JoinFormFollowsOwner(t *testing.T) {
+	_, b, tsA, _ := newInstancePair(t)
+	room, _ := b.Rooms.Create("")
+
+	client := newClientWithJar(t)
+	resp, err := client.PostForm(tsA.URL+"/rooms/join", url.Values{"code": {strings.ToLower(room.Code)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/room/"+room.Code {
+		t.Errorf("join = %d to %q, want a redirect to the room page", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestForward_ServesLocally(t *testing.T) {
+	a, b, tsA, _ := newInstancePair(t)
+	remote, _ := b.Rooms.Create("")
+	local, _ := a.Rooms.Create("")
+
+	get := func(path string, forwarded bool) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", tsA.URL+path, nil)
+		if forwarded {
+			req.Header.Set(forwardedHeader, "b")
+		}
+		resp, err := newClientWithJar(t).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := get("/room/"+local.Code, false); resp.StatusCode != http.StatusOK {
+		t.Errorf("local room = %d, want it served here", resp.StatusCode)
+	}
+	if resp := get("/room/ZZZZ", false); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("unknown room = %d, want the usual redirect home", resp.StatusCode)
+	}
+	// A request another instance already forwarded is never sent back.
+	if resp := get("/room/"+remote.Code, true); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("forwarded request = %d, want it served here", resp.StatusCode)
+	}
+}
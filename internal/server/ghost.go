@@ -0,0 +1,103 @@
+package server
+
+import (
+	"clicktrainer/internal/analytics"
+	"clicktrainer/internal/ghost"
+	"clicktrainer/internal/rooms"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// handleGhostRace opens a solo room racing a recorded run: the given
+// player's run in game_id, or their best run if no game is given.
+func (s *Server) handleGhostRace(w http.ResponseWriter, r *http.Request) {
+	if s.DB == nil {
+		http.Error(w, "Ghost races require a database connection", http.StatusServiceUnavailable)
+		return
+	}
+	database := s.DB.Store()
+	if database == nil {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Ghost races are temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	playerID, gameID := r.FormValue("player_id"), r.FormValue("game_id")
+	if playerID == "" {
+		http.Error(w, "Player ID required", http.StatusBadRequest)
+		return
+	}
+
+	q := analytics.NewQueries(database)
+	var err error
+	if gameID == "" {
+		gameID, err = q.GetBestRaceableGame(playerID)
+	}
+	var run *ghost.Run
+	if err == nil {
+		run, err = q.GetGhostRun(gameID, playerID)
+	}
+	if errors.Is(err, analytics.ErrNoLayout) {
+		http.Error(w, "This run was recorded before ghost races and can't be raced", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("ghost run query failed", "handler", "ghost_race", "game_id", gameID, "player_id", playerID, "error", err)
+		http.Error(w, "Run not found", http.StatusNotFound)
+		return
+	}
+
+	room, err := s.Rooms.Create("")
+	if errors.Is(err, rooms.ErrClosed) {
+		http.Error(w, "The server is restarting. Try again in a moment.", http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, rooms.ErrNoDirectory) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "New rooms can't be opened while the database is unavailable. Try again in a moment.", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to create room", "handler", "ghost_race", "error", err)
+		http.Error(w, "Failed to create room", http.StatusInternalServerError)
+		return
+	}
+	room.Game.SetGhost(run)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "room_code",
+		Value:    room.Code,
+		Path:     "/",
+		HttpOnly: true,
+	})
+
+	slog.Info("ghost race created", "handler", "ghost_race", "room_code", room.Code, "game_id", gameID, "player_id", playerID)
+	if s.Metrics != nil {
+		s.Metrics.RoomsCreatedTotal.Inc()
+	}
+	http.Redirect(w, r, "/room/"+room.Code, http.StatusSeeOther)
+}
+
+// handleRoomGhost returns the run the current room is racing, with the
+// round length, for the browser to play the ghost's hits against the round
+// clock.
+func (s *Server) handleRoomGhost(w http.ResponseWriter, r *http.Request) {
+	room := s.getRoom(r)
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusBadRequest)
+		return
+	}
+	run := room.Game.Ghost()
+	if run == nil {
+		http.Error(w, "This room isn't racing a ghost", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		*ghost.Run
+		DurationMs int `json:"duration_ms"`
+	}{run, room.Game.Config.RoundDuration * 1000})
+}
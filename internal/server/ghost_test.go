@@ -0,0 +1,72 @@
+package server
+
+import (
+	"clicktrainer/internal/ghost"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGhostRace_NoDB(t *testing.T) {
+	_, ts := newTestServer(t)
+	defer ts.Close()
+
+	resp, err := http.PostForm(ts.URL+"/ghost/race", url.Values{"player_id": {"p1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestGhostRace_SoloRoom(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("")
+	room.Game.SetGhost(ghost.NewRun("g1", "p0", "Ghosty", "#999", 42, []ghost.Hit{{AtMs: 1500, X: 10, Y: 20, Size: 60, Points: 3}}))
+
+	if resp := postAs(t, ts, room, "", "/room/register", url.Values{"name": {"Alice"}}); resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("first register status = %d, want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+	if resp := postAs(t, ts, room, "", "/room/register", url.Values{"name": {"Bob"}}); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("second register status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	host := room.Host()
+	req, _ := http.NewRequest("GET", ts.URL+"/room/"+room.Code, nil)
+	req.AddCookie(&http.Cookie{Name: "player_id", Value: host})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "Racing") || !strings.Contains(string(body), "Ghosty") {
+		t.Error("the lobby should say which run is being raced")
+	}
+
+	req, _ = http.NewRequest("GET", ts.URL+"/room/ghost", nil)
+	req.AddCookie(&http.Cookie{Name: "room_code", Value: room.Code})
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got struct {
+		Name       string      `json:"name"`
+		Hits       []ghost.Hit `json:"hits"`
+		DurationMs int         `json:"duration_ms"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Ghosty" || len(got.Hits) != 1 || got.Hits[0].AtMs != 1500 || got.DurationMs != room.Game.Config.RoundDuration*1000 {
+		t.Errorf("GET /room/ghost = %+v, want the run and round length", got)
+	}
+}
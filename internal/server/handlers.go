@@ -2,18 +2,30 @@ package server
 
 import (
 	"bytes"
-	"clicktrainer/internal/analytics"
+	"clicktrainer/internal/broadcast"
+	"clicktrainer/internal/clickspool"
 	"clicktrainer/internal/db"
+	"clicktrainer/internal/events"
+	"clicktrainer/internal/fanout"
 	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/journal"
 	"clicktrainer/internal/metrics"
 	"clicktrainer/internal/rooms"
+	"clicktrainer/internal/snapshot"
+	"clicktrainer/internal/tick"
+	"clicktrainer/internal/webhooks"
 	"clicktrainer/internal/wshub"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
@@ -24,10 +36,36 @@ import (
 type Server struct {
 	Rooms       *rooms.Store
 	Tmpl        *template.Template
-	DB          *db.DB             // nil if no database configured
-	ClickBuffer chan db.ClickEvent  // nil if no database configured
-	FlushSignal chan chan struct{}   // nil if no database configured
+	DB          *db.Supervisor     // nil if no database configured
+	ClickBuffer chan db.ClickEvent // nil if no database configured
+	FlushSignal chan chan struct{} // nil if no database configured
+	ClickSpool  *clickspool.Spool  // nil drops clicks the database can't take
 	Metrics     *metrics.Metrics
+	Webhooks    *webhooks.Dispatcher // nil disables outgoing webhooks
+	AdminToken  string               // empty disables the admin API
+	Snapshots   snapshot.Store       // nil disables room snapshots
+	Journals    journal.Store        // nil disables room event journals
+	RoomForward string               // ForwardRedirect, or proxy rooms open on other instances
+	Fanout      fanout.Backend       // nil when rooms' clients are all connected here
+
+	pgMu      sync.RWMutex // guards Snapshots, Journals and Fanout, which usePostgres may set while serving
+	pgOnce    sync.Once
+	overflow  clickOverflow // clicks the full ClickBuffer couldn't take, for the writer to spool
+	draining  atomic.Bool   // set once Shutdown begins
+	snapMu    sync.Mutex    // serialises snapshot saves
+	snapFinal bool          // the shutdown snapshot has been saved
+	proxies   sync.Map      // instance URL -> *httputil.ReverseProxy
+	mirrorMu  sync.Mutex
+	mirrors   map[string]*mirror // rooms on other instances followed for clients here
+}
+
+// database returns the database to record play in, or nil if none is
+// configured or it is unavailable.
+func (s *Server) database() db.Store {
+	if s.DB == nil {
+		return nil
+	}
+	return s.DB.Store()
 }
 
 // getRoom resolves the current room from the room_code cookie.
@@ -42,7 +80,19 @@ func (s *Server) getRoom(r *http.Request) *rooms.Room {
 func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 	data := map[string]any{}
 	if room := s.getRoom(r); room != nil {
-		data["RejoinCode"] = room.Code
+		idCookie, err := r.Cookie("player_id")
+		if err != nil || !room.IsBanned(idCookie.Value) {
+			data["RejoinCode"] = room.Code
+		}
+	}
+	if r.URL.Query().Get("kicked") != "" {
+		data["Error"] = "You were removed from the room by the host"
+	}
+	if r.URL.Query().Get("closed") != "" {
+		data["Error"] = "The room was closed"
+	}
+	if r.URL.Query().Get("restarting") != "" {
+		data["Error"] = "The server is restarting. Try again in a moment."
 	}
 	if err := s.Tmpl.ExecuteTemplate(w, "home", data); err != nil {
 		slog.Error("template error", "handler", "home", "error", err)
@@ -52,6 +102,15 @@ func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleCreateRoom(w http.ResponseWriter, r *http.Request) {
 	room, err := s.Rooms.Create("")
+	if errors.Is(err, rooms.ErrClosed) {
+		http.Error(w, "The server is restarting. Try again in a moment.", http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, rooms.ErrNoDirectory) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "New rooms can't be opened while the database is unavailable. Try again in a moment.", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		slog.Error("failed to create room", "handler", "create_room", "error", err)
 		http.Error(w, "Failed to create room", http.StatusInternalServerError)
@@ -81,6 +140,11 @@ func (s *Server) handleJoinRoom(w http.ResponseWriter, r *http.Request) {
 
 	code := strings.ToUpper(strings.TrimSpace(r.FormValue("code")))
 	room := s.Rooms.Get(code)
+	if _, remote := s.remoteOwner(code, r); remote {
+		// The room's own instance takes it from here.
+		http.Redirect(w, r, "/room/"+code, http.StatusSeeOther)
+		return
+	}
 	if room == nil {
 		// Re-render home with error
 		if err := s.Tmpl.ExecuteTemplate(w, "home", map[string]string{"Error": "Room not found"}); err != nil {
@@ -88,6 +152,12 @@ func (s *Server) handleJoinRoom(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if room.Locked() {
+		if err := s.Tmpl.ExecuteTemplate(w, "home", map[string]string{"Error": "Room is locked by the host"}); err != nil {
+			slog.Error("template error", "handler", "join_room", "error", err)
+		}
+		return
+	}
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     "room_code",
@@ -103,8 +173,7 @@ func (s *Server) handleJoinRoom(w http.ResponseWriter, r *http.Request) {
 func (s *Server) renderRoom(w http.ResponseWriter, r *http.Request, room *rooms.Room) {
 	idCookie, err := r.Cookie("player_id")
 	if err == nil && room.Game.Players.ValidateSession(idCookie.Value) {
-		data := room.Game.Get(idCookie.Value)
-		data.RoomCode = room.Code
+		data := s.roomView(room, idCookie.Value)
 		if err := s.Tmpl.ExecuteTemplate(w, "game", data); err != nil {
 			slog.Error("template error", "handler", "render_room", "error", err)
 			http.Error(w, "Error rendering game view", http.StatusInternalServerError)
@@ -119,6 +188,35 @@ func (s *Server) renderRoom(w http.ResponseWriter, r *http.Request, room *rooms.
 	}
 }
 
+// roomView builds the template data for a player's view of the room,
+// including the room-level details the game state doesn't know about.
+func (s *Server) roomView(room *rooms.Room, playerID string) gamedata.GameData {
+	data := room.Game.Get(playerID)
+	data.RoomCode = room.Code
+	data.Locked = room.Locked()
+	data.Paused = room.Round.Paused()
+	if at := room.AutoStartAt(); !at.IsZero() {
+		data.AutoStartAt = at.UnixMilli()
+		data.AutoStartIn = int(time.Until(at).Round(time.Second).Seconds())
+	}
+	if at := room.ExpiryWarning(); !at.IsZero() {
+		data.ExpiresAt = at.UnixMilli()
+		data.ExpiresIn = max(int(time.Until(at).Round(time.Second).Seconds()), 0)
+	}
+	if host := room.Game.Players.Get(room.Host()); host != nil {
+		data.HostName = host.Name
+	}
+	return data
+}
+
+// renderJoinError re-renders the join form with an error message.
+func (s *Server) renderJoinError(w http.ResponseWriter, room *rooms.Room, msg string, status int) {
+	w.WriteHeader(status)
+	if err := s.Tmpl.ExecuteTemplate(w, "join", map[string]string{"RoomCode": room.Code, "Error": msg}); err != nil {
+		slog.Error("template error", "handler", "render_join", "error", err)
+	}
+}
+
 func (s *Server) handleRoomWithCode(w http.ResponseWriter, r *http.Request) {
 	code := strings.ToUpper(r.PathValue("code"))
 	room := s.Rooms.Get(code)
@@ -157,6 +255,20 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+
+	if idCookie, err := r.Cookie("player_id"); err == nil && room.IsBanned(idCookie.Value) {
+		s.renderJoinError(w, room, "You were removed from this room by the host", http.StatusForbidden)
+		return
+	}
+	if room.Locked() {
+		s.renderJoinError(w, room, "This room is locked by the host", http.StatusForbidden)
+		return
+	}
+	if room.Game.Ghost() != nil && room.Game.Players.Count() > 0 {
+		s.renderJoinError(w, room, "This room is a solo ghost race", http.StatusForbidden)
+		return
+	}
+
 	id := uuid.New().String()
 	name := r.FormValue("name")
 
@@ -167,15 +279,14 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 	})
 
-	player := room.Game.Players.Add(id, name)
-
-	if room.HostID == "" {
-		room.HostID = id
-	}
+	player := room.Game.AddPlayer(id, name)
+	room.ClaimHost(id)
+	room.Presence.Track(id)
+	room.Touch()
 
 	// Broadcast immediately — before any DB I/O so existing players see the
 	// update with zero added latency.
-	slog.Info("player registered", "handler", "register", "room_code", room.Code, "player_id", id, "name", name)
+	slog.Info("player registered", "handler", "register", "room_code", room.Code, "player_id", id, "name", name, "late_join", player.LateJoin)
 	if s.Metrics != nil {
 		s.Metrics.PlayersRegisteredTotal.Inc()
 	}
@@ -188,22 +299,20 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		}
 		room.Broadcaster.BroadcastOOB("newPlayer", buf.String())
 	default:
-		count := room.Game.Players.Count()
-		topN := 5
-		if count >= 10 {
-			topN = 3
-		}
+		topN := gamedata.ScoreboardSize(room.Game.Players.Count())
 		var buf bytes.Buffer
 		if err := s.Tmpl.ExecuteTemplate(&buf, "scoreboard", room.Game.Players.GetTopPlayers(topN)); err != nil {
 			slog.Error("template error", "handler", "register", "error", err)
 		}
 		room.Broadcaster.BroadcastOOB("scoreboard", buf.String())
 	}
+	s.broadcastRoomStatus(room)
+	s.checkLobby(room)
 
 	// DB write is fire-and-forget — never block the hot path.
-	if s.DB != nil {
+	if database := s.database(); database != nil {
 		go func() {
-			if err := s.DB.UpsertPlayer(id, name, player.Color); err != nil {
+			if err := database.UpsertPlayer(id, name, player.Color); err != nil {
 				slog.Error("UpsertPlayer failed", "handler", "register", "player_id", id, "error", err)
 				if s.Metrics != nil {
 					s.Metrics.DBWriteErrorsTotal.WithLabelValues("upsert_player").Inc()
@@ -215,6 +324,20 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/room/"+room.Code, http.StatusSeeOther)
 }
 
+// upsertLivePlayers records everyone in this instance's rooms, since
+// players who registered while the database was away were never written
+// and their games and clicks would otherwise refer to nobody.
+func (s *Server) upsertLivePlayers(database db.Store) error {
+	for _, room := range s.Rooms.List() {
+		for _, p := range room.Game.Players.GetList() {
+			if err := database.UpsertPlayer(p.ID, p.Name, p.Color); err != nil {
+				return fmt.Errorf("upserting player %s: %w", p.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
 func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 	room := s.getRoom(r)
 	if room == nil {
@@ -228,74 +351,21 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	readyTxt := "waiting for player"
 	buttonTxt := "I'm Ready!"
 	inputTxt := "ready"
 	isReady := r.FormValue("ready") == "ready"
-	player := room.Game.Players.SetReady(idCookie.Value, isReady)
+	player := room.Game.SetReady(idCookie.Value, isReady)
+	room.Touch()
 
 	if isReady {
-		readyTxt = "Let's Go!"
 		buttonTxt = "Wait! I'm not ready!"
 		inputTxt = "wait"
-		if room.Game.Players.AllReady() {
-			room.Game.SetScene(gamedata.SceneCombat)
-
-			data := room.Game.Get(idCookie.Value)
-			var buf bytes.Buffer
-			if err := s.Tmpl.ExecuteTemplate(&buf, "gameContent", data); err != nil {
-				slog.Error("template error", "handler", "ready", "error", err)
-				http.Error(w, "Error executing game template", http.StatusInternalServerError)
-			}
-
-			countdownStart := room.Game.Config.CountdownSecs
-			var countdownBuf bytes.Buffer
-			if err := s.Tmpl.ExecuteTemplate(&countdownBuf, "lobbyCountdown", countdownStart); err != nil {
-				slog.Error("template error", "handler", "ready", "error", err)
-				http.Error(w, "Error executing lobbyCountdown template", http.StatusInternalServerError)
-			}
-			countdownOOB := fmt.Sprintf(`<div id="lobby" hx-swap-oob="afterend">%s</div>`, countdownBuf.String())
-			room.Broadcaster.BroadcastOOB("swap", countdownOOB)
-
-			go func() {
-				for i := range countdownStart {
-					room.Broadcaster.BroadcastOOB("swap", fmt.Sprintf(`<span id="countdown_num" hx-swap-oob="true">%d</span>`, countdownStart-i))
-					time.Sleep(1 * time.Second)
-				}
-
-				// Create game record in DB before starting round so gameID is available for clicks
-				if s.DB != nil {
-					gameID, err := s.DB.CreateGame(room.Code, room.HostID, room.Game.Config.RoundDuration*1000)
-					if err != nil {
-						slog.Error("CreateGame failed", "room_code", room.Code, "error", err)
-						if s.Metrics != nil {
-							s.Metrics.DBWriteErrorsTotal.WithLabelValues("create_game").Inc()
-						}
-					} else {
-						room.Game.SetCurrentGameID(gameID)
-					}
-				}
-
-				room.Game.StartRound()
-
-				data := room.Game.Get(idCookie.Value)
-				var gameBuf bytes.Buffer
-				if err := s.Tmpl.ExecuteTemplate(&gameBuf, "gameContent", data); err != nil {
-					slog.Error("template error", "handler", "ready_goroutine", "error", err)
-					return
-				}
-				gameOOB := fmt.Sprintf(`<div id="scene" hx-swap-oob="innerHTML">%s</div>`, gameBuf.String())
-				room.Broadcaster.BroadcastOOB("swap", gameOOB)
-
-				s.startRoundTimer(room)
-			}()
-
-			return
-		}
+	}
+	if s.checkLobby(room) {
+		return
 	}
 
-	playerOOB := fmt.Sprintf(`<div id="lobby_player_ready%s" hx-swap-oob="innerHTML">%s</div>`, player.ID, readyTxt)
-	room.Broadcaster.BroadcastOOB("swap", playerOOB)
+	s.broadcastLobbyStatus(room, player)
 
 	buttonOOB := fmt.Sprintf(`<button id="ready_button" hx-swap-oob="innerHTML">%s</button>`, buttonTxt)
 	inputOOB := fmt.Sprintf(`<input id="ready_input" type="hidden" name="ready" hx-swap-oob="outerHTML" value="%s"/>`, inputTxt)
@@ -304,88 +374,6 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) startRoundTimer(room *rooms.Room) {
-	duration := room.Game.Config.RoundDuration
-	for i := duration; i >= 0; i-- {
-		room.Game.SetTimeLeft(i)
-		room.Broadcaster.BroadcastOOB("swap", fmt.Sprintf(`<div id="timer" hx-swap-oob="innerHTML">%d</div>`, i))
-		if i == 0 {
-			break
-		}
-		time.Sleep(1 * time.Second)
-	}
-
-	rankings := room.Game.EndRound()
-	if s.Metrics != nil {
-		s.Metrics.GamesCompletedTotal.Inc()
-		s.Metrics.GameDurationSeconds.Observe(float64(room.Game.Config.RoundDuration))
-	}
-
-	// Flush pending clicks before persisting game results
-	s.flushClickBuffer()
-
-	// Persist game results and award badges
-	if s.DB != nil {
-		gameID := room.Game.CurrentGameID()
-		if gameID != "" {
-			if err := s.DB.EndGame(gameID); err != nil {
-				slog.Error("EndGame failed", "game_id", gameID, "error", err)
-				if s.Metrics != nil {
-					s.Metrics.DBWriteErrorsTotal.WithLabelValues("end_game").Inc()
-				}
-			}
-			for i, p := range rankings {
-				if err := s.DB.AddGamePlayer(gameID, p.ID, p.Score, i+1); err != nil {
-					slog.Error("AddGamePlayer failed", "game_id", gameID, "player_id", p.ID, "error", err)
-					if s.Metrics != nil {
-						s.Metrics.DBWriteErrorsTotal.WithLabelValues("add_game_player").Inc()
-					}
-				}
-			}
-			// Award badges
-			q := analytics.NewQueries(s.DB)
-			for _, p := range rankings {
-				gameStats, err := q.GetPlayerGameStats(gameID, p.ID)
-				if err != nil {
-					slog.Error("GetPlayerGameStats failed", "game_id", gameID, "player_id", p.ID, "error", err)
-					continue
-				}
-				gameBadges := analytics.EvaluateGameBadges(*gameStats)
-				for _, b := range gameBadges {
-					gID := gameID
-					if err := s.DB.AwardBadge(p.ID, string(b.ID), &gID); err != nil {
-						slog.Error("AwardBadge failed", "player_id", p.ID, "error", err)
-						if s.Metrics != nil {
-							s.Metrics.DBWriteErrorsTotal.WithLabelValues("award_badge").Inc()
-						}
-					}
-				}
-				// Check lifetime badges
-				lifeStats, err := q.GetPlayerLifetimeStats(p.ID)
-				if err == nil {
-					lifeBadges := analytics.EvaluateLifetimeBadges(*lifeStats)
-					for _, b := range lifeBadges {
-						if err := s.DB.AwardBadge(p.ID, string(b.ID), nil); err != nil {
-							slog.Error("AwardBadge failed", "player_id", p.ID, "error", err)
-							if s.Metrics != nil {
-								s.Metrics.DBWriteErrorsTotal.WithLabelValues("award_badge").Inc()
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-
-	var buf bytes.Buffer
-	if err := s.Tmpl.ExecuteTemplate(&buf, "recap", rankings); err != nil {
-		slog.Error("template error", "handler", "startRoundTimer", "error", err)
-		return
-	}
-	recapOOB := fmt.Sprintf(`<div id="scene" hx-swap-oob="innerHTML">%s</div>`, buf.String())
-	room.Broadcaster.BroadcastOOB("swap", recapOOB)
-}
-
 func (s *Server) handlePoll(w http.ResponseWriter, r *http.Request) {
 	room := s.getRoom(r)
 	if room == nil {
@@ -403,11 +391,17 @@ func (s *Server) handlePoll(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// processClick handles the core logic for a target click: kill target, update score, broadcast.
-// Returns (ok, targetX, targetY) so callers can use the position for kill effects.
-func (s *Server) processClick(room *rooms.Room, playerID string, targetID int, points int) (bool, int, int) {
+// processClick handles the core logic for a target click: kill target,
+// update score, and queue the change for the room's next tick. Returns
+// whether the click counted.
+func (s *Server) processClick(room *rooms.Room, playerID string, targetID int, points int) bool {
 	if points < 1 || points > 4 {
-		return false, 0, 0
+		return false
+	}
+	// Spectating late joiners watch the round without taking targets, and
+	// nobody scores while the host has the round paused.
+	if !room.Game.Players.CanScore(playerID) || room.Round.Paused() {
+		return false
 	}
 
 	// Capture target info before killing for click recording
@@ -416,27 +410,20 @@ func (s *Server) processClick(room *rooms.Room, playerID string, targetID int, p
 
 	if !room.Game.Targets.Kill(targetID) {
 		// Target already dead — ignore duplicate click
-		return false, 0, 0
+		return false
 	}
-	time.AfterFunc(500*time.Millisecond, func() {
-		newTarget := room.Game.Targets.Add()
-		if s.Metrics != nil {
-			s.Metrics.TargetsSpawnedTotal.Inc()
-		}
-		var buf bytes.Buffer
-		if err := s.Tmpl.ExecuteTemplate(&buf, "target", newTarget); err != nil {
-			slog.Error("template error", "handler", "processClick", "error", err)
-		}
-		room.Broadcaster.BroadcastOOB("newTarget", buf.String())
-	})
+	room.Round.Respawn()
+	room.Touch()
 
-	player := room.Game.Players.UpdateScore(playerID, points)
-	if player == nil {
-		return false, 0, 0
+	gained, score, ok := room.Game.Players.AddPoints(playerID, points)
+	if !ok {
+		return false
 	}
+	room.Game.Events.Publish(events.TargetKilled{TargetID: targetID, PlayerID: playerID, Points: points})
+	room.Game.Events.Publish(events.ScoreChanged{PlayerID: playerID, Delta: gained, Score: score})
+	room.Game.RaceScore(score)
 
 	if s.Metrics != nil {
-		s.Metrics.TargetsKilledTotal.Inc()
 		s.Metrics.ClicksProcessedTotal.WithLabelValues(strconv.Itoa(points), "http").Inc()
 		if target != nil {
 			reactionMs := float64(clickedAt.Sub(target.SpawnedAt).Milliseconds())
@@ -444,18 +431,18 @@ func (s *Server) processClick(room *rooms.Room, playerID string, targetID int, p
 		}
 	}
 
-	var targetX, targetY int
+	kill := tick.Kill{TargetID: targetID, PlayerID: playerID, Points: points}
 	if target != nil {
-		targetX, targetY = target.X, target.Y
+		kill.X, kill.Y = target.X, target.Y
 	}
+	room.Tick.Kill(kill)
 
 	// Record click event asynchronously
 	if s.ClickBuffer != nil && target != nil {
 		gameID := room.Game.CurrentGameID()
 		if gameID != "" {
 			reactionMs := int(clickedAt.Sub(target.SpawnedAt).Milliseconds())
-			select {
-			case s.ClickBuffer <- db.ClickEvent{
+			ev := db.ClickEvent{
 				GameID:     gameID,
 				PlayerID:   playerID,
 				TargetID:   targetID,
@@ -466,22 +453,25 @@ func (s *Server) processClick(room *rooms.Room, playerID string, targetID int, p
 				SpawnedAt:  target.SpawnedAt,
 				ClickedAt:  clickedAt,
 				ReactionMs: reactionMs,
-			}:
+			}
+			select {
+			case s.ClickBuffer <- ev:
 			default:
-				slog.Warn("click buffer full, dropping event", "room_code", room.Code)
+				s.spoolClick(room, ev)
 			}
 		}
 	}
 
-	rank := room.Game.Players.GetPlayerRank(playerID)
-
-	targetOOB  := fmt.Sprintf(`<div id="target_%d" hx-swap-oob="delete"></div>`, targetID)
-	scoreOOB   := fmt.Sprintf(`<div id="player_score_%s" hx-swap-oob="innerHTML">%d</div>`, player.ID, player.Score)
-	myScoreOOB := fmt.Sprintf(`<span id="my_rank_score_%s" hx-swap-oob="innerHTML">%d</span>`, player.ID, player.Score)
-	myPosOOB   := fmt.Sprintf(`<span id="my_rank_pos_%s" hx-swap-oob="innerHTML">#%d</span>`, player.ID, rank)
-	room.Broadcaster.BroadcastOOB("swap", targetOOB+scoreOOB+myScoreOOB+myPosOOB)
+	return true
+}
 
-	return true, targetX, targetY
+// spoolClick keeps a click the full buffer can't take for the batch
+// writer, which spools what has gathered as one batch and writes it once it
+// catches up.
+func (s *Server) spoolClick(room *rooms.Room, ev db.ClickEvent) {
+	if s.ClickSpool == nil || !s.overflow.add(ev) {
+		slog.Warn("click buffer full, dropping event", "room_code", room.Code)
+	}
 }
 
 // flushClickBuffer waits for the click batch writer to drain and write all pending clicks.
@@ -526,7 +516,7 @@ func (s *Server) handleTarget(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, _, _ = s.processClick(room, idCookie.Value, targetID, points)
+	s.processClick(room, idCookie.Value, targetID, points)
 }
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -567,11 +557,14 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	room.Hub.Register(client)
+	room.Presence.Connect(playerID)
+	room.Touch()
 	if s.Metrics != nil {
 		s.Metrics.WSConnectionsActive.Inc()
 	}
 	defer func() {
 		room.Hub.Unregister(playerID)
+		room.Presence.Disconnect(playerID)
 		if s.Metrics != nil {
 			s.Metrics.WSConnectionsActive.Dec()
 		}
@@ -585,6 +578,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			if websocket.CloseStatus(err) == websocket.StatusNormalClosure ||
 				websocket.CloseStatus(err) == websocket.StatusGoingAway ||
+				errors.Is(err, net.ErrClosed) || // closed by room teardown
 				ctx.Err() != nil {
 				return
 			}
@@ -597,31 +591,20 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			slog.Warn("invalid WebSocket message", "player_id", playerID, "error", err)
 			continue
 		}
+		s.handleClientMessage(room, playerID, msg)
+	}
+}
 
-		switch msg.Type {
-		case "move":
-			room.Hub.BroadcastExcept(playerID, wshub.ServerMessage{
-				Type:     "move",
-				PlayerID: playerID,
-				Name:     client.Name,
-				Color:    client.Color,
-				X:        msg.X,
-				Y:        msg.Y,
-			})
-		case "click":
-			ok, tx, ty := s.processClick(room, playerID, msg.TargetID, msg.Points)
-			if ok {
-				room.Hub.BroadcastExcept(playerID, wshub.ServerMessage{
-					Type:     "kill",
-					PlayerID: playerID,
-					Name:     client.Name,
-					Color:    client.Color,
-					X:        tx,
-					Y:        ty,
-					Points:   msg.Points,
-				})
-			}
-		}
+// handleClientMessage applies a message from a player's WebSocket, whichever
+// instance it is connected to. Moves and kill effects reach other players
+// with the room's next tick.
+func (s *Server) handleClientMessage(room *rooms.Room, playerID string, msg wshub.ClientMessage) {
+	room.Game.Players.Touch(playerID)
+	switch msg.Type {
+	case "move":
+		room.Tick.Move(playerID, msg.X, msg.Y)
+	case "click":
+		s.processClick(room, playerID, msg.TargetID, msg.Points)
 	}
 }
 
@@ -654,33 +637,51 @@ func (s *Server) handleLeaveRoom(w http.ResponseWriter, r *http.Request) {
 	}
 	playerID := idCookie.Value
 
+	s.removePlayer(room, playerID)
+
+	redirectHome()
+}
+
+// removePlayer takes a player out of the room, hands host rights to the
+// longest-standing remaining player if needed, and tells everyone else.
+// The room is deleted once the last player is gone.
+func (s *Server) removePlayer(room *rooms.Room, playerID string) {
+	room.Presence.Forget(playerID)
 	room.Game.Players.Remove(playerID)
+	room.Game.Events.Publish(events.PlayerLeft{PlayerID: playerID})
 
 	// If room is now empty, delete it.
 	if room.Game.Players.Count() == 0 {
 		s.Rooms.Delete(room.Code)
-	} else {
-		// Broadcast removal to remaining players based on scene.
-		scene := room.Game.Scene()
-		switch scene {
-		case gamedata.SceneLobby:
-			oob := fmt.Sprintf(`<div id="lobby_player%s" hx-swap-oob="delete"></div>`, playerID)
-			room.Broadcaster.BroadcastOOB("swap", oob)
-		case gamedata.SceneCombat:
-			oob := fmt.Sprintf(`<div id="player_%s" hx-swap-oob="delete"></div>`, playerID)
-			room.Broadcaster.BroadcastOOB("swap", oob)
-		case gamedata.SceneRecap:
-			rankings := room.Game.Players.GetList()
-			var buf bytes.Buffer
-			if err := s.Tmpl.ExecuteTemplate(&buf, "recap", rankings); err != nil {
-				slog.Error("template error", "handler", "leave_room", "error", err)
-			}
-			recapOOB := fmt.Sprintf(`<div id="scene" hx-swap-oob="innerHTML">%s</div>`, buf.String())
-			room.Broadcaster.BroadcastOOB("swap", recapOOB)
+		return
+	}
+
+	if room.IsHost(playerID) {
+		if next := room.Game.Players.Oldest(); next != nil {
+			room.SetHost(next.ID)
+			slog.Info("host transferred", "room_code", room.Code, "from", playerID, "to", next.ID, "reason", "host_left")
 		}
 	}
 
-	redirectHome()
+	// Broadcast removal to remaining players based on scene.
+	scene := room.Game.Scene()
+	switch scene {
+	case gamedata.SceneLobby:
+		oob := fmt.Sprintf(`<div id="lobby_player%s" hx-swap-oob="delete"></div>`, playerID)
+		room.Broadcaster.BroadcastOOB("swap", oob)
+		s.checkLobby(room)
+	case gamedata.SceneCombat:
+		oob := fmt.Sprintf(`<div id="player_%s" hx-swap-oob="delete"></div>`, playerID)
+		room.Broadcaster.BroadcastOOB("swap", oob)
+	case gamedata.SceneRecap:
+		var buf bytes.Buffer
+		if err := s.Tmpl.ExecuteTemplate(&buf, "recap", room.Game.Recap()); err != nil {
+			slog.Error("template error", "handler", "leave_room", "error", err)
+		}
+		recapOOB := fmt.Sprintf(`<div id="scene" hx-swap-oob="innerHTML">%s</div>`, buf.String())
+		room.Broadcaster.BroadcastOOB("swap", recapOOB)
+	}
+	s.broadcastRoomStatus(room)
 }
 
 func (s *Server) handlePlayAgain(w http.ResponseWriter, r *http.Request) {
@@ -689,8 +690,15 @@ func (s *Server) handlePlayAgain(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
+	// Only a finished round goes back to the lobby; one still counting down
+	// or running carries on.
+	if room.Game.Scene() != gamedata.SceneRecap {
+		http.Error(w, "The round isn't over yet", http.StatusConflict)
+		return
+	}
 
 	room.Game.ResetToLobby()
+	room.Touch()
 
 	idCookie, err := r.Cookie("player_id")
 	if err != nil {
@@ -698,8 +706,7 @@ func (s *Server) handlePlayAgain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data := room.Game.Get(idCookie.Value)
-	data.RoomCode = room.Code
+	data := s.roomView(room, idCookie.Value)
 	var buf bytes.Buffer
 	if err := s.Tmpl.ExecuteTemplate(&buf, "lobby", data); err != nil {
 		slog.Error("template error", "handler", "play_again", "error", err)
@@ -726,12 +733,45 @@ func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("X-Accel-Buffering", "no")
 
-	msgChan := room.Broadcaster.Subscribe()
+	// Only registered players count towards presence; the join page also
+	// opens an event stream.
+	var playerID string
+	if idCookie, err := r.Cookie("player_id"); err == nil && room.Game.Players.Get(idCookie.Value) != nil {
+		playerID = idCookie.Value
+	}
+
+	// A reconnecting browser sends the ID of the last message it received.
+	// Replay what it missed, or resend its view of the room if the gap is no
+	// longer in the replay buffer.
+	var msgChan chan broadcast.HxEventMessage
+	var missed []broadcast.HxEventMessage
+	resync := false
+	if lastID, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		var ok bool
+		msgChan, missed, ok = room.Broadcaster.Resume(lastID)
+		resync = !ok && playerID != ""
+		if s.Metrics != nil {
+			result := "replay"
+			if !ok {
+				result = "resync"
+			}
+			s.Metrics.SSEResumesTotal.WithLabelValues(result).Inc()
+		}
+	} else {
+		msgChan = room.Broadcaster.Subscribe()
+	}
+	if playerID != "" {
+		room.Presence.Connect(playerID)
+		room.Touch()
+	}
 	if s.Metrics != nil {
 		s.Metrics.SSEConnectionsActive.Inc()
 	}
 	defer func() {
 		room.Broadcaster.Unsubscribe(msgChan)
+		if playerID != "" {
+			room.Presence.Disconnect(playerID)
+		}
 		if s.Metrics != nil {
 			s.Metrics.SSEConnectionsActive.Dec()
 		}
@@ -741,33 +781,121 @@ func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 	// right away and HTMX registers all sse-swap listeners before any events arrive.
 	flusher.Flush()
 
+	for _, msg := range missed {
+		writeSSE(w, msg)
+	}
+	if resync {
+		for _, msg := range s.resyncMessages(room, playerID) {
+			writeSSE(w, msg)
+		}
+	}
+	flusher.Flush()
+	s.pumpSSE(w, r, flusher, msgChan)
+}
+
+// pumpSSE writes a client's messages to its stream until the client goes
+// away or the channel is closed.
+func (s *Server) pumpSSE(w http.ResponseWriter, r *http.Request, flusher http.Flusher, msgChan chan broadcast.HxEventMessage) {
 	for {
 		select {
 		case <-r.Context().Done():
 			return
-		case msg := <-msgChan:
+		case msg, ok := <-msgChan:
+			if !ok {
+				// The room was closed and its final event sent, or this
+				// client fell behind and will reconnect.
+				return
+			}
 			if s.Metrics != nil {
 				s.Metrics.SSEMessagesPublished.WithLabelValues(msg.Event).Inc()
 			}
-			fmt.Fprintf(w, "event: %s\n", msg.Event)
-			for _, line := range strings.Split(msg.Msg, "\n") {
-				fmt.Fprintf(w, "data: %s\n", line)
-			}
-			fmt.Fprint(w, "\n")
+			writeSSE(w, msg)
 			flusher.Flush()
 		}
 	}
 }
 
+// writeSSE writes one server-sent event. Messages without an ID leave the
+// client's last event ID unchanged.
+func writeSSE(w io.Writer, msg broadcast.HxEventMessage) {
+	if msg.ID != 0 {
+		fmt.Fprintf(w, "id: %d\n", msg.ID)
+	}
+	fmt.Fprintf(w, "event: %s\n", msg.Event)
+	for _, line := range strings.Split(msg.Msg, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// resyncMessages re-renders a player's whole view of the room, for a client
+// that missed more messages than the replay buffer holds.
+func (s *Server) resyncMessages(room *rooms.Room, playerID string) []broadcast.HxEventMessage {
+	data := s.roomView(room, playerID)
+	var scene bytes.Buffer
+	var err error
+	switch data.Scene {
+	case gamedata.SceneLobby:
+		err = s.Tmpl.ExecuteTemplate(&scene, "lobby", data)
+		if endsAt, ok := room.Round.CountdownEndsAt(); ok && err == nil {
+			err = s.Tmpl.ExecuteTemplate(&scene, "lobbyCountdown", newCountdownView(endsAt, true))
+		}
+	case gamedata.SceneRecap:
+		err = s.Tmpl.ExecuteTemplate(&scene, "recap", data.Recap)
+	default:
+		err = s.Tmpl.ExecuteTemplate(&scene, "gameContent", data)
+	}
+	if err != nil {
+		slog.Error("template error", "handler", "resync", "error", err)
+		return nil
+	}
+	var expiry bytes.Buffer
+	if err := s.Tmpl.ExecuteTemplate(&expiry, "roomExpiry", data); err != nil {
+		slog.Error("template error", "handler", "resync", "error", err)
+	}
+	oob := fmt.Sprintf(`<div id="scene" hx-swap-oob="innerHTML">%s</div><div id="room_expiry" hx-swap-oob="innerHTML">%s</div>`, scene.String(), expiry.String())
+	return []broadcast.HxEventMessage{
+		{Event: "swap", Msg: oob},
+		{Event: "sceneChange", Msg: string(data.Scene)},
+	}
+}
+
+// health is the body of a /health response.
+type health struct {
+	Status   string `json:"status"`
+	Database string `json:"database,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	status := "ok"
+	if s.draining.Load() {
+		// Tell load balancers to stop sending players here.
+		writeHealth(w, http.StatusServiceUnavailable, health{Status: "draining"})
+		return
+	}
+	// Rooms keep working without the database, so its outage degrades the
+	// instance rather than failing it.
 	if s.DB != nil {
-		if err := s.DB.Ping(); err != nil {
-			status = "db_error"
-			w.WriteHeader(http.StatusServiceUnavailable)
-			fmt.Fprintf(w, `{"status":"%s","error":"%s"}`, status, err.Error())
+		err := s.DB.Err()
+		if database := s.DB.Store(); database != nil {
+			err = database.Ping()
+		}
+		if err != nil {
+			writeHealth(w, http.StatusOK, health{Status: "degraded", Database: "unavailable", Error: err.Error()})
 			return
 		}
 	}
-	fmt.Fprintf(w, `{"status":"%s"}`, status)
+	writeHealth(w, http.StatusOK, health{Status: "ok"})
+}
+
+func writeHealth(w http.ResponseWriter, status int, h health) {
+	body, err := json.Marshal(h)
+	if err != nil {
+		slog.Error("encoding health failed", "handler", "health", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
 }
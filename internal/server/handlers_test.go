@@ -2,16 +2,22 @@ package server
 
 import (
 	"bufio"
+	"clicktrainer/internal/db"
 	"clicktrainer/internal/gamedata"
 	"clicktrainer/internal/rooms"
+	"clicktrainer/internal/tick"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"text/template"
 	"time"
@@ -19,7 +25,7 @@ import (
 	"github.com/coder/websocket"
 )
 
-func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+func newTestServer(t testing.TB) (*Server, *httptest.Server) {
 	t.Helper()
 	cfg := gamedata.Config{
 		RoundDuration:  5,
@@ -28,26 +34,15 @@ func newTestServer(t *testing.T) (*Server, *httptest.Server) {
 	}
 	roomStore := rooms.NewStore(cfg)
 
-	funcMap := template.FuncMap{
-		"inc": func(i int) int { return i + 1 },
-	}
-	tmpl := template.Must(template.New("").Funcs(funcMap).ParseFiles(
-		"../../templates/home.html",
-		"../../templates/game.html",
-		"../../templates/join.html",
-		"../../templates/target.html",
-		"../../templates/lobby.html",
-		"../../templates/recap.html",
-		"../../templates/analytics/dashboard.html",
-		"../../templates/analytics/leaderboard.html",
-		"../../templates/analytics/player.html",
-		"../../templates/analytics/game.html",
-	))
+	tmpl := template.Must(parseTemplates("../../templates"))
 
 	srv := &Server{
 		Rooms: roomStore,
 		Tmpl:  tmpl,
 	}
+	roomStore.SetRoundHooks(srv.roundHooksFor)
+	roomStore.SetOnCreate(srv.onRoomCreated)
+	roomStore.SetTick(tick.DefaultRate, srv.tickFlushFor)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", srv.handleHome)
@@ -60,16 +55,35 @@ func newTestServer(t *testing.T) (*Server, *httptest.Server) {
 	mux.HandleFunc("POST /room/target/", srv.handleTarget)
 	mux.HandleFunc("GET /room/ws", srv.handleWebSocket)
 	mux.HandleFunc("POST /room/leave", srv.handleLeaveRoom)
+	mux.HandleFunc("GET /room/ghost", srv.handleRoomGhost)
+	mux.HandleFunc("POST /ghost/race", srv.handleGhostRace)
 	mux.HandleFunc("GET /room/events", srv.handleEvents)
 	mux.HandleFunc("GET /room/poll", srv.handlePoll)
 	mux.HandleFunc("POST /room/play-again", srv.handlePlayAgain)
+	mux.HandleFunc("GET /room/host/panel", srv.handleHostPanel)
+	mux.HandleFunc("POST /room/host/kick", srv.handleHostKick)
+	mux.HandleFunc("POST /room/host/transfer", srv.handleHostTransfer)
+	mux.HandleFunc("POST /room/host/lock", srv.handleHostLock)
+	mux.HandleFunc("POST /room/host/start", srv.handleHostStart)
+	mux.HandleFunc("POST /room/host/settings", srv.handleHostSettings)
+	mux.HandleFunc("GET /room/host/round", srv.handleHostRoundControls)
+	mux.HandleFunc("POST /room/host/pause", srv.handleHostPause)
+	mux.HandleFunc("GET /room/host/expiry", srv.handleHostExpiry)
+	mux.HandleFunc("POST /room/host/keepalive", srv.handleHostKeepAlive)
 	mux.HandleFunc("/health", srv.handleHealth)
+	mux.HandleFunc("GET /clock", srv.handleClock)
+	mux.HandleFunc("GET /admin/webhooks", srv.handleListWebhooks)
+	mux.HandleFunc("POST /admin/webhooks", srv.handleCreateWebhook)
+	mux.HandleFunc("DELETE /admin/webhooks/{id}", srv.handleDeleteWebhook)
+	mux.HandleFunc("GET /admin/webhooks/deliveries", srv.handleWebhookDeliveries)
 	mux.HandleFunc("/analytics", srv.handleAnalyticsDashboard)
 	mux.HandleFunc("/analytics/leaderboard", srv.handleAnalyticsLeaderboard)
 	mux.HandleFunc("/analytics/player/", srv.handleAnalyticsPlayer)
 	mux.HandleFunc("/analytics/game/", srv.handleAnalyticsGame)
+	mux.HandleFunc("GET /analytics/game/{id}/replay", srv.handleAnalyticsReplay)
+	mux.HandleFunc("GET /analytics/game/{id}/timeline", srv.handleAnalyticsTimeline)
 
-	ts := httptest.NewServer(mux)
+	ts := httptest.NewServer(srv.forwardRooms(mux))
 	return srv, ts
 }
 
@@ -133,6 +147,26 @@ func TestHandleCreateRoom(t *testing.T) {
 	}
 }
 
+func TestHandleCreateRoom_AwaitingDirectory(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	srv.Rooms.AwaitDirectory()
+
+	resp, err := http.PostForm(ts.URL+"/rooms/create", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d until the shared directory attaches", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	srv.Rooms.SetDirectory(rooms.NewMemoryDirectory(), rooms.Instance{ID: "a"})
+	if code := createRoomAndGetCode(t, newClientWithJar(t), ts.URL); code == "" {
+		t.Error("rooms should open once the directory is set")
+	}
+}
+
 func TestHandleJoinRoom_Valid(t *testing.T) {
 	srv, ts := newTestServer(t)
 	defer ts.Close()
@@ -220,6 +254,56 @@ func TestHandleRegister_InRoom(t *testing.T) {
 	}
 }
 
+func TestHandleRegister_UpsertedWhenDatabaseAttaches(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "players.db")
+	var reachable atomic.Bool
+	srv.DB = db.NewSupervisor(func() (db.Store, error) {
+		if !reachable.Load() {
+			return nil, errors.New("connection refused")
+		}
+		return db.OpenSQLite(path)
+	}, db.SupervisorOptions{
+		Backoff:    10 * time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+		OnAttach: func(database db.Store) error {
+			if err := database.Migrate(); err != nil {
+				return err
+			}
+			return srv.upsertLivePlayers(database)
+		},
+	})
+	srv.DB.Start()
+	defer srv.DB.Close()
+
+	// Registered while the database is away, so nothing is written yet.
+	room, _ := srv.Rooms.Create("host")
+	client := newClientWithJar(t)
+	u, _ := url.Parse(ts.URL)
+	client.Jar.SetCookies(u, []*http.Cookie{{Name: "room_code", Value: room.Code}})
+	resp, err := client.PostForm(ts.URL+"/room/register", url.Values{"name": {"Alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	players := room.Game.Players.GetList()
+	if len(players) != 1 {
+		t.Fatalf("expected 1 player, got %d", len(players))
+	}
+
+	reachable.Store(true)
+	waitFor(t, "the database to attach", func() bool { return srv.database() != nil })
+	var name string
+	if err := srv.database().QueryRow(`SELECT name FROM players WHERE id = ?`, players[0].ID).Scan(&name); err != nil {
+		t.Fatalf("player registered while detached wasn't upserted on attach: %v", err)
+	}
+	if name != "Alice" {
+		t.Errorf("upserted name = %q, want %q", name, "Alice")
+	}
+}
+
 func TestHandleReady_InRoom(t *testing.T) {
 	srv, ts := newTestServer(t)
 	defer ts.Close()
@@ -283,10 +367,7 @@ func TestHandlePlayAgain_InRoom(t *testing.T) {
 	room.Game.Players.Add("test-id", "Alice")
 	room.Game.Players.UpdateScore("test-id", 100)
 
-	// Drain scene change events
-	go func() { <-room.Game.Events.SceneChanges }()
 	room.Game.SetScene(gamedata.SceneRecap)
-	go func() { <-room.Game.Events.SceneChanges }()
 
 	client := &http.Client{}
 	req, _ := http.NewRequest("POST", ts.URL+"/room/play-again", nil)
@@ -336,6 +417,8 @@ func TestHandleAnalytics_NoDB(t *testing.T) {
 		"/analytics/leaderboard",
 		"/analytics/player/someid",
 		"/analytics/game/someid",
+		"/analytics/game/someid/replay",
+		"/analytics/game/someid/timeline",
 	}
 
 	_, ts := newTestServer(t)
@@ -356,6 +439,97 @@ func TestHandleAnalytics_NoDB(t *testing.T) {
 	}
 }
 
+// unreachableDB returns a supervisor for a database that never answers.
+func unreachableDB(t *testing.T) *db.Supervisor {
+	t.Helper()
+	sup := db.NewSupervisor(func() (db.Store, error) {
+		return nil, errors.New("connection refused")
+	}, db.SupervisorOptions{Backoff: time.Hour})
+	sup.Start()
+	t.Cleanup(func() { sup.Close() })
+	return sup
+}
+
+func TestHandleHealth_DBUnavailable(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	srv.DB = unreachableDB(t)
+
+	resp, err := http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// Rooms still work, so the instance stays in rotation.
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	expected := `{"status":"degraded","database":"unavailable","error":"connection refused"}`
+	if string(body) != expected {
+		t.Errorf("body = %q, want %q", string(body), expected)
+	}
+}
+
+func TestHandleHealth_ErrorIsEscaped(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	msg := "dial \"db\": bad byte \x01"
+	sup := db.NewSupervisor(func() (db.Store, error) {
+		return nil, errors.New(msg)
+	}, db.SupervisorOptions{Backoff: time.Hour})
+	sup.Start()
+	defer sup.Close()
+	srv.DB = sup
+
+	resp, err := http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var got struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if got.Status != "degraded" || got.Error != msg {
+		t.Errorf("health = %+v, want degraded with error %q", got, msg)
+	}
+}
+
+func TestHandleAnalytics_DBUnavailable(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	srv.DB = unreachableDB(t)
+
+	for ep, page := range map[string]bool{
+		"/analytics":                      true,
+		"/analytics/player/someid":        true,
+		"/analytics/leaderboard":          false,
+		"/analytics/game/someid/timeline": false,
+	} {
+		t.Run(ep, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + ep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+				t.Errorf("status = %d with Retry-After %q, want %d with a retry hint", resp.StatusCode, resp.Header.Get("Retry-After"), http.StatusServiceUnavailable)
+			}
+			if page != strings.Contains(string(body), "<html>") || !strings.Contains(string(body), "temporarily unavailable") {
+				t.Errorf("body = %q, want the unavailable page: %v", body, page)
+			}
+		})
+	}
+}
+
 func TestHandleEvents_SSEStream(t *testing.T) {
 	srv, ts := newTestServer(t)
 	defer ts.Close()
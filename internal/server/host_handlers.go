@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bytes"
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/players"
+	"clicktrainer/internal/rooms"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// maxMinPlayers caps the minimum-players setting a host can choose.
+const maxMinPlayers = 20
+
+// hostPanelData is the template data for the host-only lobby controls.
+type hostPanelData struct {
+	HostID   string
+	Locked   bool
+	LateJoin gamedata.LateJoinPolicy
+	Lobby    gamedata.LobbySettings
+	Players  []*players.Player
+}
+
+// requireHost resolves the room and the calling player and checks that the
+// caller holds host rights. It writes an error response and returns ok=false
+// otherwise. Host actions count as room activity.
+func (s *Server) requireHost(w http.ResponseWriter, r *http.Request) (room *rooms.Room, hostID string, ok bool) {
+	room = s.getRoom(r)
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusBadRequest)
+		return nil, "", false
+	}
+	idCookie, err := r.Cookie("player_id")
+	if err != nil {
+		http.Error(w, "Not Registered", http.StatusBadRequest)
+		return nil, "", false
+	}
+	if !room.IsHost(idCookie.Value) {
+		http.Error(w, "Only the host can do that", http.StatusForbidden)
+		return nil, "", false
+	}
+	room.Touch()
+	return room, idCookie.Value, true
+}
+
+// broadcastRoomStatus pushes the host/lock status line to every client and
+// signals host panels to refresh themselves.
+func (s *Server) broadcastRoomStatus(room *rooms.Room) {
+	data := s.roomView(room, "")
+	var buf bytes.Buffer
+	if err := s.Tmpl.ExecuteTemplate(&buf, "roomStatus", data); err != nil {
+		slog.Error("template error", "handler", "room_status", "error", err)
+		return
+	}
+	statusOOB := fmt.Sprintf(`<div id="room_status" hx-swap-oob="innerHTML">%s</div>`, buf.String())
+	room.Broadcaster.BroadcastOOB("swap", statusOOB)
+	room.Broadcaster.BroadcastOOB("roomUpdate", room.Host())
+}
+
+func (s *Server) handleHostPanel(w http.ResponseWriter, r *http.Request) {
+	room := s.getRoom(r)
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusBadRequest)
+		return
+	}
+	idCookie, err := r.Cookie("player_id")
+	if err != nil || !room.IsHost(idCookie.Value) {
+		// Non-hosts get an empty panel.
+		return
+	}
+
+	data := hostPanelData{
+		HostID:   idCookie.Value,
+		Locked:   room.Locked(),
+		LateJoin: room.Game.LateJoinPolicy(),
+		Lobby:    room.Game.LobbySettings(),
+		Players:  room.Game.Players.GetList(),
+	}
+	if err := s.Tmpl.ExecuteTemplate(w, "hostPanel", data); err != nil {
+		slog.Error("template error", "handler", "host_panel", "error", err)
+	}
+}
+
+func (s *Server) handleHostKick(w http.ResponseWriter, r *http.Request) {
+	room, hostID, ok := s.requireHost(w, r)
+	if !ok {
+		return
+	}
+	targetID := r.FormValue("player_id")
+	if targetID == "" || targetID == hostID {
+		http.Error(w, "Invalid player", http.StatusBadRequest)
+		return
+	}
+	if room.Game.Players.Get(targetID) == nil {
+		http.Error(w, "Player not found", http.StatusNotFound)
+		return
+	}
+
+	room.Ban(targetID)
+	room.Hub.Kick(targetID, "kicked by host")
+	room.Broadcaster.BroadcastOOB("kicked", targetID)
+	s.removePlayer(room, targetID)
+
+	slog.Info("player kicked", "handler", "host_kick", "room_code", room.Code, "host_id", hostID, "player_id", targetID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleHostTransfer(w http.ResponseWriter, r *http.Request) {
+	room, hostID, ok := s.requireHost(w, r)
+	if !ok {
+		return
+	}
+	targetID := r.FormValue("player_id")
+	if room.Game.Players.Get(targetID) == nil {
+		http.Error(w, "Player not found", http.StatusNotFound)
+		return
+	}
+
+	room.SetHost(targetID)
+	s.broadcastRoomStatus(room)
+
+	slog.Info("host transferred", "handler", "host_transfer", "room_code", room.Code, "from", hostID, "to", targetID, "reason", "transfer")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleHostLock(w http.ResponseWriter, r *http.Request) {
+	room, hostID, ok := s.requireHost(w, r)
+	if !ok {
+		return
+	}
+	locked := r.FormValue("locked") == "true"
+
+	room.SetLocked(locked)
+	s.broadcastRoomStatus(room)
+
+	slog.Info("room lock changed", "handler", "host_lock", "room_code", room.Code, "host_id", hostID, "locked", locked)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleHostStart(w http.ResponseWriter, r *http.Request) {
+	room, hostID, ok := s.requireHost(w, r)
+	if !ok {
+		return
+	}
+	if room.Game.Scene() != gamedata.SceneLobby {
+		http.Error(w, "Round already in progress", http.StatusConflict)
+		return
+	}
+	if !s.startRound(room) {
+		http.Error(w, "Round already in progress", http.StatusConflict)
+		return
+	}
+
+	slog.Info("round force-started", "handler", "host_start", "room_code", room.Code, "host_id", hostID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleHostSettings(w http.ResponseWriter, r *http.Request) {
+	room, hostID, ok := s.requireHost(w, r)
+	if !ok {
+		return
+	}
+
+	// Every field is optional; validate them all before applying any.
+	policy := room.Game.LateJoinPolicy()
+	if v := r.FormValue("late_join"); v != "" {
+		p, valid := gamedata.ParseLateJoinPolicy(v)
+		if !valid {
+			http.Error(w, "Invalid late-join policy", http.StatusBadRequest)
+			return
+		}
+		policy = p
+	}
+	lobby := room.Game.LobbySettings()
+	if v := r.FormValue("min_players"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxMinPlayers {
+			http.Error(w, "Invalid minimum player count", http.StatusBadRequest)
+			return
+		}
+		lobby.MinPlayers = n
+	}
+	if v := r.FormValue("auto_start"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 100 {
+			http.Error(w, "Invalid auto-start threshold", http.StatusBadRequest)
+			return
+		}
+		lobby.AutoStartPercent = n
+	}
+	if v := r.FormValue("idle_action"); v != "" {
+		a, valid := gamedata.ParseIdleAction(v)
+		if !valid {
+			http.Error(w, "Invalid idle action", http.StatusBadRequest)
+			return
+		}
+		lobby.IdleAction = a
+	}
+
+	room.Game.SetLateJoinPolicy(policy)
+	room.Game.SetLobbySettings(lobby)
+	s.broadcastRoomStatus(room)
+	s.checkLobby(room)
+
+	slog.Info("room settings changed", "handler", "host_settings", "room_code", room.Code, "host_id", hostID,
+		"late_join", policy, "min_players", lobby.MinPlayers, "auto_start", lobby.AutoStartPercent, "idle_action", lobby.IdleAction)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/rooms"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// postAs sends a form POST to path with the room and player cookies set.
+func postAs(t *testing.T, ts *httptest.Server, room *rooms.Room, playerID, path string, form url.Values) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest("POST", ts.URL+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "room_code", Value: room.Code})
+	if playerID != "" {
+		req.AddCookie(&http.Cookie{Name: "player_id", Value: playerID})
+	}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestHostKick_RemovesAndBans(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.Players.Add("p2", "Bob")
+
+	resp := postAs(t, ts, room, "host", "/room/host/kick", url.Values{"player_id": {"p2"}})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if room.Game.Players.Get("p2") != nil {
+		t.Error("kicked player should be removed")
+	}
+	if !room.IsBanned("p2") {
+		t.Error("kicked player should be banned")
+	}
+
+	// Re-registering with the kicked player's cookie must be refused.
+	resp = postAs(t, ts, room, "p2", "/room/register", url.Values{"name": {"Bob"}})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("rejoin status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+	if room.Game.Players.Count() != 1 {
+		t.Errorf("player count = %d, want 1", room.Game.Players.Count())
+	}
+}
+
+func TestHostActions_RequireHost(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.Players.Add("p2", "Bob")
+
+	paths := []string{"/room/host/kick", "/room/host/transfer", "/room/host/lock", "/room/host/start"}
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			resp := postAs(t, ts, room, "p2", path, url.Values{"player_id": {"host"}, "locked": {"true"}})
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+			}
+		})
+	}
+
+	if room.Locked() || room.Host() != "host" || room.Game.Scene() != gamedata.SceneLobby {
+		t.Error("non-host requests should not change the room")
+	}
+}
+
+func TestHostTransfer(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.Players.Add("p2", "Bob")
+
+	resp := postAs(t, ts, room, "host", "/room/host/transfer", url.Values{"player_id": {"p2"}})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if room.Host() != "p2" {
+		t.Errorf("host = %q, want %q", room.Host(), "p2")
+	}
+}
+
+func TestHostLock_BlocksRegistration(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+
+	postAs(t, ts, room, "host", "/room/host/lock", url.Values{"locked": {"true"}})
+	if !room.Locked() {
+		t.Fatal("room should be locked")
+	}
+
+	resp := postAs(t, ts, room, "", "/room/register", url.Values{"name": {"Carol"}})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("register status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+	if room.Game.Players.Count() != 1 {
+		t.Errorf("player count = %d, want 1", room.Game.Players.Count())
+	}
+
+	postAs(t, ts, room, "host", "/room/host/lock", url.Values{"locked": {"false"}})
+	if room.Locked() {
+		t.Error("room should be unlocked")
+	}
+}
+
+func TestHostStart_IgnoresReadiness(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.Players.Add("p2", "Bob")
+
+	resp := postAs(t, ts, room, "host", "/room/host/start", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if room.Game.Scene() != gamedata.SceneCombat {
+		t.Errorf("scene = %q, want %q", room.Game.Scene(), gamedata.SceneCombat)
+	}
+
+	resp = postAs(t, ts, room, "host", "/room/host/start", nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("second start status = %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+}
+
+func TestLeaveRoom_TransfersHost(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("")
+	room.Game.Players.Add("host", "Alice")
+	room.ClaimHost("host")
+	room.Game.Players.Add("p2", "Bob")
+
+	postAs(t, ts, room, "host", "/room/leave", nil)
+
+	if room.Host() != "p2" {
+		t.Errorf("host after leave = %q, want %q", room.Host(), "p2")
+	}
+}
+
+func TestHostPanel_OnlyForHost(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.Players.Add("p2", "Bob")
+
+	get := func(playerID string) string {
+		req, _ := http.NewRequest("GET", ts.URL+"/room/host/panel", nil)
+		req.AddCookie(&http.Cookie{Name: "room_code", Value: room.Code})
+		req.AddCookie(&http.Cookie{Name: "player_id", Value: playerID})
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if body := get("host"); !strings.Contains(body, "Host Controls") || !strings.Contains(body, "Bob") {
+		t.Error("host should see the control panel listing other players")
+	}
+	if body := get("p2"); strings.TrimSpace(body) != "" {
+		t.Errorf("non-host panel should be empty, got %q", body)
+	}
+}
+
+func TestHostSettings_LateJoinSpectate(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+
+	resp := postAs(t, ts, room, "host", "/room/host/settings", url.Values{"late_join": {"spectate"}})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if room.Game.LateJoinPolicy() != gamedata.LateJoinSpectate {
+		t.Fatalf("policy = %q, want %q", room.Game.LateJoinPolicy(), gamedata.LateJoinSpectate)
+	}
+
+	room.Game.BeginCombat()
+	room.Game.StartRound()
+	target := room.Game.Targets.Add()
+
+	postAs(t, ts, room, "", "/room/register", url.Values{"name": {"Bob"}})
+	var late string
+	for _, p := range room.Game.Players.GetList() {
+		if p.Name == "Bob" {
+			late = p.ID
+		}
+	}
+	if late == "" {
+		t.Fatal("late joiner was not registered")
+	}
+
+	if srv.processClick(room, late, target.ID, 3) {
+		t.Error("spectator click should be rejected")
+	}
+	if room.Game.Targets.Get(target.ID).Dead {
+		t.Error("spectator click should not kill the target")
+	}
+}
+
+func TestHostSettings_InvalidPolicy(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+
+	resp := postAs(t, ts, room, "host", "/room/host/settings", url.Values{"late_join": {"bogus"}})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
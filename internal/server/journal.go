@@ -0,0 +1,28 @@
+package server
+
+import (
+	"log/slog"
+	"time"
+)
+
+// journalPruneInterval is how often expired room journals are deleted.
+const journalPruneInterval = time.Hour
+
+// pruneJournals deletes room journals older than retention, once at start
+// and then every journalPruneInterval.
+func (s *Server) pruneJournals(retention time.Duration) {
+	ticker := time.NewTicker(journalPruneInterval)
+	defer ticker.Stop()
+	for {
+		n, err := s.journals().Prune(time.Now().Add(-retention))
+		if err != nil {
+			slog.Error("pruning room journals failed", "component", "journal", "error", err)
+		} else if n > 0 {
+			slog.Info("pruned room journals", "component", "journal", "journals", n)
+		}
+		if s.draining.Load() {
+			return
+		}
+		<-ticker.C
+	}
+}
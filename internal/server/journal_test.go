@@ -0,0 +1,55 @@
+package server
+
+import (
+	"clicktrainer/internal/events"
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/journal"
+	"clicktrainer/internal/snapshot"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal_ContinuesAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	journals, err := journal.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snaps := snapshot.NewFileStore(filepath.Join(dir, "rooms.json"))
+
+	before, beforeTS := newTestServer(t)
+	defer beforeTS.Close()
+	before.Journals, before.Snapshots = journals, snaps
+	room, _ := before.Rooms.Create("host")
+	room.Game.AddPlayer("host", "Alice")
+	room.Game.SetScene(gamedata.SceneCombat)
+	if err := before.Shutdown(context.Background(), nil); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+
+	after, afterTS := newTestServer(t)
+	defer afterTS.Close()
+	after.Journals, after.Snapshots = journals, snaps
+	after.restoreSnapshot()
+	if err := after.Shutdown(context.Background(), nil); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+
+	entries, err := journal.Read(journals, journal.ID(room.Code, room.CreatedAt))
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	var types []string
+	for _, e := range entries {
+		types = append(types, e.Event.Type())
+	}
+	last, ok := entries[len(entries)-1].Event.(events.SceneChanged)
+	if !ok || last.Scene != string(gamedata.SceneLobby) {
+		t.Fatalf("journal = %v, want it to end with the restored room going back to the lobby", types)
+	}
+	got := journal.Rebuild(entries, gamedata.Config{})
+	if p := got.Players.Get("host"); p == nil || p.Name != "Alice" {
+		t.Errorf("rebuilt players = %+v, want Alice", got.Players.GetList())
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"bytes"
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/players"
+	"clicktrainer/internal/rooms"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// idleSweepInterval is how often lobbies are checked for idle players.
+const idleSweepInterval = 5 * time.Second
+
+// checkLobby applies the room's start rules after a change in who is ready,
+// starting the round, arming the auto-start countdown or cancelling it.
+// Returns true if a round started.
+func (s *Server) checkLobby(room *rooms.Room) bool {
+	switch room.Game.LobbyAction() {
+	case gamedata.LobbyStartNow:
+		return s.startRound(room)
+	case gamedata.LobbyAutoStart:
+		delay := time.Duration(room.Game.LobbySettings().AutoStartSecs) * time.Second
+		epoch := room.Game.Epoch()
+		if _, armed := room.ArmAutoStart(delay, func() { s.fireAutoStart(room, epoch) }); armed {
+			slog.Info("auto-start armed", "room_code", room.Code, "delay", delay)
+			s.broadcastAutoStart(room)
+		}
+	default:
+		if room.CancelAutoStart() {
+			slog.Info("auto-start cancelled", "room_code", room.Code)
+			s.broadcastAutoStart(room)
+		}
+	}
+	return false
+}
+
+// fireAutoStart starts the round when the auto-start countdown runs out,
+// provided enough players are still ready and no round has come and gone
+// since it was armed.
+func (s *Server) fireAutoStart(room *rooms.Room, epoch uint64) {
+	if s.Rooms.Get(room.Code) != room || room.Game.Epoch() != epoch || room.Game.LobbyAction() == gamedata.LobbyWait {
+		s.broadcastAutoStart(room)
+		return
+	}
+	if s.startRound(room) {
+		slog.Info("round auto-started", "room_code", room.Code)
+	}
+}
+
+// broadcastAutoStart pushes the auto-start banner (or clears it) in every
+// lobby.
+func (s *Server) broadcastAutoStart(room *rooms.Room) {
+	var buf bytes.Buffer
+	if err := s.Tmpl.ExecuteTemplate(&buf, "autoStart", s.roomView(room, "")); err != nil {
+		slog.Error("template error", "handler", "auto_start", "error", err)
+		return
+	}
+	oob := fmt.Sprintf(`<div id="auto_start" hx-swap-oob="innerHTML">%s</div>`, buf.String())
+	room.Broadcaster.BroadcastOOB("swap", oob)
+}
+
+// broadcastLobbyStatus updates a player's ready/spectating label in every
+// lobby.
+func (s *Server) broadcastLobbyStatus(room *rooms.Room, p *players.Player) {
+	var buf bytes.Buffer
+	if err := s.Tmpl.ExecuteTemplate(&buf, "lobbyPlayerStatus", p); err != nil {
+		slog.Error("template error", "handler", "lobby_status", "error", err)
+		return
+	}
+	oob := fmt.Sprintf(`<div id="lobby_player_ready%s" hx-swap-oob="innerHTML">%s</div>`, p.ID, buf.String())
+	room.Broadcaster.BroadcastOOB("swap", oob)
+}
+
+// sweepIdleLobbies applies each lobby's idle action to players who haven't
+// done anything within its idle timeout.
+func (s *Server) sweepIdleLobbies(now time.Time) {
+	for _, room := range s.Rooms.List() {
+		ls := room.Game.LobbySettings()
+		if ls.IdleTimeoutSecs <= 0 || room.Game.Scene() != gamedata.SceneLobby {
+			continue
+		}
+		cutoff := now.Add(-time.Duration(ls.IdleTimeoutSecs) * time.Second)
+
+		changed := false
+		for _, p := range room.Game.Players.IdleSince(cutoff) {
+			var updated *players.Player
+			switch ls.IdleAction {
+			case gamedata.IdleUnready:
+				if p.Ready {
+					updated = room.Game.SetReady(p.ID, false)
+				}
+			case gamedata.IdleSpectate:
+				if !p.Ready {
+					updated = room.Game.Players.SetSpectator(p.ID, true)
+				}
+			}
+			if updated == nil {
+				continue
+			}
+			changed = true
+			slog.Info("idle player", "room_code", room.Code, "player_id", p.ID, "action", ls.IdleAction)
+			s.broadcastLobbyStatus(room, updated)
+		}
+		if changed {
+			s.checkLobby(room)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"clicktrainer/internal/gamedata"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestReady_AutoStartArmsAndCancels(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("a")
+	room.Game.SetLobbySettings(gamedata.LobbySettings{MinPlayers: 2, AutoStartPercent: 50, AutoStartSecs: 60})
+	room.Game.Players.Add("a", "Alice")
+	room.Game.Players.Add("b", "Bob")
+	room.Game.Players.Add("c", "Carol")
+
+	postAs(t, ts, room, "a", "/room/ready", url.Values{"ready": {"ready"}})
+	if !room.AutoStartAt().IsZero() {
+		t.Fatal("1/3 ready should not arm the auto-start")
+	}
+
+	postAs(t, ts, room, "b", "/room/ready", url.Values{"ready": {"ready"}})
+	if room.AutoStartAt().IsZero() {
+		t.Fatal("2/3 ready should arm the auto-start")
+	}
+	if room.Game.Scene() != gamedata.SceneLobby {
+		t.Fatal("auto-start should not start the round immediately")
+	}
+
+	postAs(t, ts, room, "b", "/room/ready", url.Values{"ready": {"wait"}})
+	if !room.AutoStartAt().IsZero() {
+		t.Error("un-readying below the threshold should cancel the auto-start")
+	}
+}
+
+func TestReady_AutoStartFires(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("a")
+	room.Game.SetLobbySettings(gamedata.LobbySettings{AutoStartPercent: 50})
+	room.Game.Players.Add("a", "Alice")
+	room.Game.Players.Add("b", "Bob")
+
+	// AutoStartSecs is zero, so the countdown fires straight away.
+	postAs(t, ts, room, "a", "/room/ready", url.Values{"ready": {"ready"}})
+
+	deadline := time.Now().Add(time.Second)
+	for room.Game.Scene() != gamedata.SceneCombat && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if room.Game.Scene() != gamedata.SceneCombat {
+		t.Errorf("scene = %q, want %q", room.Game.Scene(), gamedata.SceneCombat)
+	}
+}
+
+func TestReady_MinPlayers(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("a")
+	room.Game.SetLobbySettings(gamedata.LobbySettings{MinPlayers: 2})
+	room.Game.Players.Add("a", "Alice")
+
+	postAs(t, ts, room, "a", "/room/ready", url.Values{"ready": {"ready"}})
+	if room.Game.Scene() != gamedata.SceneLobby {
+		t.Errorf("scene = %q, want lobby below the minimum player count", room.Game.Scene())
+	}
+}
+
+func TestSweepIdleLobbies(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("a")
+	room.Game.SetLobbySettings(gamedata.LobbySettings{IdleTimeoutSecs: 60, IdleAction: gamedata.IdleSpectate})
+	room.Game.Players.Add("a", "Alice")
+	room.Game.Players.Add("b", "Bob")
+	room.Game.Players.SetReady("a", true)
+
+	srv.sweepIdleLobbies(time.Now())
+	if room.Game.Players.Get("b").Spectator {
+		t.Fatal("player should not be idle before the timeout")
+	}
+
+	// Bob never readied up; once idle he no longer blocks Alice.
+	srv.sweepIdleLobbies(time.Now().Add(2 * time.Minute))
+	if !room.Game.Players.Get("b").Spectator {
+		t.Error("idle unready player should be moved to spectators")
+	}
+	if room.Game.Players.Get("a").Spectator {
+		t.Error("ready player should not be moved to spectators")
+	}
+	if room.Game.Scene() != gamedata.SceneCombat {
+		t.Errorf("scene = %q, want round to start once the idle player is out", room.Game.Scene())
+	}
+}
+
+func TestSweepIdleLobbies_Unready(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("a")
+	room.Game.SetLobbySettings(gamedata.LobbySettings{MinPlayers: 3, IdleTimeoutSecs: 60, IdleAction: gamedata.IdleUnready})
+	room.Game.Players.Add("a", "Alice")
+	room.Game.Players.Add("b", "Bob")
+	room.Game.Players.SetReady("a", true)
+
+	srv.sweepIdleLobbies(time.Now().Add(2 * time.Minute))
+	if room.Game.Players.Get("a").Ready {
+		t.Error("idle ready player should be un-readied")
+	}
+}
+
+func TestHostSettings_Lobby(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+
+	resp := postAs(t, ts, room, "host", "/room/host/settings", url.Values{
+		"min_players": {"4"},
+		"auto_start":  {"50"},
+		"idle_action": {"unready"},
+	})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	ls := room.Game.LobbySettings()
+	if ls.MinPlayers != 4 || ls.AutoStartPercent != 50 || ls.IdleAction != gamedata.IdleUnready {
+		t.Errorf("lobby settings = %+v, want min 4, auto-start 50, idle unready", ls)
+	}
+
+	for _, form := range []url.Values{
+		{"min_players": {"0"}},
+		{"auto_start": {"150"}},
+		{"idle_action": {"kick"}},
+	} {
+		resp := postAs(t, ts, room, "host", "/room/host/settings", form)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, want %d", form, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+	if got := room.Game.LobbySettings(); got != ls {
+		t.Errorf("invalid settings changed the room: %+v", got)
+	}
+}
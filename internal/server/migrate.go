@@ -0,0 +1,90 @@
+package server
+
+import (
+	"clicktrainer/internal/config"
+	"clicktrainer/internal/db"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = "usage: migrate [status | up | down [steps]]"
+
+// Migrate runs the migrate command on the database the server is configured
+// with: status lists migrations, up applies pending ones, and down undoes
+// the latest (one unless steps says otherwise).
+func Migrate(args []string, out io.Writer) error {
+	appCfg := config.Load()
+	var m *db.Migrator
+	switch {
+	case appCfg.DatabaseURL != "":
+		database, err := db.Connect(appCfg.DatabaseURL)
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+		if m, err = database.Migrator(); err != nil {
+			return err
+		}
+	case appCfg.SQLitePath != "":
+		database, err := db.OpenSQLite(appCfg.SQLitePath)
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+		if m, err = database.Migrator(); err != nil {
+			return err
+		}
+	default:
+		return errors.New("set DATABASE_URL or SQLITE_PATH to migrate")
+	}
+
+	cmd := "status"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	switch {
+	case cmd == "status" && len(args) <= 1:
+		return printMigrations(m, out)
+	case cmd == "up" && len(args) == 1:
+		return m.Up()
+	case cmd == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("steps must be a positive number\n%s", migrateUsage)
+			}
+			steps = n
+		}
+		return m.Down(steps)
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+func printMigrations(m *db.Migrator, out io.Writer) error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, st := range statuses {
+		state, appliedAt := "pending", ""
+		if st.AppliedAt != nil {
+			state, appliedAt = "applied", st.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		switch {
+		case st.Modified:
+			state = "modified"
+		case st.Unknown:
+			state = "unknown"
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", st.Version, st.Name, state, appliedAt)
+	}
+	return w.Flush()
+}
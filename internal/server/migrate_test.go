@@ -0,0 +1,52 @@
+package server
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrate_Command(t *testing.T) {
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "clicktrainer.db"))
+
+	status := func() string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := Migrate([]string{"status"}, &out); err != nil {
+			t.Fatalf("migrate status: %v", err)
+		}
+		return out.String()
+	}
+
+	if s := status(); !strings.Contains(s, "001") || !strings.Contains(s, "pending") {
+		t.Errorf("status before up:\n%s\nwant the first migration pending", s)
+	}
+	if err := Migrate([]string{"up"}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if s := status(); strings.Contains(s, "pending") || !strings.Contains(s, "applied") {
+		t.Errorf("status after up:\n%s\nwant every migration applied", s)
+	}
+	if err := Migrate([]string{"down"}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if s := status(); !strings.Contains(s, "pending") {
+		t.Errorf("status after down:\n%s\nwant the last migration pending again", s)
+	}
+
+	for _, args := range [][]string{{"sideways"}, {"down", "0"}, {"up", "extra"}} {
+		if err := Migrate(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("migrate %v should fail", args)
+		}
+	}
+}
+
+func TestMigrate_NeedsDatabase(t *testing.T) {
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("SQLITE_PATH", "")
+	if err := Migrate([]string{"status"}, &bytes.Buffer{}); err == nil {
+		t.Error("migrate without a database should fail")
+	}
+}
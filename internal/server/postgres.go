@@ -0,0 +1,92 @@
+package server
+
+import (
+	"clicktrainer/internal/config"
+	"clicktrainer/internal/db"
+	"clicktrainer/internal/fanout"
+	"clicktrainer/internal/journal"
+	"clicktrainer/internal/rooms"
+	"clicktrainer/internal/snapshot"
+	"clicktrainer/internal/webhooks"
+	"log/slog"
+	"time"
+)
+
+func (s *Server) snapshots() snapshot.Store {
+	s.pgMu.RLock()
+	defer s.pgMu.RUnlock()
+	return s.Snapshots
+}
+
+func (s *Server) journals() journal.Store {
+	s.pgMu.RLock()
+	defer s.pgMu.RUnlock()
+	return s.Journals
+}
+
+func (s *Server) fanout() fanout.Backend {
+	s.pgMu.RLock()
+	defer s.pgMu.RUnlock()
+	return s.Fanout
+}
+
+// usePostgres moves what only runs on PostgreSQL onto pg the first time it
+// attaches, whether at startup or after an outage: webhook endpoints, the
+// shared room directory and room messages, journals and snapshots, unless
+// JOURNAL_DIR or SNAPSHOT_FILE keep those on disk.
+func (s *Server) usePostgres(pg *db.DB, appCfg config.Config) {
+	s.pgOnce.Do(func() {
+		if s.Webhooks != nil {
+			if err := s.Webhooks.SetStore(webhooks.NewPGStore(pg)); err != nil {
+				slog.Error("moving webhooks to the database failed, keeping them in memory", "component", "webhooks", "error", err)
+			}
+		}
+
+		// Rooms relay their messages from the moment they open, so the
+		// fan-out comes before the directory lets rooms be created.
+		if appCfg.InstanceURL != "" {
+			s.pgMu.Lock()
+			s.Fanout = fanout.NewPG(pg, appCfg.DatabaseURL)
+			s.pgMu.Unlock()
+			s.Rooms.SetDirectory(rooms.NewPGDirectory(pg), rooms.Instance{ID: appCfg.InstanceID, URL: appCfg.InstanceURL})
+			slog.Info("sharing rooms through the database", "component", "rooms", "instance", appCfg.InstanceID, "url", appCfg.InstanceURL)
+		}
+
+		if appCfg.JournalDir == "" {
+			s.pgMu.Lock()
+			s.Journals = journal.NewPGStore(pg)
+			s.pgMu.Unlock()
+			s.startJournals(appCfg)
+		}
+
+		switch {
+		case appCfg.SnapshotFile == "":
+			s.pgMu.Lock()
+			s.Snapshots = snapshot.NewPGStore(pg)
+			s.pgMu.Unlock()
+			s.startSnapshots(appCfg)
+		case appCfg.InstanceURL != "":
+			// The file's rooms waited for the directory to claim their codes.
+			s.startSnapshots(appCfg)
+		}
+	})
+}
+
+// startJournals prunes old journals in the background, if they expire.
+func (s *Server) startJournals(appCfg config.Config) {
+	if s.journals() != nil && appCfg.JournalDays > 0 {
+		go s.pruneJournals(time.Duration(appCfg.JournalDays) * 24 * time.Hour)
+	}
+}
+
+// startSnapshots restores the rooms saved before the last shutdown and
+// snapshots rooms from then on.
+func (s *Server) startSnapshots(appCfg config.Config) {
+	if s.snapshots() == nil {
+		return
+	}
+	s.restoreSnapshot()
+	if appCfg.SnapshotSecs > 0 {
+		go s.snapshotLoop(time.Duration(appCfg.SnapshotSecs) * time.Second)
+	}
+}
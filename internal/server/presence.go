@@ -0,0 +1,64 @@
+package server
+
+import (
+	"clicktrainer/internal/rooms"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// presenceAwayAfter is how long a player may be without any connection
+// before the lobby shows them as away. Short enough to be useful, long
+// enough to ride out a page reload.
+const presenceAwayAfter = 3 * time.Second
+
+// presenceConfig wires room presence tracking to the server's handlers.
+func (s *Server) presenceConfig(grace time.Duration) rooms.PresenceConfig {
+	return rooms.PresenceConfig{
+		AwayAfter:   presenceAwayAfter,
+		RemoveAfter: grace,
+		Away:        s.onPlayerAway,
+		Back:        s.onPlayerBack,
+		Expired:     s.onPlayerExpired,
+	}
+}
+
+func (s *Server) onPlayerAway(room *rooms.Room, playerID string) {
+	if room.Game.Players.SetAway(playerID, true) == nil {
+		return
+	}
+	slog.Info("player away", "room_code", room.Code, "player_id", playerID)
+	s.broadcastAway(room, playerID, true)
+
+	// An away player no longer holds up the rest of the lobby.
+	s.checkLobby(room)
+}
+
+func (s *Server) onPlayerBack(room *rooms.Room, playerID string) {
+	if room.Game.Players.SetAway(playerID, false) == nil {
+		return
+	}
+	slog.Info("player back", "room_code", room.Code, "player_id", playerID)
+	s.broadcastAway(room, playerID, false)
+	s.checkLobby(room)
+}
+
+func (s *Server) onPlayerExpired(room *rooms.Room, playerID string) {
+	// The room may have been deleted (and its code reused) since the timer
+	// was armed.
+	if s.Rooms.Get(room.Code) != room || room.Game.Players.Get(playerID) == nil {
+		return
+	}
+	slog.Info("player removed after disconnect", "room_code", room.Code, "player_id", playerID)
+	s.removePlayer(room, playerID)
+}
+
+// broadcastAway updates the player's away marker in every lobby.
+func (s *Server) broadcastAway(room *rooms.Room, playerID string, away bool) {
+	label := ""
+	if away {
+		label = "away"
+	}
+	oob := fmt.Sprintf(`<div id="lobby_player_away%s" hx-swap-oob="innerHTML">%s</div>`, playerID, label)
+	room.Broadcaster.BroadcastOOB("swap", oob)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPresence_RemovesDisconnectedPlayer(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	srv.Rooms.SetPresence(srv.presenceConfig(50 * time.Millisecond))
+
+	room, _ := srv.Rooms.Create("")
+	room.Game.Players.Add("host", "Alice")
+	room.ClaimHost("host")
+
+	// Bob registers but never opens an event stream.
+	postAs(t, ts, room, "", "/room/register", url.Values{"name": {"Bob"}})
+	if room.Game.Players.Count() != 2 {
+		t.Fatalf("player count = %d, want 2", room.Game.Players.Count())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for room.Game.Players.Count() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if room.Game.Players.Count() != 1 {
+		t.Errorf("player count = %d, want 1 after grace period", room.Game.Players.Count())
+	}
+}
+
+func TestPresence_EventStreamKeepsPlayer(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	srv.Rooms.SetPresence(srv.presenceConfig(50 * time.Millisecond))
+
+	room, _ := srv.Rooms.Create("")
+	room.Game.Players.Add("p1", "Alice")
+	room.Presence.Track("p1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/room/events", nil)
+	req.AddCookie(&http.Cookie{Name: "room_code", Value: room.Code})
+	req.AddCookie(&http.Cookie{Name: "player_id", Value: "p1"})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	if room.Game.Players.Get("p1") == nil {
+		t.Error("connected player should not be removed")
+	}
+
+	cancel()
+	resp.Body.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for room.Game.Players.Get("p1") != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if room.Game.Players.Get("p1") != nil {
+		t.Error("player should be removed after disconnecting")
+	}
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"bytes"
+	"clicktrainer/internal/analytics"
+	"clicktrainer/internal/events"
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/players"
+	"clicktrainer/internal/rooms"
+	"clicktrainer/internal/round"
+	"clicktrainer/internal/targets"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// startRound moves the room from the lobby into combat and hands the round
+// to the room's controller. Returns false if the room was not in the lobby.
+func (s *Server) startRound(room *rooms.Room) bool {
+	if !room.Game.BeginCombat() {
+		return false
+	}
+	room.CancelAutoStart()
+	if s.Metrics != nil {
+		s.Metrics.GamesStartedTotal.Inc()
+	}
+
+	if !room.Round.Start() {
+		slog.Error("round controller busy", "room_code", room.Code)
+	}
+	return true
+}
+
+// countdownView is the template data for the pre-round countdown. A zero
+// EndsAt means the countdown is paused.
+type countdownView struct {
+	Secs   int
+	EndsAt int64 // Unix ms
+}
+
+func newCountdownView(endsAt time.Time, ok bool) countdownView {
+	if !ok {
+		return countdownView{}
+	}
+	secs := int((time.Until(endsAt) + time.Second - 1) / time.Second)
+	return countdownView{Secs: max(secs, 0), EndsAt: endsAt.UnixMilli()}
+}
+
+// roundHooks connects a room's round controller to the server's broadcasts
+// and persistence.
+type roundHooks struct {
+	s    *Server
+	room *rooms.Room
+}
+
+// roundHooksFor builds the controller hooks for a newly created room.
+func (s *Server) roundHooksFor(room *rooms.Room) round.Hooks {
+	return &roundHooks{s: s, room: room}
+}
+
+// CountdownStarted shows the countdown overlay once; clients count it down
+// against the deadline.
+func (h *roundHooks) CountdownStarted(endsAt time.Time) {
+	var buf bytes.Buffer
+	if err := h.s.Tmpl.ExecuteTemplate(&buf, "lobbyCountdown", newCountdownView(endsAt, true)); err != nil {
+		slog.Error("template error", "handler", "countdown", "error", err)
+	}
+	countdownOOB := fmt.Sprintf(`<div id="lobby" hx-swap-oob="afterend">%s</div>`, buf.String())
+	h.room.Broadcaster.BroadcastOOB("swap", countdownOOB)
+}
+
+func (h *roundHooks) RoundStarting() {
+	s, room := h.s, h.room
+	// Create game record in DB before starting round so gameID is available for clicks
+	if database := s.database(); database != nil {
+		gameID, err := database.CreateGame(room.Code, room.Host(), room.Game.Config.RoundDuration*1000)
+		if err != nil {
+			slog.Error("CreateGame failed", "room_code", room.Code, "error", err)
+			if s.Metrics != nil {
+				s.Metrics.DBWriteErrorsTotal.WithLabelValues("create_game").Inc()
+			}
+		} else {
+			room.Game.SetCurrentGameID(gameID)
+			if err := database.SetLayoutSeed(gameID, room.Game.LayoutSeed()); err != nil {
+				slog.Error("SetLayoutSeed failed", "game_id", gameID, "error", err)
+				if s.Metrics != nil {
+					s.Metrics.DBWriteErrorsTotal.WithLabelValues("set_layout_seed").Inc()
+				}
+			}
+		}
+	}
+}
+
+func (h *roundHooks) RoundStarted() {
+	data := h.s.roomView(h.room, h.room.Host())
+	var gameBuf bytes.Buffer
+	if err := h.s.Tmpl.ExecuteTemplate(&gameBuf, "gameContent", data); err != nil {
+		slog.Error("template error", "handler", "start_round", "error", err)
+		return
+	}
+	gameOOB := fmt.Sprintf(`<div id="scene" hx-swap-oob="innerHTML">%s</div>`, gameBuf.String())
+	h.room.Broadcaster.BroadcastOOB("swap", gameOOB)
+}
+
+func (h *roundHooks) TargetSpawned(t *targets.Target) {
+	h.room.Tick.Spawn(t)
+}
+
+// PauseChanged shows or hides the pause overlay and re-sends whichever
+// deadline is affected: frozen while paused, pushed back on resume.
+func (h *roundHooks) PauseChanged(paused bool) {
+	var buf bytes.Buffer
+	if err := h.s.Tmpl.ExecuteTemplate(&buf, "roundPause", paused); err != nil {
+		slog.Error("template error", "handler", "round_pause", "error", err)
+	}
+	oob := fmt.Sprintf(`<div id="round_pause" hx-swap-oob="innerHTML">%s</div>`, buf.String())
+
+	buf.Reset()
+	if h.room.Round.Phase() == round.PhaseCountdown {
+		if err := h.s.Tmpl.ExecuteTemplate(&buf, "countdownNum", newCountdownView(h.room.Round.CountdownEndsAt())); err != nil {
+			slog.Error("template error", "handler", "round_pause", "error", err)
+		}
+		oob += fmt.Sprintf(`<span id="countdown_slot" hx-swap-oob="innerHTML">%s</span>`, buf.String())
+	} else {
+		if err := h.s.Tmpl.ExecuteTemplate(&buf, "timer", h.s.roomView(h.room, "")); err != nil {
+			slog.Error("template error", "handler", "round_pause", "error", err)
+		}
+		oob += fmt.Sprintf(`<div id="timer_slot" hx-swap-oob="innerHTML">%s</div>`, buf.String())
+	}
+
+	h.room.Broadcaster.BroadcastOOB("swap", oob)
+	h.room.Broadcaster.BroadcastOOB("roomUpdate", h.room.Host())
+}
+
+func (h *roundHooks) RoundEnded(rankings []*players.Player) {
+	s, room := h.s, h.room
+	if s.Metrics != nil {
+		s.Metrics.GamesCompletedTotal.Inc()
+		s.Metrics.GameDurationSeconds.Observe(float64(room.Game.Config.RoundDuration))
+	}
+
+	// Flush pending clicks before persisting game results
+	s.flushClickBuffer()
+	s.persistResults(room, rankings)
+
+	// Send the round's last updates before the recap replaces the board.
+	room.Tick.Flush()
+	var buf bytes.Buffer
+	if err := s.Tmpl.ExecuteTemplate(&buf, "recap", room.Game.Recap()); err != nil {
+		slog.Error("template error", "handler", "round_ended", "error", err)
+		return
+	}
+	recapOOB := fmt.Sprintf(`<div id="scene" hx-swap-oob="innerHTML">%s</div>`, buf.String())
+	room.Broadcaster.BroadcastOOB("swap", recapOOB)
+}
+
+// persistResults records the finished game and awards badges.
+func (s *Server) persistResults(room *rooms.Room, rankings []*players.Player) {
+	database := s.database()
+	if database == nil {
+		return
+	}
+	gameID := room.Game.CurrentGameID()
+	if gameID == "" {
+		return
+	}
+	q := analytics.NewQueries(database)
+	// Read standings before this game is recorded so improvements can be
+	// reported afterwards.
+	topBefore, leaderboardErr := q.GetLeaderboard("score", leaderboardWatchSize)
+	if leaderboardErr != nil {
+		slog.Error("GetLeaderboard failed", "game_id", gameID, "error", leaderboardErr)
+	}
+	previousBest := make(map[string]int)
+	for _, p := range rankings {
+		if stats, err := q.GetPlayerLifetimeStats(p.ID); err == nil && stats.GamesPlayed > 0 {
+			previousBest[p.ID] = stats.BestGame
+		}
+	}
+
+	if err := database.EndGame(gameID); err != nil {
+		slog.Error("EndGame failed", "game_id", gameID, "error", err)
+		if s.Metrics != nil {
+			s.Metrics.DBWriteErrorsTotal.WithLabelValues("end_game").Inc()
+		}
+	}
+	for i, p := range rankings {
+		if err := database.AddGamePlayer(gameID, p.ID, p.Score, i+1, p.LateJoin); err != nil {
+			slog.Error("AddGamePlayer failed", "game_id", gameID, "player_id", p.ID, "error", err)
+			if s.Metrics != nil {
+				s.Metrics.DBWriteErrorsTotal.WithLabelValues("add_game_player").Inc()
+			}
+			continue
+		}
+		if prev, ok := previousBest[p.ID]; ok && p.Score > prev {
+			room.Game.Events.Publish(events.PersonalBest{PlayerID: p.ID, Name: p.Name, Score: p.Score, Previous: prev, GameID: gameID})
+		}
+	}
+	// Spectators are recorded without a placement, so the game shows who
+	// watched it.
+	for _, p := range room.Game.Spectators() {
+		if err := database.AddGamePlayer(gameID, p.ID, 0, 0, string(gamedata.LateJoinSpectate)); err != nil {
+			slog.Error("AddGamePlayer failed", "game_id", gameID, "player_id", p.ID, "error", err)
+			if s.Metrics != nil {
+				s.Metrics.DBWriteErrorsTotal.WithLabelValues("add_game_player").Inc()
+			}
+		}
+	}
+	if leaderboardErr == nil {
+		s.publishLeaderboardChange(room, q, topBefore)
+	}
+	// Award badges
+	for _, p := range rankings {
+		gameStats, err := q.GetPlayerGameStats(gameID, p.ID)
+		if err != nil {
+			slog.Error("GetPlayerGameStats failed", "game_id", gameID, "player_id", p.ID, "error", err)
+			continue
+		}
+		gameBadges := analytics.EvaluateGameBadges(*gameStats)
+		for _, b := range gameBadges {
+			gID := gameID
+			if err := database.AwardBadge(p.ID, string(b.ID), &gID); err != nil {
+				slog.Error("AwardBadge failed", "player_id", p.ID, "error", err)
+				if s.Metrics != nil {
+					s.Metrics.DBWriteErrorsTotal.WithLabelValues("award_badge").Inc()
+				}
+				continue
+			}
+			room.Game.Events.Publish(events.BadgeAwarded{PlayerID: p.ID, BadgeID: string(b.ID), GameID: gameID})
+		}
+		// Check lifetime badges
+		lifeStats, err := q.GetPlayerLifetimeStats(p.ID)
+		if err == nil {
+			lifeBadges := analytics.EvaluateLifetimeBadges(*lifeStats)
+			for _, b := range lifeBadges {
+				if err := database.AwardBadge(p.ID, string(b.ID), nil); err != nil {
+					slog.Error("AwardBadge failed", "player_id", p.ID, "error", err)
+					if s.Metrics != nil {
+						s.Metrics.DBWriteErrorsTotal.WithLabelValues("award_badge").Inc()
+					}
+					continue
+				}
+				room.Game.Events.Publish(events.BadgeAwarded{PlayerID: p.ID, BadgeID: string(b.ID)})
+			}
+		}
+	}
+}
+
+// leaderboardWatchSize is how many places of the score leaderboard are
+// watched for changes.
+const leaderboardWatchSize = 10
+
+// publishLeaderboardChange publishes the score leaderboard if its top places
+// are held by different players, or in a different order, than before.
+func (s *Server) publishLeaderboardChange(room *rooms.Room, q *analytics.Queries, before []analytics.LeaderboardEntry) {
+	after, err := q.GetLeaderboard("score", leaderboardWatchSize)
+	if err != nil {
+		slog.Error("GetLeaderboard failed", "room_code", room.Code, "error", err)
+		return
+	}
+	same := len(before) == len(after)
+	for i := 0; same && i < len(after); i++ {
+		same = before[i].PlayerID == after[i].PlayerID
+	}
+	if same {
+		return
+	}
+	top := make([]events.Standing, len(after))
+	for i, e := range after {
+		top[i] = events.Standing{Rank: e.Rank, PlayerID: e.PlayerID, Name: e.PlayerName, Value: e.Value}
+	}
+	room.Game.Events.Publish(events.LeaderboardChanged{Category: "score", Top: top})
+}
+
+func (s *Server) handleHostRoundControls(w http.ResponseWriter, r *http.Request) {
+	room := s.getRoom(r)
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusBadRequest)
+		return
+	}
+	idCookie, err := r.Cookie("player_id")
+	if err != nil || !room.IsHost(idCookie.Value) {
+		// Non-hosts get no controls.
+		return
+	}
+	if err := s.Tmpl.ExecuteTemplate(w, "hostRoundControls", room.Round.Paused()); err != nil {
+		slog.Error("template error", "handler", "host_round_controls", "error", err)
+	}
+}
+
+func (s *Server) handleHostPause(w http.ResponseWriter, r *http.Request) {
+	room, hostID, ok := s.requireHost(w, r)
+	if !ok {
+		return
+	}
+	paused := r.FormValue("paused") == "true"
+
+	var changed bool
+	if paused {
+		changed = room.Round.Pause()
+	} else {
+		changed = room.Round.Resume()
+	}
+	if !changed {
+		http.Error(w, "No round to pause or resume", http.StatusConflict)
+		return
+	}
+
+	slog.Info("round pause changed", "handler", "host_pause", "room_code", room.Code, "host_id", hostID, "paused", paused)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleClock reports the server time so clients can estimate their clock
+// offset and render deadlines locally.
+func (s *Server) handleClock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `{"now":%d}`, time.Now().UnixMilli())
+}
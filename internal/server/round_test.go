@@ -0,0 +1,199 @@
+package server
+
+import (
+	"clicktrainer/internal/db"
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/round"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitPhase polls until the room's round controller reaches phase.
+func waitPhase(t *testing.T, c *round.Controller, phase round.Phase) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for c.Phase() != phase && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c.Phase() != phase {
+		t.Fatalf("phase = %d, want %d", c.Phase(), phase)
+	}
+}
+
+func TestPersistResults_RecordsSpectators(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	database, err := db.OpenSQLite(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite() error: %v", err)
+	}
+	srv.DB = db.NewSupervisor(func() (db.Store, error) { return database, nil }, db.SupervisorOptions{
+		OnAttach: func(s db.Store) error { return s.Migrate() },
+	})
+	srv.DB.Start()
+	defer srv.DB.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.Players.Add("late", "Bob")
+	room.Game.Players.MarkLateJoin("late", string(gamedata.LateJoinSpectate), true, 0)
+	for _, p := range room.Game.Players.GetList() {
+		if err := database.UpsertPlayer(p.ID, p.Name, p.Color); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gameID, err := database.CreateGame(room.Code, "host", 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	room.Game.SetCurrentGameID(gameID)
+
+	srv.persistResults(room, room.Game.Recap().Rankings)
+
+	rows, err := database.Query(`SELECT player_id, rank, COALESCE(late_join_policy, '') FROM game_players WHERE game_id = $1 ORDER BY rank`, gameID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type row struct {
+		player string
+		rank   int
+		policy string
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.player, &r.rank, &r.policy); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	want := []row{{"late", 0, "spectate"}, {"host", 1, ""}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("game_players = %+v, want the spectator unplaced and marked, then the winner", got)
+	}
+}
+
+func TestPlayAgain_MidRound(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	srv.startRound(room)
+	waitPhase(t, room.Round, round.PhaseRunning)
+
+	// Play-again is for the recap; mid-round it is refused and the round
+	// carries on.
+	resp := postAs(t, ts, room, "host", "/room/play-again", nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("play-again mid-round: status = %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+	if room.Game.Scene() != gamedata.SceneCombat || room.Round.Phase() != round.PhaseRunning {
+		t.Fatalf("scene %q, phase %d after a refused play-again, want the round still running", room.Game.Scene(), room.Round.Phase())
+	}
+
+	// Going back to the lobby anyway abandons the round, so the next one
+	// can start.
+	room.Game.ResetToLobby()
+	waitPhase(t, room.Round, round.PhaseIdle)
+	if !srv.startRound(room) {
+		t.Fatal("a new round should start after the room went back to the lobby")
+	}
+	waitPhase(t, room.Round, round.PhaseRunning)
+}
+
+func TestHostPause(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.Players.Add("p2", "Bob")
+
+	resp := postAs(t, ts, room, "host", "/room/host/pause", url.Values{"paused": {"true"}})
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("pause with no round: status = %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+
+	srv.startRound(room)
+	waitPhase(t, room.Round, round.PhaseRunning)
+
+	resp = postAs(t, ts, room, "p2", "/room/host/pause", url.Values{"paused": {"true"}})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("non-host pause: status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	resp = postAs(t, ts, room, "host", "/room/host/pause", url.Values{"paused": {"true"}})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("pause: status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if !room.Round.Paused() {
+		t.Fatal("round should be paused")
+	}
+
+	target := room.Game.Targets.GetList()[0]
+	if srv.processClick(room, "p2", target.ID, 3) {
+		t.Error("clicks should be rejected while paused")
+	}
+
+	postAs(t, ts, room, "host", "/room/host/pause", url.Values{"paused": {"false"}})
+	if room.Round.Paused() {
+		t.Error("round should be resumed")
+	}
+	if !srv.processClick(room, "p2", target.ID, 3) {
+		t.Error("clicks should count after resuming")
+	}
+}
+
+func TestRoundStopsWhenRoomEmpties(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.ClaimHost("host")
+
+	srv.startRound(room)
+	waitPhase(t, room.Round, round.PhaseRunning)
+
+	postAs(t, ts, room, "host", "/room/leave", nil)
+
+	select {
+	case <-room.Round.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("round should stop once the room is deleted")
+	}
+	if srv.Rooms.Get(room.Code) != nil {
+		t.Error("empty room should be deleted")
+	}
+}
+
+func TestClock(t *testing.T) {
+	_, ts := newTestServer(t)
+	defer ts.Close()
+
+	before := time.Now().UnixMilli()
+	resp, err := http.Get(ts.URL + "/clock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if cc := resp.Header.Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want %q", cc, "no-store")
+	}
+	var body struct {
+		Now int64 `json:"now"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Now < before || body.Now > time.Now().UnixMilli() {
+		t.Errorf("now = %d, want between %d and the response time", body.Now, before)
+	}
+}
@@ -2,17 +2,25 @@ package server
 
 import (
 	"bufio"
+	"clicktrainer/internal/clickspool"
 	"clicktrainer/internal/config"
 	"clicktrainer/internal/db"
 	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/journal"
 	"clicktrainer/internal/metrics"
 	"clicktrainer/internal/rooms"
+	"clicktrainer/internal/snapshot"
+	"clicktrainer/internal/webhooks"
+	"context"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"text/template"
 	"time"
 
@@ -22,54 +30,190 @@ import (
 func Run() error {
 	appCfg := config.Load()
 
+	lateJoin, ok := gamedata.ParseLateJoinPolicy(appCfg.LateJoinPolicy)
+	if !ok {
+		slog.Warn("unknown LATE_JOIN_POLICY, using normal", "value", appCfg.LateJoinPolicy)
+		lateJoin = gamedata.LateJoinNormal
+	}
+	idleAction, ok := gamedata.ParseIdleAction(appCfg.LobbyIdleAction)
+	if !ok {
+		slog.Warn("unknown LOBBY_IDLE_ACTION, using spectate", "value", appCfg.LobbyIdleAction)
+		idleAction = gamedata.IdleSpectate
+	}
 	gameCfg := gamedata.Config{
 		RoundDuration:  appCfg.RoundDuration,
 		InitialTargets: 3,
 		CountdownSecs:  3,
+		LateJoin:       lateJoin,
+		Lobby: gamedata.LobbySettings{
+			MinPlayers:       appCfg.LobbyMinPlayers,
+			AutoStartPercent: appCfg.AutoStartPercent,
+			AutoStartSecs:    appCfg.AutoStartSecs,
+			IdleTimeoutSecs:  appCfg.LobbyIdleTimeout,
+			IdleAction:       idleAction,
+		},
 	}
 	roomStore := rooms.NewStore(gameCfg)
 
 	m := metrics.New()
 
-	funcMap := template.FuncMap{
-		"inc": func(i int) int { return i + 1 },
-	}
-	tmpl := template.Must(template.New("").Funcs(funcMap).ParseFiles(
-		"templates/home.html",
-		"templates/game.html",
-		"templates/join.html",
-		"templates/target.html",
-		"templates/lobby.html",
-		"templates/recap.html",
-		"templates/analytics/dashboard.html",
-		"templates/analytics/leaderboard.html",
-		"templates/analytics/player.html",
-		"templates/analytics/game.html",
-	))
+	tmpl := template.Must(parseTemplates("templates"))
 
 	srv := &Server{
-		Rooms:   roomStore,
-		Tmpl:    tmpl,
-		Metrics: m,
+		Rooms:       roomStore,
+		Tmpl:        tmpl,
+		Metrics:     m,
+		AdminToken:  appCfg.AdminToken,
+		RoomForward: appCfg.RoomForward,
 	}
+	roomStore.SetRoundHooks(srv.roundHooksFor)
+	roomStore.SetOnCreate(srv.onRoomCreated)
+	roomStore.SetTick(appCfg.TickRate, srv.tickFlushFor)
+	roomStore.SetPresence(srv.presenceConfig(time.Duration(appCfg.PresenceGrace) * time.Second))
+	roomStore.SetExpiry(srv.expiryConfig(time.Duration(appCfg.RoomIdleTTL)*time.Minute, time.Duration(appCfg.RoomExpiryWarn)*time.Second))
 
-	// Optional database connection
-	if appCfg.DatabaseURL != "" {
-		database, err := db.Connect(appCfg.DatabaseURL)
+	// Optional database: PostgreSQL at DATABASE_URL, or else a SQLite file
+	// at SQLITE_PATH for a single binary. SQLite keeps the record of play for
+	// analytics; the rest of what follows needs PostgreSQL. A database that
+	// can't be reached is retried in the background and attached once it
+	// answers, and detached again while it is away; rooms carry on either
+	// way.
+	var open func() (db.Store, error)
+	switch {
+	case appCfg.DatabaseURL != "":
+		open = func() (db.Store, error) {
+			database, err := db.Connect(appCfg.DatabaseURL)
+			if err != nil {
+				return nil, err
+			}
+			return database, nil
+		}
+	case appCfg.SQLitePath != "":
+		open = func() (db.Store, error) {
+			database, err := db.OpenSQLite(appCfg.SQLitePath)
+			if err != nil {
+				return nil, err
+			}
+			return database, nil
+		}
+	default:
+		slog.Info("DATABASE_URL and SQLITE_PATH not set, running without database", "component", "db")
+	}
+	if open != nil {
+		// The click writer retries spooled clicks as soon as the database
+		// is back rather than when its backoff runs out.
+		clicksWake := make(chan struct{}, 1)
+		srv.DB = db.NewSupervisor(open, db.SupervisorOptions{
+			OnAttach: func(database db.Store) error {
+				if err := database.Migrate(); err != nil {
+					return fmt.Errorf("migrating database: %w", err)
+				}
+				if err := srv.upsertLivePlayers(database); err != nil {
+					return err
+				}
+				if pg, ok := database.(*db.DB); ok {
+					srv.usePostgres(pg, appCfg)
+				}
+				return nil
+			},
+			OnChange: func(attached bool) {
+				if !attached {
+					if m != nil {
+						m.DBAttached.Set(0)
+					}
+					return
+				}
+				if m != nil {
+					m.DBAttached.Set(1)
+				}
+				select {
+				case clicksWake <- struct{}{}:
+				default:
+				}
+			},
+		})
+
+		// Clicks the database can't take wait in the spool, surviving
+		// restarts, until they are written.
+		spool, err := clickspool.Open(appCfg.ClickSpoolFile)
 		if err != nil {
-			slog.Error("failed to connect to database, running without", "error", err)
+			slog.Error("failed to open click spool, dropping clicks the database can't take", "component", "batch_writer", "error", err)
 		} else {
-			if err := database.Migrate(); err != nil {
-				slog.Error("database migration failed", "error", err)
+			srv.ClickSpool = spool
+			if n := spool.Len(); n > 0 {
+				slog.Info("click spool has batches to retry", "component", "batch_writer", "batches", n, "file", appCfg.ClickSpoolFile)
 			}
-			srv.DB = database
-			srv.ClickBuffer = make(chan db.ClickEvent, 1000)
-			srv.FlushSignal = make(chan chan struct{})
-			go clickBatchWriter(database, srv.ClickBuffer, srv.FlushSignal, m)
-			slog.Info("database connected and migrations applied", "component", "db")
 		}
-	} else {
-		slog.Info("DATABASE_URL not set, running without database", "component", "db")
+		srv.ClickBuffer = make(chan db.ClickEvent, 1000)
+		srv.FlushSignal = make(chan chan struct{})
+		go clickBatchWriter(srv.DB, srv.ClickSpool, srv.ClickBuffer, &srv.overflow, srv.FlushSignal, clicksWake, m)
+		if appCfg.ClickKeyDays > 0 {
+			go srv.pruneClickBatches(time.Duration(appCfg.ClickKeyDays) * 24 * time.Hour)
+		}
+	}
+
+	// What follows runs without PostgreSQL. When PostgreSQL attaches,
+	// usePostgres moves webhooks, journals and snapshots onto it unless
+	// they are kept on disk, and shares rooms with other instances.
+
+	// Webhook endpoints and their delivery log are kept in memory until
+	// then.
+	srv.Webhooks = webhooks.NewDispatcher(webhooks.NewMemoryStore(), webhooks.Options{})
+	if appCfg.AdminToken == "" {
+		slog.Info("ADMIN_TOKEN not set, admin API disabled", "component", "webhooks")
+	}
+
+	// With INSTANCE_URL set, room codes are claimed in PostgreSQL so
+	// several instances can share the load, each sending requests for rooms
+	// it doesn't have to the one that does. Room messages go out through the
+	// database too, for clients following the room from other instances.
+	// No rooms are opened until then, so this instance never hands out a
+	// code the others don't know about.
+	sharing := appCfg.InstanceURL != "" && appCfg.DatabaseURL != ""
+	if appCfg.InstanceURL != "" && !sharing {
+		slog.Warn("INSTANCE_URL needs PostgreSQL to share rooms, running alone", "component", "rooms")
+	}
+	if sharing {
+		roomStore.AwaitDirectory()
+	}
+	if appCfg.RoomForward != ForwardProxy && appCfg.RoomForward != ForwardRedirect {
+		slog.Warn("unknown ROOM_FORWARD, using proxy", "value", appCfg.RoomForward)
+		srv.RoomForward = ForwardProxy
+	}
+
+	// Every room event is journaled to JOURNAL_DIR if set, otherwise to
+	// PostgreSQL once it attaches. This comes before the snapshot restore so
+	// restored rooms carry on writing their journals.
+	if appCfg.JournalDir != "" {
+		files, err := journal.NewFileStore(appCfg.JournalDir)
+		if err != nil {
+			slog.Error("opening journal directory failed, room journals disabled", "component", "journal", "error", err)
+		} else {
+			srv.Journals = files
+			srv.startJournals(appCfg)
+		}
+	}
+
+	// Rooms are snapshotted to SNAPSHOT_FILE if set, otherwise to
+	// PostgreSQL once it attaches, and restored then. Restoring a shared
+	// instance's rooms waits for the directory to claim their codes.
+	switch {
+	case appCfg.SnapshotFile != "":
+		srv.Snapshots = snapshot.NewFileStore(appCfg.SnapshotFile)
+		if !sharing {
+			srv.startSnapshots(appCfg)
+		}
+	case appCfg.DatabaseURL == "":
+		slog.Info("no PostgreSQL or SNAPSHOT_FILE, rooms won't survive a restart", "component", "snapshot")
+	}
+
+	// A database reachable now is attached before serving; otherwise it is
+	// retried in the background and attached once it answers.
+	if srv.DB != nil {
+		srv.DB.Start()
+		if srv.DB.Store() == nil && appCfg.DatabaseURL != "" {
+			slog.Warn("PostgreSQL unavailable at startup, features that need it start once it attaches", "component", "db", "sharing_rooms", sharing)
+		}
 	}
 
 	// Background goroutine: poll room/player counts for gauges every 15s
@@ -87,6 +231,15 @@ func Run() error {
 		}
 	}()
 
+	// Background goroutine: apply lobby idle timeouts
+	go func() {
+		ticker := time.NewTicker(idleSweepInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			srv.sweepIdleLobbies(now)
+		}
+	}()
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", srv.handleHome)
 	mux.HandleFunc("/rooms/create", srv.handleCreateRoom)
@@ -98,21 +251,73 @@ func Run() error {
 	mux.HandleFunc("POST /room/target/", srv.handleTarget)
 	mux.HandleFunc("GET /room/ws", srv.handleWebSocket)
 	mux.HandleFunc("POST /room/leave", srv.handleLeaveRoom)
+	mux.HandleFunc("GET /room/ghost", srv.handleRoomGhost)
+	mux.HandleFunc("POST /ghost/race", srv.handleGhostRace)
 	mux.HandleFunc("GET /room/events", srv.handleEvents)
 	mux.HandleFunc("GET /room/poll", srv.handlePoll)
 	mux.HandleFunc("POST /room/play-again", srv.handlePlayAgain)
+	mux.HandleFunc("GET /room/host/panel", srv.handleHostPanel)
+	mux.HandleFunc("POST /room/host/kick", srv.handleHostKick)
+	mux.HandleFunc("POST /room/host/transfer", srv.handleHostTransfer)
+	mux.HandleFunc("POST /room/host/lock", srv.handleHostLock)
+	mux.HandleFunc("POST /room/host/start", srv.handleHostStart)
+	mux.HandleFunc("POST /room/host/settings", srv.handleHostSettings)
+	mux.HandleFunc("GET /room/host/round", srv.handleHostRoundControls)
+	mux.HandleFunc("POST /room/host/pause", srv.handleHostPause)
+	mux.HandleFunc("GET /room/host/expiry", srv.handleHostExpiry)
+	mux.HandleFunc("POST /room/host/keepalive", srv.handleHostKeepAlive)
 	mux.HandleFunc("/health", srv.handleHealth)
+	mux.HandleFunc("GET /clock", srv.handleClock)
 	mux.HandleFunc("POST /telemetry", srv.handleTelemetry)
+	mux.HandleFunc("GET /admin/webhooks", srv.handleListWebhooks)
+	mux.HandleFunc("POST /admin/webhooks", srv.handleCreateWebhook)
+	mux.HandleFunc("DELETE /admin/webhooks/{id}", srv.handleDeleteWebhook)
+	mux.HandleFunc("GET /admin/webhooks/deliveries", srv.handleWebhookDeliveries)
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.HandleFunc("/analytics", srv.handleAnalyticsDashboard)
 	mux.HandleFunc("/analytics/leaderboard", srv.handleAnalyticsLeaderboard)
 	mux.HandleFunc("/analytics/player/", srv.handleAnalyticsPlayer)
 	mux.HandleFunc("/analytics/game/", srv.handleAnalyticsGame)
+	mux.HandleFunc("GET /analytics/game/{id}/replay", srv.handleAnalyticsReplay)
+	mux.HandleFunc("GET /analytics/game/{id}/timeline", srv.handleAnalyticsTimeline)
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 
-	addr := "0.0.0.0:" + appCfg.Port
+	hs := &http.Server{
+		Addr:    "0.0.0.0:" + appCfg.Port,
+		Handler: metricsMiddleware(m, srv.forwardRooms(mux)),
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- hs.ListenAndServe() }()
 	slog.Info("server listening", "addr", fmt.Sprintf("http://localhost:%s", appCfg.Port))
-	return http.ListenAndServe(addr, metricsMiddleware(m, mux))
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	stop() // a second signal kills the process
+
+	timeout := time.Duration(appCfg.ShutdownSecs) * time.Second
+	slog.Info("shutting down", "component", "shutdown", "timeout", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx, hs)
+	if fan := srv.fanout(); fan != nil {
+		fan.Close()
+	}
+	if srv.ClickSpool != nil {
+		srv.ClickSpool.Close()
+	}
+	if srv.DB != nil {
+		srv.DB.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("graceful shutdown: %w", err)
+	}
+	slog.Info("shutdown complete", "component", "shutdown")
+	return nil
 }
 
 // metricsMiddleware wraps an http.Handler to record request count and duration.
@@ -190,52 +395,3 @@ func normalizePath(p string) string {
 	}
 	return strings.Join(parts, "/")
 }
-
-func clickBatchWriter(database *db.DB, buffer chan db.ClickEvent, flushSignal chan chan struct{}, m *metrics.Metrics) {
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
-
-	batch := make([]db.ClickEvent, 0, 50)
-
-	writeBatch := func() {
-		if m != nil {
-			m.ClickBufferDepth.Set(float64(len(buffer)))
-		}
-		if len(batch) > 0 {
-			if err := database.BatchRecordClicks(batch); err != nil {
-				slog.Error("BatchRecordClicks failed", "component", "batch_writer", "error", err)
-				if m != nil {
-					m.DBWriteErrorsTotal.WithLabelValues("batch_record_clicks").Inc()
-				}
-			} else if m != nil {
-				m.ClickBatchFlushesTotal.Inc()
-			}
-			batch = batch[:0]
-		}
-	}
-
-	for {
-		select {
-		case ev := <-buffer:
-			batch = append(batch, ev)
-			if len(batch) >= 50 {
-				writeBatch()
-			}
-		case <-ticker.C:
-			writeBatch()
-		case done := <-flushSignal:
-			// Drain any remaining events from the buffer channel
-		drain:
-			for {
-				select {
-				case ev := <-buffer:
-					batch = append(batch, ev)
-				default:
-					break drain
-				}
-			}
-			writeBatch()
-			close(done)
-		}
-	}
-}
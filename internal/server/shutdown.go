@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// restartURL is where clients are sent when the server shuts down.
+const restartURL = "/?restarting=1"
+
+// Shutdown drains the server before it stops. New rooms are refused and
+// every room is closed, sending its players to a "server restarting" page,
+// and saved to the snapshot store; then hs (if any) stops accepting
+// requests and waits for those in flight. Pending clicks are written,
+// games still in progress are marked interrupted and outgoing webhooks are
+// closed. Whatever is left when ctx is done is abandoned and ctx's error
+// returned.
+func (s *Server) Shutdown(ctx context.Context, hs *http.Server) error {
+	s.draining.Store(true)
+
+	closed := s.Rooms.CloseAll(restartURL, "server restarting")
+	var interrupted []string
+	for _, room := range closed {
+		// Closing cancels the round; wait for its goroutine so a round
+		// that was just ending finishes recording first.
+		select {
+		case <-room.Round.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if id := room.Game.CurrentGameID(); id != "" {
+			interrupted = append(interrupted, id)
+		}
+	}
+	slog.Info("rooms closed for shutdown", "component", "shutdown", "rooms", len(closed))
+	// Nothing changes in a closed room, so this is the state to restore.
+	s.saveSnapshot(closed, true)
+
+	if hs != nil {
+		if err := hs.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Clicks can only arrive over HTTP, so nothing is added after this.
+	flushed := make(chan struct{})
+	go func() {
+		s.flushClickBuffer()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if database := s.database(); database != nil {
+		if err := database.InterruptGames(interrupted); err != nil {
+			slog.Error("InterruptGames failed", "component", "shutdown", "error", err)
+			if s.Metrics != nil {
+				s.Metrics.DBWriteErrorsTotal.WithLabelValues("interrupt_games").Inc()
+			}
+		}
+	}
+	if s.Webhooks != nil {
+		s.Webhooks.Close()
+	}
+	return ctx.Err()
+}
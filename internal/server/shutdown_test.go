@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdown_ClosesRoomsWithRestartNotice(t *testing.T) {
+	srv, ts := newTestServer(t)
+	t.Cleanup(ts.Close) // runs after the stream's cleanup ends it
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	stream := openStream(t, ts, room.Code, "host", "")
+
+	if err := srv.Shutdown(context.Background(), nil); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+
+	if ev := nextSSE(t, stream); ev.event != "roomClosed" || ev.data != restartURL {
+		t.Errorf("last event = %+v, want roomClosed to %s", ev, restartURL)
+	}
+	if n := len(srv.Rooms.List()); n != 0 {
+		t.Errorf("%d rooms left open", n)
+	}
+
+	resp, err := http.PostForm(ts.URL+"/rooms/create", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("create room status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	resp, err = http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), "draining") {
+		t.Errorf("health = %d %s, want 503 draining", resp.StatusCode, body)
+	}
+
+	resp, err = http.Get(ts.URL + restartURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "The server is restarting") {
+		t.Error("home page should explain the restart")
+	}
+}
+
+func TestShutdown_FlushesClicks(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	var flushed atomic.Bool
+	srv.FlushSignal = make(chan chan struct{})
+	go func() {
+		done := <-srv.FlushSignal
+		flushed.Store(true)
+		close(done)
+	}()
+
+	if err := srv.Shutdown(context.Background(), nil); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+	if !flushed.Load() {
+		t.Error("Shutdown should flush the click buffer")
+	}
+}
+
+func TestShutdown_GivesUpAtDeadline(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	srv.FlushSignal = make(chan chan struct{}) // nobody writing clicks
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := srv.Shutdown(ctx, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v, want deadline exceeded", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Shutdown took %v after its deadline", took)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"clicktrainer/internal/rooms"
+	"log/slog"
+	"time"
+)
+
+// saveSnapshot saves the given rooms to the snapshot store, if there is
+// one. final marks the snapshot taken at shutdown; once it is saved, later
+// periodic saves are dropped so they can't replace it.
+func (s *Server) saveSnapshot(list []*rooms.Room, final bool) {
+	store := s.snapshots()
+	if store == nil {
+		return
+	}
+	s.snapMu.Lock()
+	defer s.snapMu.Unlock()
+	if s.snapFinal {
+		return
+	}
+	s.snapFinal = final
+	if err := store.Save(rooms.Snapshot(list)); err != nil {
+		slog.Error("saving room snapshot failed", "component", "snapshot", "error", err)
+		return
+	}
+	slog.Debug("room snapshot saved", "component", "snapshot", "rooms", len(list), "final", final)
+}
+
+// snapshotLoop saves every open room each interval until shutdown begins.
+func (s *Server) snapshotLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if s.draining.Load() {
+			return
+		}
+		s.saveSnapshot(s.Rooms.List(), false)
+	}
+}
+
+// restoreSnapshot reopens the rooms saved before the last shutdown.
+func (s *Server) restoreSnapshot() {
+	store := s.snapshots()
+	if store == nil {
+		return
+	}
+	snap, err := store.Load()
+	if err != nil {
+		slog.Error("loading room snapshot failed", "component", "snapshot", "error", err)
+		return
+	}
+	restored := s.Rooms.Restore(snap)
+	players := 0
+	for _, room := range restored {
+		players += room.Game.Players.Count()
+	}
+	slog.Info("rooms restored from snapshot", "component", "snapshot",
+		"rooms", len(restored), "players", players, "saved_at", snap.SavedAt)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/rooms"
+	"clicktrainer/internal/snapshot"
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot_RoomSurvivesRestart(t *testing.T) {
+	store := snapshot.NewFileStore(filepath.Join(t.TempDir(), "rooms.json"))
+
+	before, beforeTS := newTestServer(t)
+	defer beforeTS.Close()
+	before.Snapshots = store
+	room, _ := before.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.SetScene(gamedata.SceneCombat)
+	if err := before.Shutdown(context.Background(), nil); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+	// A periodic save that lost the race with shutdown changes nothing.
+	before.saveSnapshot(nil, false)
+
+	after, ts := newTestServer(t)
+	defer ts.Close()
+	after.Snapshots = store
+	after.restoreSnapshot()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/room/"+room.Code, nil)
+	req.AddCookie(&http.Cookie{Name: "player_id", Value: "host"})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `id="lobby"`) {
+		t.Fatal("the player's cookie should take them back to the room's lobby")
+	}
+	if !strings.Contains(string(body), rooms.InterruptedNotice) {
+		t.Error("the lobby should explain why the round is gone")
+	}
+	if restored := after.Rooms.Get(room.Code); restored == nil || !restored.IsHost("host") {
+		t.Error("the host should keep host rights")
+	}
+}
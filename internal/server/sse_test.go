@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bufio"
+	"clicktrainer/internal/broadcast"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	id, event, data string
+}
+
+// openStream connects to the room's event stream as playerID, resuming from
+// lastID if it is set. Headers have been flushed, and so the client
+// subscribed, by the time it returns.
+func openStream(t *testing.T, ts *httptest.Server, roomCode, playerID, lastID string) *bufio.Scanner {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/room/events", nil)
+	req.AddCookie(&http.Cookie{Name: "room_code", Value: roomCode})
+	req.AddCookie(&http.Cookie{Name: "player_id", Value: playerID})
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	return scanner
+}
+
+func nextSSE(t *testing.T, scanner *bufio.Scanner) sseEvent {
+	t.Helper()
+	var ev sseEvent
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			ev.data = strings.Join(data, "\n")
+			return ev
+		}
+		if v, ok := strings.CutPrefix(line, "id: "); ok {
+			ev.id = v
+		} else if v, ok := strings.CutPrefix(line, "event: "); ok {
+			ev.event = v
+		} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = append(data, v)
+		}
+	}
+	t.Fatalf("stream ended: %v", scanner.Err())
+	return ev
+}
+
+func TestEvents_SendsIDs(t *testing.T) {
+	srv, ts := newTestServer(t)
+	t.Cleanup(ts.Close) // runs after the stream's cleanup ends it
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+
+	stream := openStream(t, ts, room.Code, "host", "")
+	room.Broadcaster.BroadcastOOB("swap", "one")
+	room.Broadcaster.BroadcastOOB("swap", "two")
+
+	if ev := nextSSE(t, stream); ev.id != "1" || ev.data != "one" {
+		t.Errorf("first event = %+v, want id 1", ev)
+	}
+	if ev := nextSSE(t, stream); ev.id != "2" || ev.data != "two" {
+		t.Errorf("second event = %+v, want id 2", ev)
+	}
+}
+
+func TestEvents_ReplaysMissedMessages(t *testing.T) {
+	srv, ts := newTestServer(t)
+	t.Cleanup(ts.Close) // runs after the stream's cleanup ends it
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+
+	for _, msg := range []string{"one", "two", "three"} {
+		room.Broadcaster.BroadcastOOB("swap", msg)
+	}
+
+	stream := openStream(t, ts, room.Code, "host", "1")
+	room.Broadcaster.BroadcastOOB("swap", "four")
+
+	for _, want := range []sseEvent{{"2", "swap", "two"}, {"3", "swap", "three"}, {"4", "swap", "four"}} {
+		if got := nextSSE(t, stream); got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestEvents_ResyncsWhenGapTooLarge(t *testing.T) {
+	srv, ts := newTestServer(t)
+	t.Cleanup(ts.Close) // runs after the stream's cleanup ends it
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+
+	for range broadcast.ReplaySize + 2 {
+		room.Broadcaster.BroadcastOOB("swap", "x")
+	}
+
+	stream := openStream(t, ts, room.Code, "host", "1")
+
+	ev := nextSSE(t, stream)
+	if ev.event != "swap" || ev.id != "" || !strings.Contains(ev.data, `id="scene" hx-swap-oob="innerHTML"`) || !strings.Contains(ev.data, "Alice") {
+		t.Errorf("resync = %+v, want the whole scene re-rendered without an ID", ev)
+	}
+	if ev := nextSSE(t, stream); ev.event != "sceneChange" || ev.data != "lobby" {
+		t.Errorf("second event = %+v, want sceneChange lobby", ev)
+	}
+
+	room.Broadcaster.BroadcastOOB("swap", "live")
+	if ev := nextSSE(t, stream); ev.id != "259" || ev.data != "live" {
+		t.Errorf("live event = %+v, want id 259", ev)
+	}
+}
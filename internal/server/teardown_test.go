@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func TestRoomClose_EndsStreamsAndConnections(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	srv.Rooms.SetPresence(srv.presenceConfig(time.Minute))
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.Players.Add("p2", "Bob")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	baseline := runtime.NumGoroutine()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/room/events", nil)
+	req.AddCookie(&http.Cookie{Name: "room_code", Value: room.Code})
+	req.AddCookie(&http.Cookie{Name: "player_id", Value: "host"})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	header := http.Header{}
+	header.Set("Cookie", fmt.Sprintf("room_code=%s; player_id=p2", room.Code))
+	wsURL := strings.Replace(ts.URL, "http://", "ws://", 1) + "/room/ws"
+	conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{HTTPHeader: header})
+	if err != nil {
+		t.Fatalf("WebSocket dial error: %v", err)
+	}
+	defer conn.CloseNow()
+
+	// Wait for the WebSocket to register before tearing down.
+	deadline := time.Now().Add(time.Second)
+	for !room.Presence.Connected("p2") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !room.Presence.Connected("p2") {
+		t.Fatal("WebSocket client never connected")
+	}
+
+	srv.Rooms.Delete(room.Code)
+
+	// The SSE stream ends with the close event.
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if ev, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+			events = append(events, ev)
+		}
+	}
+	if len(events) == 0 || events[len(events)-1] != "roomClosed" {
+		t.Errorf("events = %v, want the stream to end with roomClosed", events)
+	}
+
+	// The WebSocket is closed with a reason.
+	_, _, err = conn.Read(ctx)
+	var closeErr websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.StatusGoingAway {
+		t.Errorf("read error = %v, want close with status going away", err)
+	}
+
+	resp.Body.Close()
+	conn.CloseNow()
+	http.DefaultClient.CloseIdleConnections()
+	deadline = time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := runtime.NumGoroutine(); got > baseline {
+		buf := make([]byte, 1<<16)
+		t.Errorf("goroutines = %d, want at most %d after teardown\n%s", got, baseline, buf[:runtime.Stack(buf, true)])
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"path/filepath"
+	"text/template"
+)
+
+// templateFiles are the templates the server renders, relative to the
+// templates directory.
+var templateFiles = []string{
+	"home.html",
+	"game.html",
+	"join.html",
+	"target.html",
+	"lobby.html",
+	"recap.html",
+	"analytics/dashboard.html",
+	"analytics/leaderboard.html",
+	"analytics/player.html",
+	"analytics/game.html",
+	"analytics/replay.html",
+	"analytics/unavailable.html",
+}
+
+// parseTemplates parses the server's templates from dir.
+func parseTemplates(dir string) (*template.Template, error) {
+	funcMap := template.FuncMap{
+		"inc": func(i int) int { return i + 1 },
+	}
+	paths := make([]string, len(templateFiles))
+	for i, name := range templateFiles {
+		paths[i] = filepath.Join(dir, name)
+	}
+	return template.New("").Funcs(funcMap).ParseFiles(paths...)
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestParseTemplates_CoversRenderedNames parses the templates as Run does
+// and checks every template the server executes by name is among them.
+func TestParseTemplates_CoversRenderedNames(t *testing.T) {
+	tmpl, err := parseTemplates("../../templates")
+	if err != nil {
+		t.Fatalf("parseTemplates() error: %v", err)
+	}
+
+	files, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	executed := regexp.MustCompile(`ExecuteTemplate\([^,]+, "([^"]+)"`)
+	var names int
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".go") || strings.HasSuffix(f.Name(), "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range executed.FindAllStringSubmatch(string(src), -1) {
+			names++
+			if tmpl.Lookup(match[1]) == nil {
+				t.Errorf("%s executes template %q, which parseTemplates doesn't parse", f.Name(), match[1])
+			}
+		}
+	}
+	if names == 0 {
+		t.Fatal("found no executed templates to check")
+	}
+}
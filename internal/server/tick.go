@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/rooms"
+	"clicktrainer/internal/tick"
+	"clicktrainer/internal/wshub"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// tickFlushFor builds the function that sends a room's batched updates.
+func (s *Server) tickFlushFor(room *rooms.Room) tick.FlushFunc {
+	return func(b tick.Batch) { s.flushTick(room, b) }
+}
+
+// flushTick sends one tick's worth of updates: a single SSE swap with every
+// target, score and rank change, and a single WebSocket frame with kill
+// effects and cursor positions.
+func (s *Server) flushTick(room *rooms.Room, b tick.Batch) {
+	var oob bytes.Buffer
+	for _, k := range b.Kills {
+		fmt.Fprintf(&oob, `<div id="target_%d" hx-swap-oob="delete"></div>`, k.TargetID)
+	}
+	if len(b.Spawned) > 0 {
+		oob.WriteString(`<div hx-swap-oob="beforeend:#targets">`)
+		for _, t := range b.Spawned {
+			if err := s.Tmpl.ExecuteTemplate(&oob, "target", t); err != nil {
+				slog.Error("template error", "handler", "tick", "error", err)
+			}
+		}
+		oob.WriteString(`</div>`)
+	}
+	for _, id := range b.Scores {
+		score, _, ok := room.Game.Players.Standing(id)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&oob, `<div id="player_score_%s" hx-swap-oob="innerHTML">%d</div>`, id, score)
+		fmt.Fprintf(&oob, `<span id="my_rank_score_%s" hx-swap-oob="innerHTML">%d</span>`, id, score)
+	}
+	if len(b.Ranks) > 0 && room.Game.Scene() == gamedata.SceneCombat {
+		s.writeRankChanges(&oob, room, b)
+	}
+	if oob.Len() > 0 {
+		room.Broadcaster.BroadcastOOB("swap", oob.String())
+	}
+
+	frame := make([]wshub.ServerMessage, 0, len(b.Kills)+len(b.Cursors))
+	for _, k := range b.Kills {
+		msg := wshub.ServerMessage{Type: "kill", PlayerID: k.PlayerID, X: k.X, Y: k.Y, Points: k.Points}
+		if p := room.Game.Players.Get(k.PlayerID); p != nil {
+			msg.Name, msg.Color = p.Name, p.Color
+		}
+		frame = append(frame, msg)
+	}
+	for _, c := range b.Cursors {
+		msg := wshub.ServerMessage{Type: "move", PlayerID: c.PlayerID, X: c.X, Y: c.Y}
+		if p := room.Game.Players.Get(c.PlayerID); p != nil {
+			msg.Name, msg.Color = p.Name, p.Color
+		}
+		frame = append(frame, msg)
+	}
+	if len(frame) > 0 {
+		room.Hub.Broadcast(wshub.ServerMessage{Type: "tick", Batch: frame})
+	}
+}
+
+// writeRankChanges adds the rank chip of every player who moved and
+// re-renders the scoreboard rows whose occupant changed. Ranks are read
+// fresh, so changes reported out of order still end up right.
+func (s *Server) writeRankChanges(oob *bytes.Buffer, room *rooms.Room, b tick.Batch) {
+	topN := gamedata.ScoreboardSize(room.Game.Players.Count())
+	var rows []int
+	for _, c := range b.Ranks {
+		if rank := room.Game.Players.GetPlayerRank(c.PlayerID); rank > 0 {
+			fmt.Fprintf(oob, `<span id="my_rank_pos_%s" hx-swap-oob="innerHTML">#%d</span>`, c.PlayerID, rank)
+		}
+		for _, pos := range []int{c.Old, c.New} {
+			if pos > 0 && pos <= topN && !slices.Contains(rows, pos) {
+				rows = append(rows, pos)
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+	slices.Sort(rows)
+	top := room.Game.Players.GetTopPlayers(topN)
+	for _, pos := range rows {
+		fmt.Fprintf(oob, `<div id="scoreboard_row_%d" hx-swap-oob="innerHTML">`, pos)
+		if pos <= len(top) {
+			if err := s.Tmpl.ExecuteTemplate(oob, "playerChip", top[pos-1]); err != nil {
+				slog.Error("template error", "handler", "tick", "error", err)
+			}
+		}
+		oob.WriteString(`</div>`)
+	}
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"clicktrainer/internal/broadcast"
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/rooms"
+	"clicktrainer/internal/targets"
+	"clicktrainer/internal/tick"
+	"clicktrainer/internal/wshub"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fanoutRoom is a room with n players, each with an open event stream and
+// WebSocket whose messages are counted rather than sent anywhere.
+type fanoutRoom struct {
+	room    *rooms.Room
+	streams []chan broadcast.HxEventMessage
+	sockets []*wshub.Client
+}
+
+func newFanoutRoom(tb testing.TB, srv *Server, n int) *fanoutRoom {
+	tb.Helper()
+	room, err := srv.Rooms.Create("p0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	f := &fanoutRoom{room: room}
+	for i := range n {
+		id := fmt.Sprintf("p%d", i)
+		room.Game.Players.Add(id, "Player "+id)
+		f.streams = append(f.streams, room.Broadcaster.Subscribe())
+		c := &wshub.Client{PlayerID: id, Send: make(chan []byte, 1024)}
+		room.Hub.Register(c)
+		f.sockets = append(f.sockets, c)
+	}
+	return f
+}
+
+// drain empties every client queue and returns how many SSE messages and
+// WebSocket frames were waiting.
+func (f *fanoutRoom) drain() (sse, ws int) {
+	for _, ch := range f.streams {
+		for len(ch) > 0 {
+			<-ch
+			sse++
+		}
+	}
+	for _, c := range f.sockets {
+		for len(c.Send) > 0 {
+			<-c.Send
+			ws++
+		}
+	}
+	return sse, ws
+}
+
+func TestTick_OneUpdatePerTick(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	f := newFanoutRoom(t, srv, 3)
+	room := f.room
+
+	// The first update after a quiet spell goes out at once; start the
+	// burst below inside a tick.
+	room.Tick.Move("p0", 0, 0)
+	time.Sleep(10 * time.Millisecond)
+	f.drain()
+
+	var ids []int
+	for range 3 {
+		ids = append(ids, room.Game.Targets.Add().ID)
+	}
+	for i, id := range ids {
+		if !srv.processClick(room, fmt.Sprintf("p%d", i), id, 2) {
+			t.Fatalf("click on target %d should count", id)
+		}
+	}
+	room.Tick.Move("p1", 10, 20)
+	room.Tick.Move("p2", 30, 40)
+	time.Sleep(2 * room.Tick.Interval())
+
+	msg := <-f.streams[0]
+	for _, id := range ids {
+		if !strings.Contains(msg.Msg, fmt.Sprintf(`id="target_%d" hx-swap-oob="delete"`, id)) {
+			t.Errorf("swap is missing the delete for target %d", id)
+		}
+	}
+	if !strings.Contains(msg.Msg, `id="my_rank_score_p2" hx-swap-oob="innerHTML">2<`) {
+		t.Error("swap is missing p2's score")
+	}
+
+	var frame wshub.ServerMessage
+	if err := json.Unmarshal(<-f.sockets[0].Send, &frame); err != nil {
+		t.Fatal(err)
+	}
+	kills, moves := 0, 0
+	for _, m := range frame.Batch {
+		switch m.Type {
+		case "kill":
+			kills++
+		case "move":
+			moves++
+		}
+	}
+	if frame.Type != "tick" || kills != 3 || moves != 2 {
+		t.Errorf("frame = %s with %d kills and %d moves, want one tick with 3 and 2", frame.Type, kills, moves)
+	}
+
+	// That was everything: one SSE message and one frame per client.
+	if sse, ws := f.drain(); sse != 2 || ws != 2 {
+		t.Errorf("other clients had %d SSE messages and %d frames queued, want 2 and 2", sse, ws)
+	}
+}
+
+func TestTick_SpawnsInsertIntoTargets(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	f := newFanoutRoom(t, srv, 1)
+
+	target := f.room.Game.Targets.Add()
+	srv.flushTick(f.room, tick.Batch{Spawned: []*targets.Target{target}})
+
+	msg := <-f.streams[0]
+	if !strings.Contains(msg.Msg, `hx-swap-oob="beforeend:#targets"`) || !strings.Contains(msg.Msg, fmt.Sprintf(`id="target_%d"`, target.ID)) {
+		t.Errorf("spawn swap = %q, want the target appended to #targets", msg.Msg)
+	}
+}
+
+func TestTick_SendsOnlyMovedRows(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	f := newFanoutRoom(t, srv, 4)
+	room := f.room
+	room.Game.SetScene(gamedata.SceneCombat)
+	for i, points := range []int{4, 3, 2, 1} {
+		room.Game.Players.UpdateScore(fmt.Sprintf("p%d", i), points)
+	}
+	room.Tick.Flush()
+	f.drain()
+
+	// p3 overtakes p1 and p2; p0 keeps first place.
+	room.Game.Players.UpdateScore("p3", 3)
+	room.Tick.Flush()
+
+	msg := (<-f.streams[0]).Msg
+	for row, id := range map[int]string{2: "p3", 3: "p1", 4: "p2"} {
+		if !regexp.MustCompile(fmt.Sprintf(`id="scoreboard_row_%d" hx-swap-oob="innerHTML">\s*<div id="player_%s"`, row, id)).MatchString(msg) {
+			t.Errorf("swap should put %s in row %d", id, row)
+		}
+	}
+	if strings.Contains(msg, "scoreboard_row_1") || strings.Contains(msg, "my_rank_pos_p0") {
+		t.Error("first place didn't move and shouldn't be re-sent")
+	}
+	for id, rank := range map[string]int{"p3": 2, "p1": 3, "p2": 4} {
+		if !strings.Contains(msg, fmt.Sprintf(`id="my_rank_pos_%s" hx-swap-oob="innerHTML">#%d<`, id, rank)) {
+			t.Errorf("swap should show %s at #%d", id, rank)
+		}
+	}
+}
+
+// The fan-out benchmarks replay one tick's worth of activity in a 30-player
+// room — every player moving and five targets taken — and report how many
+// SSE messages and WebSocket frames the clients receive. PerEvent sends
+// everything as it happens, as the server did before the tick loop.
+
+const (
+	benchPlayers = 30
+	benchKills   = 5
+)
+
+func BenchmarkFanout_PerEvent(b *testing.B) {
+	srv, ts := newTestServer(b)
+	defer ts.Close()
+	f := newFanoutRoom(b, srv, benchPlayers)
+	room := f.room
+	var sse, ws int
+
+	b.ResetTimer()
+	for range b.N {
+		for i := range benchKills {
+			p := fmt.Sprintf("p%d", i)
+			room.Broadcaster.BroadcastOOB("swap", fmt.Sprintf(
+				`<div id="target_%d" hx-swap-oob="delete"></div><div id="player_score_%s" hx-swap-oob="innerHTML">%d</div><span id="my_rank_score_%s" hx-swap-oob="innerHTML">%d</span><span id="my_rank_pos_%s" hx-swap-oob="innerHTML">#%d</span>`,
+				i, p, i, p, i, p, room.Game.Players.GetPlayerRank(p)))
+			room.Hub.BroadcastExcept(p, wshub.ServerMessage{Type: "kill", PlayerID: p, X: i, Y: i, Points: 2})
+		}
+		for i := range benchPlayers {
+			p := fmt.Sprintf("p%d", i)
+			room.Hub.BroadcastExcept(p, wshub.ServerMessage{Type: "move", PlayerID: p, X: i, Y: i})
+		}
+		s, w := f.drain()
+		sse, ws = sse+s, ws+w
+	}
+	b.ReportMetric(float64(sse)/float64(b.N), "sse_msgs/op")
+	b.ReportMetric(float64(ws)/float64(b.N), "ws_frames/op")
+}
+
+func BenchmarkFanout_Tick(b *testing.B) {
+	srv, ts := newTestServer(b)
+	defer ts.Close()
+	f := newFanoutRoom(b, srv, benchPlayers)
+	room := f.room
+	var sse, ws int
+
+	b.ResetTimer()
+	for range b.N {
+		var batch tick.Batch
+		for i := range benchKills {
+			p := fmt.Sprintf("p%d", i)
+			batch.Kills = append(batch.Kills, tick.Kill{TargetID: i, PlayerID: p, X: i, Y: i, Points: 2})
+			batch.Scores = append(batch.Scores, p)
+		}
+		for i := range benchPlayers {
+			batch.Cursors = append(batch.Cursors, tick.Cursor{PlayerID: fmt.Sprintf("p%d", i), X: i, Y: i})
+		}
+		srv.flushTick(room, batch)
+		s, w := f.drain()
+		sse, ws = sse+s, ws+w
+	}
+	b.ReportMetric(float64(sse)/float64(b.N), "sse_msgs/op")
+	b.ReportMetric(float64(ws)/float64(b.N), "ws_frames/op")
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"clicktrainer/internal/analytics"
+	"clicktrainer/internal/events"
+	"clicktrainer/internal/rooms"
+	"clicktrainer/internal/webhooks"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// deliveryLogLimit caps how many log entries the deliveries endpoint returns.
+const deliveryLogLimit = 100
+
+// forwardWebhooks turns a room's events into webhook deliveries.
+func (s *Server) forwardWebhooks(room *rooms.Room, sub *events.Subscription) {
+	for ev := range sub.Events() {
+		switch ev := ev.(type) {
+		case events.RoundEnded:
+			data := webhooks.RoundEnded{GameID: ev.GameID, Results: make([]webhooks.Standing, len(ev.Results))}
+			for i, r := range ev.Results {
+				data.Results[i] = webhooks.Standing{Rank: i + 1, PlayerID: r.PlayerID, PlayerName: r.Name, Value: r.Score}
+			}
+			s.Webhooks.Dispatch(webhooks.EventRoundEnded, room.Code, data)
+		case events.BadgeAwarded:
+			data := webhooks.BadgeAwarded{PlayerID: ev.PlayerID, BadgeID: ev.BadgeID, GameID: ev.GameID}
+			if b, ok := analytics.AllBadges[analytics.BadgeID(ev.BadgeID)]; ok {
+				data.BadgeName = b.Name
+			}
+			if p := room.Game.Players.Get(ev.PlayerID); p != nil {
+				data.PlayerName = p.Name
+			}
+			s.Webhooks.Dispatch(webhooks.EventBadgeAwarded, room.Code, data)
+		case events.PersonalBest:
+			s.Webhooks.Dispatch(webhooks.EventPersonalBest, room.Code, webhooks.PersonalBest{
+				PlayerID:   ev.PlayerID,
+				PlayerName: ev.Name,
+				Score:      ev.Score,
+				Previous:   ev.Previous,
+				GameID:     ev.GameID,
+			})
+		case events.LeaderboardChanged:
+			data := webhooks.LeaderboardChanged{Category: ev.Category, Top: make([]webhooks.Standing, len(ev.Top))}
+			for i, st := range ev.Top {
+				data.Top[i] = webhooks.Standing{Rank: st.Rank, PlayerID: st.PlayerID, PlayerName: st.Name, Value: st.Value}
+			}
+			s.Webhooks.Dispatch(webhooks.EventLeaderboardChanged, room.Code, data)
+		}
+	}
+}
+
+// requireAdmin checks the request's bearer token against ADMIN_TOKEN. The
+// admin API is disabled when no token is configured.
+func (s *Server) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.AdminToken == "" {
+		http.Error(w, "Admin API disabled", http.StatusNotFound)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.AdminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if s.Webhooks == nil {
+		http.Error(w, "Webhooks are not enabled", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("encoding JSON response failed", "error", err)
+	}
+}
+
+// handleListWebhooks lists registered endpoints. Secrets are only shown
+// when an endpoint is created.
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	endpoints, err := s.Webhooks.Store().Endpoints()
+	if err != nil {
+		slog.Error("listing webhooks failed", "handler", "admin_webhooks", "error", err)
+		http.Error(w, "Could not list webhooks", http.StatusInternalServerError)
+		return
+	}
+	for i := range endpoints {
+		endpoints[i].Secret = ""
+	}
+	if endpoints == nil {
+		endpoints = []webhooks.Endpoint{}
+	}
+	writeJSON(w, http.StatusOK, endpoints)
+}
+
+// handleCreateWebhook registers an endpoint from a JSON body of the form
+// {"url": "...", "events": ["round_ended", ...]}. The response includes the
+// generated signing secret.
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+		return
+	}
+	if len(req.Events) == 0 {
+		http.Error(w, "events must not be empty", http.StatusBadRequest)
+		return
+	}
+	for _, ev := range req.Events {
+		if !webhooks.ValidEvent(ev) {
+			http.Error(w, "unknown event: "+ev, http.StatusBadRequest)
+			return
+		}
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		slog.Error("generating webhook secret failed", "handler", "admin_webhooks", "error", err)
+		http.Error(w, "Could not create webhook", http.StatusInternalServerError)
+		return
+	}
+	ep, err := s.Webhooks.AddEndpoint(webhooks.Endpoint{URL: req.URL, Secret: secret, Events: req.Events})
+	if err != nil {
+		slog.Error("adding webhook failed", "handler", "admin_webhooks", "error", err)
+		http.Error(w, "Could not create webhook", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("webhook registered", "handler", "admin_webhooks", "endpoint_id", ep.ID, "url", ep.URL, "events", ep.Events)
+	writeJSON(w, http.StatusCreated, ep)
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	id := r.PathValue("id")
+	if err := s.Webhooks.DeleteEndpoint(id); err != nil {
+		if errors.Is(err, webhooks.ErrNotFound) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("deleting webhook failed", "handler", "admin_webhooks", "endpoint_id", id, "error", err)
+		http.Error(w, "Could not delete webhook", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("webhook removed", "handler", "admin_webhooks", "endpoint_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleWebhookDeliveries returns the most recent delivery attempts and dead
+// letters, newest first.
+func (s *Server) handleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	store := s.Webhooks.Store()
+	attempts, err := store.Attempts(deliveryLogLimit)
+	if err != nil {
+		slog.Error("listing webhook attempts failed", "handler", "admin_webhooks", "error", err)
+		http.Error(w, "Could not list deliveries", http.StatusInternalServerError)
+		return
+	}
+	dead, err := store.DeadLetters(deliveryLogLimit)
+	if err != nil {
+		slog.Error("listing webhook dead letters failed", "handler", "admin_webhooks", "error", err)
+		http.Error(w, "Could not list deliveries", http.StatusInternalServerError)
+		return
+	}
+	if attempts == nil {
+		attempts = []webhooks.Attempt{}
+	}
+	if dead == nil {
+		dead = []webhooks.DeadLetter{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"attempts":     attempts,
+		"dead_letters": dead,
+	})
+}
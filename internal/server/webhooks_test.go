@@ -0,0 +1,200 @@
+package server
+
+import (
+	"clicktrainer/internal/events"
+	"clicktrainer/internal/webhooks"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAdminToken = "test-admin-token"
+
+// withWebhooks enables the admin API and an in-memory webhook dispatcher.
+// It must be called before rooms are created.
+func withWebhooks(t *testing.T, srv *Server) {
+	t.Helper()
+	srv.AdminToken = testAdminToken
+	srv.Webhooks = webhooks.NewDispatcher(webhooks.NewMemoryStore(), webhooks.Options{Backoff: time.Millisecond})
+	t.Cleanup(srv.Webhooks.Close)
+}
+
+func adminRequest(t *testing.T, ts *httptest.Server, method, path, token, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestAdminWebhooks_RequiresToken(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+
+	if resp := adminRequest(t, ts, "GET", "/admin/webhooks", "anything", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("without ADMIN_TOKEN: status %d, want 404", resp.StatusCode)
+	}
+
+	withWebhooks(t, srv)
+	if resp := adminRequest(t, ts, "GET", "/admin/webhooks", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no token: status %d, want 401", resp.StatusCode)
+	}
+	if resp := adminRequest(t, ts, "GET", "/admin/webhooks", "wrong", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want 401", resp.StatusCode)
+	}
+	if resp := adminRequest(t, ts, "GET", "/admin/webhooks", testAdminToken, ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("right token: status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestAdminWebhooks_CreateListDelete(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	withWebhooks(t, srv)
+
+	for _, body := range []string{
+		`not json`,
+		`{"url":"ftp://example.test","events":["round_ended"]}`,
+		`{"url":"http://example.test","events":[]}`,
+		`{"url":"http://example.test","events":["round_started"]}`,
+	} {
+		if resp := adminRequest(t, ts, "POST", "/admin/webhooks", testAdminToken, body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("POST %s: status %d, want 400", body, resp.StatusCode)
+		}
+	}
+
+	resp := adminRequest(t, ts, "POST", "/admin/webhooks", testAdminToken, `{"url":"http://example.test/hook","events":["round_ended","badge_awarded"]}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: status %d, want 201", resp.StatusCode)
+	}
+	var created webhooks.Endpoint
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.Secret == "" {
+		t.Errorf("created = %+v, want ID and secret", created)
+	}
+
+	resp = adminRequest(t, ts, "GET", "/admin/webhooks", testAdminToken, "")
+	var listed []webhooks.Endpoint
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].ID != created.ID || listed[0].Secret != "" {
+		t.Errorf("listed = %+v, want the endpoint without its secret", listed)
+	}
+
+	if resp := adminRequest(t, ts, "DELETE", "/admin/webhooks/"+created.ID, testAdminToken, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("delete: status %d, want 204", resp.StatusCode)
+	}
+	if resp := adminRequest(t, ts, "DELETE", "/admin/webhooks/"+created.ID, testAdminToken, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("second delete: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestWebhooks_DeliversRoomEvents(t *testing.T) {
+	srv, ts := newTestServer(t)
+	defer ts.Close()
+	withWebhooks(t, srv)
+
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan received, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header, body}
+	}))
+	defer receiver.Close()
+
+	resp := adminRequest(t, ts, "POST", "/admin/webhooks", testAdminToken,
+		`{"url":"`+receiver.URL+`","events":["round_ended","personal_best"]}`)
+	var ep webhooks.Endpoint
+	if err := json.NewDecoder(resp.Body).Decode(&ep); err != nil {
+		t.Fatal(err)
+	}
+
+	room, _ := srv.Rooms.Create("host")
+	room.Game.Players.Add("host", "Alice")
+	room.Game.Players.Add("p2", "Bob")
+	room.Game.Players.UpdateScore("p2", 7)
+	room.Game.EndRound()
+	// Not subscribed, so never delivered.
+	room.Game.Events.Publish(events.BadgeAwarded{PlayerID: "p2", BadgeID: "veteran"})
+	room.Game.Events.Publish(events.PersonalBest{PlayerID: "p2", Name: "Bob", Score: 7, Previous: 5, GameID: "g1"})
+
+	// Deliveries run concurrently, so index them by event.
+	byEvent := make(map[string]received)
+	for range 2 {
+		select {
+		case r := <-got:
+			byEvent[r.header.Get(webhooks.HeaderEvent)] = r
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for webhook")
+		}
+	}
+
+	r, ok := byEvent[webhooks.EventRoundEnded]
+	if !ok {
+		t.Fatalf("no round_ended delivery; got %v", byEvent)
+	}
+	if !webhooks.Verify(ep.Secret, r.header.Get(webhooks.HeaderTimestamp), r.header.Get(webhooks.HeaderSignature), r.body) {
+		t.Error("round_ended signature did not verify")
+	}
+	var roundEnded struct {
+		RoomCode string              `json:"room_code"`
+		Data     webhooks.RoundEnded `json:"data"`
+	}
+	if err := json.Unmarshal(r.body, &roundEnded); err != nil {
+		t.Fatal(err)
+	}
+	if roundEnded.RoomCode != room.Code {
+		t.Errorf("room_code = %q, want %q", roundEnded.RoomCode, room.Code)
+	}
+	if res := roundEnded.Data.Results; len(res) != 2 || res[0].PlayerName != "Bob" || res[0].Rank != 1 || res[0].Value != 7 {
+		t.Errorf("results = %+v, want Bob first with 7", res)
+	}
+
+	r, ok = byEvent[webhooks.EventPersonalBest]
+	if !ok {
+		t.Fatalf("no personal_best delivery; got %v", byEvent)
+	}
+	var pb struct {
+		Data webhooks.PersonalBest `json:"data"`
+	}
+	if err := json.Unmarshal(r.body, &pb); err != nil {
+		t.Fatal(err)
+	}
+	if pb.Data.Score != 7 || pb.Data.Previous != 5 {
+		t.Errorf("personal best = %+v", pb.Data)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp := adminRequest(t, ts, "GET", "/admin/webhooks/deliveries", testAdminToken, "")
+		var log struct {
+			Attempts []webhooks.Attempt `json:"attempts"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&log); err != nil {
+			t.Fatal(err)
+		}
+		if len(log.Attempts) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery log has %d attempts, want 2", len(log.Attempts))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
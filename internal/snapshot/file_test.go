@@ -0,0 +1,79 @@
+package snapshot
+
+import (
+	"clicktrainer/internal/gamedata"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func sample() Snapshot {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return Snapshot{
+		Version: Version,
+		SavedAt: now,
+		Rooms: []Room{{
+			Code:       "ABCD",
+			HostID:     "p1",
+			CreatedAt:  now.Add(-time.Hour),
+			LastActive: now,
+			Locked:     true,
+			Banned:     []string{"p9"},
+			Scene:      gamedata.SceneRecap,
+			LateJoin:   gamedata.LateJoinHandicap,
+			Lobby:      gamedata.DefaultConfig().Lobby,
+			Players: []Player{
+				{ID: "p1", Name: "Alice", Color: "#fff", Score: 12, JoinedAt: now.Add(-time.Hour)},
+				{ID: "p2", Name: "Bob", Color: "#000", Score: 4, JoinedAt: now, LateJoin: "handicap", Handicap: 1.5},
+			},
+		}},
+	}
+}
+
+func TestFileStore_RoundTrip(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "rooms.json"))
+	want := sample()
+	if err := store.Save(want); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+
+	// A second save replaces the first and leaves no temporary files.
+	if err := store.Save(Snapshot{Version: Version}); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if got, _ := store.Load(); len(got.Rooms) != 0 {
+		t.Errorf("Load() after an empty save has %d rooms", len(got.Rooms))
+	}
+	entries, _ := os.ReadDir(filepath.Dir(store.Path))
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the snapshot", len(entries))
+	}
+}
+
+func TestFileStore_Missing(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "rooms.json"))
+	got, err := store.Load()
+	if err != nil || len(got.Rooms) != 0 {
+		t.Errorf("Load() = %+v, %v; want an empty snapshot", got, err)
+	}
+}
+
+func TestFileStore_RejectsOtherVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rooms.json")
+	if err := os.WriteFile(path, []byte(`{"version":99,"rooms":[{"code":"ABCD"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path).Load(); !errors.Is(err, ErrVersion) {
+		t.Errorf("Load() error = %v, want ErrVersion", err)
+	}
+}
@@ -0,0 +1,50 @@
+package snapshot
+
+import (
+	"clicktrainer/internal/db"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// PGStore keeps the snapshot in PostgreSQL, in a single row that every save
+// replaces.
+type PGStore struct {
+	DB *db.DB
+}
+
+func NewPGStore(database *db.DB) *PGStore {
+	return &PGStore{DB: database}
+}
+
+func (p *PGStore) Save(s Snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+	_, err = p.DB.Exec(`
+		INSERT INTO room_snapshots (id, saved_at, data) VALUES (1, $1, $2)
+		ON CONFLICT (id) DO UPDATE SET saved_at = EXCLUDED.saved_at, data = EXCLUDED.data
+	`, s.SavedAt, data)
+	if err != nil {
+		return fmt.Errorf("saving snapshot: %w", err)
+	}
+	return nil
+}
+
+func (p *PGStore) Load() (Snapshot, error) {
+	var data []byte
+	err := p.DB.QueryRow(`SELECT data FROM room_snapshots WHERE id = 1`).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Snapshot{Version: Version}, nil
+	}
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("loading snapshot: %w", err)
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Snapshot{}, fmt.Errorf("decoding snapshot: %w", err)
+	}
+	return check(s)
+}
@@ -0,0 +1,50 @@
+package snapshot
+
+import (
+	"clicktrainer/internal/db"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func getTestStore(t *testing.T) *PGStore {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping database tests")
+	}
+	database, err := db.Connect(dsn)
+	if err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate() error: %v", err)
+	}
+	t.Cleanup(func() {
+		// Clean up test data; errors here are intentionally ignored.
+		_, _ = database.Exec("DELETE FROM room_snapshots")
+		database.Close()
+	})
+	return NewPGStore(database)
+}
+
+func TestPGStore_RoundTrip(t *testing.T) {
+	store := getTestStore(t)
+
+	if got, err := store.Load(); err != nil || len(got.Rooms) != 0 {
+		t.Fatalf("Load() before any save = %+v, %v; want an empty snapshot", got, err)
+	}
+	want := sample()
+	for range 2 { // the second save replaces the first
+		if err := store.Save(want); err != nil {
+			t.Fatalf("Save() error: %v", err)
+		}
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
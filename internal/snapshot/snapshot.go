@@ -0,0 +1,70 @@
+// Package snapshot saves the state of open rooms so they survive a server
+// restart.
+package snapshot
+
+import (
+	"clicktrainer/internal/gamedata"
+	"clicktrainer/internal/ghost"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Version is the snapshot format written by this build. Snapshots in any
+// other format are refused rather than half-restored.
+const Version = 1
+
+// ErrVersion is returned by Load for a snapshot in an unknown format.
+var ErrVersion = errors.New("unsupported snapshot version")
+
+// Snapshot is every open room at one moment.
+type Snapshot struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"saved_at"`
+	Rooms   []Room    `json:"rooms"`
+}
+
+// Room is what a room needs to carry on after a restart. Connections,
+// timers and targets are not kept; a round in progress is not either.
+type Room struct {
+	Code       string                  `json:"code"`
+	HostID     string                  `json:"host_id,omitempty"`
+	CreatedAt  time.Time               `json:"created_at"`
+	LastActive time.Time               `json:"last_active"`
+	Locked     bool                    `json:"locked,omitempty"`
+	Banned     []string                `json:"banned,omitempty"`
+	Scene      gamedata.Scene          `json:"scene"`
+	Notice     string                  `json:"notice,omitempty"`
+	LateJoin   gamedata.LateJoinPolicy `json:"late_join"`
+	Lobby      gamedata.LobbySettings  `json:"lobby"`
+	Ghost      *ghost.Run              `json:"ghost,omitempty"` // run being raced, if any
+	Players    []Player                `json:"players"`         // scoreboard order, then spectators
+}
+
+// Player is a registered player. Ready flags are not kept: nobody is
+// connected when a room comes back.
+type Player struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	Score     int       `json:"score"`
+	JoinedAt  time.Time `json:"joined_at"`
+	LateJoin  string    `json:"late_join,omitempty"`
+	Spectator bool      `json:"spectator,omitempty"`
+	Handicap  float64   `json:"handicap,omitempty"`
+}
+
+// Store keeps the latest snapshot. Load returns an empty snapshot if none
+// has been saved.
+type Store interface {
+	Save(s Snapshot) error
+	Load() (Snapshot, error)
+}
+
+// check validates a loaded snapshot.
+func check(s Snapshot) (Snapshot, error) {
+	if s.Version != Version {
+		return Snapshot{}, fmt.Errorf("%w: %d", ErrVersion, s.Version)
+	}
+	return s, nil
+}
@@ -18,26 +18,37 @@ type Store struct {
 	mu      sync.Mutex
 	targets map[int]*Target
 	nextID  int
+	rng     *rand.Rand // decides where new targets go; see Seed
 }
 
 func NewStore() *Store {
 	return &Store{
 		targets: make(map[int]*Target),
 		nextID:  1,
+		rng:     rand.New(rand.NewSource(rand.Int63())),
 	}
 }
 
+// Seed sets the layout for targets added from now on: stores seeded alike
+// place their Nth target in the same spot, with the same size and color,
+// however long the targets before it lasted.
+func (s *Store) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rng = rand.New(rand.NewSource(seed))
+}
+
 func (s *Store) Add() *Target {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	id := s.nextID
 	s.nextID++
-	targetSize := rand.Intn(MaxTargetSize-MinTargetSize) + MinTargetSize
+	targetSize := s.rng.Intn(MaxTargetSize-MinTargetSize) + MinTargetSize
 	target := &Target{
 		ID:        id,
-		X:         rand.Intn(GameWidth - targetSize),
-		Y:         rand.Intn(GameHeight - targetSize),
-		Color:     utility.RandomColorHex(),
+		X:         s.rng.Intn(GameWidth - targetSize),
+		Y:         s.rng.Intn(GameHeight - targetSize),
+		Color:     utility.ColorHexFrom(s.rng),
 		Size:      targetSize,
 		SpawnedAt: time.Now(),
 	}
@@ -45,6 +56,17 @@ func (s *Store) Add() *Target {
 	return target
 }
 
+// Restore puts back a target recorded earlier, keeping its ID. IDs handed
+// out by Add continue after the highest restored.
+func (s *Store) Restore(t Target) *Target {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	target := &t
+	s.targets[t.ID] = target
+	s.nextID = max(s.nextID, t.ID+1)
+	return target
+}
+
 func (s *Store) Get(id int) *Target {
 	s.mu.Lock()
 	defer s.mu.Unlock()
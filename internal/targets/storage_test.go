@@ -119,3 +119,30 @@ func TestStore_Clear(t *testing.T) {
 		t.Errorf("after Clear(), new ID = %d, want 1", newTarget.ID)
 	}
 }
+
+func TestStore_Restore(t *testing.T) {
+	s := NewStore()
+	s.Restore(Target{ID: 7, X: 10, Y: 20, Size: 60})
+
+	if got := s.Get(7); got == nil || got.X != 10 || got.Size != 60 {
+		t.Errorf("Get(7) = %+v, want the restored target", got)
+	}
+	if next := s.Add(); next.ID != 8 {
+		t.Errorf("next ID = %d, want 8", next.ID)
+	}
+}
+
+func TestStore_SeedRepeatsLayout(t *testing.T) {
+	a, b := NewStore(), NewStore()
+	a.Seed(42)
+	b.Seed(42)
+
+	for i := 0; i < 5; i++ {
+		ta, tb := a.Add(), b.Add()
+		if ta.X != tb.X || ta.Y != tb.Y || ta.Size != tb.Size || ta.Color != tb.Color {
+			t.Fatalf("target %d: %+v and %+v, want the same layout", i+1, ta, tb)
+		}
+		// Killing targets in between doesn't change what comes next.
+		a.Kill(ta.ID)
+	}
+}
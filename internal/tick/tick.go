@@ -0,0 +1,194 @@
+// Package tick coalesces a room's frequent updates — score and rank
+// changes, target kills and spawns, cursor moves — so they reach clients as
+// one message per tick instead of one per event.
+package tick
+
+import (
+	"clicktrainer/internal/players"
+	"clicktrainer/internal/targets"
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultRate is how many ticks per second a room flushes at most, unless
+// the store is configured otherwise.
+const DefaultRate = 20
+
+// Kill is a target taken by a player.
+type Kill struct {
+	TargetID int
+	PlayerID string
+	X, Y     int // target position, for the kill effect
+	Points   int
+}
+
+// Cursor is a player's latest pointer position over the game area.
+type Cursor struct {
+	PlayerID string
+	X, Y     int
+}
+
+// Batch is everything that changed in a room since the last tick.
+type Batch struct {
+	Scores  []string             // players whose score changed, in order of first change
+	Kills   []Kill               // in order taken
+	Spawned []*targets.Target    // targets added and not already taken
+	Cursors []Cursor             // one per player who moved, latest position
+	Ranks   []players.RankChange // one per player who moved on the scoreboard
+}
+
+// Empty reports whether the batch holds nothing to send.
+func (b Batch) Empty() bool {
+	return len(b.Scores) == 0 && len(b.Kills) == 0 && len(b.Spawned) == 0 && len(b.Cursors) == 0 && len(b.Ranks) == 0
+}
+
+// FlushFunc sends a batch to a room's clients.
+type FlushFunc func(Batch)
+
+// Loop collects updates and flushes them at most once per interval. It
+// runs no timer while idle: the first update after a quiet spell is sent on
+// the next tick boundary, or straight away if a whole tick has passed.
+type Loop struct {
+	interval time.Duration
+	flush    FlushFunc
+	flushMu  sync.Mutex // keeps batches going out in order
+
+	mu        sync.Mutex
+	batch     Batch
+	cursorIdx map[string]int // player ID -> index in batch.Cursors
+	rankIdx   map[string]int // player ID -> index in batch.Ranks
+	timer     *time.Timer
+	lastFlush time.Time
+	stopped   bool
+}
+
+// New returns a loop flushing at most rate times per second until ctx is
+// done. A rate of zero or less uses DefaultRate.
+func New(ctx context.Context, rate int, flush FlushFunc) *Loop {
+	if rate <= 0 {
+		rate = DefaultRate
+	}
+	l := &Loop{
+		interval:  time.Second / time.Duration(rate),
+		flush:     flush,
+		cursorIdx: make(map[string]int),
+		rankIdx:   make(map[string]int),
+	}
+	context.AfterFunc(ctx, l.stop)
+	return l
+}
+
+// Interval returns the time between ticks.
+func (l *Loop) Interval() time.Duration {
+	return l.interval
+}
+
+// Kill records a target taken and its player's score change. A target
+// spawned and taken within the same tick is never sent at all.
+func (l *Loop) Kill(k Kill) {
+	l.add(func(b *Batch) {
+		if i := slices.IndexFunc(b.Spawned, func(t *targets.Target) bool { return t.ID == k.TargetID }); i >= 0 {
+			b.Spawned = slices.Delete(b.Spawned, i, i+1)
+		}
+		b.Kills = append(b.Kills, k)
+		if !slices.Contains(b.Scores, k.PlayerID) {
+			b.Scores = append(b.Scores, k.PlayerID)
+		}
+	})
+}
+
+// Spawn records a new target.
+func (l *Loop) Spawn(t *targets.Target) {
+	l.add(func(b *Batch) {
+		b.Spawned = append(b.Spawned, t)
+	})
+}
+
+// Move records a player's cursor position, replacing any earlier one in the
+// same tick.
+func (l *Loop) Move(playerID string, x, y int) {
+	l.add(func(b *Batch) {
+		if i, ok := l.cursorIdx[playerID]; ok {
+			b.Cursors[i] = Cursor{PlayerID: playerID, X: x, Y: y}
+			return
+		}
+		l.cursorIdx[playerID] = len(b.Cursors)
+		b.Cursors = append(b.Cursors, Cursor{PlayerID: playerID, X: x, Y: y})
+	})
+}
+
+// Rank records scoreboard moves. A player who moves more than once in a
+// tick is sent once, from their first old rank to their latest new one.
+func (l *Loop) Rank(changes []players.RankChange) {
+	l.add(func(b *Batch) {
+		for _, c := range changes {
+			if i, ok := l.rankIdx[c.PlayerID]; ok {
+				b.Ranks[i].New = c.New
+				continue
+			}
+			l.rankIdx[c.PlayerID] = len(b.Ranks)
+			b.Ranks = append(b.Ranks, c)
+		}
+	})
+}
+
+// Flush sends anything pending now, e.g. before a scene change replaces
+// what the updates apply to.
+func (l *Loop) Flush() {
+	l.mu.Lock()
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.mu.Unlock()
+	l.tick()
+}
+
+func (l *Loop) add(update func(b *Batch)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		return
+	}
+	update(&l.batch)
+	if l.timer == nil {
+		wait := max(l.interval-time.Since(l.lastFlush), 0)
+		l.timer = time.AfterFunc(wait, l.tick)
+	}
+}
+
+func (l *Loop) tick() {
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+
+	l.mu.Lock()
+	if l.stopped {
+		l.mu.Unlock()
+		return
+	}
+	b := l.batch
+	l.batch = Batch{}
+	clear(l.cursorIdx)
+	clear(l.rankIdx)
+	l.timer = nil
+	l.lastFlush = time.Now()
+	l.mu.Unlock()
+
+	if !b.Empty() {
+		l.flush(b)
+	}
+}
+
+// stop drops pending updates and ignores later ones.
+func (l *Loop) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopped = true
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.batch = Batch{}
+}
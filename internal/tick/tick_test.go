@@ -0,0 +1,159 @@
+package tick
+
+import (
+	"clicktrainer/internal/players"
+	"clicktrainer/internal/targets"
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recorder collects flushed batches.
+type recorder chan Batch
+
+func (r recorder) flush(b Batch) { r <- b }
+
+func (r recorder) next(t *testing.T) Batch {
+	t.Helper()
+	select {
+	case b := <-r:
+		return b
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a tick")
+		return Batch{}
+	}
+}
+
+func (r recorder) none(t *testing.T, wait time.Duration) {
+	t.Helper()
+	select {
+	case b := <-r:
+		t.Fatalf("unexpected tick: %+v", b)
+	case <-time.After(wait):
+	}
+}
+
+func TestLoop_CoalescesWithinTick(t *testing.T) {
+	rec := make(recorder, 10)
+	l := New(context.Background(), 10, rec.flush)
+
+	// The first update after a quiet spell goes out at once.
+	l.Move("p1", 1, 1)
+	if b := rec.next(t); len(b.Cursors) != 1 {
+		t.Fatalf("first tick = %+v, want one cursor", b)
+	}
+
+	// Everything in the next 100ms is one batch.
+	l.Move("p1", 2, 2)
+	l.Move("p2", 5, 5)
+	l.Move("p1", 3, 3)
+	l.Kill(Kill{TargetID: 1, PlayerID: "p2", Points: 2})
+	l.Kill(Kill{TargetID: 2, PlayerID: "p2", Points: 3})
+	l.Kill(Kill{TargetID: 3, PlayerID: "p1", Points: 1})
+
+	b := rec.next(t)
+	want := []Cursor{{"p1", 3, 3}, {"p2", 5, 5}}
+	if len(b.Cursors) != 2 || b.Cursors[0] != want[0] || b.Cursors[1] != want[1] {
+		t.Errorf("cursors = %+v, want latest per player %+v", b.Cursors, want)
+	}
+	if len(b.Kills) != 3 {
+		t.Errorf("kills = %d, want 3", len(b.Kills))
+	}
+	if len(b.Scores) != 2 || b.Scores[0] != "p2" || b.Scores[1] != "p1" {
+		t.Errorf("scores = %v, want [p2 p1]", b.Scores)
+	}
+	rec.none(t, 150*time.Millisecond)
+}
+
+func TestLoop_RespectsRate(t *testing.T) {
+	rec := make(recorder, 10)
+	l := New(context.Background(), 10, rec.flush)
+
+	l.Move("p1", 1, 1)
+	first := time.Now()
+	rec.next(t)
+	l.Move("p1", 2, 2)
+	rec.next(t)
+	if gap := time.Since(first); gap < 90*time.Millisecond {
+		t.Errorf("second tick after %v, want at least one interval", gap)
+	}
+}
+
+func TestLoop_KillCancelsPendingSpawn(t *testing.T) {
+	rec := make(recorder, 10)
+	l := New(context.Background(), 10, rec.flush)
+	l.Move("p1", 0, 0)
+	rec.next(t)
+
+	l.Spawn(&targets.Target{ID: 7})
+	l.Spawn(&targets.Target{ID: 8})
+	l.Kill(Kill{TargetID: 7, PlayerID: "p1", Points: 1})
+
+	b := rec.next(t)
+	if len(b.Spawned) != 1 || b.Spawned[0].ID != 8 {
+		t.Errorf("spawned = %+v, want only target 8", b.Spawned)
+	}
+	if len(b.Kills) != 1 {
+		t.Errorf("kills = %+v, want the kill kept for its score and effect", b.Kills)
+	}
+}
+
+func TestLoop_Flush(t *testing.T) {
+	rec := make(recorder, 10)
+	l := New(context.Background(), 1, rec.flush)
+	l.Move("p1", 0, 0)
+	rec.next(t)
+
+	l.Move("p1", 1, 1)
+	l.Flush()
+	select {
+	case b := <-rec:
+		if len(b.Cursors) != 1 {
+			t.Errorf("flushed %+v, want the pending cursor", b)
+		}
+	default:
+		t.Fatal("Flush should send pending updates straight away")
+	}
+	// Nothing is left for the timer.
+	rec.none(t, 50*time.Millisecond)
+	l.Flush()
+	rec.none(t, 10*time.Millisecond)
+}
+
+func TestLoop_StopsWithContext(t *testing.T) {
+	rec := make(recorder, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	l := New(ctx, 10, rec.flush)
+	l.Move("p1", 0, 0)
+	rec.next(t)
+
+	l.Move("p1", 1, 1)
+	cancel()
+	time.Sleep(10 * time.Millisecond) // context.AfterFunc runs in its own goroutine
+	l.Move("p1", 2, 2)
+	rec.none(t, 150*time.Millisecond)
+}
+
+func TestNew_DefaultRate(t *testing.T) {
+	l := New(context.Background(), 0, func(Batch) {})
+	if l.Interval() != time.Second/DefaultRate {
+		t.Errorf("Interval() = %v, want %v", l.Interval(), time.Second/DefaultRate)
+	}
+}
+
+func TestLoop_CoalescesRankChanges(t *testing.T) {
+	rec := make(recorder, 10)
+	l := New(context.Background(), 10, rec.flush)
+	l.Move("p1", 0, 0)
+	rec.next(t)
+
+	l.Rank([]players.RankChange{{PlayerID: "p2", Old: 3, New: 2}, {PlayerID: "p1", Old: 2, New: 3}})
+	l.Rank([]players.RankChange{{PlayerID: "p2", Old: 2, New: 1}, {PlayerID: "p3", Old: 1, New: 2}})
+
+	b := rec.next(t)
+	want := []players.RankChange{{PlayerID: "p2", Old: 3, New: 1}, {PlayerID: "p1", Old: 2, New: 3}, {PlayerID: "p3", Old: 1, New: 2}}
+	if !slices.Equal(b.Ranks, want) {
+		t.Errorf("ranks = %v, want %v", b.Ranks, want)
+	}
+}
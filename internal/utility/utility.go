@@ -6,8 +6,18 @@ import (
 )
 
 func RandomColorHex() string {
-	r := uint8(rand.Intn(248) + 4)
-	g := uint8(rand.Intn(248) + 4)
-	b := uint8(rand.Intn(248) + 4)
+	return colorHex(rand.Intn)
+}
+
+// ColorHexFrom is RandomColorHex drawing from r, so a seeded source gives
+// the same colors every time.
+func ColorHexFrom(r *rand.Rand) string {
+	return colorHex(r.Intn)
+}
+
+func colorHex(intn func(int) int) string {
+	r := uint8(intn(248) + 4)
+	g := uint8(intn(248) + 4)
+	b := uint8(intn(248) + 4)
 	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
 }
@@ -0,0 +1,408 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Options tunes delivery. Zero fields take the defaults below.
+type Options struct {
+	Client      *http.Client  // default: 10s timeout
+	MaxAttempts int           // attempts before dead-lettering; default 5
+	Backoff     time.Duration // delay before the first retry, doubled each time; default 1s
+	MaxBackoff  time.Duration // cap on the retry delay; default 1m
+	Workers     int           // concurrent deliveries; default 4
+	QueueSize   int           // deliveries waiting for a worker; default 256
+}
+
+func (o Options) withDefaults() Options {
+	if o.Client == nil {
+		o.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Minute
+	}
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 256
+	}
+	return o
+}
+
+type delivery struct {
+	id       string
+	endpoint Endpoint
+	event    string
+	body     []byte
+	attempts int    // made so far
+	lastErr  string // from the latest attempt
+}
+
+// endpointsTTL bounds how long Dispatch trusts its cached endpoint list, so
+// endpoints added or removed by another instance sharing the store are
+// picked up. Changes made through this dispatcher apply straight away.
+const endpointsTTL = 30 * time.Second
+
+// Dispatcher queues events for the endpoints subscribed to them and delivers
+// them from a pool of workers. A failed delivery waits out its backoff on a
+// timer and then rejoins the queue, so a dead endpoint doesn't hold a worker.
+type Dispatcher struct {
+	storeMu sync.RWMutex
+	store   Store
+
+	cacheMu   sync.Mutex
+	endpoints []Endpoint // cached for Dispatch; valid while cacheOK
+	cacheOK   bool
+	cachedAt  time.Time
+	cacheGen  int // bumped by invalidate, so a load that raced it is discarded
+
+	retryMu     sync.Mutex
+	retries     map[int]*retry // deliveries waiting out their backoff
+	nextRetryID int
+
+	opts  Options
+	queue chan delivery
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewDispatcher(store Store, opts Options) *Dispatcher {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		store:   store,
+		retries: make(map[int]*retry),
+		opts:    opts,
+		queue:   make(chan delivery, opts.QueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	for range opts.Workers {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+// Store returns the dispatcher's endpoint store.
+func (d *Dispatcher) Store() Store {
+	d.storeMu.RLock()
+	defer d.storeMu.RUnlock()
+	return d.store
+}
+
+// SetStore moves the dispatcher to store, copying over the endpoints of the
+// one it had, e.g. when the database comes up after endpoints were added in
+// memory. Copied endpoints keep their IDs, so copying one twice replaces it.
+// If any copy fails, the ones already made are removed again and the
+// dispatcher stays on its old store.
+func (d *Dispatcher) SetStore(store Store) error {
+	d.storeMu.Lock()
+	defer d.storeMu.Unlock()
+	endpoints, err := d.store.Endpoints()
+	if err != nil {
+		return fmt.Errorf("listing webhook endpoints to move: %w", err)
+	}
+	for i, ep := range endpoints {
+		if _, err := store.AddEndpoint(ep); err != nil {
+			for _, copied := range endpoints[:i] {
+				if err := store.DeleteEndpoint(copied.ID); err != nil {
+					slog.Error("removing copied webhook endpoint failed", "component", "webhooks", "endpoint_id", copied.ID, "error", err)
+				}
+			}
+			return fmt.Errorf("moving webhook endpoint %s: %w", ep.ID, err)
+		}
+	}
+	d.store = store
+	d.invalidate()
+	return nil
+}
+
+// AddEndpoint registers e with the store and has Dispatch pick it up.
+func (d *Dispatcher) AddEndpoint(e Endpoint) (Endpoint, error) {
+	ep, err := d.Store().AddEndpoint(e)
+	if err == nil {
+		d.invalidate()
+	}
+	return ep, err
+}
+
+// DeleteEndpoint removes an endpoint from the store and stops Dispatch
+// queueing events for it. Deliveries already queued still go out.
+func (d *Dispatcher) DeleteEndpoint(id string) error {
+	err := d.Store().DeleteEndpoint(id)
+	if err == nil {
+		d.invalidate()
+	}
+	return err
+}
+
+// cachedEndpoints returns the store's endpoints, loading them at most once
+// per endpointsTTL.
+func (d *Dispatcher) cachedEndpoints() ([]Endpoint, error) {
+	d.cacheMu.Lock()
+	if d.cacheOK && time.Since(d.cachedAt) < endpointsTTL {
+		defer d.cacheMu.Unlock()
+		return d.endpoints, nil
+	}
+	gen := d.cacheGen
+	d.cacheMu.Unlock()
+
+	endpoints, err := d.Store().Endpoints()
+	if err != nil {
+		return nil, err
+	}
+	d.cacheMu.Lock()
+	defer d.cacheMu.Unlock()
+	if gen == d.cacheGen {
+		d.endpoints, d.cacheOK, d.cachedAt = endpoints, true, time.Now()
+	}
+	return endpoints, nil
+}
+
+func (d *Dispatcher) invalidate() {
+	d.cacheMu.Lock()
+	defer d.cacheMu.Unlock()
+	d.endpoints, d.cacheOK = nil, false
+	d.cacheGen++
+}
+
+// Dispatch queues event for every endpoint subscribed to it. It never
+// blocks; if the queue is full the delivery is dead-lettered straight away.
+func (d *Dispatcher) Dispatch(event, roomCode string, data any) {
+	endpoints, err := d.cachedEndpoints()
+	if err != nil {
+		slog.Error("listing webhook endpoints failed", "component", "webhooks", "error", err)
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	for _, ep := range endpoints {
+		if !ep.Wants(event) {
+			continue
+		}
+		p := Payload{
+			ID:        uuid.New().String(),
+			Event:     event,
+			Timestamp: time.Now().UTC(),
+			RoomCode:  roomCode,
+			Data:      data,
+		}
+		body, err := json.Marshal(p)
+		if err != nil {
+			slog.Error("marshal webhook payload failed", "component", "webhooks", "event", event, "error", err)
+			return
+		}
+		dl := delivery{id: p.ID, endpoint: ep, event: event, body: body}
+		select {
+		case d.queue <- dl:
+		default:
+			d.deadLetter(dl, 0, "delivery queue full")
+		}
+	}
+}
+
+// Close stops accepting events, cancels requests in flight and waits for the
+// workers to exit. Anything not yet delivered, including deliveries waiting
+// to retry, is dead-lettered.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+
+	d.cancel()
+	d.wg.Wait()
+
+	d.retryMu.Lock()
+	pending := d.retries
+	d.retries = make(map[int]*retry)
+	d.retryMu.Unlock()
+	for _, r := range pending {
+		r.timer.Stop()
+		d.deadLetter(r.dl, r.dl.attempts, stoppedReason(r.dl))
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for dl := range d.queue {
+		if d.ctx.Err() != nil {
+			d.deadLetter(dl, dl.attempts, stoppedReason(dl))
+			continue
+		}
+		d.deliver(dl)
+	}
+}
+
+// deliver makes the next attempt at dl. If it fails in a way worth retrying
+// and attempts remain, dl is scheduled to rejoin the queue after a backoff;
+// otherwise it is dead-lettered.
+func (d *Dispatcher) deliver(dl delivery) {
+	dl.attempts++
+	start := time.Now()
+	status, err := d.send(dl)
+	a := Attempt{
+		DeliveryID: dl.id,
+		EndpointID: dl.endpoint.ID,
+		Event:      dl.event,
+		Attempt:    dl.attempts,
+		StatusCode: status,
+		DurationMs: int(time.Since(start).Milliseconds()),
+		At:         start,
+	}
+	retry := true
+	switch {
+	case err != nil:
+		dl.lastErr = err.Error()
+	case status >= 200 && status < 300:
+		d.logAttempt(a)
+		return
+	default:
+		dl.lastErr = "HTTP " + strconv.Itoa(status)
+		retry = retryable(status)
+	}
+	a.Error = dl.lastErr
+	d.logAttempt(a)
+	if !retry || dl.attempts >= d.opts.MaxAttempts {
+		d.deadLetter(dl, dl.attempts, dl.lastErr)
+		return
+	}
+	d.retryLater(dl)
+}
+
+// retry is a delivery waiting out its backoff.
+type retry struct {
+	dl    delivery
+	timer *time.Timer
+}
+
+// retryLater puts dl back on the queue once its backoff has passed.
+func (d *Dispatcher) retryLater(dl delivery) {
+	d.retryMu.Lock()
+	defer d.retryMu.Unlock()
+	id := d.nextRetryID
+	d.nextRetryID++
+	r := &retry{dl: dl}
+	d.retries[id] = r
+	r.timer = time.AfterFunc(d.backoff(dl.attempts), func() { d.requeue(id) })
+}
+
+// requeue moves a retry whose backoff has passed back onto the queue. If
+// Close already took it, there is nothing to do.
+func (d *Dispatcher) requeue(id int) {
+	d.retryMu.Lock()
+	r, ok := d.retries[id]
+	delete(d.retries, id)
+	d.retryMu.Unlock()
+	if !ok {
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		d.deadLetter(r.dl, r.dl.attempts, stoppedReason(r.dl))
+		return
+	}
+	select {
+	case d.queue <- r.dl:
+	default:
+		d.deadLetter(r.dl, r.dl.attempts, "delivery queue full: "+r.dl.lastErr)
+	}
+}
+
+func stoppedReason(dl delivery) string {
+	if dl.lastErr == "" {
+		return "dispatcher stopped"
+	}
+	return "dispatcher stopped: " + dl.lastErr
+}
+
+func (d *Dispatcher) send(dl delivery) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, dl.endpoint.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return 0, fmt.Errorf("building request: %w", err)
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "clicktrainer-webhooks")
+	req.Header.Set(HeaderEvent, dl.event)
+	req.Header.Set(HeaderDelivery, dl.id)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(dl.endpoint.Secret, now, dl.body))
+
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before retry n (1-based).
+func (d *Dispatcher) backoff(n int) time.Duration {
+	delay := d.opts.Backoff
+	for i := 1; i < n && delay < d.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.opts.MaxBackoff)
+}
+
+func (d *Dispatcher) logAttempt(a Attempt) {
+	if err := d.Store().LogAttempt(a); err != nil {
+		slog.Error("logging webhook attempt failed", "component", "webhooks", "delivery_id", a.DeliveryID, "error", err)
+	}
+}
+
+func (d *Dispatcher) deadLetter(dl delivery, attempts int, reason string) {
+	slog.Warn("webhook dead-lettered", "component", "webhooks", "delivery_id", dl.id, "endpoint_id", dl.endpoint.ID, "event", dl.event, "attempts", attempts, "reason", reason)
+	err := d.Store().AddDeadLetter(DeadLetter{
+		DeliveryID: dl.id,
+		EndpointID: dl.endpoint.ID,
+		Event:      dl.event,
+		Payload:    dl.body,
+		Attempts:   attempts,
+		LastError:  reason,
+		At:         time.Now(),
+	})
+	if err != nil {
+		slog.Error("recording webhook dead letter failed", "component", "webhooks", "delivery_id", dl.id, "error", err)
+	}
+}
+
+// retryable reports whether a response status is worth retrying: server
+// errors, timeouts and rate limiting. Other client errors won't get better.
+func retryable(status int) bool {
+	return status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
@@ -0,0 +1,412 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a local webhook endpoint that records what it is sent and
+// answers with the next status in its script (200 once the script runs out).
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+	got      chan struct{}
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+	t.Helper()
+	r := &receiver{statuses: statuses, got: make(chan struct{}, 100)}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+		w.WriteHeader(status)
+		r.got <- struct{}{}
+	}))
+	t.Cleanup(ts.Close)
+	return r, ts
+}
+
+func (r *receiver) wait(t *testing.T, n int) {
+	t.Helper()
+	for range n {
+		select {
+		case <-r.got:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for delivery")
+		}
+	}
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func newTestDispatcher(t *testing.T, store Store) *Dispatcher {
+	t.Helper()
+	d := NewDispatcher(store, Options{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Workers: 1})
+	t.Cleanup(d.Close)
+	return d
+}
+
+func addEndpoint(t *testing.T, store Store, url string, events ...string) Endpoint {
+	t.Helper()
+	ep, err := store.AddEndpoint(Endpoint{URL: url, Secret: "s3cret", Events: events})
+	if err != nil {
+		t.Fatalf("AddEndpoint: %v", err)
+	}
+	return ep
+}
+
+// waitFor polls cond until it holds, since the store is written after the
+// receiver has answered.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	recv, ts := newReceiver(t)
+	store := NewMemoryStore()
+	ep := addEndpoint(t, store, ts.URL, EventRoundEnded)
+	d := newTestDispatcher(t, store)
+
+	d.Dispatch(EventRoundEnded, "ABCD", map[string]int{"players": 2})
+	recv.wait(t, 1)
+
+	recv.mu.Lock()
+	req, body := recv.requests[0], recv.bodies[0]
+	recv.mu.Unlock()
+
+	if got := req.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := req.Header.Get(HeaderEvent); got != EventRoundEnded {
+		t.Errorf("%s = %q, want %q", HeaderEvent, got, EventRoundEnded)
+	}
+	if !Verify(ep.Secret, req.Header.Get(HeaderTimestamp), req.Header.Get(HeaderSignature), body) {
+		t.Error("signature did not verify")
+	}
+	if Verify("wrong", req.Header.Get(HeaderTimestamp), req.Header.Get(HeaderSignature), body) {
+		t.Error("signature verified with the wrong secret")
+	}
+
+	var p struct {
+		ID       string         `json:"id"`
+		Event    string         `json:"event"`
+		RoomCode string         `json:"room_code"`
+		Data     map[string]int `json:"data"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if p.Event != EventRoundEnded || p.RoomCode != "ABCD" || p.Data["players"] != 2 {
+		t.Errorf("payload = %+v", p)
+	}
+	if p.ID != req.Header.Get(HeaderDelivery) {
+		t.Errorf("payload id %q != delivery header %q", p.ID, req.Header.Get(HeaderDelivery))
+	}
+
+	waitFor(t, "attempt log", func() bool {
+		attempts, _ := store.Attempts(10)
+		return len(attempts) == 1 && attempts[0].StatusCode == http.StatusOK
+	})
+}
+
+func TestDispatcher_FiltersByEvent(t *testing.T) {
+	recv, ts := newReceiver(t)
+	store := NewMemoryStore()
+	addEndpoint(t, store, ts.URL, EventBadgeAwarded)
+	d := newTestDispatcher(t, store)
+
+	d.Dispatch(EventRoundEnded, "ABCD", nil)
+	d.Dispatch(EventBadgeAwarded, "ABCD", nil)
+	recv.wait(t, 1)
+
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	if len(recv.requests) != 1 || recv.requests[0].Header.Get(HeaderEvent) != EventBadgeAwarded {
+		t.Errorf("received %d requests, want only the badge event", len(recv.requests))
+	}
+}
+
+func TestDispatcher_RetriesThenSucceeds(t *testing.T) {
+	recv, ts := newReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	store := NewMemoryStore()
+	addEndpoint(t, store, ts.URL, EventRoundEnded)
+	d := newTestDispatcher(t, store)
+
+	d.Dispatch(EventRoundEnded, "ABCD", nil)
+	recv.wait(t, 3)
+
+	recv.mu.Lock()
+	first := recv.requests[0].Header.Get(HeaderDelivery)
+	for _, req := range recv.requests[1:] {
+		if req.Header.Get(HeaderDelivery) != first {
+			t.Error("retries should keep the delivery ID")
+		}
+	}
+	recv.mu.Unlock()
+
+	waitFor(t, "three logged attempts", func() bool {
+		attempts, _ := store.Attempts(10)
+		return len(attempts) == 3
+	})
+	attempts, _ := store.Attempts(10)
+	if attempts[0].Attempt != 3 || attempts[0].StatusCode != http.StatusOK {
+		t.Errorf("latest attempt = %+v, want #3 with 200", attempts[0])
+	}
+	if attempts[2].Error != "HTTP 503" {
+		t.Errorf("first attempt error = %q, want HTTP 503", attempts[2].Error)
+	}
+	if dead, _ := store.DeadLetters(10); len(dead) != 0 {
+		t.Errorf("dead letters = %d, want 0", len(dead))
+	}
+}
+
+func TestDispatcher_DeadLettersAfterMaxAttempts(t *testing.T) {
+	recv, ts := newReceiver(t, 500, 500, 500, 500)
+	store := NewMemoryStore()
+	ep := addEndpoint(t, store, ts.URL, EventRoundEnded)
+	d := newTestDispatcher(t, store)
+
+	d.Dispatch(EventRoundEnded, "ABCD", nil)
+	recv.wait(t, 3)
+
+	waitFor(t, "dead letter", func() bool {
+		dead, _ := store.DeadLetters(10)
+		return len(dead) == 1
+	})
+	dead, _ := store.DeadLetters(10)
+	if dead[0].EndpointID != ep.ID || dead[0].Attempts != 3 || dead[0].LastError != "HTTP 500" {
+		t.Errorf("dead letter = %+v", dead[0])
+	}
+	if !json.Valid(dead[0].Payload) {
+		t.Error("dead letter should keep the JSON payload")
+	}
+	if n := recv.count(); n != 3 {
+		t.Errorf("receiver got %d requests, want 3", n)
+	}
+}
+
+func TestDispatcher_ClientErrorIsNotRetried(t *testing.T) {
+	recv, ts := newReceiver(t, http.StatusBadRequest)
+	store := NewMemoryStore()
+	addEndpoint(t, store, ts.URL, EventRoundEnded)
+	d := newTestDispatcher(t, store)
+
+	d.Dispatch(EventRoundEnded, "ABCD", nil)
+	recv.wait(t, 1)
+
+	waitFor(t, "dead letter", func() bool {
+		dead, _ := store.DeadLetters(10)
+		return len(dead) == 1
+	})
+	dead, _ := store.DeadLetters(10)
+	if dead[0].Attempts != 1 {
+		t.Errorf("attempts = %d, want 1", dead[0].Attempts)
+	}
+	if n := recv.count(); n != 1 {
+		t.Errorf("receiver got %d requests, want 1", n)
+	}
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := &Dispatcher{opts: Options{Backoff: time.Second, MaxBackoff: 5 * time.Second}}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := d.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestDispatcher_CloseDropsNewEvents(t *testing.T) {
+	recv, ts := newReceiver(t)
+	store := NewMemoryStore()
+	addEndpoint(t, store, ts.URL, EventRoundEnded)
+	d := NewDispatcher(store, Options{})
+	d.Close()
+	d.Close()
+
+	d.Dispatch(EventRoundEnded, "ABCD", nil)
+	time.Sleep(20 * time.Millisecond)
+	if n := recv.count(); n != 0 {
+		t.Errorf("receiver got %d requests after Close, want 0", n)
+	}
+}
+
+func TestDispatcher_SetStoreMovesEndpoints(t *testing.T) {
+	recv, ts := newReceiver(t)
+	before := NewMemoryStore()
+	addEndpoint(t, before, ts.URL, EventRoundEnded)
+	d := newTestDispatcher(t, before)
+
+	after := NewMemoryStore()
+	if err := d.SetStore(after); err != nil {
+		t.Fatalf("SetStore: %v", err)
+	}
+	if d.Store() != after {
+		t.Fatal("Store() should return the new store")
+	}
+	if eps, _ := after.Endpoints(); len(eps) != 1 || eps[0].URL != ts.URL {
+		t.Fatalf("new store endpoints = %+v, want the one added before", eps)
+	}
+
+	d.Dispatch(EventRoundEnded, "ABCD", nil)
+	recv.wait(t, 1)
+	waitFor(t, "the attempt logged in the new store", func() bool {
+		attempts, _ := after.Attempts(10)
+		return len(attempts) == 1
+	})
+}
+
+func TestDispatcher_RetryDoesNotHoldWorker(t *testing.T) {
+	dead, deadTS := newReceiver(t, http.StatusServiceUnavailable)
+	live, liveTS := newReceiver(t)
+	store := NewMemoryStore()
+	deadEP := addEndpoint(t, store, deadTS.URL, EventRoundEnded)
+	addEndpoint(t, store, liveTS.URL, EventBadgeAwarded)
+	d := NewDispatcher(store, Options{MaxAttempts: 3, Backoff: time.Hour, Workers: 1})
+
+	d.Dispatch(EventRoundEnded, "ABCD", nil)
+	dead.wait(t, 1)
+	d.Dispatch(EventBadgeAwarded, "ABCD", nil)
+	live.wait(t, 1) // would wait out the hour if the retry held the only worker
+	waitFor(t, "both attempts logged", func() bool {
+		attempts, _ := store.Attempts(10)
+		return len(attempts) == 2
+	})
+
+	d.Close()
+	letters, _ := store.DeadLetters(10)
+	if len(letters) != 1 {
+		t.Fatalf("dead letters = %+v, want the retry pending at Close", letters)
+	}
+	if l := letters[0]; l.EndpointID != deadEP.ID || l.Attempts != 1 || l.LastError != "dispatcher stopped: HTTP 503" {
+		t.Errorf("dead letter = %+v", l)
+	}
+}
+
+func TestDispatcher_SetStoreKeepsIDs(t *testing.T) {
+	before := NewMemoryStore()
+	ep := addEndpoint(t, before, "http://example.test/hook", EventRoundEnded)
+	after := NewMemoryStore()
+
+	// A second move, say after a restart, replaces the copy instead of
+	// adding another.
+	for range 2 {
+		if err := NewDispatcher(before, Options{}).SetStore(after); err != nil {
+			t.Fatalf("SetStore: %v", err)
+		}
+	}
+	if eps, _ := after.Endpoints(); len(eps) != 1 || eps[0].ID != ep.ID {
+		t.Errorf("new store endpoints = %+v, want just %s", eps, ep.ID)
+	}
+}
+
+// failingStore fails AddEndpoint once it has added ok endpoints.
+type failingStore struct {
+	*MemoryStore
+	ok int
+}
+
+func (s *failingStore) AddEndpoint(e Endpoint) (Endpoint, error) {
+	if s.ok == 0 {
+		return Endpoint{}, errors.New("database went away")
+	}
+	s.ok--
+	return s.MemoryStore.AddEndpoint(e)
+}
+
+func TestDispatcher_SetStoreRollsBack(t *testing.T) {
+	before := NewMemoryStore()
+	addEndpoint(t, before, "http://example.test/one", EventRoundEnded)
+	addEndpoint(t, before, "http://example.test/two", EventRoundEnded)
+	d := newTestDispatcher(t, before)
+
+	after := &failingStore{MemoryStore: NewMemoryStore(), ok: 1}
+	if err := d.SetStore(after); err == nil {
+		t.Fatal("SetStore should fail when an endpoint can't be copied")
+	}
+	if d.Store() != before {
+		t.Error("dispatcher should stay on its old store")
+	}
+	if eps, _ := after.Endpoints(); len(eps) != 0 {
+		t.Errorf("new store endpoints = %+v, want the partial copy removed", eps)
+	}
+}
+
+// countingStore counts endpoint listings.
+type countingStore struct {
+	*MemoryStore
+	mu    sync.Mutex
+	lists int
+}
+
+func (s *countingStore) Endpoints() ([]Endpoint, error) {
+	s.mu.Lock()
+	s.lists++
+	s.mu.Unlock()
+	return s.MemoryStore.Endpoints()
+}
+
+func (s *countingStore) listed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lists
+}
+
+func TestDispatcher_CachesEndpoints(t *testing.T) {
+	recv, ts := newReceiver(t)
+	store := &countingStore{MemoryStore: NewMemoryStore()}
+	d := newTestDispatcher(t, store)
+
+	for range 3 {
+		d.Dispatch(EventRoundEnded, "ABCD", nil)
+	}
+	if n := store.listed(); n != 1 {
+		t.Errorf("store listed endpoints %d times for 3 events, want 1", n)
+	}
+
+	ep, err := d.AddEndpoint(Endpoint{URL: ts.URL, Secret: "s3cret", Events: []string{EventRoundEnded}})
+	if err != nil {
+		t.Fatalf("AddEndpoint: %v", err)
+	}
+	d.Dispatch(EventRoundEnded, "ABCD", nil)
+	recv.wait(t, 1)
+
+	if err := d.DeleteEndpoint(ep.ID); err != nil {
+		t.Fatalf("DeleteEndpoint: %v", err)
+	}
+	d.Dispatch(EventRoundEnded, "ABCD", nil)
+	time.Sleep(20 * time.Millisecond)
+	if n := recv.count(); n != 1 {
+		t.Errorf("receiver got %d requests, want none after the endpoint was deleted", n)
+	}
+	if n := store.listed(); n != 3 {
+		t.Errorf("store listed endpoints %d times, want once more after each change", n)
+	}
+}
@@ -0,0 +1,102 @@
+package webhooks
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memLogLimit caps how many attempts and dead letters MemoryStore keeps.
+const memLogLimit = 1000
+
+// MemoryStore keeps webhooks in memory, for running without a database.
+// Everything is lost on restart.
+type MemoryStore struct {
+	mu          sync.Mutex
+	endpoints   []Endpoint
+	attempts    []Attempt
+	deadLetters []DeadLetter
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (m *MemoryStore) Endpoints() ([]Endpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.endpoints), nil
+}
+
+func (m *MemoryStore) AddEndpoint(e Endpoint) (Endpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	if i := slices.IndexFunc(m.endpoints, func(x Endpoint) bool { return x.ID == e.ID }); i >= 0 {
+		m.endpoints[i] = e
+		return e, nil
+	}
+	m.endpoints = append(m.endpoints, e)
+	return e, nil
+}
+
+func (m *MemoryStore) DeleteEndpoint(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.endpoints, func(e Endpoint) bool { return e.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	m.endpoints = slices.Delete(m.endpoints, i, i+1)
+	return nil
+}
+
+func (m *MemoryStore) LogAttempt(a Attempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts = appendCapped(m.attempts, a)
+	return nil
+}
+
+func (m *MemoryStore) Attempts(limit int) ([]Attempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return newestFirst(m.attempts, limit), nil
+}
+
+func (m *MemoryStore) AddDeadLetter(d DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deadLetters = appendCapped(m.deadLetters, d)
+	return nil
+}
+
+func (m *MemoryStore) DeadLetters(limit int) ([]DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return newestFirst(m.deadLetters, limit), nil
+}
+
+func appendCapped[T any](s []T, v T) []T {
+	s = append(s, v)
+	if len(s) > memLogLimit {
+		s = slices.Delete(s, 0, len(s)-memLogLimit)
+	}
+	return s
+}
+
+func newestFirst[T any](s []T, limit int) []T {
+	out := slices.Clone(s)
+	slices.Reverse(out)
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
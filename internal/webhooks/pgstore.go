@@ -0,0 +1,147 @@
+package webhooks
+
+import (
+	"clicktrainer/internal/db"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// PGStore keeps webhooks in PostgreSQL.
+type PGStore struct {
+	DB *db.DB
+}
+
+func NewPGStore(database *db.DB) *PGStore {
+	return &PGStore{DB: database}
+}
+
+func (s *PGStore) Endpoints() ([]Endpoint, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, url, secret, events, created_at FROM webhook_endpoints ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("listing webhook endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var endpoints []Endpoint
+	for rows.Next() {
+		var e Endpoint
+		if err := rows.Scan(&e.ID, &e.URL, &e.Secret, pq.Array(&e.Events), &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, rows.Err()
+}
+
+func (s *PGStore) AddEndpoint(e Endpoint) (Endpoint, error) {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	err := s.DB.QueryRow(`
+		INSERT INTO webhook_endpoints (id, url, secret, events, created_at)
+		VALUES ($1, $2, $3, $4, COALESCE($5, now()))
+		ON CONFLICT (id) DO UPDATE SET url = EXCLUDED.url, secret = EXCLUDED.secret, events = EXCLUDED.events
+		RETURNING created_at
+	`, e.ID, e.URL, e.Secret, pq.Array(e.Events), sql.NullTime{Time: e.CreatedAt, Valid: !e.CreatedAt.IsZero()}).Scan(&e.CreatedAt)
+	if err != nil {
+		return Endpoint{}, fmt.Errorf("adding webhook endpoint: %w", err)
+	}
+	return e, nil
+}
+
+func (s *PGStore) DeleteEndpoint(id string) error {
+	res, err := s.DB.Exec(`DELETE FROM webhook_endpoints WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("deleting webhook endpoint: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PGStore) LogAttempt(a Attempt) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO webhook_attempts (delivery_id, endpoint_id, event, attempt, status_code, error, duration_ms, attempted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, a.DeliveryID, a.EndpointID, a.Event, a.Attempt, nullInt(a.StatusCode), nullString(a.Error), a.DurationMs, a.At)
+	if err != nil {
+		return fmt.Errorf("logging webhook attempt: %w", err)
+	}
+	return nil
+}
+
+func (s *PGStore) Attempts(limit int) ([]Attempt, error) {
+	rows, err := s.DB.Query(`
+		SELECT delivery_id, endpoint_id, event, attempt, status_code, error, duration_ms, attempted_at
+		FROM webhook_attempts
+		ORDER BY attempted_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing webhook attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []Attempt
+	for rows.Next() {
+		var a Attempt
+		var status sql.NullInt64
+		var errText sql.NullString
+		if err := rows.Scan(&a.DeliveryID, &a.EndpointID, &a.Event, &a.Attempt, &status, &errText, &a.DurationMs, &a.At); err != nil {
+			return nil, err
+		}
+		a.StatusCode = int(status.Int64)
+		a.Error = errText.String
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+func (s *PGStore) AddDeadLetter(d DeadLetter) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO webhook_dead_letters (delivery_id, endpoint_id, event, payload, attempts, last_error, failed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (delivery_id) DO NOTHING
+	`, d.DeliveryID, d.EndpointID, d.Event, string(d.Payload), d.Attempts, d.LastError, d.At)
+	if err != nil {
+		return fmt.Errorf("recording webhook dead letter: %w", err)
+	}
+	return nil
+}
+
+func (s *PGStore) DeadLetters(limit int) ([]DeadLetter, error) {
+	rows, err := s.DB.Query(`
+		SELECT delivery_id, endpoint_id, event, payload, attempts, last_error, failed_at
+		FROM webhook_dead_letters
+		ORDER BY failed_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing webhook dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []DeadLetter
+	for rows.Next() {
+		var d DeadLetter
+		if err := rows.Scan(&d.DeliveryID, &d.EndpointID, &d.Event, &d.Payload, &d.Attempts, &d.LastError, &d.At); err != nil {
+			return nil, err
+		}
+		letters = append(letters, d)
+	}
+	return letters, rows.Err()
+}
+
+func nullInt(v int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(v), Valid: v != 0}
+}
+
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
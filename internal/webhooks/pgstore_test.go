@@ -0,0 +1,121 @@
+package webhooks
+
+import (
+	"clicktrainer/internal/db"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func getTestStore(t *testing.T) *PGStore {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping database tests")
+	}
+	database, err := db.Connect(dsn)
+	if err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate() error: %v", err)
+	}
+	t.Cleanup(func() {
+		// Clean up test data; errors here are intentionally ignored.
+		_, _ = database.Exec("DELETE FROM webhook_dead_letters")
+		_, _ = database.Exec("DELETE FROM webhook_attempts")
+		_, _ = database.Exec("DELETE FROM webhook_endpoints")
+		database.Close()
+	})
+	return NewPGStore(database)
+}
+
+func TestPGStore_Endpoints(t *testing.T) {
+	store := getTestStore(t)
+
+	ep, err := store.AddEndpoint(Endpoint{URL: "http://example.test/hook", Secret: "s", Events: []string{EventRoundEnded, EventBadgeAwarded}})
+	if err != nil {
+		t.Fatalf("AddEndpoint() error: %v", err)
+	}
+	if ep.ID == "" || ep.CreatedAt.IsZero() {
+		t.Errorf("AddEndpoint() = %+v, want ID and CreatedAt set", ep)
+	}
+
+	endpoints, err := store.Endpoints()
+	if err != nil {
+		t.Fatalf("Endpoints() error: %v", err)
+	}
+	if len(endpoints) != 1 || !endpoints[0].Wants(EventBadgeAwarded) {
+		t.Errorf("Endpoints() = %+v", endpoints)
+	}
+
+	if err := store.DeleteEndpoint(ep.ID); err != nil {
+		t.Fatalf("DeleteEndpoint() error: %v", err)
+	}
+	if err := store.DeleteEndpoint(ep.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second DeleteEndpoint() = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPGStore_AddEndpointKeepsID(t *testing.T) {
+	store := getTestStore(t)
+
+	ep := Endpoint{ID: uuid.New().String(), URL: "http://example.test/one", Secret: "s", Events: []string{EventRoundEnded}}
+	if _, err := store.AddEndpoint(ep); err != nil {
+		t.Fatalf("AddEndpoint() error: %v", err)
+	}
+	ep.URL = "http://example.test/two"
+	got, err := store.AddEndpoint(ep)
+	if err != nil {
+		t.Fatalf("second AddEndpoint() error: %v", err)
+	}
+	if got.ID != ep.ID {
+		t.Errorf("AddEndpoint() ID = %s, want %s", got.ID, ep.ID)
+	}
+
+	endpoints, err := store.Endpoints()
+	if err != nil {
+		t.Fatalf("Endpoints() error: %v", err)
+	}
+	if len(endpoints) != 1 || endpoints[0].URL != ep.URL {
+		t.Errorf("Endpoints() = %+v, want the one endpoint, updated", endpoints)
+	}
+}
+
+func TestPGStore_DeliveryLog(t *testing.T) {
+	store := getTestStore(t)
+	now := time.Now()
+	endpointID := uuid.New().String()
+
+	for i, status := range []int{0, 200} {
+		a := Attempt{DeliveryID: uuid.New().String(), EndpointID: endpointID, Event: EventRoundEnded, Attempt: i + 1, StatusCode: status, At: now.Add(time.Duration(i) * time.Second)}
+		if status == 0 {
+			a.Error = "connection refused"
+		}
+		if err := store.LogAttempt(a); err != nil {
+			t.Fatalf("LogAttempt() error: %v", err)
+		}
+	}
+	attempts, err := store.Attempts(10)
+	if err != nil {
+		t.Fatalf("Attempts() error: %v", err)
+	}
+	if len(attempts) != 2 || attempts[0].Attempt != 2 || attempts[1].Error != "connection refused" {
+		t.Errorf("Attempts() = %+v", attempts)
+	}
+
+	dl := DeadLetter{DeliveryID: uuid.New().String(), EndpointID: endpointID, Event: EventRoundEnded, Payload: []byte(`{"a":1}`), Attempts: 5, LastError: "HTTP 500", At: now}
+	if err := store.AddDeadLetter(dl); err != nil {
+		t.Fatalf("AddDeadLetter() error: %v", err)
+	}
+	dead, err := store.DeadLetters(10)
+	if err != nil {
+		t.Fatalf("DeadLetters() error: %v", err)
+	}
+	if len(dead) != 1 || dead[0].LastError != "HTTP 500" {
+		t.Errorf("DeadLetters() = %+v", dead)
+	}
+}
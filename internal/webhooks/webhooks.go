@@ -0,0 +1,169 @@
+// Package webhooks delivers game lifecycle events to HTTP endpoints
+// registered by an admin. Payloads are JSON, signed with the endpoint's
+// secret, and retried with exponential backoff; deliveries that never
+// succeed are kept as dead letters.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Events an endpoint can subscribe to.
+const (
+	EventRoundEnded         = "round_ended"
+	EventBadgeAwarded       = "badge_awarded"
+	EventPersonalBest       = "personal_best"
+	EventLeaderboardChanged = "leaderboard_changed"
+)
+
+// AllEvents lists every event an endpoint can subscribe to.
+var AllEvents = []string{EventRoundEnded, EventBadgeAwarded, EventPersonalBest, EventLeaderboardChanged}
+
+// Request headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Clicktrainer-Event"
+	HeaderDelivery  = "X-Clicktrainer-Delivery"
+	HeaderTimestamp = "X-Clicktrainer-Timestamp"
+	HeaderSignature = "X-Clicktrainer-Signature"
+)
+
+var ErrNotFound = errors.New("webhook endpoint not found")
+
+// Endpoint is a registered receiver.
+type Endpoint struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants reports whether the endpoint subscribed to event.
+func (e Endpoint) Wants(event string) bool {
+	return slices.Contains(e.Events, event)
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	ID        string    `json:"id"` // delivery ID, stable across retries
+	Event     string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	RoomCode  string    `json:"room_code,omitempty"`
+	Data      any       `json:"data"`
+}
+
+// RoundEnded is the data of a round_ended payload.
+type RoundEnded struct {
+	GameID  string     `json:"game_id,omitempty"`
+	Results []Standing `json:"results"` // best first
+}
+
+// BadgeAwarded is the data of a badge_awarded payload.
+type BadgeAwarded struct {
+	PlayerID   string `json:"player_id"`
+	PlayerName string `json:"player_name,omitempty"`
+	BadgeID    string `json:"badge_id"`
+	BadgeName  string `json:"badge_name,omitempty"`
+	GameID     string `json:"game_id,omitempty"` // empty for lifetime badges
+}
+
+// PersonalBest is the data of a personal_best payload.
+type PersonalBest struct {
+	PlayerID   string `json:"player_id"`
+	PlayerName string `json:"player_name"`
+	Score      int    `json:"score"`
+	Previous   int    `json:"previous"`
+	GameID     string `json:"game_id"`
+}
+
+// LeaderboardChanged is the data of a leaderboard_changed payload.
+type LeaderboardChanged struct {
+	Category string     `json:"category"`
+	Top      []Standing `json:"top"` // best first
+}
+
+// Standing is one player's place in a round or on a leaderboard.
+type Standing struct {
+	Rank       int    `json:"rank"`
+	PlayerID   string `json:"player_id"`
+	PlayerName string `json:"player_name"`
+	Value      int    `json:"value"`
+}
+
+// Attempt is one entry in the delivery log.
+type Attempt struct {
+	DeliveryID string    `json:"delivery_id"`
+	EndpointID string    `json:"endpoint_id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int       `json:"duration_ms"`
+	At         time.Time `json:"at"`
+}
+
+// DeadLetter is a delivery that failed every attempt.
+type DeadLetter struct {
+	DeliveryID string          `json:"delivery_id"`
+	EndpointID string          `json:"endpoint_id"`
+	Event      string          `json:"event"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempts   int             `json:"attempts"`
+	LastError  string          `json:"last_error"`
+	At         time.Time       `json:"at"`
+}
+
+// Store persists endpoints, the delivery log and dead letters.
+type Store interface {
+	Endpoints() ([]Endpoint, error)
+	AddEndpoint(e Endpoint) (Endpoint, error) // replaces the endpoint with e.ID, if set and present
+	DeleteEndpoint(id string) error
+	LogAttempt(a Attempt) error
+	Attempts(limit int) ([]Attempt, error)
+	AddDeadLetter(d DeadLetter) error
+	DeadLetters(limit int) ([]DeadLetter, error)
+}
+
+// ValidEvent reports whether event is one endpoints can subscribe to.
+func ValidEvent(event string) bool {
+	return slices.Contains(AllEvents, event)
+}
+
+// NewSecret returns a random signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for a body sent at ts: an
+// HMAC-SHA256 over "<unix seconds>.<body>", hex encoded.
+func Sign(secret string, ts time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header produced by Sign. Receivers should also
+// reject timestamps too far from their own clock to prevent replays.
+func Verify(secret, timestamp, signature string, body []byte) bool {
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	want := Sign(secret, time.Unix(secs, 0), body)
+	return hmac.Equal([]byte(want), []byte(signature))
+}
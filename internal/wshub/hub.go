@@ -27,6 +27,10 @@ type ServerMessage struct {
 	X        int    `json:"x,omitempty"`
 	Y        int    `json:"y,omitempty"`
 	Points   int    `json:"p,omitempty"`
+
+	// Batch carries the messages of a "tick" frame. Clients skip entries
+	// about themselves.
+	Batch []ServerMessage `json:"b,omitempty"`
 }
 
 // Client represents a single WebSocket connection in the hub.
@@ -59,6 +63,7 @@ func (c *Client) WritePump(ctx context.Context) {
 type Hub struct {
 	mu      sync.RWMutex
 	clients map[string]*Client
+	relay   func(exceptID string, data []byte)
 }
 
 // NewHub creates a new Hub.
@@ -68,6 +73,14 @@ func NewHub() *Hub {
 	}
 }
 
+// SetRelay sets a function called with every broadcast, e.g. to pass it on
+// to other instances. It must not block.
+func (h *Hub) SetRelay(fn func(exceptID string, data []byte)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.relay = fn
+}
+
 // Register adds a client to the hub.
 func (h *Hub) Register(c *Client) {
 	h.mu.Lock()
@@ -93,6 +106,48 @@ func (h *Hub) Unregister(playerID string) {
 	}
 }
 
+// Kick closes a player's connection with the given reason. The read loop in
+// the connection handler then unregisters the client as usual.
+func (h *Hub) Kick(playerID, reason string) {
+	h.mu.RLock()
+	c, ok := h.clients[playerID]
+	h.mu.RUnlock()
+	if !ok || c.Conn == nil {
+		return
+	}
+	if err := c.Conn.Close(websocket.StatusPolicyViolation, reason); err != nil {
+		slog.Debug("close on kick failed", "component", "wshub", "player_id", playerID, "error", err)
+	}
+}
+
+// CloseAll closes every connection with the given reason, e.g. when the
+// room is torn down. Each connection's handler then unregisters it. The
+// close handshakes finish in the background.
+func (h *Hub) CloseAll(reason string) {
+	h.mu.RLock()
+	conns := make([]*websocket.Conn, 0, len(h.clients))
+	for _, c := range h.clients {
+		if c.Conn != nil {
+			conns = append(conns, c.Conn)
+		}
+	}
+	h.mu.RUnlock()
+
+	// Each close waits for the peer's reply; don't hold up the caller.
+	for _, conn := range conns {
+		go func() {
+			if err := conn.Close(websocket.StatusGoingAway, reason); err != nil {
+				slog.Debug("close on shutdown failed", "component", "wshub", "error", err)
+			}
+		}()
+	}
+}
+
+// Broadcast sends a message to every client. Non-blocking: drops if channel full.
+func (h *Hub) Broadcast(msg ServerMessage) {
+	h.BroadcastExcept("", msg)
+}
+
 // BroadcastExcept sends a message to all clients except the sender. Non-blocking: drops if channel full.
 func (h *Hub) BroadcastExcept(senderID string, msg ServerMessage) {
 	data, err := json.Marshal(msg)
@@ -100,7 +155,18 @@ func (h *Hub) BroadcastExcept(senderID string, msg ServerMessage) {
 		slog.Error("marshal error", "component", "wshub", "error", err)
 		return
 	}
+	h.mu.RLock()
+	relay := h.relay
+	h.mu.RUnlock()
+	if relay != nil {
+		relay(senderID, data)
+	}
+	h.Deliver(senderID, data)
+}
 
+// Deliver sends an encoded message to every client except the sender, e.g.
+// one relayed from another instance. Non-blocking: drops if channel full.
+func (h *Hub) Deliver(senderID string, data []byte) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
@@ -113,3 +113,59 @@ func TestBroadcastDropsWhenFull(t *testing.T) {
 		// expected
 	}
 }
+
+func TestBroadcastBatch(t *testing.T) {
+	h := NewHub()
+	c1 := &Client{PlayerID: "p1", Send: make(chan []byte, 16)}
+	c2 := &Client{PlayerID: "p2", Send: make(chan []byte, 16)}
+	h.Register(c1)
+	h.Register(c2)
+
+	h.Broadcast(ServerMessage{Type: "tick", Batch: []ServerMessage{
+		{Type: "move", PlayerID: "p1", X: 1, Y: 2},
+		{Type: "kill", PlayerID: "p2", Points: 3},
+	}})
+
+	for _, c := range []*Client{c1, c2} {
+		select {
+		case data := <-c.Send:
+			var got ServerMessage
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if got.Type != "tick" || len(got.Batch) != 2 || got.Batch[1].Points != 3 {
+				t.Fatalf("%s got %+v, want the whole batch", c.PlayerID, got)
+			}
+		case <-time.After(100 * time.Millisecond):
+			t.Fatalf("%s did not receive the batch", c.PlayerID)
+		}
+	}
+}
+
+func TestRelayAndDeliver(t *testing.T) {
+	owner := NewHub()
+	mirror := NewHub()
+	owner.SetRelay(mirror.Deliver)
+
+	c1 := &Client{PlayerID: "p1", Send: make(chan []byte, 16)}
+	c2 := &Client{PlayerID: "p2", Send: make(chan []byte, 16)}
+	mirror.Register(c1)
+	mirror.Register(c2)
+
+	owner.BroadcastExcept("p1", ServerMessage{Type: "move", PlayerID: "p1", X: 5})
+
+	select {
+	case data := <-c2.Send:
+		var got ServerMessage
+		if err := json.Unmarshal(data, &got); err != nil || got.X != 5 {
+			t.Fatalf("relayed message = %s, %v", data, err)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("the relayed message didn't reach the other hub's client")
+	}
+	select {
+	case <-c1.Send:
+		t.Fatal("the sender shouldn't get its own message on another hub either")
+	default:
+	}
+}